@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/thesavant42/yolosint/internal/explore"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/logs"
+)
+
+type repeated []string
+
+func (r *repeated) String() string     { return strings.Join(*r, ",") }
+func (r *repeated) Set(v string) error { *r = append(*r, v); return nil }
+
+// oci index [flags] [ref...]
+//
+// Indexes images into /cache and /cache/log.db without serving anything.
+// Layers already in the cache are skipped, so an interrupted run can be resumed
+// by running the same command again.
+func indexMain(args []string) int {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	auth := fs.Bool("auth", false, "use docker credentials")
+	verbose := fs.Bool("v", false, "verbose logs")
+	file := fs.String("f", "", "file of image references, one per line (- for stdin)")
+	jobs := fs.Int("j", 4, "layers to index concurrently")
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	var repos repeated
+	fs.Var(&repos, "repo", "index every tag in this repository (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: oci index [flags] [ref...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *verbose {
+		logs.Debug.SetOutput(os.Stderr)
+		logs.Debug.SetFlags(log.Lshortfile | log.Ldate | log.Ltime | log.Lmicroseconds)
+	}
+	log.SetFlags(log.Lshortfile | log.Ldate | log.Ltime | log.Lmicroseconds)
+
+	opt, err := options(os.Getenv("USERAGENT"), *auth)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	refs := fs.Args()
+	if *file != "" {
+		more, err := readRefs(*file)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		refs = append(refs, more...)
+	}
+
+	b := explore.NewBatch(*jobs, opt...)
+	defer b.Close()
+
+	for _, repo := range repos {
+		tags, err := b.Tags(ctx, repo)
+		if err != nil {
+			log.Printf("listing %s: %v", repo, err)
+			return 1
+		}
+		log.Printf("%s: %d tags", repo, len(tags))
+		refs = append(refs, tags...)
+	}
+
+	if len(refs) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	report := b.Index(ctx, refs)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Print(err)
+			return 1
+		}
+	} else {
+		fmt.Printf("images:    %d\n", report.Images)
+		fmt.Printf("manifests: %d\n", report.Manifests)
+		fmt.Printf("layers:    %d (%d indexed, %d already cached, %d not tarballs)\n", report.Layers, report.Indexed, report.Cached, report.Skipped)
+		fmt.Printf("files:     %d\n", report.Files)
+		fmt.Printf("failed:    %d\n", len(report.Failed))
+		for _, f := range report.Failed {
+			fmt.Printf("  %s: %s\n", f.Ref, f.Error)
+		}
+	}
+
+	if len(report.Failed) != 0 {
+		return 1
+	}
+	return 0
+}
+
+// readRefs reads references from a file, skipping blank lines and # comments.
+func readRefs(file string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	refs := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	return refs, scanner.Err()
+}
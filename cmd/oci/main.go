@@ -8,11 +8,14 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/authn"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/gcrane"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/logs"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/internal/cosign"
+	"github.com/thesavant42/yolosint/internal/credstore"
 	"github.com/thesavant42/yolosint/internal/explore"
 
 	sha256simd "github.com/minio/sha256-simd"
@@ -26,6 +29,13 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "index" {
+		os.Exit(indexMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "osv" {
+		os.Exit(osvMain(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	logs.Trace.SetOutput(os.Stderr)
@@ -49,20 +59,72 @@ func main() {
 	}
 	log.Printf("listening on %s", port)
 
+	opt, err := options(userAgent, *auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if wi := os.Getenv("WATCH_INTERVAL"); wi != "" {
+		d, err := time.ParseDuration(wi)
+		if err != nil {
+			log.Fatalf("WATCH_INTERVAL: %v", err)
+		}
+		opt = append(opt, explore.WithWatchInterval(d))
+	}
+	if path := os.Getenv("COSIGN_TRUSTED_ROOT"); path != "" {
+		tr, err := cosign.LoadTrustedRoot(path)
+		if err != nil {
+			log.Fatalf("COSIGN_TRUSTED_ROOT: %v", err)
+		}
+		opt = append(opt, explore.WithTrustedRoot(tr))
+	}
+	if api := os.Getenv("DOCKERHUB_API"); api != "" {
+		opt = append(opt, explore.WithHubAPI(api))
+	}
+
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), explore.New(opt...)))
+}
+
+// options are shared by the server and the index subcommand.
+func options(userAgent string, auth bool) ([]explore.Option, error) {
 	opt := []explore.Option{explore.WithUserAgent(userAgent)}
+
+	// Token exchanges go out through the default profile, like everything
+	// else that isn't for a particular request.
+	var profile http.RoundTripper
+	if path := os.Getenv("OPSEC_PROFILES"); path != "" {
+		ps, err := explore.LoadProfiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("OPSEC_PROFILES: %w", err)
+		}
+		opt = append(opt, explore.WithProfiles(ps))
+		if profile, err = ps.Get(""); err != nil {
+			return nil, fmt.Errorf("OPSEC_PROFILES: %w", err)
+		}
+	}
+
 	kcs := []authn.Keychain{}
+	if path := os.Getenv("CREDENTIALS_FILE"); path != "" {
+		store, err := openCredentials(path)
+		if err != nil {
+			return nil, fmt.Errorf("CREDENTIALS_FILE: %w", err)
+		}
+		// Stored credentials are the most specific, so they go first.
+		kcs = append(kcs, store)
+		opt = append(opt, explore.WithCredentialStore(store, os.Getenv("ADMIN_TOKEN")))
+	}
 	if cgid := os.Getenv("CHAINGUARD_IDENTITY"); cgid != "" {
-		cgauth := explore.NewChainguardIdentityAuth(cgid, "https://issuer.enforce.dev", "cgr.dev")
+		cgauth := explore.NewChainguardIdentityAuth(cgid, "https://issuer.enforce.dev", "cgr.dev", profile)
 		kcs = append(kcs, cgauth)
 	}
-	if *auth || os.Getenv("AUTH") == "keychain" {
+	if auth || os.Getenv("AUTH") == "keychain" {
 		kcs = append(kcs, gcrane.Keychain)
 	}
 
 	if dh := os.Getenv("DOCKERHUB_AUTH"); dh != "" {
 		kc, err := newHubKeychain(dh)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		kcs = append(kcs, kc)
 	}
@@ -71,7 +133,25 @@ func main() {
 		opt = append(opt, explore.WithKeychain(authn.NewMultiKeychain(kcs...)))
 	}
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), explore.New(opt...)))
+	return opt, nil
+}
+
+// openCredentials opens the credential store at path with
+// CREDENTIALS_KEY_FILE or, failing that, CREDENTIALS_PASSPHRASE.
+func openCredentials(path string) (*credstore.Store, error) {
+	var secret []byte
+	if kf := os.Getenv("CREDENTIALS_KEY_FILE"); kf != "" {
+		b, err := credstore.ReadKeyFile(kf)
+		if err != nil {
+			return nil, err
+		}
+		secret = b
+	} else if pass := os.Getenv("CREDENTIALS_PASSPHRASE"); pass != "" {
+		secret = []byte(pass)
+	} else {
+		return nil, fmt.Errorf("set CREDENTIALS_KEY_FILE or CREDENTIALS_PASSPHRASE")
+	}
+	return credstore.Open(path, secret)
 }
 
 func newHubKeychain(env string) (*keychain, error) {
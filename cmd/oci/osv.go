@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/thesavant42/yolosint/internal/explore"
+)
+
+// oci osv [flags] dump...
+//
+// Imports OSV vulnerability records into the explorer's database so that
+// /vulns/ can match image packages against them with no network access.
+// A dump is a JSON file, a zip of them (e.g. an ecosystem's all.zip from
+// the OSV bucket) or a directory of either. Importing a newer dump of the
+// same records replaces them, an older one doesn't.
+func osvMain(args []string) int {
+	fs := flag.NewFlagSet("osv", flag.ExitOnError)
+	db := fs.String("db", "/cache/log.db", "database to import into")
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: oci osv [flags] dump...\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	log.SetFlags(log.Lshortfile | log.Ldate | log.Ltime | log.Lmicroseconds)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	tdb := explore.NewTocDB(*db)
+	defer tdb.Close()
+
+	stats, err := tdb.ImportOSV(ctx, fs.Args())
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			log.Print(err)
+			return 1
+		}
+	} else {
+		fmt.Printf("vulns:     %d\n", stats.Vulns)
+		fmt.Printf("packages:  %d\n", stats.Affected)
+		fmt.Printf("withdrawn: %d\n", stats.Withdrawn)
+		fmt.Printf("stale:     %d\n", stats.Stale)
+	}
+	return 0
+}
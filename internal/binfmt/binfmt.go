@@ -0,0 +1,148 @@
+// Package binfmt prints what's in the headers of Windows (PE) and macOS
+// (Mach-O) executables, a bit like objdump -x, for files that the ELF
+// renderer can't handle.
+//
+// Output is plain text; callers escape it for HTML.
+package binfmt
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Sniff returns "pe" or "macho" if the start of a file looks like one,
+// otherwise "".
+func Sniff(b []byte) string {
+	if len(b) >= 0x40 && b[0] == 'M' && b[1] == 'Z' {
+		off := binary.LittleEndian.Uint32(b[0x3c:])
+		if int64(off)+4 <= int64(len(b)) && bytes.Equal(b[off:off+4], []byte("PE\x00\x00")) {
+			return "pe"
+		}
+		return ""
+	}
+	if len(b) < 8 {
+		return ""
+	}
+	switch binary.BigEndian.Uint32(b) {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe:
+		return "macho"
+	case 0xcafebabe:
+		// Java class files share the magic; their version number is never
+		// this small, which is how file(1) tells them apart too.
+		if n := binary.BigEndian.Uint32(b[4:]); n > 0 && n < 20 {
+			return "macho"
+		}
+	}
+	return ""
+}
+
+// Don't read anything silly out of a header we can't trust.
+const maxTable = 16 << 20
+
+func readAt(r io.ReaderAt, off int64, n uint32) ([]byte, error) {
+	if n > maxTable {
+		return nil, fmt.Errorf("%d bytes at %#x is too big", n, off)
+	}
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// utf16z decodes a NUL terminated little endian UTF-16 string starting at
+// off, returning it and the offset just past the terminator.
+func utf16z(b []byte, off int) (string, int) {
+	var u []uint16
+	for ; off+1 < len(b); off += 2 {
+		c := binary.LittleEndian.Uint16(b[off:])
+		if c == 0 {
+			return string(utf16.Decode(u)), off + 2
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u)), len(b)
+}
+
+func flagNames(v uint32, names []flagName) string {
+	var s []string
+	for _, n := range names {
+		if v&n.bit != 0 {
+			s = append(s, n.name)
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+type flagName struct {
+	bit  uint32
+	name string
+}
+
+// certificates pulls the X.509 certificates out of a PKCS #7 SignedData
+// blob. Nothing is verified; it's just who the signature claims to be from.
+func certificates(der []byte) ([]*x509.Certificate, error) {
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("parsing ContentInfo: %w", err)
+	}
+	var sd asn1.RawValue
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("parsing SignedData: %w", err)
+	}
+
+	// version, digestAlgorithms, contentInfo, [0] certificates, [1] crls, signerInfos
+	var certs []*x509.Certificate
+	for rest := sd.Bytes; len(rest) > 0; {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return certs, err
+		}
+		if field.Class != asn1.ClassContextSpecific || field.Tag != 0 {
+			continue
+		}
+		for raw := field.Bytes; len(raw) > 0; {
+			var cert asn1.RawValue
+			if raw, err = asn1.Unmarshal(raw, &cert); err != nil {
+				return certs, err
+			}
+			c, err := x509.ParseCertificate(cert.FullBytes)
+			if err != nil {
+				// Probably an attribute certificate or something else odd.
+				continue
+			}
+			certs = append(certs, c)
+		}
+	}
+	return certs, nil
+}
+
+func printCertificates(w io.Writer, indent string, der []byte) {
+	certs, err := certificates(der)
+	if err != nil {
+		fmt.Fprintf(w, "%s(%v)\n", indent, err)
+	}
+	for _, c := range certs {
+		fmt.Fprintf(w, "%ssubject   %s\n", indent, c.Subject)
+		fmt.Fprintf(w, "%sissuer    %s\n", indent, c.Issuer)
+		fmt.Fprintf(w, "%sserial    %x\n", indent, c.SerialNumber)
+		fmt.Fprintf(w, "%svalid     %s to %s\n\n", indent, c.NotBefore.UTC().Format("2006-01-02"), c.NotAfter.UTC().Format("2006-01-02"))
+	}
+}
@@ -0,0 +1,370 @@
+package binfmt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestSniff(t *testing.T) {
+	pe := make([]byte, 0x100)
+	copy(pe, "MZ")
+	binary.LittleEndian.PutUint32(pe[0x3c:], 0x80)
+	copy(pe[0x80:], "PE\x00\x00")
+
+	dos := bytes.Clone(pe)
+	copy(dos[0x80:], "NE")
+
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"pe", pe, "pe"},
+		{"dos", dos, ""},
+		{"macho64", []byte("\xcf\xfa\xed\xfe\x0c\x00\x00\x01"), "macho"},
+		{"macho32be", []byte("\xfe\xed\xfa\xce\x00\x00\x00\x12"), "macho"},
+		{"fat", []byte("\xca\xfe\xba\xbe\x00\x00\x00\x02"), "macho"},
+		{"java", []byte("\xca\xfe\xba\xbe\x00\x00\x00\x34"), ""},
+		{"elf", []byte("\x7fELF\x02\x01\x01\x00"), ""},
+		{"short", []byte("MZ"), ""},
+	} {
+		if got := Sniff(tc.in); got != tc.want {
+			t.Errorf("Sniff(%s) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// buildVerBlock lays out one node of a VS_VERSIONINFO resource.
+func buildVerBlock(key string, value []byte, text bool, children ...[]byte) []byte {
+	var b bytes.Buffer
+	b.Write(make([]byte, 6))
+	for _, c := range utf16.Encode([]rune(key + "\x00")) {
+		binary.Write(&b, binary.LittleEndian, c)
+	}
+	pad := func() { b.Write(make([]byte, align4(b.Len())-b.Len())) }
+	pad()
+	b.Write(value)
+	for _, c := range children {
+		pad()
+		b.Write(c)
+	}
+	out := b.Bytes()
+	vlen := len(value)
+	if text {
+		vlen /= 2
+	}
+	binary.LittleEndian.PutUint16(out, uint16(len(out)))
+	binary.LittleEndian.PutUint16(out[2:], uint16(vlen))
+	if text {
+		binary.LittleEndian.PutUint16(out[4:], 1)
+	}
+	return out
+}
+
+func utf16le(s string) []byte {
+	var b bytes.Buffer
+	for _, c := range utf16.Encode([]rune(s + "\x00")) {
+		binary.Write(&b, binary.LittleEndian, c)
+	}
+	return b.Bytes()
+}
+
+func TestVersionInfo(t *testing.T) {
+	fixed := make([]byte, 52)
+	binary.LittleEndian.PutUint32(fixed, 0xfeef04bd)
+	binary.LittleEndian.PutUint32(fixed[8:], 1<<16|2)
+	binary.LittleEndian.PutUint32(fixed[12:], 3<<16|4)
+	binary.LittleEndian.PutUint32(fixed[16:], 5<<16)
+
+	data := buildVerBlock("VS_VERSION_INFO", fixed, false,
+		buildVerBlock("StringFileInfo", nil, true,
+			buildVerBlock("040904b0", nil, true,
+				buildVerBlock("CompanyName", utf16le("Example Corp"), true),
+				buildVerBlock("OriginalFilename", utf16le("agent.exe"), true),
+			),
+		),
+		buildVerBlock("VarFileInfo", nil, true,
+			buildVerBlock("Translation", []byte{0x09, 0x04, 0xb0, 0x04}, false),
+		),
+	)
+
+	vi, err := parseVersionInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vi.FileVersion != "1.2.3.4" || vi.ProductVersion != "5.0.0.0" {
+		t.Errorf("versions = %q, %q", vi.FileVersion, vi.ProductVersion)
+	}
+	want := [][2]string{{"CompanyName", "Example Corp"}, {"OriginalFilename", "agent.exe"}}
+	if len(vi.Strings) != len(want) || vi.Strings[0] != want[0] || vi.Strings[1] != want[1] {
+		t.Errorf("strings = %q", vi.Strings)
+	}
+
+	if _, err := parseVersionInfo(data[:20]); err == nil {
+		t.Errorf("no error for a truncated resource")
+	}
+}
+
+// signedData wraps a certificate in just enough PKCS #7 to look signed.
+func signedData(t *testing.T, cert []byte) []byte {
+	t.Helper()
+	certs, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, _ := asn1.Marshal(1)
+	empty, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true})
+	content, _ := asn1.Marshal(struct{ Type asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}})
+	sd, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: bytes.Join([][]byte{version, empty, content, certs, empty}, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd})
+	oid, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2})
+	ci, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: append(oid, explicit...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ci
+}
+
+func selfSigned(t *testing.T, cn string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCertificates(t *testing.T) {
+	certs, err := certificates(signedData(t, selfSigned(t, "Example Signing CA")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || certs[0].Subject.CommonName != "Example Signing CA" {
+		t.Errorf("certificates = %v", certs)
+	}
+}
+
+func TestCodeSignature(t *testing.T) {
+	be := binary.BigEndian
+	blob := func(magic uint32, body []byte) []byte {
+		b := be.AppendUint32(nil, magic)
+		b = be.AppendUint32(b, uint32(8+len(body)))
+		return append(b, body...)
+	}
+
+	// Offsets in the body are 8 less than in cs_blobs.h, blob() adds the header.
+	cd := make([]byte, 52)
+	be.PutUint32(cd[0:], 0x20400)  // version
+	be.PutUint32(cd[4:], 0x10000)  // flags: runtime
+	be.PutUint32(cd[12:], 8+52)    // identOffset, from the start of the blob
+	be.PutUint32(cd[20:], 3)       // nCodeSlots
+	cd[29] = 2                     // hashType
+	be.PutUint32(cd[40:], 8+52+16) // teamOffset
+	cd = append(cd, "com.example.app\x00ABCDE12345\x00"...)
+
+	ents := `<?xml version="1.0"?><plist><dict><key>com.apple.security.get-task-allow</key><true/></dict></plist>`
+	blobs := [][]byte{
+		blob(csMagicCodeDirectory, cd),
+		blob(csMagicEmbeddedEntitlements, []byte(ents)),
+		blob(csMagicBlobWrapper, signedData(t, selfSigned(t, "Developer ID Application: Example"))),
+	}
+
+	sig := be.AppendUint32(nil, csMagicEmbeddedSignature)
+	sig = be.AppendUint32(sig, 0) // length, unused
+	sig = be.AppendUint32(sig, uint32(len(blobs)))
+	off := 12 + 8*len(blobs)
+	for i, b := range blobs {
+		sig = be.AppendUint32(sig, uint32(i))
+		sig = be.AppendUint32(sig, uint32(off))
+		off += len(b)
+	}
+	sig = append(sig, bytes.Join(blobs, nil)...)
+
+	var out strings.Builder
+	printCodeSignature(&out, sig)
+	for _, want := range []string{
+		"identifier: com.example.app",
+		"team id: ABCDE12345",
+		"flags: runtime",
+		"3 pages hashed with sha256",
+		"get-task-allow",
+		"CN=Developer ID Application: Example",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	// Garbage offsets shouldn't take us out of bounds.
+	be.PutUint32(sig[16:], 1<<30)
+	printCodeSignature(&strings.Builder{}, sig)
+}
+
+func TestReadRVABounds(t *testing.T) {
+	f := &pe.File{Sections: []*pe.Section{{SectionHeader: pe.SectionHeader{VirtualAddress: 0x1000, VirtualSize: 0x100, Size: 0x100}}}}
+	for _, tc := range []struct {
+		rva uint32
+		n   uint64
+	}{
+		{0x1000, 4 * uint64(0x40000001)}, // 4*nfuncs that would wrap to 4 in uint32
+		{0x10f0, 0x20},                   // runs off the end of the section
+		{0x2000, 4},                      // in no section
+	} {
+		if _, err := readRVA(f, tc.rva, tc.n); err == nil {
+			t.Errorf("readRVA(%#x, %d) worked", tc.rva, tc.n)
+		}
+	}
+}
+
+func TestVersionResource(t *testing.T) {
+	le := binary.LittleEndian
+	const dir = 1 << 31
+	// rsrc lays out directories of [id, offset] entries at the given
+	// offsets, and a leaf pointing at rva 0x1000 at 0x200.
+	rsrc := func(dirs map[uint32][][2]uint32) []byte {
+		b := make([]byte, 0x210)
+		for off, es := range dirs {
+			if need := int(off) + 16 + 8*len(es); need > len(b) {
+				b = append(b, make([]byte, need-len(b))...)
+			}
+			le.PutUint16(b[off+14:], uint16(len(es)))
+			for i, e := range es {
+				le.PutUint32(b[int(off)+16+8*i:], e[0])
+				le.PutUint32(b[int(off)+20+8*i:], e[1])
+			}
+		}
+		le.PutUint32(b[0x200:], 0x1000)
+		le.PutUint32(b[0x204:], 8)
+		return b
+	}
+	f := &pe.File{Sections: []*pe.Section{{
+		SectionHeader: pe.SectionHeader{VirtualAddress: 0x1000, VirtualSize: 8, Size: 8},
+		ReaderAt:      strings.NewReader("VERSION!"),
+	}}}
+
+	loop := make([][2]uint32, 0xffff)
+	for i := range loop {
+		loop[i] = [2]uint32{rtVersion, dir | 0}
+	}
+	wide := [][2]uint32{}
+	dirs := map[uint32][][2]uint32{}
+	for i := range uint32(200) {
+		wide = append(wide, [2]uint32{rtVersion, dir | (0x1000 + 0x800*i)})
+		dirs[0x1000+0x800*i] = make([][2]uint32, 200)
+	}
+	dirs[0] = wide
+	last := dirs[0x1000+0x800*199]
+	last[len(last)-1] = [2]uint32{1, dir | 0x80}
+	dirs[0x80] = [][2]uint32{{0x409, 0x200}}
+
+	for _, tc := range []struct {
+		name string
+		dirs map[uint32][][2]uint32
+		want string
+	}{{
+		name: "ok",
+		dirs: map[uint32][][2]uint32{0: {{rtVersion, dir | 0x40}}, 0x40: {{1, dir | 0x80}}, 0x80: {{0x409, 0x200}}},
+		want: "VERSION!",
+	}, {
+		name: "past a loop",
+		dirs: map[uint32][][2]uint32{0: {{rtVersion, dir | 0}, {rtVersion, dir | 0x40}}, 0x40: {{1, dir | 0}, {1, dir | 0x80}}, 0x80: {{0x409, 0x200}}},
+		want: "VERSION!",
+	}, {
+		// Every entry is RT_VERSION, pointing back at the root.
+		name: "self loop",
+		dirs: map[uint32][][2]uint32{0: loop},
+	}, {
+		// Few entries each, but the version is past too many in all.
+		name: "wide",
+		dirs: dirs,
+	}} {
+		if got := versionResource(f, rsrc(tc.dirs)); string(got) != tc.want {
+			t.Errorf("%s: versionResource() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestPrint cross compiles a program for Windows and macOS, the easiest
+// way to get real binaries of each.
+func TestPrint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds binaries")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module hello\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() { println(\"hi\") }\n"), 0644)
+
+	build := func(goos, goarch string) *os.File {
+		out := filepath.Join(dir, goos)
+		cmd := exec.Command(gobin, "build", "-o", out, ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+		if b, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %v\n%s", goos, err, b)
+		}
+		f, err := os.Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	for _, tc := range []struct {
+		goos, goarch string
+		print        func(w *strings.Builder, f *os.File, size int64) error
+		want         []string
+	}{
+		{"windows", "amd64", func(w *strings.Builder, f *os.File, size int64) error { return PrintPE(w, f, size) },
+			[]string{"file format pe-x86-64", "subsystem: windows console", ".text", "kernel32.dll", "LoadLibraryExW"}},
+		{"darwin", "arm64", func(w *strings.Builder, f *os.File, size int64) error { return PrintMachO(w, f, size) },
+			[]string{"file format mach-o64-arm64", "LC_MAIN", "/usr/lib/libSystem.B.dylib", "flags: adhoc"}},
+	} {
+		f := build(tc.goos, tc.goarch)
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if err := tc.print(&out, f, fi.Size()); err != nil {
+			t.Fatalf("%s: %v", tc.goos, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s: missing %q in:\n%s", tc.goos, want, out.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package binfmt
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var machoCpus = map[macho.Cpu]string{
+	macho.Cpu386:   "i386",
+	macho.CpuAmd64: "x86-64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc:   "ppc",
+	macho.CpuPpc64: "ppc64",
+}
+
+func machoCpu(c macho.Cpu) string {
+	if s, ok := machoCpus[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("%#x", uint32(c))
+}
+
+var machoTypes = map[macho.Type]string{
+	macho.TypeObj:    "object",
+	macho.TypeExec:   "executable",
+	macho.TypeDylib:  "dylib",
+	macho.TypeBundle: "bundle",
+	0x7:              "dylinker",
+	0x9:              "dylib stub",
+	0xa:              "dsym",
+	0xb:              "kext bundle",
+}
+
+var machoFlags = []flagName{
+	{macho.FlagNoUndefs, "NOUNDEFS"},
+	{macho.FlagDyldLink, "DYLDLINK"},
+	{macho.FlagTwoLevel, "TWOLEVEL"},
+	{macho.FlagBindsToWeak, "BINDS_TO_WEAK"},
+	{macho.FlagAllowStackExecution, "ALLOW_STACK_EXECUTION"},
+	{macho.FlagPIE, "PIE"},
+	{macho.FlagHasTLVDescriptors, "HAS_TLV_DESCRIPTORS"},
+	{macho.FlagNoHeapExecution, "NO_HEAP_EXECUTION"},
+	{macho.FlagAppExtensionSafe, "APP_EXTENSION_SAFE"},
+}
+
+// Load commands, from <mach-o/loader.h>.
+const (
+	lcReqDyld           = 0x80000000
+	lcSegment           = 0x1
+	lcSymtab            = 0x2
+	lcDysymtab          = 0xb
+	lcLoadDylib         = 0xc
+	lcIDDylib           = 0xd
+	lcLoadDylinker      = 0xe
+	lcIDDylinker        = 0xf
+	lcSegment64         = 0x19
+	lcUUID              = 0x1b
+	lcCodeSignature     = 0x1d
+	lcLazyLoadDylib     = 0x20
+	lcEncryptionInfo    = 0x21
+	lcVersionMinMacOSX  = 0x24
+	lcVersionMinIPhone  = 0x25
+	lcSourceVersion     = 0x2a
+	lcEncryptionInfo64  = 0x2c
+	lcVersionMinTVOS    = 0x2f
+	lcVersionMinWatchOS = 0x30
+	lcBuildVersion      = 0x32
+	lcLoadWeakDylib     = 0x18 | lcReqDyld
+	lcRpath             = 0x1c | lcReqDyld
+	lcReexportDylib     = 0x1f | lcReqDyld
+	lcDyldInfoOnly      = 0x22 | lcReqDyld
+	lcLoadUpwardDylib   = 0x23 | lcReqDyld
+	lcMain              = 0x28 | lcReqDyld
+)
+
+var loadCommands = map[uint32]string{
+	lcSegment:           "LC_SEGMENT",
+	lcSymtab:            "LC_SYMTAB",
+	lcDysymtab:          "LC_DYSYMTAB",
+	lcLoadDylib:         "LC_LOAD_DYLIB",
+	lcIDDylib:           "LC_ID_DYLIB",
+	lcLoadDylinker:      "LC_LOAD_DYLINKER",
+	lcIDDylinker:        "LC_ID_DYLINKER",
+	lcSegment64:         "LC_SEGMENT_64",
+	lcUUID:              "LC_UUID",
+	lcCodeSignature:     "LC_CODE_SIGNATURE",
+	0x1e:                "LC_SEGMENT_SPLIT_INFO",
+	lcLazyLoadDylib:     "LC_LAZY_LOAD_DYLIB",
+	lcEncryptionInfo:    "LC_ENCRYPTION_INFO",
+	0x22:                "LC_DYLD_INFO",
+	lcVersionMinMacOSX:  "LC_VERSION_MIN_MACOSX",
+	lcVersionMinIPhone:  "LC_VERSION_MIN_IPHONEOS",
+	0x26:                "LC_FUNCTION_STARTS",
+	0x27:                "LC_DYLD_ENVIRONMENT",
+	0x29:                "LC_DATA_IN_CODE",
+	lcSourceVersion:     "LC_SOURCE_VERSION",
+	0x2b:                "LC_DYLIB_CODE_SIGN_DRS",
+	lcEncryptionInfo64:  "LC_ENCRYPTION_INFO_64",
+	0x2d:                "LC_LINKER_OPTION",
+	0x2e:                "LC_LINKER_OPTIMIZATION_HINT",
+	lcVersionMinTVOS:    "LC_VERSION_MIN_TVOS",
+	lcVersionMinWatchOS: "LC_VERSION_MIN_WATCHOS",
+	0x31:                "LC_NOTE",
+	lcBuildVersion:      "LC_BUILD_VERSION",
+	0x33 | lcReqDyld:    "LC_DYLD_EXPORTS_TRIE",
+	0x34 | lcReqDyld:    "LC_DYLD_CHAINED_FIXUPS",
+	0x35:                "LC_FILESET_ENTRY",
+	lcLoadWeakDylib:     "LC_LOAD_WEAK_DYLIB",
+	lcRpath:             "LC_RPATH",
+	lcReexportDylib:     "LC_REEXPORT_DYLIB",
+	lcDyldInfoOnly:      "LC_DYLD_INFO_ONLY",
+	lcLoadUpwardDylib:   "LC_LOAD_UPWARD_DYLIB",
+	lcMain:              "LC_MAIN",
+}
+
+var machoPlatforms = map[uint32]string{
+	1: "macos", 2: "ios", 3: "tvos", 4: "watchos", 5: "bridgeos", 6: "maccatalyst",
+	7: "ios simulator", 8: "tvos simulator", 9: "watchos simulator", 10: "driverkit",
+	11: "visionos", 12: "visionos simulator",
+}
+
+// xxxx.yy.zz packed into 32 bits.
+func machoVersion(v uint32) string {
+	return fmt.Sprintf("%d.%d.%d", v>>16, (v>>8)&0xff, v&0xff)
+}
+
+// PrintMachO writes the header, load commands, linked libraries and code
+// signature (including entitlements) of the Mach-O file in r. Universal
+// binaries get one of each per architecture.
+func PrintMachO(w io.Writer, r io.ReaderAt, size int64) error {
+	fat, err := macho.NewFatFile(r)
+	if err == nil {
+		defer fat.Close()
+		for i, arch := range fat.Arches {
+			if i != 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "architecture %s (offset %#x, %d bytes):\n", machoCpu(arch.Cpu), arch.Offset, arch.Size)
+			printMachO(w, arch.File, io.NewSectionReader(r, int64(arch.Offset), int64(arch.Size)))
+		}
+		return nil
+	} else if !errors.Is(err, macho.ErrNotFat) {
+		return err
+	}
+
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	printMachO(w, f, io.NewSectionReader(r, 0, size))
+	return nil
+}
+
+type machoLoad struct {
+	cmd uint32
+	raw []byte
+}
+
+func (l machoLoad) u32(bo binary.ByteOrder, off int) uint32 {
+	if off+4 > len(l.raw) {
+		return 0
+	}
+	return bo.Uint32(l.raw[off:])
+}
+
+// str is an lc_str: an offset from the start of the command.
+func (l machoLoad) str(bo binary.ByteOrder, off int) string {
+	at := int(l.u32(bo, off))
+	if at <= 0 || at >= len(l.raw) {
+		return ""
+	}
+	return cstring(l.raw[at:])
+}
+
+func printMachO(w io.Writer, f *macho.File, r *io.SectionReader) {
+	bo := f.ByteOrder
+	kind, ok := machoTypes[f.Type]
+	if !ok {
+		kind = fmt.Sprintf("%#x", uint32(f.Type))
+	}
+	bits := 32
+	if f.Magic == macho.Magic64 {
+		bits = 64
+	}
+	fmt.Fprintf(w, "file format mach-o%d-%s\n", bits, machoCpu(f.Cpu))
+	fmt.Fprintf(w, "type: %s\n", kind)
+	fmt.Fprintf(w, "flags: %s\n", flagNames(uint32(f.Flags), machoFlags))
+
+	var loads []machoLoad
+	for _, l := range f.Loads {
+		raw := l.Raw()
+		if len(raw) < 8 {
+			continue
+		}
+		loads = append(loads, machoLoad{bo.Uint32(raw), raw})
+	}
+
+	fmt.Fprintf(w, "\nLoad commands:\n")
+	for i, l := range loads {
+		name, ok := loadCommands[l.cmd]
+		if !ok {
+			name = fmt.Sprintf("%#x", l.cmd)
+		}
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("% 3d %-24s %s", i, name, loadDetail(bo, l)), " "))
+	}
+
+	fmt.Fprintf(w, "\nSections:\n")
+	fmt.Fprintf(w, "Idx %-16s %-16s Size             VMA\n", "Segment", "Name")
+	for i, s := range f.Sections {
+		fmt.Fprintf(w, "% 3d %-16s %-16s %016x %016x\n", i, s.Seg, s.Name, s.Size, s.Addr)
+	}
+
+	var dylibs []string
+	for _, l := range loads {
+		switch l.cmd {
+		case lcLoadDylib, lcLoadWeakDylib, lcReexportDylib, lcLazyLoadDylib, lcLoadUpwardDylib:
+			name := l.str(bo, 8)
+			if l.cmd != lcLoadDylib {
+				name += " (" + strings.ToLower(strings.TrimPrefix(loadCommands[l.cmd], "LC_")) + ")"
+			}
+			dylibs = append(dylibs, fmt.Sprintf("  %s (compatibility version %s, current version %s)", name, machoVersion(l.u32(bo, 20)), machoVersion(l.u32(bo, 16))))
+		}
+	}
+	if len(dylibs) != 0 {
+		fmt.Fprintf(w, "\nDynamic libraries:\n%s\n", strings.Join(dylibs, "\n"))
+	}
+
+	for _, l := range loads {
+		if l.cmd != lcCodeSignature {
+			continue
+		}
+		fmt.Fprintf(w, "\nCode signature (not verified):\n")
+		sig, err := readAt(r, int64(l.u32(bo, 8)), l.u32(bo, 12))
+		if err != nil {
+			fmt.Fprintf(w, "  (%v)\n", err)
+			continue
+		}
+		printCodeSignature(w, sig)
+	}
+}
+
+func loadDetail(bo binary.ByteOrder, l machoLoad) string {
+	switch l.cmd {
+	case lcSegment, lcSegment64:
+		seg := cstring(l.raw[8:min(24, len(l.raw))])
+		if l.cmd == lcSegment64 && len(l.raw) >= 64 {
+			return fmt.Sprintf("%-16s vmaddr 0x%016x vmsize 0x%x prot %s", seg, bo.Uint64(l.raw[24:]), bo.Uint64(l.raw[32:]), vmProt(l.u32(bo, 60)))
+		}
+		return fmt.Sprintf("%-16s vmaddr 0x%08x vmsize 0x%x prot %s", seg, l.u32(bo, 24), l.u32(bo, 28), vmProt(l.u32(bo, 44)))
+	case lcLoadDylib, lcIDDylib, lcLoadWeakDylib, lcReexportDylib, lcLazyLoadDylib, lcLoadUpwardDylib:
+		return l.str(bo, 8)
+	case lcLoadDylinker, lcIDDylinker, lcRpath:
+		return l.str(bo, 8)
+	case lcUUID:
+		if len(l.raw) >= 24 {
+			u := l.raw[8:24]
+			return fmt.Sprintf("%X-%X-%X-%X-%X", u[:4], u[4:6], u[6:8], u[8:10], u[10:])
+		}
+	case lcBuildVersion:
+		platform, ok := machoPlatforms[l.u32(bo, 8)]
+		if !ok {
+			platform = fmt.Sprint(l.u32(bo, 8))
+		}
+		return fmt.Sprintf("platform %s minos %s sdk %s", platform, machoVersion(l.u32(bo, 12)), machoVersion(l.u32(bo, 16)))
+	case lcVersionMinMacOSX, lcVersionMinIPhone, lcVersionMinTVOS, lcVersionMinWatchOS:
+		return fmt.Sprintf("version %s sdk %s", machoVersion(l.u32(bo, 8)), machoVersion(l.u32(bo, 12)))
+	case lcSourceVersion:
+		if len(l.raw) >= 16 {
+			v := bo.Uint64(l.raw[8:])
+			return fmt.Sprintf("%d.%d.%d.%d.%d", v>>40, (v>>30)&0x3ff, (v>>20)&0x3ff, (v>>10)&0x3ff, v&0x3ff)
+		}
+	case lcMain:
+		if len(l.raw) >= 16 {
+			return fmt.Sprintf("entryoff 0x%x", bo.Uint64(l.raw[8:]))
+		}
+	case lcCodeSignature:
+		return fmt.Sprintf("dataoff 0x%x datasize %d", l.u32(bo, 8), l.u32(bo, 12))
+	case lcEncryptionInfo, lcEncryptionInfo64:
+		return fmt.Sprintf("cryptid %d", l.u32(bo, 16))
+	}
+	return ""
+}
+
+func vmProt(p uint32) string {
+	rwx := []byte("---")
+	for i, c := range "rwx" {
+		if p&(1<<i) != 0 {
+			rwx[i] = byte(c)
+		}
+	}
+	return string(rwx)
+}
+
+// Code signing blobs, from xnu's cs_blobs.h. Unlike the rest of the file
+// these are always big endian.
+const (
+	csMagicEmbeddedSignature    = 0xfade0cc0
+	csMagicCodeDirectory        = 0xfade0c02
+	csMagicRequirements         = 0xfade0c01
+	csMagicEmbeddedEntitlements = 0xfade7171
+	csMagicEntitlementsDER      = 0xfade7172
+	csMagicBlobWrapper          = 0xfade0b01
+)
+
+var codeDirectoryFlags = []flagName{
+	{0x1, "host"},
+	{0x2, "adhoc"},
+	{0x100, "hard"},
+	{0x200, "kill"},
+	{0x800, "restrict"},
+	{0x1000, "enforcement"},
+	{0x2000, "library-validation"},
+	{0x10000, "runtime"},
+	{0x20000, "linker-signed"},
+}
+
+var csHashTypes = map[byte]string{1: "sha1", 2: "sha256", 3: "sha256 (truncated)", 4: "sha384"}
+
+func printCodeSignature(w io.Writer, sig []byte) {
+	be := binary.BigEndian
+	if len(sig) < 12 || be.Uint32(sig) != csMagicEmbeddedSignature {
+		fmt.Fprintf(w, "  not an embedded signature\n")
+		return
+	}
+	count := be.Uint32(sig[8:])
+	for i := range count {
+		idx := 12 + 8*int(i)
+		if idx+8 > len(sig) {
+			break
+		}
+		off := int(be.Uint32(sig[idx+4:]))
+		if off+8 > len(sig) {
+			continue
+		}
+		magic, length := be.Uint32(sig[off:]), int(be.Uint32(sig[off+4:]))
+		if length < 8 || off+length > len(sig) {
+			continue
+		}
+		blob := sig[off : off+length]
+
+		switch magic {
+		case csMagicCodeDirectory:
+			printCodeDirectory(w, blob)
+		case csMagicRequirements:
+			fmt.Fprintf(w, "  requirements: %d bytes\n", length)
+		case csMagicEmbeddedEntitlements:
+			fmt.Fprintf(w, "  entitlements:\n%s\n", strings.TrimSpace(string(blob[8:])))
+		case csMagicEntitlementsDER:
+			fmt.Fprintf(w, "  entitlements (DER): %d bytes\n", length)
+		case csMagicBlobWrapper:
+			if length == 8 {
+				// What ad-hoc signatures have instead.
+				fmt.Fprintf(w, "  signature: empty\n")
+				continue
+			}
+			fmt.Fprintf(w, "  signature:\n")
+			printCertificates(w, "    ", blob[8:])
+		default:
+			fmt.Fprintf(w, "  blob %#x: %d bytes\n", magic, length)
+		}
+	}
+}
+
+func printCodeDirectory(w io.Writer, cd []byte) {
+	be := binary.BigEndian
+	if len(cd) < 44 {
+		fmt.Fprintf(w, "  code directory: too short\n")
+		return
+	}
+	version := be.Uint32(cd[8:])
+	str := func(off uint32) string {
+		if off == 0 || int(off) >= len(cd) {
+			return ""
+		}
+		return cstring(cd[off:])
+	}
+	fmt.Fprintf(w, "  identifier: %s\n", str(be.Uint32(cd[20:])))
+	if version >= 0x20200 && len(cd) >= 52 {
+		if team := str(be.Uint32(cd[48:])); team != "" {
+			fmt.Fprintf(w, "  team id: %s\n", team)
+		}
+	}
+	fmt.Fprintf(w, "  flags: %s\n", flagNames(be.Uint32(cd[12:]), codeDirectoryFlags))
+	hash, ok := csHashTypes[cd[37]]
+	if !ok {
+		hash = fmt.Sprint(cd[37])
+	}
+	fmt.Fprintf(w, "  code directory: version %#x, %d pages hashed with %s\n", version, be.Uint32(cd[28:]), hash)
+}
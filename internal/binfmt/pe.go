@@ -0,0 +1,514 @@
+package binfmt
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var peMachines = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:    "i386",
+	pe.IMAGE_FILE_MACHINE_AMD64:   "x86-64",
+	pe.IMAGE_FILE_MACHINE_ARM:     "arm",
+	pe.IMAGE_FILE_MACHINE_ARMNT:   "arm",
+	pe.IMAGE_FILE_MACHINE_ARM64:   "arm64",
+	pe.IMAGE_FILE_MACHINE_IA64:    "ia64",
+	pe.IMAGE_FILE_MACHINE_RISCV64: "riscv64",
+}
+
+var peSubsystems = map[uint16]string{
+	pe.IMAGE_SUBSYSTEM_NATIVE:                   "native",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_GUI:              "windows gui",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CUI:              "windows console",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_CE_GUI:           "windows ce gui",
+	pe.IMAGE_SUBSYSTEM_EFI_APPLICATION:          "efi application",
+	pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER:  "efi boot service driver",
+	pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER:       "efi runtime driver",
+	pe.IMAGE_SUBSYSTEM_XBOX:                     "xbox",
+	pe.IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION: "windows boot application",
+}
+
+var peCharacteristics = []flagName{
+	{pe.IMAGE_FILE_RELOCS_STRIPPED, "RELOCS_STRIPPED"},
+	{pe.IMAGE_FILE_EXECUTABLE_IMAGE, "EXECUTABLE_IMAGE"},
+	{pe.IMAGE_FILE_LARGE_ADDRESS_AWARE, "LARGE_ADDRESS_AWARE"},
+	{pe.IMAGE_FILE_32BIT_MACHINE, "32BIT_MACHINE"},
+	{pe.IMAGE_FILE_DEBUG_STRIPPED, "DEBUG_STRIPPED"},
+	{pe.IMAGE_FILE_SYSTEM, "SYSTEM"},
+	{pe.IMAGE_FILE_DLL, "DLL"},
+}
+
+var peDllCharacteristics = []flagName{
+	{pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA, "HIGH_ENTROPY_VA"},
+	{pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE, "DYNAMIC_BASE"},
+	{pe.IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY, "FORCE_INTEGRITY"},
+	{pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT, "NX_COMPAT"},
+	{pe.IMAGE_DLLCHARACTERISTICS_NO_ISOLATION, "NO_ISOLATION"},
+	{pe.IMAGE_DLLCHARACTERISTICS_NO_SEH, "NO_SEH"},
+	{pe.IMAGE_DLLCHARACTERISTICS_NO_BIND, "NO_BIND"},
+	{pe.IMAGE_DLLCHARACTERISTICS_APPCONTAINER, "APPCONTAINER"},
+	{pe.IMAGE_DLLCHARACTERISTICS_WDM_DRIVER, "WDM_DRIVER"},
+	{pe.IMAGE_DLLCHARACTERISTICS_GUARD_CF, "GUARD_CF"},
+	{pe.IMAGE_DLLCHARACTERISTICS_TERMINAL_SERVER_AWARE, "TERMINAL_SERVER_AWARE"},
+}
+
+// peHeader is the part of the optional header that doesn't depend on
+// whether it's PE32 or PE32+.
+type peHeader struct {
+	magic              uint16
+	linker             string
+	os                 string
+	entry              uint32
+	imageBase          uint64
+	checksum           uint32
+	subsystem          uint16
+	dllCharacteristics uint16
+	dirs               []pe.DataDirectory
+}
+
+func optionalHeader(f *pe.File) *peHeader {
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return &peHeader{oh.Magic, fmt.Sprintf("%d.%d", oh.MajorLinkerVersion, oh.MinorLinkerVersion), fmt.Sprintf("%d.%d", oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion),
+			oh.AddressOfEntryPoint, uint64(oh.ImageBase), oh.CheckSum, oh.Subsystem, oh.DllCharacteristics, oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, 16)]}
+	case *pe.OptionalHeader64:
+		return &peHeader{oh.Magic, fmt.Sprintf("%d.%d", oh.MajorLinkerVersion, oh.MinorLinkerVersion), fmt.Sprintf("%d.%d", oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion),
+			oh.AddressOfEntryPoint, oh.ImageBase, oh.CheckSum, oh.Subsystem, oh.DllCharacteristics, oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, 16)]}
+	}
+	return nil
+}
+
+func (h *peHeader) dir(i int) pe.DataDirectory {
+	if h == nil || i >= len(h.dirs) {
+		return pe.DataDirectory{}
+	}
+	return h.dirs[i]
+}
+
+// PrintPE writes the headers, sections, imports, exports, version info and
+// Authenticode certificates of the PE file in r.
+func PrintPE(w io.Writer, r io.ReaderAt, size int64) error {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fh := f.FileHeader
+	arch, ok := peMachines[fh.Machine]
+	if !ok {
+		arch = fmt.Sprintf("%#x", fh.Machine)
+	}
+	oh := optionalHeader(f)
+
+	fmt.Fprintf(w, "file format pe-%s\n", arch)
+	fmt.Fprintf(w, "characteristics: %s\n", flagNames(uint32(fh.Characteristics), peCharacteristics))
+	fmt.Fprintf(w, "timestamp: %s\n", time.Unix(int64(fh.TimeDateStamp), 0).UTC().Format(time.RFC3339))
+	if oh != nil {
+		kind := "PE32"
+		if oh.magic == 0x20b {
+			kind = "PE32+"
+		}
+		subsystem, ok := peSubsystems[oh.subsystem]
+		if !ok {
+			subsystem = fmt.Sprint(oh.subsystem)
+		}
+		fmt.Fprintf(w, "magic: %s\n", kind)
+		fmt.Fprintf(w, "subsystem: %s\n", subsystem)
+		fmt.Fprintf(w, "dll characteristics: %s\n", flagNames(uint32(oh.dllCharacteristics), peDllCharacteristics))
+		fmt.Fprintf(w, "linker version: %s\n", oh.linker)
+		fmt.Fprintf(w, "os version: %s\n", oh.os)
+		fmt.Fprintf(w, "image base: 0x%016x\n", oh.imageBase)
+		fmt.Fprintf(w, "start address: 0x%016x\n", oh.imageBase+uint64(oh.entry))
+		fmt.Fprintf(w, "checksum: 0x%08x\n", oh.checksum)
+	}
+
+	fmt.Fprintf(w, "\nSections:\n")
+	maxlen := 4
+	for _, s := range f.Sections {
+		maxlen = max(maxlen, len(s.Name))
+	}
+	fmt.Fprintf(w, "Idx %-*s Size     VMA      File off Flags\n", maxlen, "Name")
+	for i, s := range f.Sections {
+		fmt.Fprintf(w, "% 3d %-*s %08x %08x %08x %s\n", i, maxlen, s.Name, s.VirtualSize, s.VirtualAddress, s.Offset, sectionFlags(s.Characteristics))
+	}
+
+	printPEDebug(w, f, oh)
+	printPEImports(w, f)
+	printPEExports(w, f, oh)
+	printPEVersion(w, f, oh)
+	printPECertificates(w, r, size, oh)
+	return nil
+}
+
+func sectionFlags(c uint32) string {
+	rwx := []byte("---")
+	if c&pe.IMAGE_SCN_MEM_READ != 0 {
+		rwx[0] = 'r'
+	}
+	if c&pe.IMAGE_SCN_MEM_WRITE != 0 {
+		rwx[1] = 'w'
+	}
+	if c&pe.IMAGE_SCN_MEM_EXECUTE != 0 {
+		rwx[2] = 'x'
+	}
+	var kind []string
+	if c&pe.IMAGE_SCN_CNT_CODE != 0 {
+		kind = append(kind, "CODE")
+	}
+	if c&pe.IMAGE_SCN_CNT_INITIALIZED_DATA != 0 {
+		kind = append(kind, "DATA")
+	}
+	if c&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 {
+		kind = append(kind, "BSS")
+	}
+	return string(rwx) + " " + strings.Join(kind, ", ")
+}
+
+// readRVA reads n bytes at a relative virtual address, i.e. from whichever
+// section it's mapped into.
+func readRVA(f *pe.File, rva uint32, n uint64) ([]byte, error) {
+	for _, s := range f.Sections {
+		end := max(s.VirtualSize, s.Size)
+		if rva < s.VirtualAddress || rva-s.VirtualAddress >= end {
+			continue
+		}
+		if n > maxTable || n > uint64(end-(rva-s.VirtualAddress)) {
+			return nil, fmt.Errorf("%d bytes at rva %#x is too big", n, rva)
+		}
+		b := make([]byte, n)
+		if _, err := s.ReadAt(b, int64(rva-s.VirtualAddress)); err != nil {
+			return nil, fmt.Errorf("reading rva %#x: %w", rva, err)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("rva %#x isn't in any section", rva)
+}
+
+func stringRVA(f *pe.File, rva uint32) string {
+	for n := uint64(256); n > 0; n /= 2 {
+		// Shorter reads for strings at the very end of a section.
+		if b, err := readRVA(f, rva, n); err == nil {
+			return cstring(b)
+		}
+	}
+	return ""
+}
+
+func printPEDebug(w io.Writer, f *pe.File, oh *peHeader) {
+	dd := oh.dir(pe.IMAGE_DIRECTORY_ENTRY_DEBUG)
+	if dd.Size == 0 {
+		return
+	}
+	b, err := readRVA(f, dd.VirtualAddress, uint64(dd.Size))
+	if err != nil {
+		return
+	}
+	for ; len(b) >= 28; b = b[28:] {
+		// IMAGE_DEBUG_DIRECTORY, and we only care about CodeView.
+		if binary.LittleEndian.Uint32(b[12:]) != 2 {
+			continue
+		}
+		cv, err := readRVA(f, binary.LittleEndian.Uint32(b[20:]), uint64(binary.LittleEndian.Uint32(b[16:])))
+		if err != nil || len(cv) < 24 || string(cv[:4]) != "RSDS" {
+			continue
+		}
+		g := cv[4:20]
+		fmt.Fprintf(w, "\nDebug:\n")
+		fmt.Fprintf(w, "  pdb   %s\n", cstring(cv[24:]))
+		fmt.Fprintf(w, "  guid  %08x-%04x-%04x-%x-%x age %d\n", binary.LittleEndian.Uint32(g), binary.LittleEndian.Uint16(g[4:]), binary.LittleEndian.Uint16(g[6:]), g[8:10], g[10:], binary.LittleEndian.Uint32(cv[20:]))
+	}
+}
+
+func printPEImports(w io.Writer, f *pe.File) {
+	syms, err := f.ImportedSymbols()
+	if err != nil {
+		fmt.Fprintf(w, "\nImports:\n  (%v)\n", err)
+		return
+	}
+	if len(syms) == 0 {
+		return
+	}
+
+	// They come as "func:dll"; group them by dll in the order they appear.
+	var dlls []string
+	funcs := map[string][]string{}
+	for _, sym := range syms {
+		fn, dll, _ := strings.Cut(sym, ":")
+		if _, ok := funcs[dll]; !ok {
+			dlls = append(dlls, dll)
+		}
+		funcs[dll] = append(funcs[dll], fn)
+	}
+	fmt.Fprintf(w, "\nImports:\n")
+	for _, dll := range dlls {
+		fmt.Fprintf(w, "  %s\n", dll)
+		for _, fn := range funcs[dll] {
+			fmt.Fprintf(w, "    %s\n", fn)
+		}
+	}
+}
+
+func printPEExports(w io.Writer, f *pe.File, oh *peHeader) {
+	dd := oh.dir(pe.IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if dd.Size == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nExports:\n")
+	b, err := readRVA(f, dd.VirtualAddress, 40)
+	if err != nil {
+		fmt.Fprintf(w, "  (%v)\n", err)
+		return
+	}
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(b[off:]) }
+	base, nfuncs, nnames := u32(16), u32(20), u32(24)
+	fmt.Fprintf(w, "  name  %s\n", stringRVA(f, u32(12)))
+
+	// The counts are whatever the file says, so the sizes can't overflow
+	// and the loops go by what was actually read.
+	funcs, err := readRVA(f, u32(28), 4*uint64(nfuncs))
+	if err != nil {
+		fmt.Fprintf(w, "  (%v)\n", err)
+		return
+	}
+	names, err := readRVA(f, u32(32), 4*uint64(nnames))
+	if err != nil {
+		fmt.Fprintf(w, "  (%v)\n", err)
+		return
+	}
+	ords, err := readRVA(f, u32(36), 2*uint64(nnames))
+	if err != nil {
+		fmt.Fprintf(w, "  (%v)\n", err)
+		return
+	}
+
+	named := map[uint32]string{}
+	for i := range min(len(names)/4, len(ords)/2) {
+		ord := uint32(binary.LittleEndian.Uint16(ords[2*i:]))
+		named[ord] = stringRVA(f, binary.LittleEndian.Uint32(names[4*i:]))
+	}
+	for i := range uint32(len(funcs) / 4) {
+		rva := binary.LittleEndian.Uint32(funcs[4*i:])
+		if rva == 0 {
+			continue
+		}
+		line := fmt.Sprintf("  %5d %08x %s", base+i, rva, named[i])
+		// Forwarded exports point back into the export directory, at "dll.func".
+		if rva >= dd.VirtualAddress && rva < dd.VirtualAddress+dd.Size {
+			line = fmt.Sprintf("  %5d %8s %s -> %s", base+i, "", named[i], stringRVA(f, rva))
+		}
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// RT_VERSION in the resource directory.
+const rtVersion = 16
+
+// maxResourceEntries bounds the resource directory entries versionResource
+// will walk. Real files have a handful.
+const maxResourceEntries = 4096
+
+func printPEVersion(w io.Writer, f *pe.File, oh *peHeader) {
+	dd := oh.dir(pe.IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if dd.Size == 0 {
+		return
+	}
+	rsrc, err := readRVA(f, dd.VirtualAddress, uint64(dd.Size))
+	if err != nil {
+		return
+	}
+	data := versionResource(f, rsrc)
+	if data == nil {
+		return
+	}
+	vi, err := parseVersionInfo(data)
+	if err != nil {
+		fmt.Fprintf(w, "\nVersion info:\n  (%v)\n", err)
+		return
+	}
+	fmt.Fprintf(w, "\nVersion info:\n")
+	if vi.FileVersion != "" {
+		fmt.Fprintf(w, "  FileVersion (fixed)     %s\n", vi.FileVersion)
+		fmt.Fprintf(w, "  ProductVersion (fixed)  %s\n", vi.ProductVersion)
+	}
+	for _, kv := range vi.Strings {
+		fmt.Fprintf(w, "  %-22s  %s\n", kv[0], kv[1])
+	}
+}
+
+// versionResource finds the first RT_VERSION resource: type, then name,
+// then language. The offsets between directories come from the file, so
+// each directory is read at most once and the walk gives up, returning
+// nil, after maxResourceEntries.
+func versionResource(f *pe.File, rsrc []byte) []byte {
+	type entry struct {
+		id  uint32
+		off uint32
+		dir bool
+	}
+	visited := map[uint32]bool{}
+	walked := 0
+	entries := func(off uint32) []entry {
+		if visited[off] || int(off)+16 > len(rsrc) {
+			return nil
+		}
+		visited[off] = true
+		n := int(binary.LittleEndian.Uint16(rsrc[off+12:])) + int(binary.LittleEndian.Uint16(rsrc[off+14:]))
+		var es []entry
+		for i := range n {
+			p := int(off) + 16 + 8*i
+			if p+8 > len(rsrc) {
+				break
+			}
+			if walked++; walked > maxResourceEntries {
+				return nil
+			}
+			to := binary.LittleEndian.Uint32(rsrc[p+4:])
+			es = append(es, entry{binary.LittleEndian.Uint32(rsrc[p:]), to &^ (1 << 31), to&(1<<31) != 0})
+		}
+		return es
+	}
+
+	for _, typ := range entries(0) {
+		if walked > maxResourceEntries {
+			return nil
+		}
+		if typ.id != rtVersion || !typ.dir {
+			continue
+		}
+		for _, name := range entries(typ.off) {
+			if walked > maxResourceEntries {
+				return nil
+			}
+			if !name.dir {
+				continue
+			}
+			for _, lang := range entries(name.off) {
+				if walked > maxResourceEntries {
+					return nil
+				}
+				if lang.dir || int(lang.off)+8 > len(rsrc) {
+					continue
+				}
+				rva := binary.LittleEndian.Uint32(rsrc[lang.off:])
+				size := binary.LittleEndian.Uint32(rsrc[lang.off+4:])
+				if b, err := readRVA(f, rva, uint64(size)); err == nil {
+					return b
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type versionInfo struct {
+	FileVersion    string
+	ProductVersion string
+	Strings        [][2]string // from StringFileInfo, in order
+}
+
+// verBlock is the shape everything in a VS_VERSIONINFO resource takes:
+// a length, a key, a value and children.
+type verBlock struct {
+	key      string
+	value    []byte
+	text     bool
+	children []verBlock
+}
+
+func align4(n int) int { return (n + 3) &^ 3 }
+
+func parseVerBlock(b []byte, depth int) (verBlock, int, error) {
+	var blk verBlock
+	if len(b) < 6 {
+		return blk, 0, fmt.Errorf("short version block")
+	}
+	length := int(binary.LittleEndian.Uint16(b))
+	vlen := int(binary.LittleEndian.Uint16(b[2:]))
+	blk.text = binary.LittleEndian.Uint16(b[4:]) == 1
+	if length < 6 || length > len(b) || depth > 4 {
+		return blk, 0, fmt.Errorf("bad version block")
+	}
+	b = b[:length]
+
+	var off int
+	blk.key, off = utf16z(b, 6)
+	off = align4(off)
+	if blk.text {
+		vlen *= 2
+	}
+	blk.value = b[min(off, len(b)):min(off+vlen, len(b))]
+	for off = align4(off + vlen); off < len(b); {
+		child, n, err := parseVerBlock(b[off:], depth+1)
+		if err != nil {
+			return blk, length, err
+		}
+		blk.children = append(blk.children, child)
+		off = align4(off + n)
+	}
+	return blk, length, nil
+}
+
+func parseVersionInfo(b []byte) (*versionInfo, error) {
+	root, _, err := parseVerBlock(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	if root.key != "VS_VERSION_INFO" {
+		return nil, fmt.Errorf("not VS_VERSION_INFO: %q", root.key)
+	}
+	vi := &versionInfo{}
+
+	// VS_FIXEDFILEINFO
+	if v := root.value; len(v) >= 52 && binary.LittleEndian.Uint32(v) == 0xfeef04bd {
+		version := func(off int) string {
+			ms, ls := binary.LittleEndian.Uint32(v[off:]), binary.LittleEndian.Uint32(v[off+4:])
+			return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+		}
+		vi.FileVersion, vi.ProductVersion = version(8), version(16)
+	}
+
+	for _, sfi := range root.children {
+		if sfi.key != "StringFileInfo" {
+			continue
+		}
+		for _, table := range sfi.children {
+			for _, s := range table.children {
+				val, _ := utf16z(s.value, 0)
+				vi.Strings = append(vi.Strings, [2]string{s.key, val})
+			}
+		}
+	}
+	return vi, nil
+}
+
+func printPECertificates(w io.Writer, r io.ReaderAt, size int64, oh *peHeader) {
+	// Unlike the other directories, this one is a file offset, not an RVA.
+	dd := oh.dir(pe.IMAGE_DIRECTORY_ENTRY_SECURITY)
+	if dd.Size == 0 || int64(dd.VirtualAddress)+int64(dd.Size) > size {
+		return
+	}
+	fmt.Fprintf(w, "\nAuthenticode certificates (not verified):\n")
+	b, err := readAt(r, int64(dd.VirtualAddress), dd.Size)
+	if err != nil {
+		fmt.Fprintf(w, "  (%v)\n", err)
+		return
+	}
+	// WIN_CERTIFICATE entries, each 8 byte aligned.
+	for len(b) >= 8 {
+		length := binary.LittleEndian.Uint32(b)
+		typ := binary.LittleEndian.Uint16(b[6:])
+		if length < 8 || int64(length) > int64(len(b)) {
+			break
+		}
+		if typ == 2 { // WIN_CERT_TYPE_PKCS_SIGNED_DATA
+			printCertificates(w, "  ", b[8:length])
+		} else {
+			fmt.Fprintf(w, "  certificate type %d, %d bytes\n", typ, length)
+		}
+		b = b[min(len(b), int((length+7)&^7)):]
+	}
+}
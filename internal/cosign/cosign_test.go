@@ -0,0 +1,374 @@
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+)
+
+var signedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type fixture struct {
+	t *testing.T
+
+	root     []byte // trusted_root.json
+	leaf     *x509.Certificate
+	leafKey  *ecdsa.PrivateKey
+	logKey   *ecdsa.PrivateKey
+	logID    string
+	tsaCert  *x509.Certificate
+	tsaKey   *ecdsa.PrivateKey
+	otherKey *ecdsa.PrivateKey
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func newCert(t *testing.T, tmpl, parent *x509.Certificate, pub *ecdsa.PublicKey, priv *ecdsa.PrivateKey) *x509.Certificate {
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{t: t}
+
+	caKey := newKey(t)
+	ca := newCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test fulcio"},
+		NotBefore:             signedAt.AddDate(-1, 0, 0),
+		NotAfter:              signedAt.AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &caKey.PublicKey, caKey)
+
+	issuer, _ := asn1.Marshal("https://accounts.example.com")
+	f.leafKey = newKey(t)
+	f.leaf = newCert(t, &x509.Certificate{
+		NotBefore:       signedAt.Add(-time.Minute),
+		NotAfter:        signedAt.Add(10 * time.Minute),
+		EmailAddresses:  []string{"signer@example.com"},
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuer}},
+	}, ca, &f.leafKey.PublicKey, caKey)
+
+	f.logKey = newKey(t)
+	logDER, _ := x509.MarshalPKIXPublicKey(&f.logKey.PublicKey)
+	sum := sha256.Sum256(logDER)
+	f.logID = hex.EncodeToString(sum[:])
+
+	tsaRootKey := newKey(t)
+	tsaRoot := newCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test tsa root"},
+		NotBefore:             signedAt.AddDate(-1, 0, 0),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &tsaRootKey.PublicKey, tsaRootKey)
+	f.tsaKey = newKey(t)
+	f.tsaCert = newCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "test tsa"},
+		NotBefore:   signedAt.AddDate(-1, 0, 0),
+		NotAfter:    time.Now().AddDate(10, 0, 0),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}, tsaRoot, &f.tsaKey.PublicKey, tsaRootKey)
+
+	f.otherKey = newKey(t)
+
+	f.root = []byte(fmt.Sprintf(`{
+	  "mediaType": "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+	  "tlogs": [{"baseUrl": "https://rekor.example.com", "hashAlgorithm": "SHA2_256",
+	             "publicKey": {"rawBytes": %q, "keyDetails": "PKIX_ECDSA_P256_SHA_256", "validFor": {"start": "2020-01-01T00:00:00Z"}},
+	             "logId": {"keyId": %q}}],
+	  "certificateAuthorities": [{"uri": "https://fulcio.example.com", "certChain": {"certificates": [{"rawBytes": %q}]},
+	                              "validFor": {"start": "2020-01-01T00:00:00Z"}}],
+	  "timestampAuthorities": [{"uri": "https://tsa.example.com", "certChain": {"certificates": [{"rawBytes": %q}, {"rawBytes": %q}]}}]
+	}`, base64.StdEncoding.EncodeToString(logDER), base64.StdEncoding.EncodeToString(sum[:]),
+		base64.StdEncoding.EncodeToString(ca.Raw), base64.StdEncoding.EncodeToString(f.tsaCert.Raw), base64.StdEncoding.EncodeToString(tsaRoot.Raw)))
+	return f
+}
+
+func (f *fixture) trustedRoot() *TrustedRoot {
+	tr, err := ParseTrustedRoot(f.root)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return tr
+}
+
+func (f *fixture) sign(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	sig, err := ecdsa.SignASN1(rand.Reader, f.leafKey, sum[:])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return sig
+}
+
+// entry makes a hashedrekord log entry for sig over digest and its SET.
+func (f *fixture) entry(digest, sig []byte, key *ecdsa.PrivateKey) (body string, set []byte) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.leaf.Raw})
+	b, _ := json.Marshal(map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(digest)}},
+			"signature": map[string]any{"content": sig, "publicKey": map[string]any{"content": certPEM}},
+		},
+	})
+	body = base64.StdEncoding.EncodeToString(b)
+	canonical := fmt.Sprintf(`{"body":%q,"integratedTime":%d,"logID":%q,"logIndex":42}`, body, signedAt.Unix(), f.logID)
+	sum := sha256.Sum256([]byte(canonical))
+	set, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return body, set
+}
+
+func (f *fixture) timestamp(sig []byte) []byte {
+	sum := sha256.Sum256(sig)
+	ts := &timestamp.Timestamp{
+		HashAlgorithm:     crypto.SHA256,
+		HashedMessage:     sum[:],
+		Time:              signedAt.Add(time.Second),
+		Policy:            asn1.ObjectIdentifier{1, 2, 3, 4, 1},
+		AddTSACertificate: true,
+	}
+	resp, err := ts.CreateResponseWithOpts(f.tsaCert, f.tsaKey, crypto.SHA256)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return resp
+}
+
+const subject = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+func (f *fixture) layer(payload string, setKey *ecdsa.PrivateKey) map[string]string {
+	sig := f.sign([]byte(payload))
+	digest := sha256.Sum256([]byte(payload))
+	body, set := f.entry(digest[:], sig, setKey)
+	bundle, _ := json.Marshal(map[string]any{
+		"SignedEntryTimestamp": set,
+		"Payload":              map[string]any{"body": body, "integratedTime": signedAt.Unix(), "logIndex": 42, "logID": f.logID},
+	})
+	ts, _ := json.Marshal(map[string]any{"SignedRFC3161Timestamp": f.timestamp(sig)})
+	return map[string]string{
+		SignatureAnnotation:   base64.StdEncoding.EncodeToString(sig),
+		CertificateAnnotation: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.leaf.Raw})),
+		BundleAnnotation:      string(bundle),
+		TimestampAnnotation:   string(ts),
+	}
+}
+
+func checks(res *Result) map[string]Check {
+	m := map[string]Check{}
+	for _, c := range res.Checks {
+		m[c.Name] = c
+	}
+	return m
+}
+
+func TestVerifyLayer(t *testing.T) {
+	f := newFixture(t)
+	root := f.trustedRoot()
+	payload := `{"critical":{"identity":{"docker-reference":"example.com/app"},"image":{"docker-manifest-digest":"` + subject + `"},"type":"cosign container image signature"},"optional":null}`
+
+	s, err := FromLayer(SimpleSigningMediaType, []byte(payload), f.layer(payload, f.logKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := Verify(s, root, subject)
+	if !res.OK() {
+		t.Errorf("Verify() = %+v", res.Checks)
+	}
+	if res.Identity == nil || res.Identity.SAN != "signer@example.com" || res.Identity.Issuer != "https://accounts.example.com" {
+		t.Errorf("Identity = %+v", res.Identity)
+	}
+	want := []string{CheckSignature, CheckSubject, CheckChain, CheckLog, CheckTimestamp}
+	for i, c := range res.Checks {
+		if i >= len(want) || c.Name != want[i] {
+			t.Errorf("checks in order %+v, want %v", res.Checks, want)
+			break
+		}
+	}
+
+	if res := Verify(s, root, "sha256:2222"); res.OK() || checks(res)[CheckSubject].OK {
+		t.Errorf("Verify(other subject) = %+v", res.Checks)
+	}
+
+	// Without a trusted root only the signature can be checked.
+	res = Verify(s, nil, "")
+	if c := checks(res); !c[CheckSignature].OK || c[CheckChain].OK || c[CheckLog].OK || res.OK() {
+		t.Errorf("Verify(no root) = %+v", res.Checks)
+	}
+
+	// A payload that wasn't what was signed.
+	tampered, err := FromLayer(SimpleSigningMediaType, []byte(strings.Replace(payload, "app", "evil", 1)), f.layer(payload, f.logKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := checks(Verify(tampered, root, "")); c[CheckSignature].OK || c[CheckLog].OK {
+		t.Errorf("Verify(tampered) = %+v", c)
+	}
+
+	// A SET from a log that isn't trusted, and no timestamp to fall back on.
+	ann := f.layer(payload, f.otherKey)
+	delete(ann, TimestampAnnotation)
+	s, err = FromLayer(SimpleSigningMediaType, []byte(payload), ann)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := checks(Verify(s, root, ""))
+	if !c[CheckSignature].OK || c[CheckLog].OK || c[CheckChain].OK || !strings.Contains(c[CheckChain].Detail, "neither") {
+		t.Errorf("Verify(bad SET) = %+v", c)
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	f := newFixture(t)
+	artifact := []byte(`{"schemaVersion":2}`)
+	digest := sha256.Sum256(artifact)
+	sig := f.sign(artifact)
+	body, set := f.entry(digest[:], sig, f.logKey)
+	logID, _ := hex.DecodeString(f.logID)
+
+	b, _ := json.Marshal(map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]any{"rawBytes": f.leaf.Raw},
+			"tlogEntries": []any{map[string]any{
+				"logIndex":          "42",
+				"logId":             map[string]any{"keyId": logID},
+				"kindVersion":       map[string]any{"kind": "hashedrekord", "version": "0.0.1"},
+				"integratedTime":    fmt.Sprint(signedAt.Unix()),
+				"inclusionPromise":  map[string]any{"signedEntryTimestamp": set},
+				"canonicalizedBody": body,
+			}},
+		},
+		"messageSignature": map[string]any{
+			"messageDigest": map[string]any{"algorithm": "SHA2_256", "digest": digest[:]},
+			"signature":     sig,
+		},
+	})
+	s, err := ParseBundle(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Kind != KindMessage || s.Entry == nil || s.Entry.LogIndex != 42 {
+		t.Errorf("ParseBundle() = %+v", s)
+	}
+	res := Verify(s, f.trustedRoot(), "sha256:"+hex.EncodeToString(digest[:]))
+	if !res.OK() {
+		t.Errorf("Verify(bundle) = %+v", res.Checks)
+	}
+
+	if _, err := ParseBundle([]byte(`{"mediaType": "application/json"}`)); err == nil {
+		t.Errorf("no error for something that isn't a bundle")
+	}
+}
+
+func TestPAE(t *testing.T) {
+	// From the DSSE spec.
+	got := string(pae("http://example.com/HelloWorld", []byte("hello world")))
+	if want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"; got != want {
+		t.Errorf("pae() = %q, want %q", got, want)
+	}
+}
+
+func TestEntryMatches(t *testing.T) {
+	f := newFixture(t)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.leaf.Raw})
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v1"}`)
+	signed := pae("application/vnd.in-toto+json", payload)
+	digest := sha256.Sum256(signed)
+	env := &Signature{Kind: KindDSSE, Payload: payload, Signed: signed, Digest: digest[:], Signature: f.sign(signed), Certificate: f.leaf}
+	payloadSum := sha256.Sum256(payload)
+	payloadHash := map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(payloadSum[:])}
+
+	msg := []byte("hello")
+	msgDigest := sha256.Sum256(msg)
+	ss := &Signature{Kind: KindSimpleSigning, Payload: msg, Signed: msg, Digest: msgDigest[:], Signature: f.sign(msg), Certificate: f.leaf}
+	other := f.sign([]byte("something else"))
+
+	hashedrekord := func(key []byte) map[string]any {
+		return map[string]any{"kind": "hashedrekord", "spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(msgDigest[:])}},
+			"signature": map[string]any{"content": ss.Signature, "publicKey": map[string]any{"content": key}},
+		}}
+	}
+	dsse := func(sig []byte, hash map[string]string) map[string]any {
+		return map[string]any{"kind": "dsse", "spec": map[string]any{
+			"payloadHash": hash,
+			"signatures":  []any{map[string]any{"signature": sig, "verifier": certPEM}},
+		}}
+	}
+	intoto := map[string]any{"kind": "intoto", "spec": map[string]any{"content": map[string]any{
+		"envelope":    map[string]any{"signatures": []any{map[string]any{"sig": []byte(base64.StdEncoding.EncodeToString(env.Signature)), "publicKey": certPEM}}},
+		"payloadHash": payloadHash,
+	}}}
+
+	for _, tc := range []struct {
+		name  string
+		entry map[string]any
+		s     *Signature
+		ok    bool
+	}{
+		{"hashedrekord", hashedrekord(certPEM), ss, true},
+		{"hashedrekord without a PEM key", hashedrekord([]byte("not a key")), ss, false},
+		{"dsse", dsse(env.Signature, payloadHash), env, true},
+		{"dsse of another payload", dsse(env.Signature, map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(msgDigest[:])}), env, false},
+		{"dsse quoting the signature elsewhere", func() map[string]any {
+			e := dsse(other, payloadHash)
+			e["spec"].(map[string]any)["note"] = base64.StdEncoding.EncodeToString(env.Signature)
+			return e
+		}(), env, false},
+		{"intoto", intoto, env, true},
+		{"intoto of a simplesigning signature", intoto, ss, false},
+		{"rekord", map[string]any{"kind": "rekord", "spec": map[string]any{}}, ss, false},
+	} {
+		body, err := json.Marshal(tc.entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := entryMatches(body, tc.s); (err == nil) != tc.ok {
+			t.Errorf("entryMatches(%s) = %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package cosign
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Annotations cosign puts on each layer of a signature manifest.
+const (
+	SignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	CertificateAnnotation = "dev.sigstore.cosign/certificate"
+	ChainAnnotation       = "dev.sigstore.cosign/chain"
+	BundleAnnotation      = "dev.sigstore.cosign/bundle"
+	TimestampAnnotation   = "dev.sigstore.cosign/rfc3161timestamp"
+)
+
+// Media types of what gets signed.
+const (
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	DSSEMediaType          = "application/vnd.dsse.envelope.v1+json"
+)
+
+// IsBundle reports whether mediaType is a Sigstore bundle, as pushed as a
+// referrer by newer cosign.
+func IsBundle(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "application/vnd.dev.sigstore.bundle")
+}
+
+// What a Signature signs.
+const (
+	KindSimpleSigning = "simplesigning" // cosign's JSON naming the image
+	KindDSSE          = "dsse"          // an envelope, usually of an in-toto statement
+	KindMessage       = "message"       // an artifact known only by its digest
+)
+
+// Signature is one signature with whatever came with it to check it by.
+type Signature struct {
+	Kind        string
+	Payload     []byte // what was signed, or the envelope's payload for DSSE
+	PayloadType string // of a DSSE envelope
+	Signed      []byte // the exact bytes signed, nil for KindMessage
+	Digest      []byte // SHA-256 of what was signed
+	Signature   []byte
+
+	Certificate *x509.Certificate // nil if signed with a plain key
+	Chain       []*x509.Certificate
+	Entry       *LogEntry
+	Timestamps  [][]byte // RFC 3161 responses
+}
+
+// LogEntry is a Rekor entry with the signed promise to include it.
+type LogEntry struct {
+	Body           []byte // canonicalized entry
+	IntegratedTime int64
+	LogIndex       int64
+	LogID          string // hex
+	SET            []byte
+}
+
+// pae is DSSE's pre-authentication encoding, what an envelope's
+// signatures actually sign.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+type envelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     []byte `json:"payload"`
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   []byte `json:"sig"`
+	} `json:"signatures"`
+}
+
+func (s *Signature) setEnvelope(env *envelope) error {
+	if len(env.Signatures) == 0 {
+		return fmt.Errorf("envelope has no signatures")
+	}
+	s.Kind = KindDSSE
+	s.Payload = env.Payload
+	s.PayloadType = env.PayloadType
+	s.Signed = pae(env.PayloadType, env.Payload)
+	sum := sha256.Sum256(s.Signed)
+	s.Digest = sum[:]
+	s.Signature = env.Signatures[0].Sig
+	return nil
+}
+
+func parsePEMCerts(s string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// legacyBundle is the dev.sigstore.cosign/bundle annotation.
+type legacyBundle struct {
+	SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+	Payload              struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogIndex       int64  `json:"logIndex"`
+		LogID          string `json:"logID"`
+	} `json:"Payload"`
+}
+
+// FromLayer reads a signature from a layer of a cosign .sig or .att
+// manifest: blob is the layer, of mediaType, and annotations its
+// annotations.
+func FromLayer(mediaType string, blob []byte, annotations map[string]string) (*Signature, error) {
+	s := &Signature{}
+	if mediaType == DSSEMediaType {
+		var env envelope
+		if err := json.Unmarshal(blob, &env); err != nil {
+			return nil, fmt.Errorf("envelope: %w", err)
+		}
+		if err := s.setEnvelope(&env); err != nil {
+			return nil, err
+		}
+	} else {
+		s.Kind = KindSimpleSigning
+		s.Payload = blob
+		s.Signed = blob
+		sum := sha256.Sum256(blob)
+		s.Digest = sum[:]
+		sig, err := base64.StdEncoding.DecodeString(annotations[SignatureAnnotation])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", SignatureAnnotation, err)
+		}
+		s.Signature = sig
+	}
+	if len(s.Signature) == 0 {
+		return nil, fmt.Errorf("no signature")
+	}
+
+	if pemCert := annotations[CertificateAnnotation]; pemCert != "" {
+		certs, err := parsePEMCerts(pemCert)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", CertificateAnnotation, err)
+		}
+		if len(certs) != 0 {
+			s.Certificate = certs[0]
+		}
+	}
+	if chain := annotations[ChainAnnotation]; chain != "" {
+		certs, err := parsePEMCerts(chain)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ChainAnnotation, err)
+		}
+		s.Chain = certs
+	}
+
+	if b := annotations[BundleAnnotation]; b != "" {
+		var lb legacyBundle
+		if err := json.Unmarshal([]byte(b), &lb); err != nil {
+			return nil, fmt.Errorf("%s: %w", BundleAnnotation, err)
+		}
+		body, err := base64.StdEncoding.DecodeString(lb.Payload.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: body: %w", BundleAnnotation, err)
+		}
+		s.Entry = &LogEntry{
+			Body:           body,
+			IntegratedTime: lb.Payload.IntegratedTime,
+			LogIndex:       lb.Payload.LogIndex,
+			LogID:          lb.Payload.LogID,
+			SET:            lb.SignedEntryTimestamp,
+		}
+	}
+
+	if ts := annotations[TimestampAnnotation]; ts != "" {
+		var t struct {
+			SignedRFC3161Timestamp []byte `json:"SignedRFC3161Timestamp"`
+		}
+		if err := json.Unmarshal([]byte(ts), &t); err != nil {
+			return nil, fmt.Errorf("%s: %w", TimestampAnnotation, err)
+		}
+		s.Timestamps = append(s.Timestamps, t.SignedRFC3161Timestamp)
+	}
+	return s, nil
+}
+
+// pbInt is an int64 in protobuf's JSON, which is usually a string.
+type pbInt int64
+
+func (p *pbInt) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	*p = pbInt(n)
+	return err
+}
+
+type rawCert struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+type bundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		Certificate          *rawCert `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []rawCert `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []struct {
+			LogIndex pbInt `json:"logIndex"`
+			LogID    struct {
+				KeyID []byte `json:"keyId"`
+			} `json:"logId"`
+			IntegratedTime   pbInt `json:"integratedTime"`
+			InclusionPromise *struct {
+				SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+			} `json:"inclusionPromise"`
+			CanonicalizedBody []byte `json:"canonicalizedBody"`
+		} `json:"tlogEntries"`
+		TimestampVerificationData *struct {
+			RFC3161Timestamps []struct {
+				SignedTimestamp []byte `json:"signedTimestamp"`
+			} `json:"rfc3161Timestamps"`
+		} `json:"timestampVerificationData"`
+	} `json:"verificationMaterial"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+	DSSEEnvelope *envelope `json:"dsseEnvelope"`
+}
+
+// ParseBundle reads a Sigstore bundle (v0.1 to v0.3).
+func ParseBundle(b []byte) (*Signature, error) {
+	var bun bundle
+	if err := json.Unmarshal(b, &bun); err != nil {
+		return nil, err
+	}
+	if !IsBundle(bun.MediaType) {
+		return nil, fmt.Errorf("not a Sigstore bundle: %q", bun.MediaType)
+	}
+
+	s := &Signature{}
+	switch {
+	case bun.DSSEEnvelope != nil:
+		if err := s.setEnvelope(bun.DSSEEnvelope); err != nil {
+			return nil, err
+		}
+	case bun.MessageSignature != nil:
+		ms := bun.MessageSignature
+		if ms.MessageDigest.Algorithm != "SHA2_256" {
+			return nil, fmt.Errorf("unsupported message digest %q", ms.MessageDigest.Algorithm)
+		}
+		s.Kind = KindMessage
+		s.Digest = ms.MessageDigest.Digest
+		s.Signature = ms.Signature
+	default:
+		return nil, fmt.Errorf("bundle has neither a message signature nor an envelope")
+	}
+
+	vm := bun.VerificationMaterial
+	var raws []rawCert
+	if vm.Certificate != nil {
+		raws = append(raws, *vm.Certificate)
+	} else if vm.X509CertificateChain != nil {
+		raws = vm.X509CertificateChain.Certificates
+	}
+	for i, rc := range raws {
+		cert, err := x509.ParseCertificate(rc.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("certificate: %w", err)
+		}
+		if i == 0 {
+			s.Certificate = cert
+		} else {
+			s.Chain = append(s.Chain, cert)
+		}
+	}
+
+	if len(vm.TlogEntries) != 0 {
+		e := vm.TlogEntries[0]
+		s.Entry = &LogEntry{
+			Body:           e.CanonicalizedBody,
+			IntegratedTime: int64(e.IntegratedTime),
+			LogIndex:       int64(e.LogIndex),
+			LogID:          hex.EncodeToString(e.LogID.KeyID),
+		}
+		if e.InclusionPromise != nil {
+			s.Entry.SET = e.InclusionPromise.SignedEntryTimestamp
+		}
+	}
+	if tvd := vm.TimestampVerificationData; tvd != nil {
+		for _, ts := range tvd.RFC3161Timestamps {
+			s.Timestamps = append(s.Timestamps, ts.SignedTimestamp)
+		}
+	}
+	return s, nil
+}
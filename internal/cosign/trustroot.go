@@ -0,0 +1,176 @@
+// Package cosign checks cosign and Sigstore signatures without going
+// online: everything is checked against a trusted root loaded from disk.
+package cosign
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TrustedRoot is what signatures are checked against, read from a
+// Sigstore trusted_root.json: the public good instance's comes from
+// https://github.com/sigstore/root-signing, and "cosign trusted-root
+// create" makes one for a private deployment.
+type TrustedRoot struct {
+	CAs  []*Authority // Fulcio
+	TSAs []*Authority // RFC 3161 timestamp authorities
+	Logs map[string]*TransparencyLog
+}
+
+// Authority is a certificate authority, with its chain ending in a root.
+type Authority struct {
+	URI           string
+	Root          *x509.Certificate
+	Intermediates []*x509.Certificate
+	Leaf          *x509.Certificate // a TSA's signing certificate, if given
+	validity
+}
+
+// TransparencyLog is a Rekor instance.
+type TransparencyLog struct {
+	BaseURL   string
+	ID        string // hex SHA-256 of its public key
+	PublicKey crypto.PublicKey
+	validity
+}
+
+type validity struct {
+	Start, End time.Time // zero if open-ended
+}
+
+func (v validity) covers(t time.Time) bool {
+	return (v.Start.IsZero() || !t.Before(v.Start)) && (v.End.IsZero() || !t.After(v.End))
+}
+
+type rawValidity struct {
+	Start *time.Time `json:"start"`
+	End   *time.Time `json:"end"`
+}
+
+func (r *rawValidity) validity() validity {
+	var v validity
+	if r == nil {
+		return v
+	}
+	if r.Start != nil {
+		v.Start = *r.Start
+	}
+	if r.End != nil {
+		v.End = *r.End
+	}
+	return v
+}
+
+type rawAuthority struct {
+	URI       string `json:"uri"`
+	CertChain struct {
+		Certificates []struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificates"`
+	} `json:"certChain"`
+	ValidFor *rawValidity `json:"validFor"`
+}
+
+type rawLog struct {
+	BaseURL   string `json:"baseUrl"`
+	PublicKey struct {
+		RawBytes []byte       `json:"rawBytes"`
+		ValidFor *rawValidity `json:"validFor"`
+	} `json:"publicKey"`
+	LogID struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+}
+
+type rawTrustedRoot struct {
+	MediaType string         `json:"mediaType"`
+	Tlogs     []rawLog       `json:"tlogs"`
+	CAs       []rawAuthority `json:"certificateAuthorities"`
+	TSAs      []rawAuthority `json:"timestampAuthorities"`
+}
+
+// LoadTrustedRoot reads a trusted_root.json.
+func LoadTrustedRoot(path string) (*TrustedRoot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTrustedRoot(b)
+}
+
+// ParseTrustedRoot parses the contents of a trusted_root.json.
+func ParseTrustedRoot(b []byte) (*TrustedRoot, error) {
+	var raw rawTrustedRoot
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	tr := &TrustedRoot{Logs: map[string]*TransparencyLog{}}
+	for _, l := range raw.Tlogs {
+		pub, err := x509.ParsePKIXPublicKey(l.PublicKey.RawBytes)
+		if err != nil {
+			return nil, fmt.Errorf("tlog %s: %w", l.BaseURL, err)
+		}
+		id := l.LogID.KeyID
+		if len(id) == 0 {
+			sum := sha256.Sum256(l.PublicKey.RawBytes)
+			id = sum[:]
+		}
+		log := &TransparencyLog{
+			BaseURL:   l.BaseURL,
+			ID:        hex.EncodeToString(id),
+			PublicKey: pub,
+			validity:  l.PublicKey.ValidFor.validity(),
+		}
+		tr.Logs[log.ID] = log
+	}
+
+	var err error
+	if tr.CAs, err = authorities(raw.CAs, false); err != nil {
+		return nil, err
+	}
+	if tr.TSAs, err = authorities(raw.TSAs, true); err != nil {
+		return nil, err
+	}
+	if len(tr.CAs) == 0 && len(tr.Logs) == 0 && len(tr.TSAs) == 0 {
+		return nil, fmt.Errorf("no certificate authorities, transparency logs or timestamp authorities in trusted root")
+	}
+	return tr, nil
+}
+
+// authorities parses each chain, which is in leaf to root order. A TSA's
+// chain starts with the certificate it signs timestamps with.
+func authorities(raws []rawAuthority, tsa bool) ([]*Authority, error) {
+	var as []*Authority
+	for _, ra := range raws {
+		var certs []*x509.Certificate
+		for _, c := range ra.CertChain.Certificates {
+			cert, err := x509.ParseCertificate(c.RawBytes)
+			if err != nil {
+				return nil, fmt.Errorf("authority %s: %w", ra.URI, err)
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("authority %s has no certificates", ra.URI)
+		}
+		a := &Authority{
+			URI:      ra.URI,
+			Root:     certs[len(certs)-1],
+			validity: ra.ValidFor.validity(),
+		}
+		rest := certs[:len(certs)-1]
+		if tsa && len(rest) != 0 {
+			a.Leaf, rest = rest[0], rest[1:]
+		}
+		a.Intermediates = rest
+		as = append(as, a)
+	}
+	return as, nil
+}
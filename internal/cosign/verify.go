@@ -0,0 +1,475 @@
+package cosign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+)
+
+// The checks Verify makes, in the order it reports them.
+const (
+	CheckSignature = "signature"
+	CheckSubject   = "subject"
+	CheckChain     = "certificate chain"
+	CheckLog       = "transparency log"
+	CheckTimestamp = "timestamp"
+)
+
+// Check is the outcome of one step of verifying a signature.
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Identity is who a Fulcio certificate was issued to.
+type Identity struct {
+	SAN    string `json:"san"`              // email address or URI, e.g. a GitHub workflow
+	Issuer string `json:"issuer,omitempty"` // OIDC issuer that vouched for them
+}
+
+// Result is what Verify found.
+type Result struct {
+	Identity *Identity `json:"identity,omitempty"`
+	Checks   []Check   `json:"checks"`
+}
+
+// OK reports whether every check passed.
+func (r *Result) OK() bool {
+	for _, c := range r.Checks {
+		if !c.OK {
+			return false
+		}
+	}
+	return len(r.Checks) != 0
+}
+
+var errNoRoot = errors.New("no trusted root configured")
+
+// Fulcio's certificate extensions for the OIDC issuer.
+var (
+	oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Verify checks s against root, which may be nil to check just the
+// signature itself. If subject, a digest like "sha256:...", isn't empty,
+// s must be a signature of it.
+func Verify(s *Signature, root *TrustedRoot, subject string) *Result {
+	res := &Result{Checks: []Check{}}
+	add := func(name string, err error, detail string) {
+		if err != nil {
+			detail = err.Error()
+		}
+		res.Checks = append(res.Checks, Check{name, err == nil, detail})
+	}
+
+	if s.Certificate == nil {
+		add(CheckSignature, errors.New("signed with a key rather than a certificate, so there's nothing to check it against"), "")
+	} else {
+		res.Identity = identity(s.Certificate)
+		add(CheckSignature, verifySignature(s.Certificate.PublicKey, s.Signed, s.Digest, s.Signature), "signed by the certificate's key")
+	}
+
+	if subject != "" {
+		detail, err := checkSubject(s, subject)
+		add(CheckSubject, err, detail)
+	}
+
+	// Fulcio certificates only last minutes, so the chain is checked at
+	// whatever times the log and timestamps vouch for.
+	var times []time.Time
+	var later []Check
+	if s.Entry == nil {
+		later = append(later, Check{CheckLog, false, "no transparency log entry"})
+	} else if t, detail, err := verifyEntry(s, root); err != nil {
+		later = append(later, Check{CheckLog, false, err.Error()})
+	} else {
+		times = append(times, t)
+		later = append(later, Check{CheckLog, true, detail})
+	}
+	for _, ts := range s.Timestamps {
+		if t, detail, err := verifyTimestamp(ts, s.Signature, root); err != nil {
+			later = append(later, Check{CheckTimestamp, false, err.Error()})
+		} else {
+			times = append(times, t)
+			later = append(later, Check{CheckTimestamp, true, detail})
+		}
+	}
+
+	if s.Certificate != nil {
+		detail, err := verifyChain(s.Certificate, s.Chain, root, times)
+		add(CheckChain, err, detail)
+	}
+	res.Checks = append(res.Checks, later...)
+	return res
+}
+
+func identity(cert *x509.Certificate) *Identity {
+	id := &Identity{}
+	switch {
+	case len(cert.EmailAddresses) != 0:
+		id.SAN = cert.EmailAddresses[0]
+	case len(cert.URIs) != 0:
+		id.SAN = cert.URIs[0].String()
+	}
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var s string
+			if _, err := asn1.Unmarshal(ext.Value, &s); err == nil {
+				id.Issuer = s
+			}
+		case ext.Id.Equal(oidIssuerV1) && id.Issuer == "":
+			id.Issuer = string(ext.Value)
+		}
+	}
+	return id
+}
+
+// verifySignature checks sig over msg with pub. msg may be nil if only its
+// SHA-256 digest is known, which is enough for ECDSA and RSA.
+func verifySignature(pub crypto.PublicKey, msg, digest, sig []byte) error {
+	hashed := func(h crypto.Hash) ([]byte, error) {
+		if msg != nil {
+			hh := h.New()
+			hh.Write(msg)
+			return hh.Sum(nil), nil
+		}
+		if h == crypto.SHA256 && digest != nil {
+			return digest, nil
+		}
+		return nil, fmt.Errorf("need the signed message to check a %v signature", h)
+	}
+
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		h := crypto.SHA256
+		switch k.Curve.Params().BitSize {
+		case 384:
+			h = crypto.SHA384
+		case 521:
+			h = crypto.SHA512
+		}
+		d, err := hashed(h)
+		if err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(k, d, sig) {
+			return errors.New("ECDSA signature doesn't match")
+		}
+	case *rsa.PublicKey:
+		d, err := hashed(crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, d, sig) != nil && rsa.VerifyPSS(k, crypto.SHA256, d, sig, nil) != nil {
+			return errors.New("RSA signature doesn't match")
+		}
+	case ed25519.PublicKey:
+		if msg == nil {
+			return errors.New("need the signed message to check an Ed25519 signature")
+		}
+		if !ed25519.Verify(k, msg, sig) {
+			return errors.New("Ed25519 signature doesn't match")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+	return nil
+}
+
+func checkSubject(s *Signature, subject string) (string, error) {
+	switch s.Kind {
+	case KindSimpleSigning:
+		var ss struct {
+			Critical struct {
+				Image struct {
+					Digest string `json:"docker-manifest-digest"`
+				} `json:"image"`
+			} `json:"critical"`
+		}
+		if err := json.Unmarshal(s.Payload, &ss); err != nil {
+			return "", fmt.Errorf("payload: %w", err)
+		}
+		if got := ss.Critical.Image.Digest; got != subject {
+			return "", fmt.Errorf("payload is for %s", got)
+		}
+		return "payload names " + subject, nil
+	case KindDSSE:
+		var st struct {
+			Subject []struct {
+				Digest map[string]string `json:"digest"`
+			} `json:"subject"`
+		}
+		if err := json.Unmarshal(s.Payload, &st); err != nil {
+			return "", fmt.Errorf("payload: %w", err)
+		}
+		for _, sub := range st.Subject {
+			for alg, hex := range sub.Digest {
+				if alg+":"+hex == subject {
+					return "statement is about " + subject, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("statement isn't about %s", subject)
+	}
+	if got := "sha256:" + hex.EncodeToString(s.Digest); got != subject {
+		return "", fmt.Errorf("signs %s", got)
+	}
+	return "signs " + subject, nil
+}
+
+// verifyEntry checks the log's signed promise to include s, and that the
+// entry is really for s.
+func verifyEntry(s *Signature, root *TrustedRoot) (time.Time, string, error) {
+	e := s.Entry
+	if root == nil {
+		return time.Time{}, "", errNoRoot
+	}
+	log, ok := root.Logs[e.LogID]
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("log %s isn't in the trusted root", e.LogID)
+	}
+	if len(e.SET) == 0 {
+		return time.Time{}, "", errors.New("no signed entry timestamp")
+	}
+
+	// What the log signed, as canonical JSON.
+	canonical, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{base64.StdEncoding.EncodeToString(e.Body), e.IntegratedTime, e.LogID, e.LogIndex})
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if err := verifySignature(log.PublicKey, canonical, nil, e.SET); err != nil {
+		return time.Time{}, "", fmt.Errorf("signed entry timestamp: %w", err)
+	}
+
+	t := time.Unix(e.IntegratedTime, 0).UTC()
+	if !log.covers(t) {
+		return time.Time{}, "", fmt.Errorf("log key wasn't valid at %s", t.Format(time.RFC3339))
+	}
+	if err := entryMatches(e.Body, s); err != nil {
+		return time.Time{}, "", err
+	}
+	return t, fmt.Sprintf("%s entry %d, integrated %s", log.BaseURL, e.LogIndex, t.Format(time.RFC3339)), nil
+}
+
+// entryHash is how log entries name a digest.
+type entryHash struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+// entrySignature is one of an intoto or dsse entry's signatures. intoto
+// calls the fields sig and publicKey, dsse signature and verifier.
+type entrySignature struct {
+	Sig       []byte `json:"sig"`
+	PublicKey []byte `json:"publicKey"`
+	Signature []byte `json:"signature"`
+	Verifier  []byte `json:"verifier"`
+}
+
+// entryMatches checks that a log entry records s, not some other
+// signature.
+func entryMatches(body []byte, s *Signature) error {
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			// hashedrekord
+			Data struct {
+				Hash entryHash `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+
+			// intoto
+			Content struct {
+				Envelope struct {
+					Signatures []entrySignature `json:"signatures"`
+				} `json:"envelope"`
+				PayloadHash entryHash `json:"payloadHash"`
+			} `json:"content"`
+
+			// dsse
+			Signatures  []entrySignature `json:"signatures"`
+			PayloadHash entryHash        `json:"payloadHash"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return fmt.Errorf("log entry: %w", err)
+	}
+
+	switch entry.Kind {
+	case "hashedrekord":
+		if h := entry.Spec.Data.Hash; h.Algorithm != "sha256" || h.Value != hex.EncodeToString(s.Digest) {
+			return fmt.Errorf("log entry is for %s:%s", h.Algorithm, h.Value)
+		}
+		if !bytes.Equal(entry.Spec.Signature.Content, s.Signature) {
+			return errors.New("log entry is for a different signature")
+		}
+		return keyMatches(entry.Spec.Signature.PublicKey.Content, s)
+
+	case "intoto", "dsse":
+		if s.Kind != KindDSSE {
+			return fmt.Errorf("%s log entry is for an envelope, not a %s signature", entry.Kind, s.Kind)
+		}
+		sigs, h := entry.Spec.Signatures, entry.Spec.PayloadHash
+		if entry.Kind == "intoto" {
+			sigs, h = entry.Spec.Content.Envelope.Signatures, entry.Spec.Content.PayloadHash
+		}
+		sum := sha256.Sum256(s.Payload)
+		if h.Algorithm != "sha256" || h.Value != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("log entry is for a payload with %s:%s", h.Algorithm, h.Value)
+		}
+		// intoto entries base64 encode the envelope's already base64
+		// encoded signature again.
+		once := base64.StdEncoding.EncodeToString(s.Signature)
+		for _, es := range sigs {
+			sig, key := es.Signature, es.Verifier
+			if entry.Kind == "intoto" {
+				sig, key = es.Sig, es.PublicKey
+			}
+			if bytes.Equal(sig, s.Signature) || string(sig) == once {
+				return keyMatches(key, s)
+			}
+		}
+		return fmt.Errorf("%s log entry is for a different signature", entry.Kind)
+	}
+	return fmt.Errorf("unsupported log entry kind %q", entry.Kind)
+}
+
+// keyMatches checks that key, the PEM public key or certificate a log
+// entry records, is what s was signed with.
+func keyMatches(key []byte, s *Signature) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return errors.New("log entry has no PEM public key")
+	}
+	if s.Certificate != nil && !bytes.Equal(block.Bytes, s.Certificate.Raw) {
+		return errors.New("log entry is for a different certificate")
+	}
+	return nil
+}
+
+// verifyTimestamp checks an RFC 3161 timestamp of sig against the
+// trusted root's timestamp authorities.
+func verifyTimestamp(resp, sig []byte, root *TrustedRoot) (time.Time, string, error) {
+	ts, err := timestamp.ParseResponse(resp)
+	if err != nil {
+		// Some carry just the token.
+		if ts, err = timestamp.Parse(resp); err != nil {
+			return time.Time{}, "", err
+		}
+	}
+	if !ts.HashAlgorithm.Available() {
+		return time.Time{}, "", fmt.Errorf("unsupported hash %v", ts.HashAlgorithm)
+	}
+	h := ts.HashAlgorithm.New()
+	h.Write(sig)
+	if !bytes.Equal(h.Sum(nil), ts.HashedMessage) {
+		return time.Time{}, "", errors.New("timestamp is of something other than the signature")
+	}
+	if root == nil {
+		return time.Time{}, "", errNoRoot
+	}
+
+	p7, err := pkcs7.Parse(ts.RawToken)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	embedded := p7.Certificates
+	err = errors.New("no timestamp authority in the trusted root")
+	for _, a := range root.TSAs {
+		if !a.covers(ts.Time) {
+			continue
+		}
+		p7.Certificates = slices.Clone(embedded)
+		if a.Leaf != nil {
+			p7.Certificates = append(p7.Certificates, a.Leaf)
+		}
+		p7.Certificates = append(p7.Certificates, a.Intermediates...)
+
+		opts := x509.VerifyOptions{
+			Roots:         certPool(a.Root),
+			Intermediates: certPool(a.Intermediates...),
+			CurrentTime:   ts.Time,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		}
+		if err = p7.VerifyWithOpts(opts); err == nil {
+			t := ts.Time.UTC()
+			return t, fmt.Sprintf("%s at %s", a.URI, t.Format(time.RFC3339)), nil
+		}
+	}
+	return time.Time{}, "", err
+}
+
+// verifyChain checks that cert was issued by one of the trusted root's
+// CAs and was valid at each of times.
+func verifyChain(cert *x509.Certificate, chain []*x509.Certificate, root *TrustedRoot, times []time.Time) (string, error) {
+	if root == nil {
+		return "", errNoRoot
+	}
+	at := cert.NotBefore
+	if len(times) != 0 {
+		at = times[0]
+	}
+
+	err := fmt.Errorf("no certificate authority in the trusted root was valid at %s", at.Format(time.RFC3339))
+	for _, ca := range root.CAs {
+		if !ca.covers(at) {
+			continue
+		}
+		opts := x509.VerifyOptions{
+			Roots:         certPool(ca.Root),
+			Intermediates: certPool(append(slices.Clone(ca.Intermediates), chain...)...),
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}
+		if _, err = cert.Verify(opts); err != nil {
+			continue
+		}
+		if len(times) == 0 {
+			return "", fmt.Errorf("issued by %s, but neither a log entry nor a timestamp proves it was used while valid", ca.URI)
+		}
+		for _, t := range times[1:] {
+			if t.Before(cert.NotBefore) || t.After(cert.NotAfter) {
+				return "", fmt.Errorf("issued by %s, but also vouched for at %s, when it wasn't valid", ca.URI, t.Format(time.RFC3339))
+			}
+		}
+		return fmt.Sprintf("issued by %s, valid at %s", ca.URI, at.Format(time.RFC3339)), nil
+	}
+	return "", err
+}
+
+func certPool(certs ...*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool
+}
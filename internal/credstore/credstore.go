@@ -0,0 +1,295 @@
+// Package credstore keeps registry credentials in a file encrypted with a
+// passphrase or key file, and hands them out as an authn.Keychain.
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/authn"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Kinds of credential.
+const (
+	KindBasic         = "basic"          // username and password
+	KindIdentityToken = "identity-token" // a refresh token exchanged for bearer tokens
+	KindBearer        = "bearer"         // a registry token sent as is
+)
+
+// Entry is the credential for every repository under Match, which is a
+// registry host or a repository prefix like ghcr.io/org.
+type Entry struct {
+	Match    string `json:"match"`
+	Kind     string `json:"kind"`
+	Username string `json:"username,omitempty"`
+	Secret   string `json:"secret"` // password or token
+	Note     string `json:"note,omitempty"`
+}
+
+// Validate checks e and normalizes its Match, so index.docker.io and
+// docker.io are the same thing.
+func (e *Entry) Validate() error {
+	m, err := normalize(e.Match)
+	if err != nil {
+		return err
+	}
+	e.Match = m
+	switch e.Kind {
+	case KindBasic:
+		if e.Username == "" {
+			return fmt.Errorf("%s: basic credentials need a username", e.Match)
+		}
+	case KindIdentityToken, KindBearer:
+	default:
+		return fmt.Errorf("%s: unknown kind %q", e.Match, e.Kind)
+	}
+	if e.Secret == "" {
+		return fmt.Errorf("%s: no secret", e.Match)
+	}
+	return nil
+}
+
+func normalize(match string) (string, error) {
+	match = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(match), "https://"), "/")
+	if match == "" {
+		return "", fmt.Errorf("empty match")
+	}
+	if !strings.Contains(match, "/") {
+		reg, err := name.NewRegistry(match)
+		if err != nil {
+			return "", err
+		}
+		return reg.Name(), nil
+	}
+	repo, err := name.NewRepository(match)
+	if err != nil {
+		return "", err
+	}
+	return repo.Name(), nil
+}
+
+func (e *Entry) authenticator() authn.Authenticator {
+	switch e.Kind {
+	case KindIdentityToken:
+		return authn.FromConfig(authn.AuthConfig{Username: e.Username, IdentityToken: e.Secret})
+	case KindBearer:
+		return &authn.Bearer{Token: e.Secret}
+	}
+	return &authn.Basic{Username: e.Username, Password: e.Secret}
+}
+
+// scrypt parameters for new files; the ones a file was written with are
+// kept in it.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32
+)
+
+// file is what's on disk: everything but the KDF parameters is sealed.
+type file struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Store is an encrypted credential file, loaded into memory.
+type Store struct {
+	path   string
+	secret []byte
+
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+// Open decrypts the store at path with secret, a passphrase or the
+// contents of a key file. A missing file is an empty store, created on the
+// first Put.
+func Open(path string, secret []byte) (*Store, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("no passphrase or key")
+	}
+	s := &Store{path: path, secret: secret, entries: []Entry{}}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Version != 1 || f.KDF != "scrypt" {
+		return nil, fmt.Errorf("%s: unsupported version %d (%s)", path, f.Version, f.KDF)
+	}
+	aead, err := newAEAD(secret, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase or key, or the file is corrupt", path)
+	}
+	if err := json.Unmarshal(plain, &s.entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ReadKeyFile reads a key file, without a trailing newline.
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(b), "\r\n")), nil
+}
+
+func newAEAD(secret, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(secret, salt, n, r, p, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// save seals entries with a fresh salt and nonce, replaces the file with
+// them and, if that worked, makes them the store's. The caller holds s.mu.
+func (s *Store) save(entries []Entry) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	f := file{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(s.secret, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plain, nil)
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.entries = entries
+	return nil
+}
+
+// Entries returns every entry, sorted by Match.
+func (s *Store) Entries() []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := slices.Clone(s.entries)
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Match, b.Match) })
+	return entries
+}
+
+// Put adds e, replacing any entry with the same Match, and saves the store.
+func (s *Store) Put(e Entry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := slices.DeleteFunc(slices.Clone(s.entries), func(old Entry) bool { return old.Match == e.Match })
+	return s.save(append(entries, e))
+}
+
+// Delete removes the entry for match and saves the store.
+func (s *Store) Delete(match string) error {
+	m, err := normalize(match)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := slices.DeleteFunc(slices.Clone(s.entries), func(e Entry) bool { return e.Match == m })
+	if len(entries) == len(s.entries) {
+		return fmt.Errorf("no credentials for %s", m)
+	}
+	return s.save(entries)
+}
+
+// Lookup returns the entry with the longest Match covering target, a
+// registry or repository name.
+func (s *Store) Lookup(target string) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var (
+		best  Entry
+		found bool
+	)
+	for _, e := range s.entries {
+		if target != e.Match && !strings.HasPrefix(target, e.Match+"/") {
+			continue
+		}
+		if !found || len(e.Match) > len(best.Match) {
+			best, found = e, true
+		}
+	}
+	return best, found
+}
+
+// Resolve implements authn.Keychain.
+func (s *Store) Resolve(r authn.Resource) (authn.Authenticator, error) {
+	// A Repository's String is whatever it was parsed from, e.g. "busybox".
+	target := r.RegistryStr()
+	if repo, ok := r.(name.Repository); ok {
+		target = repo.Name()
+	}
+	if e, ok := s.Lookup(target); ok {
+		return e.authenticator(), nil
+	}
+	return authn.Anonymous, nil
+}
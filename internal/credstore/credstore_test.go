@@ -0,0 +1,105 @@
+package credstore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/authn"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	s, err := Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Entry{
+		{Match: "ghcr.io", Kind: KindBasic, Username: "alice", Secret: "ghp_one"},
+		{Match: "ghcr.io/acme", Kind: KindBasic, Username: "bob", Secret: "ghp_two"},
+		{Match: "https://quay.io/", Kind: KindBearer, Secret: "quaytoken"},
+		{Match: "docker.io", Kind: KindIdentityToken, Username: "<token>", Secret: "refresh"},
+	} {
+		if err := s.Put(e); err != nil {
+			t.Fatalf("Put(%s): %v", e.Match, err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "ghp_one") || strings.Contains(string(b), "alice") {
+		t.Errorf("store file has credentials in the clear: %s", b)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	if _, err := Open(path, []byte("wrong horse")); err == nil {
+		t.Errorf("Open with the wrong passphrase succeeded")
+	}
+	s, err = Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ref  string
+		want authn.AuthConfig
+	}{
+		{"ghcr.io/other/app", authn.AuthConfig{Username: "alice", Password: "ghp_one"}},
+		{"ghcr.io/acme/app", authn.AuthConfig{Username: "bob", Password: "ghp_two"}},
+		{"ghcr.io/acmecorp/app", authn.AuthConfig{Username: "alice", Password: "ghp_one"}},
+		{"quay.io/org/app", authn.AuthConfig{RegistryToken: "quaytoken"}},
+		{"busybox", authn.AuthConfig{Username: "<token>", IdentityToken: "refresh"}},
+		{"gcr.io/proj/app", authn.AuthConfig{}},
+	} {
+		repo, err := name.NewRepository(tc.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := s.Resolve(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := auth.Authorization()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != tc.want {
+			t.Errorf("Resolve(%s) = %+v, want %+v", tc.ref, *got, tc.want)
+		}
+	}
+
+	if err := s.Delete("ghcr.io/acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("ghcr.io/acme"); err == nil {
+		t.Errorf("deleting twice succeeded")
+	}
+	var matches []string
+	for _, e := range s.Entries() {
+		matches = append(matches, e.Match)
+	}
+	if got, want := strings.Join(matches, ","), "ghcr.io,index.docker.io,quay.io"; got != want {
+		t.Errorf("Entries() = %s, want %s", got, want)
+	}
+}
+
+func TestEntryValidate(t *testing.T) {
+	for _, e := range []Entry{
+		{Match: "", Kind: KindBearer, Secret: "x"},
+		{Match: "ghcr.io", Kind: KindBasic, Secret: "x"},
+		{Match: "ghcr.io", Kind: "oauth", Secret: "x"},
+		{Match: "ghcr.io", Kind: KindBearer},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", e)
+		}
+	}
+}
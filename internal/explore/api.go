@@ -0,0 +1,68 @@
+package explore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Every view answers Accept: application/json (or ?format=json) with one of
+// the types below instead of HTML. Scripts depend on these field names, so
+// only ever add to them.
+//
+// Directory listings (/fs/, /layers/, /size/, /sizes/) are served by the
+// forked http package as httpserve.Listing, and single files there as
+// httpserve.Entry.
+
+type (
+	Listing = httpserve.Listing
+	Entry   = httpserve.Entry
+)
+
+// RepoJSON is /?repo= for a repository, a registry catalog or a Docker Hub
+// namespace.
+type RepoJSON struct {
+	Repository   string   `json:"repository"`
+	Tags         []string `json:"tags,omitempty"`
+	Children     []string `json:"children,omitempty"`     // nested repositories, where the registry reports them
+	Repositories []string `json:"repositories,omitempty"` // for catalogs and Docker Hub namespaces
+	Next         string   `json:"next,omitempty"`         // pass back as ?next= for the next page
+	Error        string   `json:"error,omitempty"`        // set when this is a partial listing
+}
+
+// ManifestJSON is /?image=.
+type ManifestJSON struct {
+	Reference string          `json:"reference"`
+	Digest    string          `json:"digest"`
+	MediaType string          `json:"mediaType"`
+	Size      int64           `json:"size"`
+	Manifest  json.RawMessage `json:"manifest"`
+
+	// Paths to the other views of this manifest, for images.
+	Layers string `json:"layers,omitempty"` // merged filesystem
+	Sizes  string `json:"sizes,omitempty"`  // every file, biggest first
+}
+
+// ReferrersJSON is /?referrers=.
+type ReferrersJSON struct {
+	Subject   string          `json:"subject"`
+	Referrers []v1.Descriptor `json:"referrers"`
+}
+
+func manifestJSON(ref, repo string, desc v1.Descriptor, manifest []byte) *ManifestJSON {
+	m := &ManifestJSON{
+		Reference: ref,
+		Digest:    desc.Digest.String(),
+		MediaType: string(desc.MediaType),
+		Size:      desc.Size,
+		Manifest:  manifest,
+	}
+	if desc.MediaType.IsImage() {
+		dig := repo + "@" + desc.Digest.String()
+		m.Layers = "/layers/" + dig + "/"
+		m.Sizes = fmt.Sprintf("/sizes/%s?mt=%s&size=%d", dig, desc.MediaType, desc.Size)
+	}
+	return m
+}
@@ -0,0 +1,297 @@
+package explore
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/internal/secrets"
+	"github.com/thesavant42/yolosint/internal/soci"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestWantsJSON(t *testing.T) {
+	for _, tc := range []struct {
+		url    string
+		accept string
+		want   bool
+	}{
+		{"/?image=busybox", "", false},
+		{"/?image=busybox", "text/html,application/xhtml+xml", false},
+		{"/?image=busybox", "application/json", true},
+		{"/?image=busybox", "text/html, application/json;q=0.9", true},
+		{"/?image=busybox&format=json", "", true},
+		{"/?image=busybox&format=json", "text/html", true},
+		{"/?image=busybox&format=html", "application/json", false},
+		{"/?image=busybox&format=csv", "application/json", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		if got := wantsJSON(r); got != tc.want {
+			t.Errorf("wantsJSON(%s, Accept: %q) = %v, want %v", tc.url, tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestJSONViews(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	ref, err := name.ParseReference(host + "/acme/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgType, err := img.MediaType()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgSize, err := img.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        img,
+		Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+	})
+	idxRef := ref.Context().Tag("multi")
+	if err := remote.WriteIndex(idxRef, idx); err != nil {
+		t.Fatal(err)
+	}
+	idxDigest, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idxSize, err := idx.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handler{
+		profiles:  builtinProfiles(),
+		tocDB:     NewTocDB(filepath.Join(t.TempDir(), "log.db")),
+		manifests: map[string]*remote.Descriptor{},
+		pings:     map[string]*transport.PingResp{},
+		sawTags:   map[string][]string{},
+	}
+	defer h.tocDB.Close()
+
+	repo := ref.Context().String()
+	imgPath := repo + "@" + imgDigest.String()
+	for _, tc := range []struct {
+		url    string
+		accept string
+		want   ManifestJSON
+	}{{
+		// Images point at their filesystem and size views.
+		url: "/?image=" + ref.String() + "&format=json",
+		want: ManifestJSON{
+			Reference: ref.String(),
+			Digest:    imgDigest.String(),
+			MediaType: string(imgType),
+			Size:      imgSize,
+			Layers:    "/layers/" + imgPath + "/",
+			Sizes:     "/sizes/" + imgPath + "?mt=" + string(imgType) + "&size=" + strconv.FormatInt(imgSize, 10),
+		},
+	}, {
+		// Indexes have neither, and the Accept header is enough.
+		url:    "/?image=" + idxRef.String(),
+		accept: "application/json",
+		want: ManifestJSON{
+			Reference: idxRef.String(),
+			Digest:    idxDigest.String(),
+			MediaType: string(types.OCIImageIndex),
+			Size:      idxSize,
+		},
+	}} {
+		r := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		w := httptest.NewRecorder()
+		if err := h.renderResponse(w, r); err != nil {
+			t.Fatalf("%s: %v", tc.url, err)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q", tc.url, ct)
+		}
+		var got ManifestJSON
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v: %s", tc.url, err, w.Body.String())
+		}
+		if len(got.Manifest) == 0 || !json.Valid(got.Manifest) {
+			t.Errorf("%s: manifest = %s", tc.url, got.Manifest)
+		}
+		got.Manifest = nil
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tc.url, got, tc.want)
+		}
+	}
+
+	// Tag listings are RepoJSON.
+	w := httptest.NewRecorder()
+	if err := h.renderResponse(w, httptest.NewRequest(http.MethodGet, "/?repo="+repo+"&format=json", nil)); err != nil {
+		t.Fatal(err)
+	}
+	var rj RepoJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &rj); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if rj.Repository != repo || strings.Join(rj.Tags, " ") != "multi v1" {
+		t.Errorf("repo = %+v", rj)
+	}
+}
+
+// tarLayer is a layer of regular files, in order.
+func tarLayer(t *testing.T, files ...string) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestListingJSON(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	// The top layer deletes shadow and replaces passwd.
+	base := tarLayer(t, "etc/passwd", "etc/shadow", "etc/aws")
+	top := tarLayer(t, "etc/.wh.shadow", "etc/passwd")
+	img, err := mutate.AppendLayers(empty.Image, base, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(host + "/acme/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseDigest, err := base.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topDigest, err := top.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handler{
+		profiles:   builtinProfiles(),
+		tocDB:      NewTocDB(filepath.Join(t.TempDir(), "log.db")),
+		indexCache: &multiCache{[]cache{&dirCache{dir: t.TempDir()}}},
+		manifests:  map[string]*remote.Descriptor{},
+		pings:      map[string]*transport.PingResp{},
+		sawTags:    map[string][]string{},
+		inflight:   map[string]*soci.Indexer{},
+	}
+	defer h.tocDB.Close()
+	if err := h.tocDB.InsertFindings(baseDigest.String(), 3, map[string][]secrets.Finding{
+		"etc/aws": {{Rule: "aws-access-key", Preview: "AKIA…"}},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := ref.Context().String()
+	baseRef, topRef := repo+"@"+baseDigest.String(), repo+"@"+topDigest.String()
+	for _, tc := range []struct {
+		url    string
+		render func(http.ResponseWriter, *http.Request) error
+		want   []Entry
+	}{{
+		// The merged view keeps what later layers hid, saying which did.
+		url:    "/layers/" + repo + "@" + imgDigest.String() + "/etc/",
+		render: h.renderLayers,
+		want: []Entry{
+			{Name: "aws", Path: "/etc/aws", Layer: baseRef, Flagged: "aws-access-key"},
+			{Name: "passwd", Path: "/etc/passwd", Layer: topRef},
+			{Name: "passwd", Path: "/etc/passwd", Layer: baseRef, Overwritten: topRef},
+			{Name: "shadow", Path: "/etc/shadow", Layer: baseRef, Whiteout: "/etc/.wh.shadow"},
+		},
+	}, {
+		// A single layer has nothing to hide, and lists in tar order.
+		url:    "/fs/" + baseRef + "/etc/",
+		render: h.renderFS,
+		want: []Entry{
+			{Name: "passwd", Path: "/etc/passwd", Layer: baseRef},
+			{Name: "shadow", Path: "/etc/shadow", Layer: baseRef},
+			{Name: "aws", Path: "/etc/aws", Layer: baseRef, Flagged: "aws-access-key"},
+		},
+	}} {
+		w := httptest.NewRecorder()
+		if err := tc.render(w, httptest.NewRequest(http.MethodGet, tc.url+"?format=json", nil)); err != nil {
+			t.Fatalf("%s: %v", tc.url, err)
+		}
+		var l Listing
+		if err := json.Unmarshal(w.Body.Bytes(), &l); err != nil {
+			t.Fatalf("%s: %v: %s", tc.url, err, w.Body.String())
+		}
+		if want := strings.TrimSuffix(tc.url, "/"); l.Path != want {
+			t.Errorf("%s: path = %q, want %q", tc.url, l.Path, want)
+		}
+		got := []Entry{}
+		for _, e := range l.Entries {
+			if e.Type != "file" || e.Mode != "-rw-r--r--" || e.Size != int64(len(strings.TrimPrefix(e.Path, "/"))) {
+				t.Errorf("%s: %s = %s %s %d", tc.url, e.Path, e.Type, e.Mode, e.Size)
+			}
+			got = append(got, Entry{Name: e.Name, Path: e.Path, Layer: e.Layer, Whiteout: e.Whiteout, Overwritten: e.Overwritten, Flagged: e.Flagged})
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tc.url, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,740 @@
+package explore
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+	"github.com/thesavant42/yolosint/internal/secrets"
+)
+
+func init() {
+	httpserve.RegisterViewer("attestation", viewAttestation)
+}
+
+// Attestations bigger than this aren't worth picking apart.
+const maxAttestationSize = 16 << 20
+
+// AttestationJSON is ?render=attestation: a DSSE envelope, the in-toto
+// statement inside it, and what its predicate says.
+type AttestationJSON struct {
+	PayloadType   string               `json:"payloadType,omitempty"` // of the envelope, if there was one
+	KeyIDs        []string             `json:"keyids,omitempty"`      // one per signature, often ""
+	Signatures    int                  `json:"signatures"`
+	Type          string               `json:"type,omitempty"`
+	PredicateType string               `json:"predicateType,omitempty"`
+	Subjects      []AttestationSubject `json:"subjects,omitempty"`
+	Provenance    *Provenance          `json:"provenance,omitempty"`
+	Packages      []AttestedPackage    `json:"packages,omitempty"` // of an SPDX or CycloneDX predicate
+	Exposures     []Exposure           `json:"exposures"`
+}
+
+// AttestationSubject is an artifact the statement is about.
+type AttestationSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is SLSA v0.2 or v1 provenance, or BuildKit's buildinfo,
+// reduced to the parts worth reading.
+type Provenance struct {
+	BuilderID    string      `json:"builderId,omitempty"`
+	BuildType    string      `json:"buildType,omitempty"`
+	Frontend     string      `json:"frontend,omitempty"` // BuildKit's, e.g. "dockerfile.v0"
+	Source       string      `json:"source,omitempty"`   // repository the build came from
+	Revision     string      `json:"revision,omitempty"` // its commit
+	EntryPoint   string      `json:"entryPoint,omitempty"`
+	InvocationID string      `json:"invocationId,omitempty"`
+	StartedOn    string      `json:"startedOn,omitempty"`
+	FinishedOn   string      `json:"finishedOn,omitempty"`
+	Secrets      []string    `json:"secrets,omitempty"` // IDs of secrets mounted into the build
+	SSH          []string    `json:"ssh,omitempty"`     // IDs of forwarded SSH agents
+	Parameters   []Parameter `json:"parameters"`
+	Materials    []Material  `json:"materials"`
+}
+
+// Parameter is one build parameter, with nested objects flattened into a
+// dotted name like "request.args.build-arg:VERSION".
+type Parameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Material is something the build pulled in.
+type Material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// AttestedPackage is a package listed in an SBOM predicate.
+type AttestedPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Purl    string `json:"purl,omitempty"`
+	License string `json:"license,omitempty"`
+}
+
+// Exposure is something in an attestation that probably wasn't meant to
+// be published. Rule is a secrets rule ID or one of the rules below.
+type Exposure struct {
+	Where   string `json:"where"`
+	Rule    string `json:"rule"`
+	Preview string `json:"preview,omitempty"`
+}
+
+const (
+	ruleURLCredentials = "url-credentials"
+	ruleSecretParam    = "secret-parameter"
+)
+
+// BuildKit keeps its own metadata under this key of the SLSA metadata.
+const buildkitMetadata = "https://mobyproject.org/buildkit@v1#metadata"
+
+var secretName = regexp.MustCompile(`(?i)(secret|passw|pwd|token|auth|credential|api_?key|access_?key|private_?key)`)
+
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	} `json:"signatures"`
+}
+
+type inTotoStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []AttestationSubject `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     any                  `json:"predicate"`
+}
+
+// buildkitBuildInfo is the moby.buildkit.buildinfo.v1 of an image config,
+// which older BuildKit wrote instead of provenance.
+type buildkitBuildInfo struct {
+	Frontend string             `json:"frontend"`
+	Attrs    map[string]*string `json:"attrs"`
+	Sources  []struct {
+		Type string `json:"type"`
+		Ref  string `json:"ref"`
+		Pin  string `json:"pin"`
+	} `json:"sources"`
+}
+
+// errNotAttestation is returned for JSON that is none of the above.
+var errNotAttestation = errors.New("not a DSSE envelope, in-toto statement or BuildKit buildinfo")
+
+// parseAttestations parses every JSON document in b, which may be JSON
+// lines like an .intoto.jsonl file.
+func parseAttestations(b []byte) ([]*AttestationJSON, error) {
+	var atts []*AttestationJSON
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		att, err := parseAttestation(raw)
+		if err != nil {
+			return nil, err
+		}
+		atts = append(atts, att)
+	}
+	if len(atts) == 0 {
+		return nil, errNotAttestation
+	}
+	return atts, nil
+}
+
+// isAttestation is a quick check of whether b is worth parsing with
+// parseAttestations, going by its top-level keys.
+func isAttestation(b []byte) bool {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(b, &top); err != nil {
+		return false
+	}
+	for _, k := range []string{"payloadType", "predicateType", "moby.buildkit.buildinfo.v1"} {
+		if _, ok := top[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAttestation(b []byte) (*AttestationJSON, error) {
+	var top map[string]any
+	if err := json.Unmarshal(b, &top); err != nil {
+		return nil, err
+	}
+	att := &AttestationJSON{Exposures: []Exposure{}}
+
+	if _, ok := top["payloadType"]; ok {
+		var env dsseEnvelope
+		if err := json.Unmarshal(b, &env); err != nil {
+			return nil, err
+		}
+		payload, err := decodeBase64(env.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("payload: %w", err)
+		}
+		att.PayloadType = env.PayloadType
+		att.Signatures = len(env.Signatures)
+		for _, s := range env.Signatures {
+			att.KeyIDs = append(att.KeyIDs, s.KeyID)
+		}
+		b = payload
+		top = nil
+		if err := json.Unmarshal(b, &top); err != nil {
+			return nil, fmt.Errorf("payload: %w", err)
+		}
+	}
+
+	switch {
+	case top["predicateType"] != nil || top["_type"] != nil:
+		var st inTotoStatement
+		if err := json.Unmarshal(b, &st); err != nil {
+			return nil, err
+		}
+		att.Type = st.Type
+		att.PredicateType = st.PredicateType
+		att.Subjects = st.Subject
+		parsePredicate(att, st.PredicateType, st.Predicate)
+	case top["moby.buildkit.buildinfo.v1"] != nil:
+		s, _ := top["moby.buildkit.buildinfo.v1"].(string)
+		bi, err := decodeBase64(s)
+		if err != nil {
+			return nil, fmt.Errorf("moby.buildkit.buildinfo.v1: %w", err)
+		}
+		b = bi
+		fallthrough
+	case top["frontend"] != nil && top["sources"] != nil:
+		var bi buildkitBuildInfo
+		if err := json.Unmarshal(b, &bi); err != nil {
+			return nil, err
+		}
+		att.Provenance = buildInfoProvenance(&bi)
+	default:
+		return nil, errNotAttestation
+	}
+
+	if att.Provenance != nil {
+		att.Exposures = append(att.Exposures, provenanceExposures(att.Provenance)...)
+	}
+	for _, f := range secrets.Scan("attestation.json", b) {
+		att.Exposures = append(att.Exposures, Exposure{Where: fmt.Sprintf("offset %d", f.Offset), Rule: f.Rule, Preview: f.Preview})
+	}
+	return att, nil
+}
+
+// DSSE allows either base64 alphabet, padded or not.
+func decodeBase64(s string) ([]byte, error) {
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		var b []byte
+		if b, err = enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, err
+}
+
+func parsePredicate(att *AttestationJSON, predicateType string, pred any) {
+	switch {
+	case strings.HasPrefix(predicateType, "https://slsa.dev/provenance/v0."):
+		att.Provenance = slsa02(pred)
+	case strings.HasPrefix(predicateType, "https://slsa.dev/provenance/v1"):
+		att.Provenance = slsa1(pred)
+	case dig(pred, "spdxVersion") != nil:
+		att.Packages = spdxPackages(pred)
+	case digString(pred, "bomFormat") == "CycloneDX":
+		att.Packages = cycloneDXPackages(pred)
+	}
+}
+
+// dig walks into nested JSON objects.
+func dig(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+func digString(v any, keys ...string) string {
+	s, _ := dig(v, keys...).(string)
+	return s
+}
+
+func digList(v any, keys ...string) []any {
+	l, _ := dig(v, keys...).([]any)
+	return l
+}
+
+// flatten appends v to params with nested names joined by dots.
+func flatten(params []Parameter, name string, v any) []Parameter {
+	switch v := v.(type) {
+	case nil:
+		return params
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if k == "buildConfig" {
+				// BuildKit's LLB, thousands of lines of it.
+				continue
+			}
+			params = flatten(params, strings.TrimPrefix(name+"."+k, "."), v[k])
+		}
+		return params
+	case []any:
+		for i, e := range v {
+			params = flatten(params, fmt.Sprintf("%s[%d]", name, i), e)
+		}
+		return params
+	case string:
+		return append(params, Parameter{name, v})
+	}
+	b, _ := json.Marshal(v)
+	return append(params, Parameter{name, string(b)})
+}
+
+func gitCommit(digest any) string {
+	if c := digString(digest, "gitCommit"); c != "" {
+		return c
+	}
+	return digString(digest, "sha1")
+}
+
+func materials(list []any) []Material {
+	ms := []Material{}
+	for _, m := range list {
+		mat := Material{URI: digString(m, "uri")}
+		if d, ok := dig(m, "digest").(map[string]any); ok {
+			mat.Digest = map[string]string{}
+			for k, v := range d {
+				mat.Digest[k], _ = v.(string)
+			}
+		}
+		if mat.URI == "" {
+			mat.URI = digString(m, "name")
+		}
+		ms = append(ms, mat)
+	}
+	return ms
+}
+
+// buildkitRequest fills in what BuildKit records about how it was asked
+// to build: its frontend and the IDs of any secrets and SSH agents.
+func buildkitRequest(p *Provenance, req any) {
+	if f := digString(req, "frontend"); f != "" {
+		p.Frontend = f
+	}
+	for _, s := range digList(req, "secrets") {
+		p.Secrets = append(p.Secrets, digString(s, "id"))
+	}
+	for _, s := range digList(req, "ssh") {
+		p.SSH = append(p.SSH, digString(s, "id"))
+	}
+	if p.EntryPoint == "" {
+		p.EntryPoint = digString(req, "args", "filename")
+	}
+}
+
+// fillSource fills in the source from BuildKit's own metadata, and the
+// rest from the first git material of the same repository.
+func fillSource(p *Provenance, metadata any) {
+	if p.Source == "" {
+		p.Source = digString(metadata, buildkitMetadata, "vcs", "source")
+		p.Revision = digString(metadata, buildkitMetadata, "vcs", "revision")
+	}
+	if p.Revision != "" {
+		return
+	}
+	for _, m := range p.Materials {
+		after, ok := strings.CutPrefix(m.URI, "git+")
+		if !ok {
+			continue
+		}
+		repo, _, _ := strings.Cut(after, "@")
+		if p.Source == "" || strings.TrimSuffix(repo, ".git") == strings.TrimSuffix(p.Source, ".git") {
+			p.Source = repo
+			p.Revision = cmp.Or(m.Digest["gitCommit"], m.Digest["sha1"])
+			return
+		}
+	}
+}
+
+func slsa02(pred any) *Provenance {
+	p := &Provenance{
+		BuilderID:    digString(pred, "builder", "id"),
+		BuildType:    digString(pred, "buildType"),
+		Source:       digString(pred, "invocation", "configSource", "uri"),
+		Revision:     gitCommit(dig(pred, "invocation", "configSource", "digest")),
+		EntryPoint:   digString(pred, "invocation", "configSource", "entryPoint"),
+		InvocationID: digString(pred, "metadata", "buildInvocationID"),
+		StartedOn:    digString(pred, "metadata", "buildStartedOn"),
+		FinishedOn:   digString(pred, "metadata", "buildFinishedOn"),
+		Materials:    materials(digList(pred, "materials")),
+	}
+	params := dig(pred, "invocation", "parameters")
+	buildkitRequest(p, params)
+	p.Parameters = flatten([]Parameter{}, "parameters", params)
+	p.Parameters = flatten(p.Parameters, "environment", dig(pred, "invocation", "environment"))
+	fillSource(p, dig(pred, "metadata"))
+	return p
+}
+
+func slsa1(pred any) *Provenance {
+	def, run := dig(pred, "buildDefinition"), dig(pred, "runDetails")
+	ext := dig(def, "externalParameters")
+	p := &Provenance{
+		BuilderID:    digString(run, "builder", "id"),
+		BuildType:    digString(def, "buildType"),
+		Source:       digString(ext, "configSource", "uri"),
+		Revision:     gitCommit(dig(ext, "configSource", "digest")),
+		EntryPoint:   digString(ext, "configSource", "path"),
+		InvocationID: digString(run, "metadata", "invocationID"),
+		StartedOn:    digString(run, "metadata", "startedOn"),
+		FinishedOn:   digString(run, "metadata", "finishedOn"),
+		Materials:    materials(digList(def, "resolvedDependencies")),
+	}
+	// GitHub Actions.
+	if p.Source == "" {
+		p.Source = digString(ext, "workflow", "repository")
+		p.EntryPoint = digString(ext, "workflow", "path")
+	}
+	buildkitRequest(p, dig(ext, "request"))
+	p.Parameters = flatten([]Parameter{}, "externalParameters", ext)
+	p.Parameters = flatten(p.Parameters, "internalParameters", dig(def, "internalParameters"))
+	fillSource(p, dig(run, "metadata"))
+	return p
+}
+
+func buildInfoProvenance(bi *buildkitBuildInfo) *Provenance {
+	p := &Provenance{
+		Frontend:   bi.Frontend,
+		Parameters: []Parameter{},
+		Materials:  []Material{},
+	}
+	attr := func(k string) string {
+		if v := bi.Attrs[k]; v != nil {
+			return *v
+		}
+		return ""
+	}
+	keys := make([]string, 0, len(bi.Attrs))
+	for k := range bi.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p.Parameters = append(p.Parameters, Parameter{"attrs." + k, attr(k)})
+	}
+	p.Source, p.Revision = attr("vcs:source"), attr("vcs:revision")
+	if p.Source == "" {
+		p.Source = attr("context")
+	}
+	p.EntryPoint = attr("filename")
+
+	for _, s := range bi.Sources {
+		m := Material{URI: s.Ref}
+		if s.Type == "docker-image" {
+			m.URI = "docker-image://" + s.Ref
+		}
+		if alg, hex, ok := strings.Cut(s.Pin, ":"); ok {
+			m.Digest = map[string]string{alg: hex}
+		} else if s.Pin != "" {
+			m.Digest = map[string]string{"sha1": s.Pin}
+		}
+		p.Materials = append(p.Materials, m)
+	}
+	return p
+}
+
+func spdxPackages(pred any) []AttestedPackage {
+	pkgs := []AttestedPackage{}
+	for _, p := range digList(pred, "packages") {
+		ap := AttestedPackage{
+			Name:    digString(p, "name"),
+			Version: digString(p, "versionInfo"),
+			License: digString(p, "licenseConcluded"),
+		}
+		if ap.License == "" || ap.License == "NOASSERTION" {
+			ap.License = digString(p, "licenseDeclared")
+		}
+		if ap.License == "NOASSERTION" {
+			ap.License = ""
+		}
+		for _, ref := range digList(p, "externalRefs") {
+			if digString(ref, "referenceType") == "purl" {
+				ap.Purl = digString(ref, "referenceLocator")
+				break
+			}
+		}
+		pkgs = append(pkgs, ap)
+	}
+	return pkgs
+}
+
+func cycloneDXPackages(pred any) []AttestedPackage {
+	pkgs := []AttestedPackage{}
+	for _, c := range digList(pred, "components") {
+		ap := AttestedPackage{
+			Name:    digString(c, "name"),
+			Version: digString(c, "version"),
+			Purl:    digString(c, "purl"),
+		}
+		if g := digString(c, "group"); g != "" {
+			ap.Name = g + "/" + ap.Name
+		}
+		var licenses []string
+		for _, l := range digList(c, "licenses") {
+			for _, s := range []string{digString(l, "expression"), digString(l, "license", "id"), digString(l, "license", "name")} {
+				if s != "" {
+					licenses = append(licenses, s)
+					break
+				}
+			}
+		}
+		ap.License = strings.Join(licenses, " AND ")
+		pkgs = append(pkgs, ap)
+	}
+	return pkgs
+}
+
+// urlCredentials reports whether s is a URL with a password or token in
+// it. A bare user like git@ doesn't count.
+func urlCredentials(s string) bool {
+	if !strings.Contains(s, "://") {
+		return false
+	}
+	u, err := url.Parse(strings.TrimPrefix(s, "git+"))
+	if err != nil || u.User == nil {
+		return false
+	}
+	_, hasPassword := u.User.Password()
+	return hasPassword || u.Scheme == "http" || u.Scheme == "https"
+}
+
+// provenanceExposures flags build parameters that sound secret and URLs
+// carrying credentials. The secret scanner catches the rest.
+func provenanceExposures(p *Provenance) []Exposure {
+	var exps []Exposure
+	if urlCredentials(p.Source) {
+		exps = append(exps, Exposure{"source", ruleURLCredentials, redactURL(p.Source)})
+	}
+	for _, m := range p.Materials {
+		if urlCredentials(m.URI) {
+			exps = append(exps, Exposure{"materials", ruleURLCredentials, redactURL(m.URI)})
+		}
+	}
+	for _, param := range p.Parameters {
+		if urlCredentials(param.Value) {
+			exps = append(exps, Exposure{param.Name, ruleURLCredentials, redactURL(param.Value)})
+			continue
+		}
+		// The IDs of secret mounts are named after secrets, but aren't them.
+		if param.Value == "" || strings.Contains(param.Name, "secrets[") || strings.Contains(param.Name, "ssh[") {
+			continue
+		}
+		leaf := param.Name[strings.LastIndexAny(param.Name, ".:")+1:]
+		if secretName.MatchString(leaf) {
+			exps = append(exps, Exposure{param.Name, ruleSecretParam, secrets.Redact(param.Value)})
+		}
+	}
+	return exps
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(strings.TrimPrefix(s, "git+"))
+	if err != nil || u.User == nil {
+		return s
+	}
+	user := u.User.Username()
+	if p, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(user, secrets.Redact(p))
+	} else {
+		u.User = url.User(secrets.Redact(user))
+	}
+	return u.String()
+}
+
+// viewAttestation shows an attestation file from a layer, such as the
+// .intoto.jsonl that slsa-github-generator publishes.
+func viewAttestation(w http.ResponseWriter, r *http.Request, f httpserve.File, fi fs.FileInfo) error {
+	if fi.Size() > maxAttestationSize {
+		return fmt.Errorf("%d bytes is too big to parse, download it instead", fi.Size())
+	}
+	b, err := io.ReadAll(io.LimitReader(f, maxAttestationSize))
+	if err != nil {
+		return err
+	}
+	atts, err := parseAttestations(b)
+	if err != nil {
+		return err
+	}
+	if wantsJSON(r) {
+		return writeJSON(w, atts)
+	}
+	for _, att := range atts {
+		writeAttestation(w, att, "")
+	}
+	return nil
+}
+
+// writeAttestation renders att as HTML. Subject digests link to images in
+// repo, if there is one.
+func writeAttestation(w io.Writer, att *AttestationJSON, repo string) {
+	fmt.Fprintf(w, "<pre>\n")
+	if att.PayloadType != "" {
+		fmt.Fprintf(w, "envelope   %s, %d signatures", html.EscapeString(att.PayloadType), att.Signatures)
+		if keys := strings.TrimSpace(strings.Join(att.KeyIDs, " ")); keys != "" {
+			fmt.Fprintf(w, " (keyid %s)", html.EscapeString(keys))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if att.Type != "" {
+		fmt.Fprintf(w, "statement  %s\n", html.EscapeString(att.Type))
+	}
+	if att.PredicateType != "" {
+		pt := html.EscapeString(att.PredicateType)
+		if href := getPredicateLink(att.PredicateType); href != "" {
+			pt = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), pt)
+		}
+		fmt.Fprintf(w, "predicate  %s\n", pt)
+	}
+	for _, s := range att.Subjects {
+		fmt.Fprintf(w, "subject    %s", html.EscapeString(s.Name))
+		for _, alg := range sortedKeys(s.Digest) {
+			d := html.EscapeString(alg + ":" + s.Digest[alg])
+			if repo != "" && alg == "sha256" {
+				d = fmt.Sprintf(`<a href="/?image=%s">%s</a>`, url.QueryEscape(repo+"@"+alg+":"+s.Digest[alg]), d)
+			}
+			fmt.Fprintf(w, " %s", d)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	if len(att.Exposures) != 0 {
+		fmt.Fprintf(w, "<h3>%d possible exposures</h3>\n<table>\n<tr><th>where</th><th>rule</th><th>preview</th></tr>\n", len(att.Exposures))
+		for _, e := range att.Exposures {
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td><code>%s</code></td></tr>\n", html.EscapeString(e.Where), html.EscapeString(e.Rule), html.EscapeString(e.Preview))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+
+	if p := att.Provenance; p != nil {
+		writeProvenance(w, p)
+	}
+
+	if att.Packages != nil {
+		fmt.Fprintf(w, "<h3>%d packages</h3>\n<table>\n<tr><th>name</th><th>version</th><th>license</th><th>purl</th></tr>\n", len(att.Packages))
+		for _, p := range att.Packages {
+			purlCell := html.EscapeString(p.Purl)
+			if pu, err := parsePurl(p.Purl); err == nil {
+				if href, err := pu.url(repo); err == nil {
+					purlCell = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), purlCell)
+				}
+			}
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+				html.EscapeString(p.Name), html.EscapeString(p.Version), html.EscapeString(p.License), purlCell)
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+}
+
+func writeProvenance(w io.Writer, p *Provenance) {
+	fmt.Fprintf(w, "<h3>provenance</h3>\n<pre>\n")
+	line := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(w, "%-11s%s\n", k, v)
+		}
+	}
+	strong := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "<strong>" + s + "</strong>"
+	}
+	line("builder", html.EscapeString(p.BuilderID))
+	line("buildType", html.EscapeString(p.BuildType))
+	line("frontend", html.EscapeString(p.Frontend))
+	source := html.EscapeString(p.Source)
+	if strings.HasPrefix(p.Source, "https://") || strings.HasPrefix(p.Source, "git://") {
+		href := p.Source
+		if p.Revision != "" {
+			href = gitUrl(p.Source + "#" + p.Revision)
+		}
+		source = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), source)
+	}
+	line("source", strong(source))
+	line("revision", strong(html.EscapeString(p.Revision)))
+	line("entryPoint", html.EscapeString(p.EntryPoint))
+	line("invocation", html.EscapeString(p.InvocationID))
+	line("started", html.EscapeString(p.StartedOn))
+	line("finished", html.EscapeString(p.FinishedOn))
+	line("secrets", strong(html.EscapeString(strings.Join(p.Secrets, " "))))
+	line("ssh", strong(html.EscapeString(strings.Join(p.SSH, " "))))
+	fmt.Fprintf(w, "</pre>\n")
+
+	if len(p.Parameters) != 0 {
+		fmt.Fprintf(w, "<h3>build parameters</h3>\n<pre>\n")
+		for _, param := range p.Parameters {
+			l := html.EscapeString(param.Name + "=" + param.Value)
+			if strings.Contains(param.Name, "build-arg:") || secretName.MatchString(param.Name) {
+				l = "<strong>" + l + "</strong>"
+			}
+			fmt.Fprintf(w, "%s\n", l)
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	if len(p.Materials) != 0 {
+		fmt.Fprintf(w, "<h3>%d materials</h3>\n<pre>\n", len(p.Materials))
+		for _, m := range p.Materials {
+			uri := html.EscapeString(m.URI)
+			if image, ok := strings.CutPrefix(m.URI, "docker-image://"); ok {
+				uri = fmt.Sprintf(`<a href="/?image=%s">%s</a>`, url.QueryEscape(image), uri)
+			} else if pu, err := parsePurl(m.URI); err == nil {
+				if href, err := pu.url(""); err == nil {
+					uri = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), uri)
+				}
+			}
+			fmt.Fprintf(w, "%s", uri)
+			for _, alg := range sortedKeys(m.Digest) {
+				fmt.Fprintf(w, " %s", html.EscapeString(alg+":"+m.Digest[alg]))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
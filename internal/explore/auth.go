@@ -1,29 +1,41 @@
 package explore
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"time"
 
-	"chainguard.dev/sdk/sts"
+	oidc "chainguard.dev/sdk/proto/platform/oidc/v1"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/authn"
 	"golang.org/x/time/rate"
 	"google.golang.org/api/idtoken"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
-func NewChainguardIdentityAuth(identity, issuer, audience string) authn.Keychain {
+// NewChainguardIdentityAuth exchanges an identity token for cgr.dev
+// credentials, talking to the issuer through t (http.DefaultTransport if nil).
+func NewChainguardIdentityAuth(identity, issuer, audience string, t http.RoundTripper) authn.Keychain {
 	log.Printf("NewChainguardIdentityAuth(%q, %q, %q)", identity, issuer, audience)
+	if t == nil {
+		t = http.DefaultTransport
+	}
 	return &keychain{
 		id:        identity,
 		iss:       issuer,
 		aud:       audience,
+		client:    &http.Client{Transport: t},
 		sometimes: rate.Sometimes{Interval: 30 * time.Minute},
 	}
 }
 
 type keychain struct {
 	id, iss, aud string
+	client       *http.Client
 
 	sometimes rate.Sometimes
 	cgtok     string
@@ -61,7 +73,7 @@ func (k *keychain) ResolveContext(ctx context.Context, res authn.Resource) (auth
 			k.cgerr = fmt.Errorf("getting token: %w", err)
 			return
 		}
-		ctok, err := sts.Exchange(ctx, k.iss, k.aud, tok.AccessToken, sts.WithIdentity(k.id))
+		ctok, err := k.exchange(ctx, tok.AccessToken)
 		if err != nil {
 			k.cgerr = fmt.Errorf("exchanging token: %w", err)
 		}
@@ -79,3 +91,40 @@ func (k *keychain) ResolveContext(ctx context.Context, res authn.Resource) (auth
 		Password: k.cgtok,
 	}, nil
 }
+
+// exchange is the STS exchange of sts.Exchange, over plain HTTP so that it
+// goes out through k.client like everything else.
+func (k *keychain) exchange(ctx context.Context, idToken string) (string, error) {
+	body, err := protojson.Marshal(&oidc.ExchangeRequest{Aud: []string{k.aud}, Identity: k.id})
+	if err != nil {
+		return "", err
+	}
+	u, err := url.JoinPath(k.iss, "/sts/exchange")
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+idToken)
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, tooBig))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("exchanging token with %q: %s", k.iss, resp.Status)
+	}
+	var out oidc.RawToken
+	if err := protojson.Unmarshal(b, &out); err != nil {
+		return "", err
+	}
+	return out.Token, nil
+}
@@ -0,0 +1,44 @@
+package explore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type countingTransport struct {
+	n int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.n++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestChainguardExchange(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/sts/exchange" || r.Header.Get("Authorization") != "Bearer idtok" || !strings.Contains(string(b), `"identity":"me"`) {
+			http.Error(w, "bad exchange", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"token":"cgtok"}`))
+	}))
+	defer s.Close()
+
+	ct := &countingTransport{}
+	k := NewChainguardIdentityAuth("me", s.URL, "cgr.dev", ct).(*keychain)
+	tok, err := k.exchange(context.Background(), "idtok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok != "cgtok" || ct.n != 1 {
+		t.Errorf("exchange = %q after %d requests", tok, ct.n)
+	}
+	if _, err := k.exchange(context.Background(), "wrong"); err == nil {
+		t.Errorf("exchanging a bad token worked")
+	}
+}
@@ -0,0 +1,278 @@
+package explore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+)
+
+// BatchReport summarizes what a Batch did.
+type BatchReport struct {
+	Images    int `json:"images"`    // references resolved
+	Manifests int `json:"manifests"` // platform manifests walked
+	Layers    int `json:"layers"`    // distinct layers seen
+	Indexed   int `json:"indexed"`   // newly indexed layers
+	Cached    int `json:"cached"`    // layers indexed by an earlier run
+	Skipped   int `json:"skipped"`   // layers that aren't tarballs
+	Files     int `json:"files"`     // files across indexed and cached layers
+
+	Failed []BatchError `json:"failed,omitempty"`
+}
+
+// BatchError is something a Batch couldn't index.
+type BatchError struct {
+	Ref   string `json:"ref"`
+	Error string `json:"error"`
+}
+
+// Batch indexes images ahead of time into the same /cache and log.db that
+// the server reads, so they're searchable without browsing them first.
+// Layers that are already indexed are skipped, so an interrupted run can
+// just be started again.
+type Batch struct {
+	h *handler
+	g errgroup.Group
+
+	// just resolve manifests and configs, for crawls that don't index
+	skipLayers bool
+
+	mu     sync.Mutex
+	layers map[string]struct{}
+	report BatchReport
+}
+
+// NewBatch returns a Batch that indexes up to concurrency layers at a time.
+func NewBatch(concurrency int, opts ...Option) *Batch {
+	return newBatch(newHandler(opts...), concurrency)
+}
+
+func newBatch(h *handler, concurrency int) *Batch {
+	b := &Batch{h: h}
+	b.g.SetLimit(max(concurrency, 1))
+	return b
+}
+
+// Tags lists every tag in repo, e.g. to index a whole repository.
+func (b *Batch) Tags(ctx context.Context, repo string) ([]string, error) {
+	r, err := name.NewRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := remote.List(r, b.h.backgroundOptions(ctx, r)...)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]string, 0, len(tags.Tags))
+	for _, tag := range tags.Tags {
+		refs = append(refs, r.Tag(tag).String())
+	}
+	return refs, nil
+}
+
+// Index resolves each reference to every platform it ships and indexes all
+// of their layers. Failures are collected in the report rather than
+// stopping the batch. Calls to Index must not overlap.
+func (b *Batch) Index(ctx context.Context, refs []string) *BatchReport {
+	b.mu.Lock()
+	b.layers = map[string]struct{}{}
+	b.report = BatchReport{}
+	b.mu.Unlock()
+
+	for _, ref := range refs {
+		if err := ctx.Err(); err != nil {
+			b.fail(ref, err)
+			break
+		}
+		if err := b.indexRef(ctx, ref); err != nil {
+			b.fail(ref, err)
+		}
+	}
+	b.g.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	report := b.report
+	sort.Slice(report.Failed, func(i, j int) bool {
+		return report.Failed[i].Ref < report.Failed[j].Ref
+	})
+	return &report
+}
+
+// Close closes the TocDB.
+func (b *Batch) Close() error {
+	return b.h.tocDB.Close()
+}
+
+func (b *Batch) fail(ref string, err error) {
+	log.Printf("[batch] %s: %v", ref, err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.report.Failed = append(b.report.Failed, BatchError{Ref: ref, Error: err.Error()})
+}
+
+func (b *Batch) count(f func(r *BatchReport)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f(&b.report)
+}
+
+func (b *Batch) indexRef(ctx context.Context, s string) error {
+	ref, err := name.ParseReference(s)
+	if err != nil {
+		return err
+	}
+	opts := b.h.backgroundOptions(ctx, ref.Context())
+	opts = append(opts, remote.WithMaxSize(tooBig))
+
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return err
+	}
+	b.h.logManifest(ref, desc)
+	b.count(func(r *BatchReport) { r.Images++ })
+
+	switch {
+	case desc.MediaType.IsIndex():
+		idx, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+		if err != nil {
+			return err
+		}
+		for _, child := range idx.Manifests {
+			if !child.MediaType.IsImage() {
+				continue
+			}
+			dig := ref.Context().Digest(child.Digest.String())
+			cdesc, err := remote.Get(dig, opts...)
+			if err != nil {
+				b.fail(dig.String(), err)
+				continue
+			}
+			b.h.logManifest(dig, cdesc)
+			if err := b.indexImage(ctx, dig, cdesc, opts); err != nil {
+				b.fail(dig.String(), err)
+			}
+		}
+		return nil
+	case desc.MediaType.IsImage():
+		return b.indexImage(ctx, ref.Context().Digest(desc.Digest.String()), desc, opts)
+	}
+	return fmt.Errorf("cannot index %s", desc.MediaType)
+}
+
+func (b *Batch) indexImage(ctx context.Context, dig name.Digest, desc *remote.Descriptor, opts []remote.Option) error {
+	m, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return err
+	}
+	b.count(func(r *BatchReport) { r.Manifests++ })
+
+	// Configs are small and searchable, so grab them while we're here.
+	cfg := dig.Context().Digest(m.Config.Digest.String())
+	if err := b.logConfig(cfg, m.Config, opts); err != nil {
+		b.fail(cfg.String(), err)
+	}
+	if b.skipLayers {
+		return nil
+	}
+
+	for _, layer := range m.Layers {
+		digest := layer.Digest.String()
+		if digest == emptyDigest {
+			continue
+		}
+
+		b.mu.Lock()
+		_, dup := b.layers[digest]
+		b.layers[digest] = struct{}{}
+		if !dup {
+			b.report.Layers++
+		}
+		b.mu.Unlock()
+		if dup {
+			continue
+		}
+
+		layerRef := dig.Context().Digest(digest)
+		b.g.Go(func() error {
+			if err := b.indexLayer(ctx, layerRef, layer, opts); err != nil {
+				b.fail(layerRef.String(), err)
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+func (b *Batch) logConfig(dig name.Digest, desc v1.Descriptor, opts []remote.Option) error {
+	if !desc.MediaType.IsConfig() || desc.Size > tooBig {
+		return nil
+	}
+	l, err := remote.Layer(dig, opts...)
+	if err != nil {
+		return err
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	cfg, err := io.ReadAll(io.LimitReader(rc, tooBig))
+	if err != nil {
+		return err
+	}
+	b.h.logConfig(dig, desc.MediaType, cfg)
+	return nil
+}
+
+func (b *Batch) indexLayer(ctx context.Context, dig name.Digest, layer v1.Descriptor, opts []remote.Option) error {
+	digest := layer.Digest.String()
+
+	index, err := b.h.getIndex(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("getIndex: %w", err)
+	}
+	if index != nil {
+		b.count(func(r *BatchReport) { r.Cached++ })
+	} else {
+		l, err := remote.Layer(dig, opts...)
+		if err != nil {
+			return err
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		index, err = b.h.createIndex(ctx, rc, layer.Size, digest, 0, string(layer.MediaType), extractImageContext(dig))
+		if err != nil {
+			return fmt.Errorf("createIndex: %w", err)
+		}
+		if index == nil {
+			b.count(func(r *BatchReport) { r.Skipped++ })
+			return nil
+		}
+		b.count(func(r *BatchReport) { r.Indexed++ })
+	}
+
+	toc := index.TOC()
+	b.count(func(r *BatchReport) { r.Files += len(toc.Files) })
+	log.Printf("[batch] %s: %d files", dig, len(toc.Files))
+
+	// The server queues these, but here we have the time to wait.
+	if b.h.scans == nil {
+		if err := b.h.scanLayer(ctx, scanJob{dig: dig, prefix: digest, toc: toc}); err != nil {
+			log.Printf("[batch] scanLayer(%s): %v", dig, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package explore
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/registry"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestBatch(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	app, err := name.NewTag(host + "/acme/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(app, img); err != nil {
+		t.Fatal(err)
+	}
+	multi, err := name.NewTag(host + "/acme/multi:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(multi, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handler{profiles: builtinProfiles(), tocDB: NewTocDB(filepath.Join(t.TempDir(), "log.db")), indexCache: &multiCache{[]cache{&dirCache{dir: t.TempDir()}}}}
+	b := newBatch(h, 2)
+	defer b.Close()
+
+	tags, err := b.Tags(context.Background(), host+"/acme/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0] != app.String() {
+		t.Errorf("Tags() = %v", tags)
+	}
+
+	// Each run starts afresh, but layers indexed by an earlier one are cached.
+	for _, tc := range []struct {
+		refs []string
+		want BatchReport
+	}{{
+		refs: []string{app.String()},
+		want: BatchReport{Images: 1, Manifests: 1, Layers: 2, Indexed: 2, Files: 2},
+	}, {
+		refs: []string{app.String(), multi.String()},
+		want: BatchReport{Images: 2, Manifests: 3, Layers: 4, Indexed: 2, Cached: 2, Files: 4},
+	}, {
+		refs: []string{host + "/acme/gone:v1", "not a reference"},
+		want: BatchReport{Failed: []BatchError{{Ref: host + "/acme/gone:v1"}, {Ref: "not a reference"}}},
+	}} {
+		got := b.Index(context.Background(), tc.refs)
+		if len(got.Failed) != len(tc.want.Failed) {
+			t.Fatalf("Index(%v) failed = %+v", tc.refs, got.Failed)
+		}
+		for i, f := range got.Failed {
+			if f.Ref != tc.want.Failed[i].Ref || f.Error == "" {
+				t.Errorf("Index(%v) failed[%d] = %+v", tc.refs, i, f)
+			}
+		}
+		got.Failed, tc.want.Failed = nil, nil
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("Index(%v) = %+v, want %+v", tc.refs, *got, tc.want)
+		}
+	}
+
+	// The configs came along too.
+	hits, err := h.tocDB.SearchConfigs(&ConfigQuery{Repository: "multi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 {
+		t.Errorf("SearchConfigs(multi) = %+v, want both platforms", hits)
+	}
+}
@@ -0,0 +1,67 @@
+package explore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/thesavant42/yolosint/internal/binfmt"
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+)
+
+func init() {
+	httpserve.RegisterViewer("pe", viewBinary("pe", binfmt.PrintPE))
+	httpserve.RegisterViewer("macho", viewBinary("macho", binfmt.PrintMachO))
+}
+
+// BinaryJSON is ?render=pe or ?render=macho.
+type BinaryJSON struct {
+	Format string `json:"format"`
+	Text   string `json:"text"` // objdump-ish
+}
+
+// viewBinary shows the headers of a PE or Mach-O file with print. Unlike
+// ELF these are laid out for seeking around in, so the file is copied out
+// of the layer first.
+func viewBinary(format string, print func(w io.Writer, r io.ReaderAt, size int64) error) httpserve.Viewer {
+	return func(w http.ResponseWriter, r *http.Request, f httpserve.File, fi fs.FileInfo) error {
+		if fi.Size() > maxBinarySize {
+			return fmt.Errorf("%d bytes is too big to parse, download it instead", fi.Size())
+		}
+		tmp, err := extractTemp(f, "yolosint-*.bin", maxBinarySize)
+		if err != nil {
+			return fmt.Errorf("extracting binary: %w", err)
+		}
+		defer os.Remove(tmp)
+
+		bin, err := os.Open(tmp)
+		if err != nil {
+			return err
+		}
+		defer bin.Close()
+		st, err := bin.Stat()
+		if err != nil {
+			return err
+		}
+
+		if wantsJSON(r) {
+			var text strings.Builder
+			if err := print(&text, bin, st.Size()); err != nil {
+				return err
+			}
+			return writeJSON(w, BinaryJSON{format, text.String()})
+		}
+
+		fmt.Fprintf(w, "<pre>\n")
+		if err := print(&dumbEscaper{buf: bufio.NewWriter(w)}, bin, st.Size()); err != nil {
+			fmt.Fprintf(w, "</pre>\n")
+			return err
+		}
+		fmt.Fprintf(w, "</pre>\n")
+		return nil
+	}
+}
@@ -0,0 +1,224 @@
+package explore
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	runtimedebug "runtime/debug"
+	"sort"
+	"strings"
+
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+)
+
+func init() {
+	httpserve.RegisterViewer("buildinfo", viewBuildInfo)
+}
+
+// BuildInfoJSON is ?render=buildinfo for a Go binary.
+type BuildInfoJSON struct {
+	GoVersion string      `json:"goversion"`
+	Path      string      `json:"path,omitempty"` // package path of main
+	Main      *GoModule   `json:"main,omitempty"`
+	Deps      []GoModule  `json:"deps"`
+	Settings  []GoSetting `json:"settings"` // -ldflags, vcs.revision, vcs.time, GOOS...
+}
+
+// GoModule is a module the binary was built from.
+type GoModule struct {
+	Path    string    `json:"path"`
+	Version string    `json:"version,omitempty"`
+	Sum     string    `json:"sum,omitempty"`
+	Replace *GoModule `json:"replace,omitempty"`
+}
+
+// GoSetting is a build setting as key=value.
+type GoSetting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// GoBinary is one entry of /buildinfo/, a Go binary in the combined image.
+type GoBinary struct {
+	Name      string `json:"name"`
+	Layer     string `json:"layer"`
+	Size      int64  `json:"size"`
+	GoVersion string `json:"goversion"`
+	Module    string `json:"module,omitempty"` // main module, or package path
+}
+
+func goModule(m *runtimedebug.Module) *GoModule {
+	if m == nil || m.Path == "" {
+		return nil
+	}
+	return &GoModule{
+		Path:    m.Path,
+		Version: m.Version,
+		Sum:     m.Sum,
+		Replace: goModule(m.Replace),
+	}
+}
+
+// viewBuildInfo decodes what the Go toolchain embeds in a binary: its
+// version, the modules that went into it and the build settings.
+func viewBuildInfo(w http.ResponseWriter, r *http.Request, f httpserve.File, fi fs.FileInfo) error {
+	if fi.Size() > maxBinarySize {
+		return fmt.Errorf("%d bytes is too big to read build info from", fi.Size())
+	}
+	// debug/buildinfo needs the whole binary to seek around in.
+	tmp, err := extractTemp(f, "yolosint-*.bin", maxBinarySize)
+	if err != nil {
+		return fmt.Errorf("extracting binary: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	bi, err := buildinfo.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+
+	bv := &BuildInfoJSON{
+		GoVersion: bi.GoVersion,
+		Path:      bi.Path,
+		Main:      goModule(&bi.Main),
+		Deps:      []GoModule{},
+		Settings:  []GoSetting{},
+	}
+	for _, dep := range bi.Deps {
+		if m := goModule(dep); m != nil {
+			bv.Deps = append(bv.Deps, *m)
+		}
+	}
+	for _, s := range bi.Settings {
+		bv.Settings = append(bv.Settings, GoSetting{s.Key, s.Value})
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, bv)
+	}
+	writeBuildInfo(w, bv)
+	return nil
+}
+
+// Settings worth a second look: what was baked in at link time and where
+// the source came from.
+func interestingSetting(key string) bool {
+	return key == "-ldflags" || strings.HasPrefix(key, "vcs")
+}
+
+func writeBuildInfo(w http.ResponseWriter, bv *BuildInfoJSON) {
+	fmt.Fprintf(w, "<pre>\n")
+	fmt.Fprintf(w, "go      %s\n", html.EscapeString(bv.GoVersion))
+	fmt.Fprintf(w, "path    %s\n", html.EscapeString(bv.Path))
+	if bv.Main != nil {
+		fmt.Fprintf(w, "mod     %s\n", goModuleLine(bv.Main))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	if len(bv.Settings) != 0 {
+		fmt.Fprintf(w, "<h3>build settings</h3>\n<pre>\n")
+		for _, s := range bv.Settings {
+			line := html.EscapeString(s.Key + "=" + s.Value)
+			if interestingSetting(s.Key) {
+				line = "<strong>" + line + "</strong>"
+			}
+			fmt.Fprintf(w, "%s\n", line)
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	fmt.Fprintf(w, "<h3>%d dependencies</h3>\n<pre>\n", len(bv.Deps))
+	for i := range bv.Deps {
+		fmt.Fprintf(w, "dep     %s\n", goModuleLine(&bv.Deps[i]))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// goModuleLine is "path version sum", plus "=> replacement" if replaced.
+func goModuleLine(m *GoModule) string {
+	name := html.EscapeString(m.Path)
+	if m.Version != "" && m.Version != "(devel)" {
+		href := "https://pkg.go.dev/" + m.Path + "@" + m.Version
+		name = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), name)
+	}
+	line := strings.TrimRight(fmt.Sprintf("%s\t%s\t%s", name, html.EscapeString(m.Version), html.EscapeString(m.Sum)), "\t")
+	if m.Replace != nil {
+		line += "\n\t=> " + goModuleLine(m.Replace)
+	}
+	return line
+}
+
+// Every Go binary in the combined image, from what the indexer saw.
+func (h *handler) renderGoBinaries(w http.ResponseWriter, r *http.Request) error {
+	dig, ref, err := h.getDigest(w, r)
+	if err != nil {
+		return err
+	}
+
+	desc, err := h.fetchManifest(w, r, dig)
+	if err != nil {
+		return err
+	}
+
+	mfs, err := h.multiFS(w, r, dig, desc, ref)
+	if err != nil {
+		return err
+	}
+
+	bins := []GoBinary{}
+	for name, ff := range mfs.Flatten() {
+		if ff.GoVersion == "" {
+			continue
+		}
+		bins = append(bins, GoBinary{
+			Name:      name,
+			Layer:     ff.Layer,
+			Size:      ff.Size,
+			GoVersion: ff.GoVersion,
+			Module:    ff.GoModule,
+		})
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].Name < bins[j].Name
+	})
+
+	// Allow this to be cached for an hour.
+	w.Header().Set("Cache-Control", "max-age=3600, immutable")
+
+	if wantsJSON(r) {
+		return writeJSON(w, bins)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"go binaries " + dig.String()}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	u := *r.URL
+	qs := u.Query()
+	qs.Set("format", "json")
+	u.RawQuery = qs.Encode()
+	fmt.Fprintf(w, "<p>%d Go binaries in <a href=\"/layers/%s/\">%s</a> (<a href=%q>json</a>)</p>\n",
+		len(bins), dig.String(), html.EscapeString(dig.String()), u.String())
+	if len(bins) == 0 {
+		fmt.Fprintf(w, "<p>Layers indexed before Go binaries were recorded won't show any.</p>\n")
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, b := range bins {
+		href := (&url.URL{Path: path.Join("/fs/", b.Layer, b.Name), RawQuery: "render=buildinfo"}).String()
+		fmt.Fprintf(w, "<span title=%q>%s</span> %-10s <a href=%q>%s</a> %s\n",
+			b.Layer, shortLayer(b.Layer), html.EscapeString(b.GoVersion), href, html.EscapeString(b.Name), html.EscapeString(b.Module))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	fmt.Fprint(w, footer)
+	return nil
+}
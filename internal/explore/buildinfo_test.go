@@ -0,0 +1,67 @@
+package explore
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestViewBuildInfo(t *testing.T) {
+	// The test binary is as good a Go binary as any.
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	view := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		f, err := os.Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/fs/x/app?render=buildinfo&"+query, nil)
+		if err := viewBuildInfo(w, r, f, fi); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	var bv BuildInfoJSON
+	if err := json.Unmarshal(view("format=json").Body.Bytes(), &bv); err != nil {
+		t.Fatal(err)
+	}
+	if bv.GoVersion != runtime.Version() || !strings.HasSuffix(bv.Path, "explore.test") {
+		t.Errorf("got %q %q", bv.GoVersion, bv.Path)
+	}
+	found := false
+	for _, s := range bv.Settings {
+		found = found || s.Key == "GOOS"
+	}
+	if !found {
+		t.Errorf("settings = %+v", bv.Settings)
+	}
+
+	if page := view("").Body.String(); !strings.Contains(page, "go      "+runtime.Version()) {
+		t.Errorf("page = %s", page)
+	}
+
+	// Not a binary at all.
+	f, err := os.Open("buildinfo.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, _ := f.Stat()
+	if err := viewBuildInfo(httptest.NewRecorder(), httptest.NewRequest("GET", "/?render=buildinfo", nil), f, fi); err == nil {
+		t.Errorf("no error for a source file")
+	}
+}
@@ -0,0 +1,492 @@
+package explore
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ConfigQuery searches the image configs we've rendered. Every field that's
+// set must match.
+type ConfigQuery struct {
+	Env       string // glob on variable names, e.g. "*_TOKEN"
+	Port      string // exposed port, e.g. "22" or "22/tcp"
+	Label     string // glob on label keys, e.g. "org.opencontainers.image.source"
+	Value     string // substring of the matching env or label value
+	CreatedBy string // substring of a history created_by line, "*" matches anything, e.g. "curl*| sh"
+
+	Registry   string
+	Namespace  string
+	Repository string
+
+	Limit  int
+	Offset int
+}
+
+// ConfigMatch is the part of a config that satisfied a ConfigQuery.
+type ConfigMatch struct {
+	Field string `json:"field"` // "env", "port", "label" or "created_by"
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// ConfigHit is a single config that matched a ConfigQuery.
+type ConfigHit struct {
+	Config       string        `json:"config"`
+	MediaType    string        `json:"mediaType,omitempty"`
+	Registry     string        `json:"registry"`
+	Namespace    string        `json:"namespace,omitempty"`
+	Repository   string        `json:"repository"`
+	OS           string        `json:"os,omitempty"`
+	Architecture string        `json:"architecture,omitempty"`
+	Created      string        `json:"created,omitempty"`
+	Manifests    []string      `json:"manifests,omitempty"`
+	Matches      []ConfigMatch `json:"matches,omitempty"`
+	URL          string        `json:"url,omitempty"`
+}
+
+func (c *ConfigHit) repo() string {
+	return path.Join(c.Registry, c.Namespace, c.Repository)
+}
+
+func (c *ConfigHit) link() string {
+	qs := url.Values{}
+	qs.Set("blob", c.repo()+"@"+c.Config)
+	if c.MediaType != "" {
+		qs.Set("mt", c.MediaType)
+	}
+	return "/?" + qs.Encode()
+}
+
+// InsertConfig parses an image config and logs it, keyed by digest.
+// Configs are content-addressed, so seeing one again only records the
+// repository it was seen in.
+func (t *TocDB) InsertConfig(dig name.Digest, mediaType types.MediaType, b []byte) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+
+	cf, err := v1.ParseConfigFile(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("ParseConfigFile: %w", err)
+	}
+	imgCtx := repoContext(dig.Context())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	entrypoint, err := json.Marshal(cf.Config.Entrypoint)
+	if err != nil {
+		return err
+	}
+	cmd, err := json.Marshal(cf.Config.Cmd)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(
+		`INSERT OR IGNORE INTO configs (digest, media_type, registry, namespace, repository, os, architecture, created, author, user, working_dir, entrypoint, cmd)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		dig.DigestStr(), mediaType, imgCtx.Registry, imgCtx.Namespace, imgCtx.Repository, cf.OS, cf.Architecture,
+		nullTime(cf.Created), cf.Author, cf.Config.User, cf.Config.WorkingDir, string(entrypoint), string(cmd),
+	)
+	if err != nil {
+		return fmt.Errorf("configs: %w", err)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO config_repos (config_digest, registry, namespace, repository) VALUES (?, ?, ?, ?)
+		 ON CONFLICT DO UPDATE SET seen_at = CURRENT_TIMESTAMP`,
+		dig.DigestStr(), imgCtx.Registry, imgCtx.Namespace, imgCtx.Repository,
+	); err != nil {
+		return fmt.Errorf("config_repos: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return tx.Commit()
+	}
+
+	for _, kv := range cf.Config.Env {
+		k, v, _ := strings.Cut(kv, "=")
+		if _, err := tx.Exec(`INSERT INTO config_env (config_digest, name, value) VALUES (?, ?, ?)`, dig.DigestStr(), k, v); err != nil {
+			return fmt.Errorf("config_env: %w", err)
+		}
+	}
+	for port := range cf.Config.ExposedPorts {
+		number, proto, ok := strings.Cut(port, "/")
+		if !ok {
+			proto = "tcp"
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			log.Printf("[DB] InsertConfig: port %q: %v", port, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO config_ports (config_digest, port, number, protocol) VALUES (?, ?, ?, ?)`, dig.DigestStr(), port, n, proto); err != nil {
+			return fmt.Errorf("config_ports: %w", err)
+		}
+	}
+	for k, v := range cf.Config.Labels {
+		if _, err := tx.Exec(`INSERT INTO config_labels (config_digest, key, value) VALUES (?, ?, ?)`, dig.DigestStr(), k, v); err != nil {
+			return fmt.Errorf("config_labels: %w", err)
+		}
+	}
+	for i, h := range cf.History {
+		if _, err := tx.Exec(
+			`INSERT INTO config_history (config_digest, position, created, created_by, comment, empty_layer) VALUES (?, ?, ?, ?, ?, ?)`,
+			dig.DigestStr(), i, nullTime(h.Created), h.CreatedBy, h.Comment, h.EmptyLayer,
+		); err != nil {
+			return fmt.Errorf("config_history: %w", err)
+		}
+	}
+
+	log.Printf("[DB] InsertConfig: %s env=%d ports=%d labels=%d history=%d", dig.DigestStr(), len(cf.Config.Env), len(cf.Config.ExposedPorts), len(cf.Config.Labels), len(cf.History))
+	return tx.Commit()
+}
+
+func nullTime(t v1.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Time
+}
+
+// configItem is one of the per-config tables that ConfigQuery can match against.
+type configItem struct {
+	field string
+	query string // selects key, value for a config digest
+	where []string
+	args  []any
+}
+
+func (q *ConfigQuery) items() []configItem {
+	items := []configItem{}
+
+	value := "%" + likeEscaper.Replace(q.Value) + "%"
+	if q.Env != "" || (q.Value != "" && q.Label == "") {
+		item := configItem{field: "env", query: `SELECT name, value FROM config_env x`}
+		if q.Env != "" {
+			item.where = append(item.where, `upper(x.name) GLOB upper(?)`)
+			item.args = append(item.args, q.Env)
+		}
+		if q.Value != "" {
+			item.where = append(item.where, `x.value LIKE ? ESCAPE '\'`)
+			item.args = append(item.args, value)
+		}
+		items = append(items, item)
+	}
+	if q.Label != "" || (q.Value != "" && q.Env == "") {
+		item := configItem{field: "label", query: `SELECT key, value FROM config_labels x`}
+		if q.Label != "" {
+			item.where = append(item.where, `x.key GLOB ?`)
+			item.args = append(item.args, q.Label)
+		}
+		if q.Value != "" {
+			item.where = append(item.where, `x.value LIKE ? ESCAPE '\'`)
+			item.args = append(item.args, value)
+		}
+		items = append(items, item)
+	}
+	if q.Port != "" {
+		item := configItem{field: "port", query: `SELECT port, protocol FROM config_ports x`}
+		if n, err := strconv.Atoi(q.Port); err == nil {
+			item.where = append(item.where, `x.number = ?`)
+			item.args = append(item.args, n)
+		} else {
+			item.where = append(item.where, `x.port = ?`)
+			item.args = append(item.args, q.Port)
+		}
+		items = append(items, item)
+	}
+	if q.CreatedBy != "" {
+		items = append(items, configItem{
+			field: "created_by",
+			query: `SELECT position, created_by FROM config_history x`,
+			where: []string{`x.created_by LIKE ? ESCAPE '\'`},
+			args:  []any{"%" + strings.ReplaceAll(likeEscaper.Replace(q.CreatedBy), "*", "%") + "%"},
+		})
+	}
+	return items
+}
+
+func (q *ConfigQuery) empty() bool {
+	return q.Env == "" && q.Port == "" && q.Label == "" && q.Value == "" && q.CreatedBy == "" &&
+		q.Registry == "" && q.Namespace == "" && q.Repository == ""
+}
+
+// SearchConfigs finds configs by env, exposed ports, labels or history.
+func (t *TocDB) SearchConfigs(q *ConfigQuery) ([]ConfigHit, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+
+	items := q.items()
+	where := []string{}
+	args := []any{}
+
+	// A bare value can come from either env or labels, everything else must all match.
+	if q.Value != "" && q.Env == "" && q.Label == "" {
+		env, label := items[0], items[1]
+		where = append(where, `(EXISTS (`+env.exists()+`) OR EXISTS (`+label.exists()+`))`)
+		args = append(args, env.args...)
+		args = append(args, label.args...)
+		items = items[2:]
+	}
+	for _, item := range items {
+		where = append(where, `EXISTS (`+item.exists()+`)`)
+		args = append(args, item.args...)
+	}
+	for col, v := range map[string]string{
+		"r.registry":   q.Registry,
+		"r.namespace":  q.Namespace,
+		"r.repository": q.Repository,
+	} {
+		if v != "" {
+			where = append(where, col+` = ?`)
+			args = append(args, v)
+		}
+	}
+	if len(where) == 0 {
+		where = append(where, `1 = 1`)
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+	args = append(args, limit, q.Offset)
+
+	rows, err := t.db.Query(
+		`SELECT c.digest, c.media_type, r.registry, r.namespace, r.repository, c.os, c.architecture, c.created
+		 FROM configs c JOIN config_repos r ON r.config_digest = c.digest WHERE `+strings.Join(where, " AND ")+`
+		 ORDER BY r.seen_at DESC, c.digest, r.registry, r.namespace, r.repository
+		 LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []ConfigHit{}
+	for rows.Next() {
+		var (
+			hit                   ConfigHit
+			mt, os, arch, created sql.NullString
+		)
+		if err := rows.Scan(&hit.Config, &mt, &hit.Registry, &hit.Namespace, &hit.Repository, &os, &arch, &created); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hit.MediaType = mt.String
+		hit.OS = os.String
+		hit.Architecture = arch.String
+		hit.Created = created.String
+		hit.URL = hit.link()
+		hits = append(hits, hit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		if err := t.fillConfigHit(&hits[i], q.items()); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[DB] SearchConfigs: %d hits", len(hits))
+	return hits, nil
+}
+
+func (c configItem) exists() string {
+	return c.query + ` WHERE x.config_digest = c.digest AND ` + strings.Join(c.where, " AND ")
+}
+
+// fillConfigHit looks up which manifests use the config and what in it matched.
+func (t *TocDB) fillConfigHit(hit *ConfigHit, items []configItem) error {
+	rows, err := t.db.Query(`SELECT DISTINCT digest FROM manifests WHERE config_digest = ? ORDER BY digest`, hit.Config)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var m string
+		if err := rows.Scan(&m); err != nil {
+			rows.Close()
+			return err
+		}
+		hit.Manifests = append(hit.Manifests, m)
+	}
+	rows.Close()
+
+	for _, item := range items {
+		rows, err := t.db.Query(item.query+` WHERE x.config_digest = ? AND `+strings.Join(item.where, " AND "), append([]any{hit.Config}, item.args...)...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var k, v sql.NullString
+			if err := rows.Scan(&k, &v); err != nil {
+				rows.Close()
+				return err
+			}
+			hit.Matches = append(hit.Matches, ConfigMatch{Field: item.field, Key: k.String, Value: v.String})
+		}
+		rows.Close()
+	}
+	sort.SliceStable(hit.Matches, func(i, j int) bool {
+		return hit.Matches[i].Field < hit.Matches[j].Field
+	})
+	return nil
+}
+
+// logConfig is like logTOC but for image configs rendered via renderBlobJSON
+// or renderDockerfile.
+func (h *handler) logConfig(dig name.Digest, mediaType types.MediaType, b []byte) {
+	if h.tocDB != nil {
+		if err := h.tocDB.InsertConfig(dig, mediaType, b); err != nil {
+			log.Printf("SQLite config insert failed for %s: %v", dig, err)
+		}
+	}
+}
+
+func parseConfigQuery(r *http.Request) (*ConfigQuery, error) {
+	qs := r.URL.Query()
+	q := &ConfigQuery{
+		Env:        strings.TrimSpace(qs.Get("env")),
+		Port:       strings.TrimSpace(qs.Get("port")),
+		Label:      strings.TrimSpace(qs.Get("label")),
+		Value:      qs.Get("value"),
+		CreatedBy:  qs.Get("created_by"),
+		Registry:   qs.Get("registry"),
+		Namespace:  qs.Get("namespace"),
+		Repository: qs.Get("repository"),
+	}
+	if q.Port != "" {
+		number, _, _ := strings.Cut(q.Port, "/")
+		if _, err := strconv.Atoi(number); err != nil {
+			return nil, fmt.Errorf("port: %w", err)
+		}
+	}
+	if v := qs.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("limit: %w", err)
+		}
+		q.Limit = n
+	}
+	if v := qs.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("offset: %w", err)
+		}
+		q.Offset = n
+	}
+	if q.Limit <= 0 || q.Limit > maxSearchLimit {
+		q.Limit = defaultSearchLimit
+	}
+	return q, nil
+}
+
+// Search every image config we've rendered, via /search?scope=config.
+func (h *handler) renderConfigSearch(w http.ResponseWriter, r *http.Request) error {
+	q, err := parseConfigQuery(r)
+	if err != nil {
+		return err
+	}
+
+	hits := []ConfigHit{}
+	if !q.empty() {
+		hits, err = h.tocDB.SearchConfigs(q)
+		if err != nil {
+			return fmt.Errorf("SearchConfigs: %w", err)
+		}
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, hits)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"search configs"}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, configSearchForm, html.EscapeString(q.Env), html.EscapeString(q.Port), html.EscapeString(q.Label), html.EscapeString(q.Value),
+		html.EscapeString(q.CreatedBy), html.EscapeString(q.Registry), html.EscapeString(q.Namespace), html.EscapeString(q.Repository))
+
+	if len(hits) == 0 {
+		if !q.empty() {
+			fmt.Fprintf(w, "<p>no matches</p>\n")
+		}
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, hit := range hits {
+		short := hit.Config
+		if _, after, ok := strings.Cut(short, ":"); ok && len(after) > 8 {
+			short = after[:8]
+		}
+		fmt.Fprintf(w, "<a title=%q href=%q>%s</a> %s", hit.Config, hit.URL, short, html.EscapeString(hit.repo()))
+		for _, m := range hit.Manifests {
+			if _, after, ok := strings.Cut(m, ":"); ok && len(after) > 8 {
+				fmt.Fprintf(w, " <a title=%q href=\"/?image=%s\">%s</a>", m, url.QueryEscape(hit.repo()+"@"+m), after[:8])
+			}
+		}
+		fmt.Fprintf(w, "\n")
+		for _, m := range hit.Matches {
+			fmt.Fprintf(w, "    %-10s %s %s\n", m.Field, html.EscapeString(m.Key), html.EscapeString(m.Value))
+		}
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	if len(hits) == q.Limit {
+		next := *r.URL
+		qs := next.Query()
+		qs.Set("offset", strconv.Itoa(q.Offset+len(hits)))
+		next.RawQuery = qs.Encode()
+		fmt.Fprintf(w, "<p><a href=%q>next</a></p>\n", next.String())
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+const configSearchForm = `
+<form action="/search" method="GET" autocomplete="off" spellcheck="false">
+<input type="hidden" name="scope" value="config"/>
+<p>
+<input size="16" type="text" name="env" value="%s" placeholder="*_TOKEN"/>
+<input size="6" type="text" name="port" value="%s" placeholder="22"/>
+<input size="32" type="text" name="label" value="%s" placeholder="org.opencontainers.image.source"/>
+<input size="24" type="text" name="value" value="%s" placeholder="github.com/"/>
+<input type="submit" value="search configs"/>
+</p>
+<p>
+<input size="40" type="text" name="created_by" value="%s" placeholder="curl*| sh"/>
+</p>
+<p>
+<input size="16" type="text" name="registry" value="%s" placeholder="registry"/>
+<input size="16" type="text" name="namespace" value="%s" placeholder="namespace"/>
+<input size="16" type="text" name="repository" value="%s" placeholder="repository"/>
+</p>
+<p><a href="/search">search files</a></p>
+</form>
+`
@@ -0,0 +1,121 @@
+package explore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestSearchConfigs(t *testing.T) {
+	db := NewTocDB(filepath.Join(t.TempDir(), "log.db"))
+	defer db.Close()
+
+	cf := v1.ConfigFile{
+		OS:           "linux",
+		Architecture: "amd64",
+		Config: v1.Config{
+			Env:          []string{"PATH=/usr/bin", "GITHUB_TOKEN=ghp_example"},
+			ExposedPorts: map[string]struct{}{"22/tcp": {}, "8080/tcp": {}},
+			Labels:       map[string]string{"org.opencontainers.image.source": "https://github.com/robdisney/fauxpilotgov"},
+		},
+		History: []v1.History{{
+			CreatedBy: "/bin/sh -c apk add curl",
+		}, {
+			CreatedBy: "/bin/sh -c curl -fsSL https://example.com/install.sh | sh",
+		}},
+	}
+	b, err := json.Marshal(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dig, err := name.NewDigest("robdisney/fauxpilotgov@" + fakeHash("c").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := db.InsertConfig(dig, types.OCIConfigJSON, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		q    ConfigQuery
+		want int // matches in the one hit, or -1 for no hits
+	}{
+		{ConfigQuery{Env: "*_token"}, 1},
+		{ConfigQuery{Port: "22"}, 1},
+		{ConfigQuery{Port: "22/udp"}, -1},
+		{ConfigQuery{Label: "org.opencontainers.image.source", Value: "github.com/robdisney"}, 1},
+		{ConfigQuery{Value: "github.com/robdisney"}, 1},
+		{ConfigQuery{CreatedBy: "curl*| sh"}, 1},
+		{ConfigQuery{CreatedBy: "curl*| sh", Port: "22", Namespace: "robdisney"}, 2},
+		{ConfigQuery{CreatedBy: "curl*| sh", Namespace: "library"}, -1},
+		{ConfigQuery{Repository: "fauxpilotgov"}, 0},
+		{ConfigQuery{Repository: "busybox"}, -1},
+	} {
+		hits, err := db.SearchConfigs(&tc.q)
+		if err != nil {
+			t.Fatalf("SearchConfigs(%+v): %v", tc.q, err)
+		}
+		if tc.want == -1 {
+			if len(hits) != 0 {
+				t.Errorf("SearchConfigs(%+v) = %+v, want none", tc.q, hits)
+			}
+			continue
+		}
+		if len(hits) != 1 {
+			t.Fatalf("SearchConfigs(%+v) = %+v, want 1 hit", tc.q, hits)
+		}
+		if got := len(hits[0].Matches); got != tc.want {
+			t.Errorf("SearchConfigs(%+v) matches = %+v, want %d", tc.q, hits[0].Matches, tc.want)
+		}
+	}
+
+	// The same config, mirrored into another repository, is found there too.
+	mirror, err := name.NewDigest("acme/mirror@" + fakeHash("c").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertConfig(mirror, types.OCIConfigJSON, b); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := db.SearchConfigs(&ConfigQuery{Port: "22", Namespace: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Repository != "mirror" {
+		t.Errorf("SearchConfigs(acme) = %+v, want acme/mirror", hits)
+	}
+	if hits, err := db.SearchConfigs(&ConfigQuery{Port: "22"}); err != nil || len(hits) != 2 {
+		t.Errorf("SearchConfigs(22) = %+v, %v, want both repositories", hits, err)
+	}
+}
+
+func TestConfigQueryEmpty(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		empty bool
+	}{
+		{"", true},
+		{"scope=config&limit=10", true},
+		{"env=*_TOKEN", false},
+		{"created_by=curl", false},
+		{"registry=ghcr.io", false},
+		{"namespace=acme", false},
+		{"repository=mirror", false},
+	} {
+		q, err := parseConfigQuery(httptest.NewRequest(http.MethodGet, "/search?"+tc.query, nil))
+		if err != nil {
+			t.Fatalf("parseConfigQuery(%q): %v", tc.query, err)
+		}
+		if got := q.empty(); got != tc.empty {
+			t.Errorf("parseConfigQuery(%q).empty() = %v, want %v", tc.query, got, tc.empty)
+		}
+	}
+}
@@ -1,12 +1,12 @@
 package explore
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/authn"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
-	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
 
@@ -15,6 +15,24 @@ type RedirectCookie struct {
 	Url    string
 }
 
+// ping is transport.Ping, remembered per registry.
+func (h *handler) ping(ctx context.Context, reg name.Registry, t http.RoundTripper) (*transport.PingResp, error) {
+	h.Lock()
+	pr, ok := h.pings[reg.String()]
+	h.Unlock()
+	if ok {
+		return pr, nil
+	}
+	pr, err := transport.Ping(ctx, reg, t)
+	if err != nil {
+		return nil, err
+	}
+	h.Lock()
+	h.pings[reg.String()] = pr
+	h.Unlock()
+	return pr, nil
+}
+
 func (h *handler) transportFromCookie(w http.ResponseWriter, r *http.Request, repo string, auth authn.Authenticator) (http.RoundTripper, error) {
 	parsed, err := name.NewRepository(repo)
 	if err != nil {
@@ -23,24 +41,14 @@ func (h *handler) transportFromCookie(w http.ResponseWriter, r *http.Request, re
 	scopes := []string{parsed.Scope(transport.PullScope)}
 	reg := parsed.Registry
 
-	t := remote.DefaultTransport
-	t = transport.NewRetry(t)
-	t = transport.NewUserAgent(t, h.userAgent)
+	t := h.transport(r.Context())
 	if r.URL.Query().Get("trace") != "" {
 		t = transport.NewTracer(t)
 	}
 
-	h.Lock()
-	pr, ok := h.pings[reg.String()]
-	h.Unlock()
-	if !ok {
-		pr, err = transport.Ping(r.Context(), reg, t)
-		if err != nil {
-			return nil, err
-		}
-		h.Lock()
-		h.pings[reg.String()] = pr
-		h.Unlock()
+	pr, err := h.ping(r.Context(), reg, t)
+	if err != nil {
+		return nil, err
 	}
 
 	h.Lock()
@@ -0,0 +1,713 @@
+package explore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// Bounds on registry crawls.
+const (
+	defaultCrawlConcurrency = 2
+	maxCrawlConcurrency     = 16
+	defaultCrawlRate        = 5   // requests per second
+	crawlBatchSize          = 100 // pending repositories picked up at a time
+)
+
+// Repositories asked for per catalog page, a var so tests can page through
+// a small catalog.
+var crawlPageSize = 100
+
+// Crawl walks a registry's whole catalog, listing the tags of every
+// repository and resolving their manifests, and optionally indexing their
+// layers. Its progress is in SQLite, so it picks up where it was after a
+// restart.
+type Crawl struct {
+	ID          int64   `json:"id"`
+	Registry    string  `json:"registry"`
+	Profile     string  `json:"profile,omitempty"`
+	Concurrency int     `json:"concurrency"` // repositories at a time
+	Rate        float64 `json:"rate"`        // requests per second, 0 for no limit
+	Index       bool    `json:"index"`       // index layers too
+	State       string  `json:"state"`       // "running", "paused", "done" or "failed"
+	Next        string  `json:"next,omitempty"`
+	Listed      bool    `json:"listed"` // whether the whole catalog has been listed
+	Error       string  `json:"error,omitempty"`
+	StartedAt   string  `json:"started_at,omitempty"`
+	UpdatedAt   string  `json:"updated_at,omitempty"`
+
+	Repos  int `json:"repos"`
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+}
+
+// CrawlRepo is how crawling one repository went.
+type CrawlRepo struct {
+	Repository string `json:"repository"`
+	State      string `json:"state"` // "pending", "done" or "failed"
+	Tags       int    `json:"tags"`
+	Manifests  int    `json:"manifests"`
+	Layers     int    `json:"layers"`
+	Error      string `json:"error,omitempty"`
+	UpdatedAt  string `json:"updated_at,omitempty"`
+}
+
+// crawlRun is a crawl going on in this process.
+type crawlRun struct {
+	cancel context.CancelFunc
+}
+
+type crawlLimiterKey struct{}
+
+// withCrawlLimiter makes every request made with ctx wait for l.
+func withCrawlLimiter(ctx context.Context, l *rate.Limiter) context.Context {
+	return context.WithValue(ctx, crawlLimiterKey{}, l)
+}
+
+func crawlLimiter(ctx context.Context) *rate.Limiter {
+	l, _ := ctx.Value(crawlLimiterKey{}).(*rate.Limiter)
+	return l
+}
+
+// limitedTransport holds each request until the limiter lets it through.
+type limitedTransport struct {
+	inner   http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.inner.RoundTrip(req)
+}
+
+// AddCrawl records a new crawl and returns its ID.
+func (t *TocDB) AddCrawl(c Crawl) (int64, error) {
+	if err := t.init(); err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res, err := t.db.Exec(
+		`INSERT INTO crawls (registry, profile, concurrency, rate, index_layers, state) VALUES (?, ?, ?, ?, ?, ?)`,
+		c.Registry, c.Profile, c.Concurrency, c.Rate, c.Index, c.State,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const crawlColumns = `c.id, c.registry, c.profile, c.concurrency, c.rate, c.index_layers, c.state, c.next, c.listed, c.error, c.started_at, c.updated_at,
+	(SELECT COUNT(*) FROM crawl_repos WHERE crawl_id = c.id),
+	(SELECT COUNT(*) FROM crawl_repos WHERE crawl_id = c.id AND state = 'done'),
+	(SELECT COUNT(*) FROM crawl_repos WHERE crawl_id = c.id AND state = 'failed')`
+
+func scanCrawl(row interface{ Scan(...any) error }) (Crawl, error) {
+	var (
+		c                        Crawl
+		errText, started, update sql.NullString
+	)
+	err := row.Scan(&c.ID, &c.Registry, &c.Profile, &c.Concurrency, &c.Rate, &c.Index, &c.State, &c.Next, &c.Listed,
+		&errText, &started, &update, &c.Repos, &c.Done, &c.Failed)
+	c.Error, c.StartedAt, c.UpdatedAt = errText.String, started.String, update.String
+	return c, err
+}
+
+// Crawls returns every crawl, newest first.
+func (t *TocDB) Crawls() ([]Crawl, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	rows, err := t.db.Query(`SELECT ` + crawlColumns + ` FROM crawls c ORDER BY c.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	crawls := []Crawl{}
+	for rows.Next() {
+		c, err := scanCrawl(rows)
+		if err != nil {
+			return nil, err
+		}
+		crawls = append(crawls, c)
+	}
+	return crawls, rows.Err()
+}
+
+// Crawl returns crawl id.
+func (t *TocDB) Crawl(id int64) (Crawl, error) {
+	if err := t.init(); err != nil {
+		return Crawl{}, err
+	}
+	c, err := scanCrawl(t.db.QueryRow(`SELECT `+crawlColumns+` FROM crawls c WHERE c.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, fmt.Errorf("no crawl %d", id)
+	}
+	return c, err
+}
+
+// CrawlRepos returns up to limit of crawl id's repositories, optionally in
+// one state, the most recently crawled first.
+func (t *TocDB) CrawlRepos(id int64, state string, limit int) ([]CrawlRepo, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	query := `SELECT repository, state, tags, manifests, layers, error, updated_at FROM crawl_repos WHERE crawl_id = ?`
+	args := []any{id}
+	if state != "" {
+		query += ` AND state = ?`
+		args = append(args, state)
+	}
+	query += ` ORDER BY updated_at IS NULL, updated_at DESC, repository LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	repos := []CrawlRepo{}
+	for rows.Next() {
+		var (
+			cr            CrawlRepo
+			errText, when sql.NullString
+		)
+		if err := rows.Scan(&cr.Repository, &cr.State, &cr.Tags, &cr.Manifests, &cr.Layers, &errText, &when); err != nil {
+			return nil, err
+		}
+		cr.Error, cr.UpdatedAt = errText.String, when.String
+		repos = append(repos, cr)
+	}
+	return repos, rows.Err()
+}
+
+// RemoveCrawl forgets crawl id and its progress.
+func (t *TocDB) RemoveCrawl(id int64) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM crawl_repos WHERE crawl_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM crawls WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setCrawlState records where crawl id is at and why it stopped, if it did.
+func (t *TocDB) setCrawlState(id int64, state string, crawlErr error) error {
+	var errText *string
+	if crawlErr != nil {
+		s := crawlErr.Error()
+		errText = &s
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.db.Exec(`UPDATE crawls SET state = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, state, errText, id)
+	return err
+}
+
+// addCrawlPage queues the repositories on a catalog page along with the
+// page after it, so a restart carries on from there.
+func (t *TocDB) addCrawlPage(id int64, repos []string, next string, listed bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, repo := range repos {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO crawl_repos (crawl_id, repository) VALUES (?, ?)`, id, repo); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE crawls SET next = ?, listed = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, next, listed, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *TocDB) pendingCrawlRepos(id int64, limit int) ([]string, error) {
+	rows, err := t.db.Query(`SELECT repository FROM crawl_repos WHERE crawl_id = ? AND state = 'pending' ORDER BY repository LIMIT ?`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	repos := []string{}
+	for rows.Next() {
+		var repo string
+		if err := rows.Scan(&repo); err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, rows.Err()
+}
+
+func (t *TocDB) finishCrawlRepo(id int64, cr CrawlRepo) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.db.Exec(
+		`UPDATE crawl_repos SET state = ?, tags = ?, manifests = ?, layers = ?, error = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP
+		 WHERE crawl_id = ? AND repository = ?`,
+		cr.State, cr.Tags, cr.Manifests, cr.Layers, cr.Error, id, cr.Repository,
+	)
+	return err
+}
+
+// retryCrawlRepos puts crawl id's failed repositories back in the queue.
+func (t *TocDB) retryCrawlRepos(id int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.db.Exec(`UPDATE crawl_repos SET state = 'pending', error = NULL WHERE crawl_id = ? AND state = 'failed'`, id)
+	return err
+}
+
+// resumeCrawls restarts the crawls that were running when we last stopped.
+func (h *handler) resumeCrawls() {
+	crawls, err := h.tocDB.Crawls()
+	if err != nil {
+		log.Printf("[crawl] Crawls: %v", err)
+		return
+	}
+	for _, c := range crawls {
+		if c.State == "running" {
+			log.Printf("[crawl] resuming %d (%s)", c.ID, c.Registry)
+			h.startCrawl(c.ID)
+		}
+	}
+}
+
+// startCrawl runs crawl id in the background, unless it already is.
+func (h *handler) startCrawl(id int64) {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.crawls[id]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &crawlRun{cancel: cancel}
+	h.crawls[id] = run
+
+	go func() {
+		err := h.runCrawl(ctx, id)
+		stopped := ctx.Err() != nil
+		cancel()
+
+		h.Lock()
+		if h.crawls[id] == run {
+			delete(h.crawls, id)
+		}
+		h.Unlock()
+
+		// Whoever stopped it has already said why.
+		if stopped {
+			return
+		}
+		state := "done"
+		if err != nil {
+			log.Printf("[crawl] %d: %v", id, err)
+			state = "failed"
+		}
+		if err := h.tocDB.setCrawlState(id, state, err); err != nil {
+			log.Printf("[crawl] setCrawlState: %v", err)
+		}
+	}()
+}
+
+// stopCrawl cancels crawl id if it's running here.
+func (h *handler) stopCrawl(id int64) {
+	h.Lock()
+	defer h.Unlock()
+	if run, ok := h.crawls[id]; ok {
+		run.cancel()
+		delete(h.crawls, id)
+	}
+}
+
+// runCrawl lists the rest of the catalog, then crawls every repository
+// that's still pending, until there are none or ctx is done.
+func (h *handler) runCrawl(ctx context.Context, id int64) error {
+	c, err := h.tocDB.Crawl(id)
+	if err != nil {
+		return err
+	}
+	reg, err := name.NewRegistry(c.Registry)
+	if err != nil {
+		return err
+	}
+	ctx = withProfile(ctx, c.Profile)
+	if c.Rate > 0 {
+		ctx = withCrawlLimiter(ctx, rate.NewLimiter(rate.Limit(c.Rate), 1))
+	}
+
+	for !c.Listed {
+		opts := append(h.backgroundOptions(ctx, reg), remote.WithPageSize(crawlPageSize))
+		page, err := remote.CatalogPage(reg, c.Next, opts...)
+		if err != nil {
+			return fmt.Errorf("listing the catalog: %w", err)
+		}
+		// A registry handing back the page we asked for would go on forever.
+		if page.Next == c.Next {
+			page.Next = ""
+		}
+		c.Next, c.Listed = page.Next, page.Next == ""
+		if err := h.tocDB.addCrawlPage(id, page.Repos, c.Next, c.Listed); err != nil {
+			return err
+		}
+	}
+
+	for {
+		repos, err := h.tocDB.pendingCrawlRepos(id, crawlBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(repos) == 0 {
+			return nil
+		}
+
+		var g errgroup.Group
+		g.SetLimit(max(c.Concurrency, 1))
+		for _, repo := range repos {
+			g.Go(func() error {
+				return h.crawlRepo(ctx, id, reg, repo, c.Index)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// crawlRepo lists repo's tags and resolves (or indexes) every one of them.
+// It only returns an error if the outcome couldn't be recorded; a repository
+// that's interrupted stays pending.
+func (h *handler) crawlRepo(ctx context.Context, id int64, reg name.Registry, repo string, index bool) error {
+	cr := CrawlRepo{Repository: repo, State: "done"}
+
+	r, err := name.NewRepository(reg.Name() + "/" + repo)
+	if err != nil {
+		cr.State, cr.Error = "failed", err.Error()
+		return h.tocDB.finishCrawlRepo(id, cr)
+	}
+	tags, err := remote.List(r, h.backgroundOptions(ctx, r)...)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		cr.State, cr.Error = "failed", err.Error()
+		return h.tocDB.finishCrawlRepo(id, cr)
+	}
+
+	refs := make([]string, 0, len(tags.Tags))
+	for _, tag := range tags.Tags {
+		refs = append(refs, r.Tag(tag).String())
+	}
+	b := newBatch(h, 1)
+	b.skipLayers = !index
+	report := b.Index(ctx, refs)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	cr.Tags, cr.Manifests, cr.Layers = len(refs), report.Manifests, report.Layers
+	if n := len(report.Failed); n != 0 {
+		cr.State = "failed"
+		cr.Error = fmt.Sprintf("%s: %s", report.Failed[0].Ref, report.Failed[0].Error)
+		if n > 1 {
+			cr.Error = fmt.Sprintf("%d failures, the first %s", n, cr.Error)
+		}
+	}
+	return h.tocDB.finishCrawlRepo(id, cr)
+}
+
+// Start, pause and resume crawls, and show how they're going.
+func (h *handler) renderCrawls(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodPost {
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request", http.StatusForbidden)
+			return nil
+		}
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		action := r.PostForm.Get("action")
+		if action == "start" {
+			id, err := h.addCrawl(r)
+			if err != nil {
+				return err
+			}
+			h.startCrawl(id)
+			http.Redirect(w, r, fmt.Sprintf("/crawl?id=%d", id), http.StatusSeeOther)
+			return nil
+		}
+
+		id, err := strconv.ParseInt(r.PostForm.Get("id"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("id: %w", err)
+		}
+		if _, err := h.tocDB.Crawl(id); err != nil {
+			return err
+		}
+		switch action {
+		case "pause":
+			h.stopCrawl(id)
+			if err := h.tocDB.setCrawlState(id, "paused", nil); err != nil {
+				return err
+			}
+		case "resume":
+			if err := h.tocDB.retryCrawlRepos(id); err != nil {
+				return err
+			}
+			if err := h.tocDB.setCrawlState(id, "running", nil); err != nil {
+				return err
+			}
+			h.startCrawl(id)
+		case "remove":
+			h.stopCrawl(id)
+			if err := h.tocDB.RemoveCrawl(id); err != nil {
+				return err
+			}
+			http.Redirect(w, r, "/crawl", http.StatusSeeOther)
+			return nil
+		default:
+			return fmt.Errorf("unknown action %q", action)
+		}
+		http.Redirect(w, r, fmt.Sprintf("/crawl?id=%d", id), http.StatusSeeOther)
+		return nil
+	}
+
+	qs := r.URL.Query()
+	if s := qs.Get("id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("id: %w", err)
+		}
+		return h.renderCrawl(w, r, id)
+	}
+
+	crawls, err := h.tocDB.Crawls()
+	if err != nil {
+		return fmt.Errorf("Crawls: %w", err)
+	}
+	if wantsJSON(r) {
+		return writeJSON(w, crawls)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"crawls"}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, crawlForm, html.EscapeString(qs.Get("registry")), defaultCrawlConcurrency, maxCrawlConcurrency, defaultCrawlRate, h.profileSelect())
+
+	if len(crawls) == 0 {
+		fmt.Fprintf(w, "<p>no crawls yet</p>\n")
+	} else {
+		fmt.Fprintf(w, "<pre>\n")
+		for _, c := range crawls {
+			fmt.Fprintf(w, "<a href=\"/crawl?id=%d\">%4d</a> %-8s %s %s", c.ID, c.ID, c.State, crawlButtons(c), html.EscapeString(c.Registry))
+			writeCrawlProgress(w, c)
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// addCrawl records the crawl the start form asks for.
+func (h *handler) addCrawl(r *http.Request) (int64, error) {
+	host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(r.PostForm.Get("registry")), "https://"), "/")
+	reg, err := name.NewRegistry(host)
+	if err != nil {
+		return 0, err
+	}
+	c := Crawl{
+		Registry:    reg.Name(),
+		Profile:     r.PostForm.Get("profile"),
+		Concurrency: defaultCrawlConcurrency,
+		Rate:        defaultCrawlRate,
+		Index:       r.PostForm.Get("index") != "",
+		State:       "running",
+	}
+	if _, err := h.profiles.Get(c.Profile); err != nil {
+		return 0, err
+	}
+	if s := r.PostForm.Get("concurrency"); s != "" {
+		if c.Concurrency, err = strconv.Atoi(s); err != nil {
+			return 0, fmt.Errorf("concurrency: %w", err)
+		}
+		if c.Concurrency < 1 || c.Concurrency > maxCrawlConcurrency {
+			return 0, fmt.Errorf("concurrency must be between 1 and %d", maxCrawlConcurrency)
+		}
+	}
+	if s := r.PostForm.Get("rate"); s != "" {
+		if c.Rate, err = strconv.ParseFloat(s, 64); err != nil {
+			return 0, fmt.Errorf("rate: %w", err)
+		}
+		if c.Rate < 0 {
+			return 0, fmt.Errorf("rate can't be negative")
+		}
+	}
+	return h.tocDB.AddCrawl(c)
+}
+
+// One crawl's repositories, with whatever went wrong.
+func (h *handler) renderCrawl(w http.ResponseWriter, r *http.Request, id int64) error {
+	c, err := h.tocDB.Crawl(id)
+	if err != nil {
+		return err
+	}
+	qs := r.URL.Query()
+	state := qs.Get("state")
+	limit := defaultSearchLimit
+	if v := qs.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("limit: %w", err)
+		}
+		if limit <= 0 || limit > maxSearchLimit {
+			limit = defaultSearchLimit
+		}
+	}
+	repos, err := h.tocDB.CrawlRepos(id, state, limit)
+	if err != nil {
+		return fmt.Errorf("CrawlRepos: %w", err)
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, struct {
+			Crawl
+			Repositories []CrawlRepo `json:"repositories"`
+		}{c, repos})
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"crawl " + c.Registry}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, "<h2>%s</h2>\n<pre>\n%s %s", html.EscapeString(c.Registry), c.State, crawlButtons(c))
+	writeCrawlProgress(w, c)
+	fmt.Fprintf(w, "\nstarted %s, %d at a time", c.StartedAt, c.Concurrency)
+	if c.Rate > 0 {
+		fmt.Fprintf(w, ", %g requests/s", c.Rate)
+	}
+	if c.Index {
+		fmt.Fprintf(w, ", indexing layers")
+	}
+	fmt.Fprintf(w, "\n</pre>\n")
+
+	fmt.Fprintf(w, "<p>")
+	for _, s := range []string{"", "done", "failed", "pending"} {
+		label := s
+		if label == "" {
+			label = "all"
+		}
+		if s == state {
+			fmt.Fprintf(w, "%s ", label)
+		} else {
+			fmt.Fprintf(w, "<a href=\"/crawl?id=%d&state=%s\">%s</a> ", id, s, label)
+		}
+	}
+	fmt.Fprintf(w, "</p>\n")
+
+	if len(repos) == 0 {
+		fmt.Fprintf(w, "<p>none</p>\n")
+	} else {
+		fmt.Fprintf(w, "<pre>\n")
+		for _, cr := range repos {
+			repo := c.Registry + "/" + cr.Repository
+			fmt.Fprintf(w, "%-7s <a href=\"/?repo=%s\">%s</a> %d tags, %d manifests", cr.State, url.QueryEscape(repo), html.EscapeString(cr.Repository), cr.Tags, cr.Manifests)
+			if c.Index {
+				fmt.Fprintf(w, ", %d layers", cr.Layers)
+			}
+			if cr.Error != "" {
+				fmt.Fprintf(w, " <span class=\"flag\">error</span> %s", html.EscapeString(cr.Error))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// crawlButtons are the forms that pause, resume or remove c.
+func crawlButtons(c Crawl) string {
+	button := func(action, label string) string {
+		return fmt.Sprintf("<form style=\"display:inline\" method=\"POST\" action=\"/crawl\"><input type=\"hidden\" name=\"action\" value=\"%s\"/><input type=\"hidden\" name=\"id\" value=\"%d\"/><input type=\"submit\" value=\"%s\"/></form>", action, c.ID, label)
+	}
+	s := button("remove", "x")
+	switch c.State {
+	case "running":
+		s += button("pause", "pause")
+	case "paused", "failed":
+		s += button("resume", "resume")
+	case "done":
+		if c.Failed != 0 {
+			s += button("resume", "retry")
+		}
+	}
+	return s
+}
+
+func writeCrawlProgress(w io.Writer, c Crawl) {
+	fmt.Fprintf(w, " <small>%d/%d repositories", c.Done+c.Failed, c.Repos)
+	if !c.Listed {
+		fmt.Fprintf(w, " so far, still listing the catalog")
+	}
+	fmt.Fprintf(w, "</small>")
+	if c.Failed != 0 {
+		fmt.Fprintf(w, " <a class=\"flag\" href=\"/crawl?id=%d&state=failed\">%d failed</a>", c.ID, c.Failed)
+	}
+	if c.Profile != "" {
+		fmt.Fprintf(w, " <small>via %s</small>", html.EscapeString(c.Profile))
+	}
+	if c.Error != "" {
+		fmt.Fprintf(w, " <span class=\"flag\" title=\"%s\">error</span>", html.EscapeString(c.Error))
+	}
+}
+
+const crawlForm = `
+<form action="/crawl" method="POST" autocomplete="off" spellcheck="false">
+<p>
+<input type="hidden" name="action" value="start"/>
+<input size="30" type="text" name="registry" placeholder="registry.example.com" value="%s"/>
+<input size="3" type="number" name="concurrency" title="repositories at a time" value="%d" min="1" max="%d"/>
+<input size="4" type="text" name="rate" title="requests per second, 0 for no limit" value="%d"/> req/s
+<label><input type="checkbox" name="index"/> index layers</label>
+%s<input type="submit" value="crawl"/>
+</p>
+</form>
+`
@@ -0,0 +1,142 @@
+package explore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/registry"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestCrawl(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	for _, ref := range []string{"acme/a:v1", "acme/b:v1", "acme/b:v2", "acme/c:v1", "acme/d:v1"} {
+		tag, err := name.NewTag(host + "/" + ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(tag, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(n int) { crawlPageSize = n }(crawlPageSize)
+	crawlPageSize = 2
+
+	h := &handler{profiles: builtinProfiles(), tocDB: NewTocDB(filepath.Join(t.TempDir(), "log.db")), crawls: map[int64]*crawlRun{}}
+	defer h.tocDB.Close()
+
+	id, err := h.tocDB.AddCrawl(Crawl{Registry: host, Concurrency: 2, State: "running"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As if we'd been stopped after the first page, which also turned up a
+	// repository that has since gone away.
+	if err := h.tocDB.addCrawlPage(id, []string{"acme/a", "acme/gone"}, s.URL+"/v2/_catalog?n=2&last=acme%2Fa", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.runCrawl(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := h.tocDB.Crawl(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Listed || c.Next != "" || c.Repos != 5 || c.Done != 4 || c.Failed != 1 {
+		t.Errorf("crawl = %+v", c)
+	}
+
+	repos, err := h.tocDB.CrawlRepos(id, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]CrawlRepo{}
+	for _, cr := range repos {
+		got[cr.Repository] = cr
+	}
+	if b := got["acme/b"]; b.State != "done" || b.Tags != 2 || b.Manifests != 2 {
+		t.Errorf("acme/b = %+v", b)
+	}
+	if d := got["acme/d"]; d.State != "done" || d.Tags != 1 {
+		t.Errorf("acme/d, from the last catalog page = %+v", d)
+	}
+	if gone := got["acme/gone"]; gone.State != "failed" || gone.Error == "" {
+		t.Errorf("acme/gone = %+v", gone)
+	}
+
+	// Resuming retries what failed.
+	if err := h.tocDB.retryCrawlRepos(id); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := h.tocDB.pendingCrawlRepos(id, crawlBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != "acme/gone" {
+		t.Errorf("pending after retry = %v", pending)
+	}
+}
+
+func TestRenderCrawlsOrigin(t *testing.T) {
+	h := &handler{profiles: builtinProfiles(), tocDB: NewTocDB(filepath.Join(t.TempDir(), "log.db")), crawls: map[int64]*crawlRun{}}
+	defer h.tocDB.Close()
+	id, err := h.tocDB.AddCrawl(Crawl{Registry: "registry.example", Concurrency: 1, State: "running"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pause := url.Values{"action": {"pause"}, "id": {strconv.FormatInt(id, 10)}}
+	for _, tc := range []struct {
+		origin, site string
+		code         int
+		state        string
+	}{
+		{"https://evil.example", "", http.StatusForbidden, "running"},
+		{"", "cross-site", http.StatusForbidden, "running"},
+		{"http://example.com", "same-origin", http.StatusSeeOther, "paused"},
+		{"", "", http.StatusSeeOther, "paused"},
+	} {
+		if err := h.tocDB.setCrawlState(id, "running", nil); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/crawl", strings.NewReader(pause.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.site != "" {
+			req.Header.Set("Sec-Fetch-Site", tc.site)
+		}
+		w := httptest.NewRecorder()
+		if err := h.renderCrawls(w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tc.code {
+			t.Errorf("Origin %q, Sec-Fetch-Site %q: %d, want %d", tc.origin, tc.site, w.Code, tc.code)
+		}
+		c, err := h.tocDB.Crawl(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.State != tc.state {
+			t.Errorf("Origin %q, Sec-Fetch-Site %q: crawl %s, want %s", tc.origin, tc.site, c.State, tc.state)
+		}
+	}
+}
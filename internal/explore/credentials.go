@@ -0,0 +1,154 @@
+package explore
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/thesavant42/yolosint/internal/credstore"
+)
+
+// WithCredentialStore lets /admin/credentials edit s, for whoever has
+// adminToken. The store still has to be in the keychain to be used.
+func WithCredentialStore(s *credstore.Store, adminToken string) Option {
+	return func(h *handler) {
+		h.credStore = s
+		h.adminToken = adminToken
+	}
+}
+
+// CredentialJSON is a stored credential as /admin/credentials shows it,
+// which is everything but the secret.
+type CredentialJSON struct {
+	Match    string `json:"match"`
+	Kind     string `json:"kind"`
+	Username string `json:"username,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// checkAdmin is whether r carries the admin token, as a bearer token or the
+// password of basic auth.
+func (h *handler) checkAdmin(r *http.Request) bool {
+	tok := ""
+	if _, pass, ok := r.BasicAuth(); ok {
+		tok = pass
+	} else if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		tok = bearer
+	}
+	return tok != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(h.adminToken)) == 1
+}
+
+// sameOrigin rejects form posts from other sites, which the browser would
+// otherwise send along with its cached basic auth.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+	return true
+}
+
+// Manage the credential store.
+func (h *handler) renderCredentials(w http.ResponseWriter, r *http.Request) error {
+	if h.credStore == nil {
+		return fmt.Errorf("no credential store configured (CREDENTIALS_FILE)")
+	}
+	if h.adminToken == "" {
+		return fmt.Errorf("credentials can't be managed without ADMIN_TOKEN")
+	}
+	if !h.checkAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="yolosint admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method == http.MethodPost {
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request", http.StatusForbidden)
+			return nil
+		}
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		switch r.PostForm.Get("action") {
+		case "add":
+			e := credstore.Entry{
+				Match:    r.PostForm.Get("match"),
+				Kind:     r.PostForm.Get("kind"),
+				Username: strings.TrimSpace(r.PostForm.Get("username")),
+				Secret:   r.PostForm.Get("secret"),
+				Note:     r.PostForm.Get("note"),
+			}
+			if err := h.credStore.Put(e); err != nil {
+				return err
+			}
+		case "remove":
+			if err := h.credStore.Delete(r.PostForm.Get("match")); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown action %q", r.PostForm.Get("action"))
+		}
+
+		// Tokens fetched with the old credentials would outlive them.
+		h.Lock()
+		h.tokens = map[string]token{}
+		h.Unlock()
+
+		http.Redirect(w, r, "/admin/credentials", http.StatusSeeOther)
+		return nil
+	}
+
+	creds := []CredentialJSON{}
+	for _, e := range h.credStore.Entries() {
+		creds = append(creds, CredentialJSON{Match: e.Match, Kind: e.Kind, Username: e.Username, Note: e.Note})
+	}
+	if wantsJSON(r) {
+		return writeJSON(w, creds)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"credentials"}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprint(w, credentialForm)
+
+	if len(creds) == 0 {
+		fmt.Fprintf(w, "<p>no credentials stored yet</p>\n")
+	} else {
+		fmt.Fprintf(w, "<table>\n<tr><th></th><th>match</th><th>kind</th><th>username</th><th>note</th></tr>\n")
+		for _, c := range creds {
+			fmt.Fprintf(w, "<tr><td><form style=\"display:inline\" method=\"POST\" action=\"/admin/credentials\"><input type=\"hidden\" name=\"action\" value=\"remove\"/><input type=\"hidden\" name=\"match\" value=\"%s\"/><input type=\"submit\" value=\"x\"/></form></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+				html.EscapeString(c.Match), html.EscapeString(c.Match), html.EscapeString(c.Kind), html.EscapeString(c.Username), html.EscapeString(c.Note))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+const credentialForm = `
+<form action="/admin/credentials" method="POST" autocomplete="off" spellcheck="false">
+<p>
+<input type="hidden" name="action" value="add"/>
+<input size="30" type="text" name="match" placeholder="ghcr.io or quay.io/org"/>
+<select name="kind">
+  <option value="basic">username and password</option>
+  <option value="identity-token">identity token</option>
+  <option value="bearer">bearer token</option>
+</select>
+<input size="15" type="text" name="username" placeholder="username"/>
+<input size="25" type="password" name="secret" placeholder="password or token"/>
+<input size="20" type="text" name="note" placeholder="note"/>
+<input type="submit" value="save"/>
+</p>
+</form>
+`
@@ -0,0 +1,80 @@
+package explore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/internal/credstore"
+)
+
+func TestRenderCredentials(t *testing.T) {
+	store, err := credstore.Open(filepath.Join(t.TempDir(), "creds.json"), []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handler{credStore: store, adminToken: "letmein", tokens: map[string]token{"ghcr.io/acme/app": {}}}
+
+	post := func(form url.Values, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/credentials", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("admin", "letmein")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		if err := h.renderCredentials(w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/credentials?format=json", nil)
+	w := httptest.NewRecorder()
+	if err := h.renderCredentials(w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without the token: %d, want 401", w.Code)
+	}
+
+	add := url.Values{"action": {"add"}, "match": {"ghcr.io/acme"}, "kind": {"basic"}, "username": {"bob"}, "secret": {"ghp_secret"}}
+	if w := post(add, "https://evil.example"); w.Code != http.StatusForbidden {
+		t.Errorf("cross-origin add: %d, want 403", w.Code)
+	}
+	if len(store.Entries()) != 0 {
+		t.Fatalf("cross-origin add went through")
+	}
+	if w := post(add, "http://example.com"); w.Code != http.StatusSeeOther {
+		t.Errorf("add: %d, want 303", w.Code)
+	}
+	if len(h.tokens) != 0 {
+		t.Errorf("cached tokens survived a credential change")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/credentials?format=json", nil)
+	req.Header.Set("Authorization", "Bearer letmein")
+	w = httptest.NewRecorder()
+	if err := h.renderCredentials(w, req); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(w.Body.String(), "ghp_secret") {
+		t.Errorf("secret in listing: %s", w.Body)
+	}
+	var creds []CredentialJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &creds); err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 1 || creds[0].Match != "ghcr.io/acme" || creds[0].Username != "bob" {
+		t.Errorf("listing = %+v", creds)
+	}
+
+	post(url.Values{"action": {"remove"}, "match": {"ghcr.io/acme"}}, "")
+	if len(store.Entries()) != 0 {
+		t.Errorf("remove didn't")
+	}
+}
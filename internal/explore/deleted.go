@@ -0,0 +1,99 @@
+package explore
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/thesavant42/yolosint/internal/soci"
+)
+
+// Files that later layers deleted or overwrote, i.e. everything /layers/ hides.
+func (h *handler) renderDeleted(w http.ResponseWriter, r *http.Request) error {
+	dig, ref, err := h.getDigest(w, r)
+	if err != nil {
+		return err
+	}
+
+	desc, err := h.fetchManifest(w, r, dig)
+	if err != nil {
+		return err
+	}
+
+	mfs, err := h.multiFS(w, r, dig, desc, ref)
+	if err != nil {
+		return err
+	}
+
+	shadowed := mfs.Shadowed()
+
+	// Allow this to be cached for an hour.
+	w.Header().Set("Cache-Control", "max-age=3600, immutable")
+
+	if wantsJSON(r) {
+		return writeJSON(w, shadowed)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"deleted " + dig.String()}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	u := *r.URL
+	qs := u.Query()
+	qs.Set("format", "json")
+	u.RawQuery = qs.Encode()
+	fmt.Fprintf(w, "<p>%d files in lower layers of %s are hidden from <a href=\"/layers/%s/\">the combined view</a> (<a href=\"%s\">json</a>)</p>\n",
+		len(shadowed), html.EscapeString(dig.String()), dig.String(), html.EscapeString(u.String()))
+
+	if len(shadowed) == 0 {
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, sf := range shadowed {
+		fmt.Fprint(w, shadowedRow(sf))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// shadowedRow is one line of /deleted/. Names, layers and whiteouts all come
+// from the tars, so everything is escaped.
+func shadowedRow(sf soci.ShadowedFile) string {
+	mode := fs.FileMode(sf.Mode).String()
+	ts := sf.ModTime.Format("2006-01-02 15:04")
+
+	href := (&url.URL{Path: path.Join("/fs/", sf.Layer, sf.Name)}).String()
+	name := fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(href), html.EscapeString(sf.Name))
+	if sf.Linkname != "" {
+		name += " -> " + html.EscapeString(sf.Linkname)
+	}
+
+	title := sf.By
+	if sf.Whiteout != "" {
+		title += " " + sf.Whiteout
+	}
+	return fmt.Sprintf("<span title=\"%s\">%s</span> %s <span title=\"%s\">%12d</span> %s %s <span title=\"%s\">%s by %s</span>\n",
+		html.EscapeString(sf.Layer), html.EscapeString(shortLayer(sf.Layer)), mode, humanize.IBytes(uint64(sf.Size)), sf.Size, ts, name,
+		html.EscapeString(title), html.EscapeString(sf.Reason), html.EscapeString(shortLayer(sf.By)))
+}
+
+// shortLayer turns "repo@sha256:abcdef..." into "abcdef12".
+func shortLayer(ref string) string {
+	if _, after, ok := strings.Cut(ref, "@"); ok {
+		ref = after
+	}
+	if _, after, ok := strings.Cut(ref, ":"); ok && len(after) > 8 {
+		return after[:8]
+	}
+	return ref
+}
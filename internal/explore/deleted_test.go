@@ -0,0 +1,39 @@
+package explore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/internal/soci"
+)
+
+func TestShadowedRow(t *testing.T) {
+	const layer = "acme/app@sha256:5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5"
+	for _, tc := range []struct {
+		sf   soci.ShadowedFile
+		want []string
+	}{{
+		sf:   soci.ShadowedFile{Name: "etc/passwd", Layer: layer, Reason: "overwritten", By: layer},
+		want: []string{`href="/fs/acme/app@sha256:5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5/etc/passwd"`, ">overwritten by 5994471a</span>"},
+	}, {
+		sf: soci.ShadowedFile{
+			Name:     `x" onmouseover="alert(1)`,
+			Layer:    layer,
+			Reason:   "whiteout",
+			By:       layer,
+			Whiteout: `.wh.x" onmouseover="alert(1)`,
+			Linkname: "<script>",
+		},
+		want: []string{`.wh.x&#34; onmouseover=&#34;alert(1)"`, `x&#34; onmouseover=&#34;alert(1)</a>`, "-> &lt;script&gt;"},
+	}} {
+		got := shadowedRow(tc.sf)
+		for _, want := range tc.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("shadowedRow(%q) = %s, want %s", tc.sf.Name, got, want)
+			}
+		}
+		if strings.Contains(got, `" onmouseover`) || strings.Contains(got, "<script>") {
+			t.Errorf("shadowedRow(%q) is not escaped: %s", tc.sf.Name, got)
+		}
+	}
+}
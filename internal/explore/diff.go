@@ -0,0 +1,499 @@
+package explore
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	unicodeutf8 "unicode/utf8"
+
+	"github.com/thesavant42/yolosint/internal/soci"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Bounds on content diffs, which are computed in memory.
+const (
+	maxDiffSize  = 1 << 20
+	maxDiffCells = 1 << 22 // changed lines in a * changed lines in b
+	diffContext  = 3
+)
+
+// FileChange is one path that differs between two flattened images.
+type FileChange struct {
+	Path   string   `json:"path"`
+	Change string   `json:"change"`           // "added", "removed" or "modified"
+	Fields []string `json:"fields,omitempty"` // what was modified
+
+	A *soci.FlatFile `json:"a,omitempty"`
+	B *soci.FlatFile `json:"b,omitempty"`
+}
+
+// Diffable reports whether both sides are regular files small enough to
+// compare contents.
+func (fc *FileChange) Diffable() bool {
+	return fc.A != nil && fc.B != nil &&
+		fc.A.Typeflag == tar.TypeReg && fc.B.Typeflag == tar.TypeReg &&
+		fc.A.Size <= maxDiffSize && fc.B.Size <= maxDiffSize
+}
+
+// diffFiles compares two Flatten results, sorted by directory and then name,
+// so each directory's changes are together.
+func diffFiles(a, b map[string]*soci.FlatFile) []FileChange {
+	changes := []FileChange{}
+	for p, af := range a {
+		bf, ok := b[p]
+		if !ok {
+			changes = append(changes, FileChange{Path: p, Change: "removed", A: af})
+			continue
+		}
+		if fields := changedFields(&af.TOCFile, &bf.TOCFile); len(fields) != 0 {
+			changes = append(changes, FileChange{Path: p, Change: "modified", Fields: fields, A: af, B: bf})
+		}
+	}
+	for p, bf := range b {
+		if _, ok := a[p]; !ok {
+			changes = append(changes, FileChange{Path: p, Change: "added", B: bf})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		di, dj := path.Dir(changes[i].Path), path.Dir(changes[j].Path)
+		if di != dj {
+			return di < dj
+		}
+		return path.Base(changes[i].Path) < path.Base(changes[j].Path)
+	})
+	return changes
+}
+
+func changedFields(a, b *soci.TOCFile) []string {
+	fields := []string{}
+	if a.Typeflag != b.Typeflag {
+		fields = append(fields, "type")
+	}
+	if a.Size != b.Size {
+		fields = append(fields, "size")
+	}
+	if a.Mode != b.Mode {
+		fields = append(fields, "mode")
+	}
+	if a.Uid != b.Uid {
+		fields = append(fields, "uid")
+	}
+	if a.Gid != b.Gid {
+		fields = append(fields, "gid")
+	}
+	if !a.ModTime.Equal(b.ModTime) {
+		fields = append(fields, "mtime")
+	}
+	if a.Linkname != b.Linkname {
+		fields = append(fields, "linkname")
+	}
+	// Layers indexed before digests were recorded have none to compare.
+	if a.SHA256 != "" && b.SHA256 != "" && a.SHA256 != b.SHA256 {
+		fields = append(fields, "content")
+	}
+	return fields
+}
+
+// resolveImage turns a tag or digest into a single-platform image, picking
+// ?platform= (default linux/amd64) out of an index.
+func (h *handler) resolveImage(w http.ResponseWriter, r *http.Request, s string) (name.Digest, *remote.Descriptor, error) {
+	ref, err := name.ParseReference(s)
+	if err != nil {
+		return name.Digest{}, nil, err
+	}
+	desc, err := h.fetchManifest(w, r, ref)
+	if err != nil {
+		return name.Digest{}, nil, err
+	}
+
+	if desc.MediaType.IsIndex() {
+		want := v1.Platform{OS: "linux", Architecture: "amd64"}
+		if p := r.URL.Query().Get("platform"); p != "" {
+			parsed, err := v1.ParsePlatform(p)
+			if err != nil {
+				return name.Digest{}, nil, err
+			}
+			want = *parsed
+		}
+
+		idx, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+		if err != nil {
+			return name.Digest{}, nil, err
+		}
+		var child *v1.Descriptor
+		for i, m := range idx.Manifests {
+			if !m.MediaType.IsImage() {
+				continue
+			}
+			if child == nil {
+				child = &idx.Manifests[i]
+			}
+			if m.Platform != nil && m.Platform.Satisfies(want) {
+				child = &idx.Manifests[i]
+				break
+			}
+		}
+		if child == nil {
+			return name.Digest{}, nil, fmt.Errorf("%s: no images in index", s)
+		}
+
+		desc, err = h.fetchManifest(w, r, ref.Context().Digest(child.Digest.String()))
+		if err != nil {
+			return name.Digest{}, nil, err
+		}
+	}
+
+	if !desc.MediaType.IsImage() {
+		return name.Digest{}, nil, fmt.Errorf("%s: cannot diff %s", s, desc.MediaType)
+	}
+	return ref.Context().Digest(desc.Digest.String()), desc, nil
+}
+
+func (h *handler) flatten(w http.ResponseWriter, r *http.Request, s string) (name.Digest, map[string]*soci.FlatFile, error) {
+	dig, desc, err := h.resolveImage(w, r, s)
+	if err != nil {
+		return name.Digest{}, nil, err
+	}
+	mfs, err := h.multiFS(w, r, dig, desc, "/layers/"+dig.String())
+	if err != nil {
+		return name.Digest{}, nil, err
+	}
+	return dig, mfs.Flatten(), nil
+}
+
+// Compare the flattened filesystems of ?a= and ?b=, or the contents of one ?file=.
+func (h *handler) renderDiff(w http.ResponseWriter, r *http.Request) error {
+	qs := r.URL.Query()
+	a, b := strings.TrimSpace(qs.Get("a")), strings.TrimSpace(qs.Get("b"))
+	if a == "" || b == "" {
+		if err := headerTmpl.Execute(w, TitleData{"diff"}); err != nil {
+			return err
+		}
+		fmt.Fprint(w, searchHeader)
+		fmt.Fprintf(w, diffForm, html.EscapeString(a), html.EscapeString(b), html.EscapeString(qs.Get("platform")))
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	adig, afiles, err := h.flatten(w, r, a)
+	if err != nil {
+		return fmt.Errorf("a: %w", err)
+	}
+	bdig, bfiles, err := h.flatten(w, r, b)
+	if err != nil {
+		return fmt.Errorf("b: %w", err)
+	}
+
+	if file := qs.Get("file"); file != "" {
+		return h.renderFileDiff(w, r, path.Clean("/"+file), afiles, bfiles)
+	}
+
+	changes := diffFiles(afiles, bfiles)
+
+	if wantsJSON(r) {
+		return writeJSON(w, changes)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"diff " + a + " " + b}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, diffForm, html.EscapeString(a), html.EscapeString(b), html.EscapeString(qs.Get("platform")))
+
+	counts := map[string]int{}
+	for _, fc := range changes {
+		counts[fc.Change]++
+	}
+	u := *r.URL
+	jq := u.Query()
+	jq.Set("format", "json")
+	u.RawQuery = jq.Encode()
+	fmt.Fprintf(w, "<p><a href=\"/layers/%s/\">%s</a> &rarr; <a href=\"/layers/%s/\">%s</a>: %d added, %d removed, %d modified (<a href=%q>json</a>)</p>\n",
+		adig, html.EscapeString(a), bdig, html.EscapeString(b), counts["added"], counts["removed"], counts["modified"], u.String())
+
+	if len(changes) == 0 {
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	dir := ""
+	for i := range changes {
+		fc := &changes[i]
+		if d := path.Dir(fc.Path); d != dir {
+			dir = d
+			fmt.Fprintf(w, "\n<b>%s</b>\n", html.EscapeString(dir))
+		}
+		fmt.Fprintf(w, "  %s\n", h.diffLine(r, fc))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+func (h *handler) diffLine(r *http.Request, fc *FileChange) string {
+	link := func(f *soci.FlatFile) string {
+		href := (&url.URL{Path: path.Join("/fs/", f.Layer, f.Name)}).String()
+		return fmt.Sprintf("<a href=%q>%s</a>", href, html.EscapeString(path.Base(fc.Path)))
+	}
+
+	switch fc.Change {
+	case "added":
+		return fmt.Sprintf("+ %s %12d %s", fs.FileMode(fc.B.Mode), fc.B.Size, link(fc.B))
+	case "removed":
+		return fmt.Sprintf("- %s %12d %s", fs.FileMode(fc.A.Mode), fc.A.Size, link(fc.A))
+	}
+
+	changes := []string{}
+	for _, field := range fc.Fields {
+		var before, after any
+		switch field {
+		case "type":
+			before, after = string(fc.A.Typeflag), string(fc.B.Typeflag)
+		case "size":
+			before, after = fc.A.Size, fc.B.Size
+		case "mode":
+			before, after = fs.FileMode(fc.A.Mode), fs.FileMode(fc.B.Mode)
+		case "uid":
+			before, after = fc.A.Uid, fc.B.Uid
+		case "gid":
+			before, after = fc.A.Gid, fc.B.Gid
+		case "mtime":
+			before, after = fc.A.ModTime.Format("2006-01-02 15:04"), fc.B.ModTime.Format("2006-01-02 15:04")
+		case "linkname":
+			before, after = fc.A.Linkname, fc.B.Linkname
+		}
+		changes = append(changes, html.EscapeString(fmt.Sprintf("%s %v -> %v", field, before, after)))
+	}
+	line := fmt.Sprintf("~ %s %12d %s (%s)", fs.FileMode(fc.B.Mode), fc.B.Size, link(fc.B), strings.Join(changes, ", "))
+
+	if fc.Diffable() {
+		u := *r.URL
+		qs := u.Query()
+		qs.Set("file", fc.Path)
+		qs.Del("format")
+		u.RawQuery = qs.Encode()
+		line += fmt.Sprintf(" <a href=%q>diff</a>", u.String())
+	}
+	return line
+}
+
+func (h *handler) renderFileDiff(w http.ResponseWriter, r *http.Request, file string, afiles, bfiles map[string]*soci.FlatFile) error {
+	fc := &FileChange{Path: file, A: afiles[file], B: bfiles[file]}
+	if !fc.Diffable() {
+		return fmt.Errorf("%s: not a small regular file in both images", file)
+	}
+
+	read := func(f *soci.FlatFile) ([]byte, error) {
+		rc, err := f.Open(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, maxDiffSize))
+	}
+	a, err := read(fc.A)
+	if err != nil {
+		return fmt.Errorf("a: %w", err)
+	}
+	b, err := read(fc.B)
+	if err != nil {
+		return fmt.Errorf("b: %w", err)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"diff " + file}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	u := *r.URL
+	qs := u.Query()
+	qs.Del("file")
+	u.RawQuery = qs.Encode()
+	fmt.Fprintf(w, "<p><a href=%q>back to diff</a></p>\n", u.String())
+
+	switch {
+	case !isText(a) || !isText(b):
+		fmt.Fprintf(w, "<p>binary files differ</p>\n")
+	case bytes.Equal(a, b):
+		fmt.Fprintf(w, "<p>contents are identical</p>\n")
+	default:
+		diff, ok := unifiedDiff("a"+file, "b"+file, string(a), string(b))
+		if !ok {
+			fmt.Fprintf(w, "<p>too many changed lines to diff</p>\n")
+			break
+		}
+		fmt.Fprintf(w, "<pre>\n%s</pre>\n", html.EscapeString(diff))
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+func isText(b []byte) bool {
+	return unicodeutf8.Valid(b) && bytes.IndexByte(b, 0) == -1
+}
+
+type diffOp struct {
+	kind   byte // ' ', '-' or '+'
+	line   string
+	ai, bi int // lines of a and b before this one
+}
+
+// unifiedDiff is a small LCS-based diff -u. It gives up (returning false) if
+// the changed region is too big to diff in memory.
+func unifiedDiff(aName, bName, a, b string) (string, bool) {
+	ops, ok := diffLines(splitLines(a), splitLines(b))
+	if !ok {
+		return "", false
+	}
+
+	changed := []int{}
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return "", true
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for i := 0; i < len(changed); {
+		// Grow the hunk while the next change is within reach of its context.
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*diffContext+1 {
+			j++
+		}
+		start := max(0, changed[i]-diffContext)
+		end := min(len(ops), changed[j]+diffContext+1)
+
+		alen, blen := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				alen++
+			}
+			if op.kind != '-' {
+				blen++
+			}
+		}
+		astart, bstart := ops[start].ai, ops[start].bi
+		if alen != 0 {
+			astart++
+		}
+		if blen != 0 {
+			bstart++
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", astart, alen, bstart, blen)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = j + 1
+	}
+	return sb.String(), true
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) != 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func diffLines(a, b []string) ([]diffOp, bool) {
+	// Only run the LCS over what's between the common prefix and suffix.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	am, bm := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	n, m := len(am), len(bm)
+	if n*m > maxDiffCells {
+		return nil, false
+	}
+
+	// lcs[i*(m+1)+j] is the LCS length of am[i:] and bm[j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if am[i] == bm[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b)-pre-suf)
+	ai, bi := 0, 0
+	emit := func(kind byte, line string) {
+		ops = append(ops, diffOp{kind, line, ai, bi})
+		if kind != '+' {
+			ai++
+		}
+		if kind != '-' {
+			bi++
+		}
+	}
+
+	for _, line := range a[:pre] {
+		emit(' ', line)
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case am[i] == bm[j]:
+			emit(' ', am[i])
+			i++
+			j++
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			emit('-', am[i])
+			i++
+		default:
+			emit('+', bm[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		emit('-', am[i])
+	}
+	for ; j < m; j++ {
+		emit('+', bm[j])
+	}
+	for _, line := range a[len(a)-suf:] {
+		emit(' ', line)
+	}
+	return ops, true
+}
+
+const diffForm = `
+<form action="/diff/" method="GET" autocomplete="off" spellcheck="false">
+<p>
+<input size="40" type="text" name="a" value="%s" placeholder="ubuntu:22.04"/>
+<input size="40" type="text" name="b" value="%s" placeholder="ubuntu:24.04"/>
+<input size="16" type="text" name="platform" value="%s" placeholder="linux/amd64"/>
+<input type="submit" value="diff"/>
+</p>
+</form>
+`
@@ -0,0 +1,90 @@
+package explore
+
+import (
+	"archive/tar"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thesavant42/yolosint/internal/soci"
+)
+
+func TestDiffFiles(t *testing.T) {
+	file := func(size int64, mode int64, mtime int64) *soci.FlatFile {
+		return &soci.FlatFile{TOCFile: soci.TOCFile{Typeflag: tar.TypeReg, Size: size, Mode: mode, ModTime: time.Unix(mtime, 0)}}
+	}
+	hashed := func(sha string) *soci.FlatFile {
+		f := file(10, 0o644, 1)
+		f.SHA256 = sha
+		return f
+	}
+	a := map[string]*soci.FlatFile{
+		"/etc/passwd":  file(100, 0o644, 1),
+		"/etc/shadow":  file(50, 0o640, 1),
+		"/usr/bin/foo": file(10, 0o755, 1),
+		"/etc/hosts":   hashed("aaaa"),
+		"/etc/motd":    hashed("aaaa"),
+	}
+	b := map[string]*soci.FlatFile{
+		"/etc/passwd":  file(120, 0o600, 2),
+		"/etc/shadow":  file(50, 0o640, 1),
+		"/usr/bin/bar": file(10, 0o755, 1),
+		// Same size and mtime, different bytes.
+		"/etc/hosts": hashed("bbbb"),
+		// Indexed before digests were recorded.
+		"/etc/motd": hashed(""),
+		// Sorted by path alone, these would split /etc in two.
+		"/etc/ssl/ca.pem": file(10, 0o644, 1),
+		"/etc/zz":         file(10, 0o644, 1),
+	}
+
+	got := []string{}
+	for _, fc := range diffFiles(a, b) {
+		got = append(got, fc.Change+" "+fc.Path+" "+strings.Join(fc.Fields, ","))
+	}
+	want := []string{
+		"modified /etc/hosts content",
+		"modified /etc/passwd size,mode,mtime",
+		"added /etc/zz ",
+		"added /etc/ssl/ca.pem ",
+		"added /usr/bin/bar ",
+		"removed /usr/bin/foo ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diffFiles() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven"
+
+	got, ok := unifiedDiff("a/f", "b/f", a, b)
+	if !ok {
+		t.Fatal("unifiedDiff() gave up")
+	}
+	want := `--- a/f
++++ b/f
+@@ -1,6 +1,6 @@
+ one
+ two
+-three
++THREE
+ four
+ five
+ six
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+\ No newline at end of file
+`
+	if got != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant:\n%s", got, want)
+	}
+
+	if got, _ := unifiedDiff("a/f", "b/f", a, a); got != "" {
+		t.Errorf("unifiedDiff(a, a) = %q, want empty", got)
+	}
+}
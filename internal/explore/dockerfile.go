@@ -41,7 +41,7 @@ func whitespaceRepl(in []byte) []byte {
 	return bytes.Replace(in, []byte(" "), []byte(" \\\n"), 1)
 }
 
-func renderDockerfileSchema1(w io.Writer, b []byte, repo name.Repository) error {
+func renderDockerfileSchema1(w io.Writer, b []byte, repo name.Repository, opts []remote.Option) error {
 	m := Schema1{}
 	err := json.Unmarshal(b, &m)
 	if err != nil {
@@ -71,8 +71,7 @@ func renderDockerfileSchema1(w io.Writer, b []byte, repo name.Repository) error
 			}
 
 			if fsl.BlobSum != "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4" {
-				// TODO: Plumb opts.
-				l, err := remote.Layer(repo.Digest(fsl.BlobSum))
+				l, err := remote.Layer(repo.Digest(fsl.BlobSum), opts...)
 				if err == nil {
 					size, _ = l.Size()
 				}
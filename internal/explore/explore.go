@@ -5,6 +5,7 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -24,6 +25,8 @@ import (
 	"github.com/digitorus/timestamp"
 	"github.com/dustin/go-humanize"
 	"github.com/fxamacker/cbor/v2"
+	"github.com/thesavant42/yolosint/internal/cosign"
+	"github.com/thesavant42/yolosint/internal/credstore"
 	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
 	"github.com/thesavant42/yolosint/internal/gguf"
 	"github.com/thesavant42/yolosint/internal/soci"
@@ -72,6 +75,32 @@ type handler struct {
 	indexCache cache
 	tocDB      *TocDB
 
+	// layers waiting to be scanned for secrets
+	scans chan scanJob
+
+	// how often watched repositories are re-listed, 0 to never
+	watchInterval time.Duration
+	watchBatch    *Batch
+
+	// what /verify/ checks signatures against, nil for just the signatures
+	trustedRoot *cosign.TrustedRoot
+
+	// how requests go out, see transport
+	profiles *Profiles
+
+	// editable at /admin/credentials by whoever has adminToken
+	credStore  *credstore.Store
+	adminToken string
+
+	// crawl ID -> the crawl running in this process
+	crawls map[int64]*crawlRun
+
+	// Docker Hub API base URL, without the trailing slash
+	hubAPI string
+
+	// profile and namespace -> recent /?hub= report, see cachedHubNamespace
+	hubReports map[string]hubReport
+
 	sync.Mutex
 	sawTags  map[string][]string
 	inflight map[string]*soci.Indexer
@@ -93,7 +122,8 @@ func WithUserAgent(ua string) Option {
 	}
 }
 
-func New(opts ...Option) http.Handler {
+// newHandler sets up the caches and TocDB shared by the server and Batch.
+func newHandler(opts ...Option) *handler {
 	h := handler{
 		manifests:  map[string]*remote.Descriptor{},
 		pings:      map[string]*transport.PingResp{},
@@ -101,9 +131,15 @@ func New(opts ...Option) http.Handler {
 		redirects:  map[string]string{},
 		sawTags:    map[string][]string{},
 		inflight:   map[string]*soci.Indexer{},
+		crawls:     map[int64]*crawlRun{},
+		hubReports: map[string]hubReport{},
 		tocCache:   buildTocCache(),
 		indexCache: buildIndexCache(),
 		oauth:      buildOauth(),
+		profiles:   builtinProfiles(),
+		hubAPI:     defaultHubAPI,
+
+		watchInterval: defaultWatchInterval,
 	}
 
 	// Initialize SQLite for TOC logging
@@ -116,6 +152,20 @@ func New(opts ...Option) http.Handler {
 		opt(&h)
 	}
 
+	return &h
+}
+
+func New(opts ...Option) http.Handler {
+	h := newHandler(opts...)
+
+	h.scans = make(chan scanJob, scanQueueSize)
+	go h.scanWorker()
+
+	if h.watchInterval > 0 {
+		go h.watchLoop()
+	}
+	go h.resumeCrawls()
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", h.errHandler(h.renderResponse))
@@ -129,6 +179,12 @@ func New(opts ...Option) http.Handler {
 	mux.HandleFunc("/https/", h.errHandler(h.renderFS))
 
 	mux.HandleFunc("/layers/", h.errHandler(h.renderLayers))
+	mux.HandleFunc("/deleted/", h.errHandler(h.renderDeleted))
+	mux.HandleFunc("/buildinfo/", h.errHandler(h.renderGoBinaries))
+	mux.HandleFunc("/sbom/", h.errHandler(h.renderInventory))
+	mux.HandleFunc("/vulns/", h.errHandler(h.renderVulns))
+	mux.HandleFunc("/diff/", h.errHandler(h.renderDiff))
+	mux.HandleFunc("/verify/", h.errHandler(h.renderVerify))
 	mux.HandleFunc("/cache/", h.errHandler(h.renderIndex))
 
 	// Try to detect mediaType.
@@ -138,25 +194,46 @@ func New(opts ...Option) http.Handler {
 
 	mux.HandleFunc("/zurl/", h.errHandler(h.renderZurl))
 
+	// Search files across every layer logged to SQLite.
+	mux.HandleFunc("/search", h.errHandler(h.renderSearch))
+	mux.HandleFunc("/findings", h.errHandler(h.renderFindings))
+
+	// Repositories whose tags are re-listed and indexed on a schedule.
+	mux.HandleFunc("/watch", h.errHandler(h.renderWatch))
+	mux.HandleFunc("/crawl", h.errHandler(h.renderCrawls))
+	mux.HandleFunc("/admin/credentials", h.errHandler(h.renderCredentials))
+	mux.HandleFunc("/git/", h.errHandler(h.renderGit))
+
 	// Authenticated layer download endpoint
 	mux.HandleFunc("/download/", h.errHandler(h.downloadLayer))
 
 	h.mux = gzhttp.GzipHandler(mux)
 
-	return &h
+	return h
 }
 
 // logTOC is the callback for Indexer.OnTOC - logs TOC data to SQLite
-func (h *handler) logTOC(key string, toc *soci.TOC, imgCtx *ImageContext) {
+func (h *handler) logTOC(ctx context.Context, key string, toc *soci.TOC, imgCtx *ImageContext) {
 	if h.tocDB != nil {
 		if err := h.tocDB.Insert(key, toc, imgCtx); err != nil {
 			log.Printf("SQLite insert failed for %s: %v", key, err)
 		}
+		h.queueScan(ctx, key, toc, imgCtx)
+	}
+}
+
+// logManifest records tag -> manifest -> layer relationships so that layers
+// (which we only ever see by digest) can be traced back to their tags.
+func (h *handler) logManifest(ref name.Reference, desc *remote.Descriptor) {
+	if h.tocDB != nil {
+		if err := h.tocDB.RecordManifest(ref, desc.Descriptor, desc.Manifest); err != nil {
+			log.Printf("SQLite manifest insert failed for %s: %v", ref, err)
+		}
 	}
 }
 
 func splitFsURL(p string) (string, string, error) {
-	for _, prefix := range []string{"/fs/", "/layers/", "/https/", "/http/", "/blob/", "/cache/", "/size/", "/sizes/", "/zurl/", "/download/"} {
+	for _, prefix := range []string{"/fs/", "/layers/", "/deleted/", "/buildinfo/", "/sbom/", "/vulns/", "/verify/", "/https/", "/http/", "/blob/", "/cache/", "/size/", "/sizes/", "/zurl/", "/download/"} {
 		if strings.HasPrefix(p, prefix) {
 			return strings.TrimPrefix(p, prefix), prefix, nil
 		}
@@ -181,6 +258,12 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r, err := h.selectProfile(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if r.URL.Path == "/favicon.svg" || r.URL.Path == "/favicon.ico" {
 		w.Header().Set("Cache-Control", "max-age=3600")
 		data, _ := Assets.ReadFile("assets/favicon.svg")
@@ -262,6 +345,14 @@ func (h *handler) errHandler(hfe HandleFuncE) http.HandlerFunc {
 		if err := hfe(w, r); err != nil {
 			if err := h.maybeOauthErr(w, r, err); err != nil {
 				log.Printf("%s: %v", r.URL.Path, err)
+				if wantsJSON(r) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(struct {
+						Error string `json:"error"`
+					}{err.Error()})
+					return
+				}
 				fmt.Fprintf(w, "failed: %s", html.EscapeString(err.Error()))
 
 				var serr *ErrorSuggestion
@@ -310,6 +401,12 @@ func (h *handler) renderResponse(w http.ResponseWriter, r *http.Request) error {
 	if blob := qs.Get("blob"); blob != "" {
 		return h.renderBlobJSON(w, r, strings.TrimPrefix(strings.TrimSpace(blob), "https://"))
 	}
+	if ns := qs.Get("hub"); ns != "" {
+		return h.renderHubNamespace(w, r, strings.TrimSpace(ns))
+	}
+	if reg := qs.Get("registry"); reg != "" {
+		return h.renderRegistry(w, r, strings.TrimPrefix(strings.TrimSpace(reg), "https://"))
+	}
 	if repo := qs.Get("repo"); repo != "" {
 		return h.renderRepo(w, r, strings.TrimPrefix(strings.TrimSpace(repo), "https://"))
 	}
@@ -345,6 +442,18 @@ func (h *handler) renderRepo(w http.ResponseWriter, r *http.Request, repo string
 		return h.renderDockerHub(w, r, repo)
 	}
 
+	if wantsJSON(r) {
+		tags, err := h.listTags(w, r, ref, repo)
+		if tags == nil {
+			return err
+		}
+		out := RepoJSON{Repository: ref.String(), Tags: tags.Tags, Next: tags.Next}
+		if err != nil {
+			out.Error = err.Error()
+		}
+		return writeJSON(w, out)
+	}
+
 	if err := headerTmpl.Execute(w, TitleData{repo}); err != nil {
 		return err
 	}
@@ -412,6 +521,9 @@ func (h *handler) renderGoogleRepo(w http.ResponseWriter, r *http.Request, repo
 	h.Lock()
 	h.sawTags[ref.String()] = tags.Tags
 	h.Unlock()
+	if wantsJSON(r) {
+		return writeJSON(w, RepoJSON{Repository: ref.String(), Tags: tags.Tags, Children: tags.Children})
+	}
 	if err := headerTmpl.Execute(w, TitleData{repo}); err != nil {
 		return err
 	}
@@ -454,28 +566,53 @@ func (h *handler) renderGoogleRepo(w http.ResponseWriter, r *http.Request, repo
 
 // https://hub.docker.com/v2/repositories/tonistiigi/?page_size=25&page=1&ordering=last_updated
 func (h *handler) renderDockerHub(w http.ResponseWriter, r *http.Request, repo string) error {
-	t := remote.DefaultTransport
-	t = transport.NewRetry(t)
-	t = transport.NewUserAgent(t, h.userAgent)
+	t := h.transport(r.Context())
 	if r.URL.Query().Get("trace") != "" {
 		t = transport.NewTracer(t)
 	}
 	t = transport.Wrap(t)
 
-	if err := headerTmpl.Execute(w, TitleData{repo}); err != nil {
+	nextUri := h.hubURL(fmt.Sprintf("/v2/repositories/%s/", path.Base(repo)), "page_size=25&ordering=last_updated")
+	if next := r.URL.Query().Get("next"); next != "" {
+		if strings.HasPrefix(next, h.hubAPI+"/v2/repositories") {
+			nextUri = next
+		}
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, nextUri, nil)
+	if err != nil {
 		return err
 	}
-	uri := &url.URL{
-		Scheme:   "https",
-		Host:     "hub.docker.com",
-		Path:     fmt.Sprintf("/v2/repositories/%s/", path.Base(repo)),
-		RawQuery: "page_size=25&ordering=last_updated",
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return err
 	}
-	nextUri := uri.String()
-	if next := r.URL.Query().Get("next"); next != "" {
-		if strings.HasPrefix(next, "https://hub.docker.com/v2/repositories") {
-			nextUri = next
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, tooBig))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if wantsJSON(r) {
+		var page struct {
+			Next    string `json:"next"`
+			Results []struct {
+				Name string `json:"name"`
+			} `json:"results"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return fmt.Errorf("%s: %w", resp.Status, err)
 		}
+		out := RepoJSON{Repository: repo, Repositories: []string{}, Next: page.Next}
+		for _, res := range page.Results {
+			out.Repositories = append(out.Repositories, path.Base(repo)+"/"+res.Name)
+		}
+		return writeJSON(w, out)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{repo}); err != nil {
+		return err
 	}
 
 	header := HeaderData{
@@ -497,21 +634,7 @@ func (h *handler) renderDockerHub(w http.ResponseWriter, r *http.Request, repo s
 	if err := bodyTmpl.Execute(w, header); err != nil {
 		return err
 	}
-
-	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, nextUri, nil)
-	if err != nil {
-		return err
-	}
-	resp, err := t.RoundTrip(req)
-	if err != nil {
-		return err
-	}
-
-	b, err := io.ReadAll(io.LimitReader(resp.Body, tooBig))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	fmt.Fprintf(w, "<p><a href=\"/?hub=%s\">every repository and tag, with pulls and stars</a></p>\n", url.QueryEscape(path.Base(repo)))
 
 	output := &jsonOutputter{
 		w:         w,
@@ -533,6 +656,13 @@ func (h *handler) renderCatalog(w http.ResponseWriter, r *http.Request, repo str
 	if err != nil {
 		return err
 	}
+	if wantsJSON(r) {
+		v, err := h.listCatalog(w, r, ref, repo)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, RepoJSON{Repository: ref.RegistryStr(), Repositories: v.Repos, Next: v.Next})
+	}
 	if err := headerTmpl.Execute(w, TitleData{repo}); err != nil {
 		return err
 	}
@@ -543,6 +673,7 @@ func (h *handler) renderCatalog(w http.ResponseWriter, r *http.Request, repo str
 	if err := bodyTmpl.Execute(w, header); err != nil {
 		return err
 	}
+	fmt.Fprintf(w, "<p><a href=\"/?registry=%s\">fingerprint this registry</a> <a href=\"/crawl?registry=%s\">crawl all of it</a></p>\n", url.QueryEscape(ref.RegistryStr()), url.QueryEscape(ref.RegistryStr()))
 
 	output := &jsonOutputter{
 		w:     w,
@@ -579,6 +710,10 @@ func (h *handler) renderManifest(w http.ResponseWriter, r *http.Request, image s
 		return fmt.Errorf("fetchManifest: %w", err)
 	}
 
+	if wantsJSON(r) {
+		return writeJSON(w, manifestJSON(ref.String(), ref.Context().String(), desc.Descriptor, desc.Manifest))
+	}
+
 	header := h.manifestHeader(ref, desc.Descriptor)
 
 	u := *r.URL
@@ -618,6 +753,11 @@ func (h *handler) renderManifest(w http.ResponseWriter, r *http.Request, image s
 		return fmt.Errorf("bodyTmpl: %w", err)
 	}
 
+	if hasSignatures(desc.Manifest) {
+		link := verifyLink(ref.Context().Digest(desc.Digest.String()), tagSubject(ref))
+		fmt.Fprintf(w, "<p><a href=\"%s\">verify signatures</a></p>\n", html.EscapeString(link))
+	}
+
 	if err := h.renderContent(w, r, ref, b, output, u); err != nil {
 		return err
 	}
@@ -736,7 +876,11 @@ func (h *handler) renderHistory(w http.ResponseWriter, r *http.Request, image st
 	}
 
 	if ref.Context().RegistryStr() != "cgr.dev" {
-		return fmt.Errorf("not a cgr.dev image: %s", image)
+		tag := ""
+		if t, ok := ref.(name.Tag); ok {
+			tag = t.TagStr()
+		}
+		return h.renderTagHistory(w, r, ref.Context().String(), tag)
 	}
 
 	raw := url.Values{
@@ -819,6 +963,14 @@ func (h *handler) renderReferrers(w http.ResponseWriter, r *http.Request, src st
 		return err
 	}
 
+	if wantsJSON(r) {
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, ReferrersJSON{Subject: ref.String(), Referrers: im.Manifests})
+	}
+
 	desc, err := partial.Descriptor(idx)
 	if err != nil {
 		return err
@@ -856,6 +1008,17 @@ func (h *handler) renderReferrers(w http.ResponseWriter, r *http.Request, src st
 		return fmt.Errorf("bodyTmpl: %w", err)
 	}
 
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, m := range im.Manifests {
+		if at := m.ArtifactType; cosign.IsBundle(at) || at == cosignSigArtifactType {
+			link := verifyLink(ref.Context().Digest(m.Digest.String()), ref.Identifier())
+			fmt.Fprintf(w, "<p><a href=\"%s\">verify %s</a></p>\n", html.EscapeString(link), html.EscapeString(m.Digest.String()))
+		}
+	}
+
 	if err := h.renderContent(w, r, ref, b, output, u); err != nil {
 		return err
 	}
@@ -893,6 +1056,18 @@ func (h *handler) renderBlobJSON(w http.ResponseWriter, r *http.Request, blobRef
 	// Allow this to be cached for an hour.
 	w.Header().Set("Cache-Control", "max-age=3600, immutable")
 
+	if r.URL.Query().Get("render") == "attestation" && wantsJSON(r) {
+		input, err := io.ReadAll(io.LimitReader(blob, maxAttestationSize))
+		if err != nil {
+			return err
+		}
+		atts, err := parseAttestations(input)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, atts)
+	}
+
 	if err := headerTmpl.Execute(w, TitleData{blobRef}); err != nil {
 		return fmt.Errorf("headerTmpl: %w", err)
 	}
@@ -947,6 +1122,10 @@ func (h *handler) renderBlobJSON(w http.ResponseWriter, r *http.Request, blobRef
 		return err
 	}
 
+	if mediaType.IsConfig() {
+		h.logConfig(ref, mediaType, input)
+	}
+
 	if string(mediaType) == "application/cose" {
 		var v interface{}
 		if err := cbor.Unmarshal(input, &v); err != nil {
@@ -974,6 +1153,17 @@ func (h *handler) renderBlobJSON(w http.ResponseWriter, r *http.Request, blobRef
 		return fmt.Errorf("bodyTmpl: %w", err)
 	}
 
+	// Provenance and SBOMs are easier to read picked apart.
+	if r.URL.Query().Get("render") == "" {
+		if isAttestation(b) {
+			u := *r.URL
+			qs := u.Query()
+			qs.Set("render", "attestation")
+			u.RawQuery = qs.Encode()
+			fmt.Fprintf(w, "<p>view as: <a href=\"%s\">attestation</a></p>\n", html.EscapeString(u.String()))
+		}
+	}
+
 	if err := h.renderContent(w, r, ref, b, output, *r.URL); err != nil {
 		if r.URL.Query().Get("render") == "xxd" {
 			return fmt.Errorf("renderContent: %w", err)
@@ -1017,7 +1207,7 @@ func (h *handler) renderContent(w http.ResponseWriter, r *http.Request, ref name
 		return renderDer(w, b)
 	case "history":
 		if types.MediaType(r.URL.Query().Get("mt")).IsSchema1() {
-			return renderDockerfileSchema1(w, b, ref.Context())
+			return renderDockerfileSchema1(w, b, ref.Context(), h.remoteOptions(w, r, ref.Context().Name()))
 		} else {
 			return h.renderDockerfile(w, r, ref, b)
 		}
@@ -1029,6 +1219,14 @@ func (h *handler) renderContent(w http.ResponseWriter, r *http.Request, ref name
 		fmt.Fprintf(w, "</pre>")
 	case "xxd":
 		return renderOctets(w, r, b)
+	case "attestation":
+		atts, err := parseAttestations(b)
+		if err != nil {
+			return err
+		}
+		for _, att := range atts {
+			writeAttestation(w, att, ref.Context().String())
+		}
 	case "timestamp":
 		ts, err := timestamp.Parse(b)
 		if err != nil {
@@ -1062,6 +1260,11 @@ func (h *handler) renderGGUF(w http.ResponseWriter, r io.Reader) error {
 }
 
 func (h *handler) renderDockerfile(w http.ResponseWriter, r *http.Request, ref name.Reference, b []byte) error {
+	// History links don't always say what b is, but it's a config.
+	if dig, ok := ref.(name.Digest); ok {
+		h.logConfig(dig, types.MediaType(r.URL.Query().Get("mt")), b)
+	}
+
 	manifest := r.URL.Query().Get("manifest")
 	if manifest == "" {
 		return renderDockerfile(w, b, nil, ref.Context())
@@ -1225,7 +1428,7 @@ func (h *handler) renderFat(w http.ResponseWriter, r *http.Request) error {
 			return fmt.Errorf("fetchBlob: %w", err)
 		}
 
-		index, err = h.createIndex(r.Context(), blob, blob.size, dig.String(), 0, mt)
+		index, err = h.createIndex(r.Context(), blob, blob.size, dig.String(), 0, mt, extractImageContext(dig))
 		if err != nil {
 			return fmt.Errorf("createIndex: %w", err)
 		}
@@ -1366,9 +1569,7 @@ func (h *handler) indexedFS(w http.ResponseWriter, r *http.Request, dig name.Dig
 			u = scheme + u
 			cachedUrl = u
 
-			t := remote.DefaultTransport
-			t = transport.NewRetry(t)
-			t = transport.NewUserAgent(t, h.userAgent)
+			t := h.transport(r.Context())
 			if r.URL.Query().Get("trace") != "" {
 				t = transport.NewTracer(t)
 			}
@@ -1411,6 +1612,8 @@ func (h *handler) indexedFS(w http.ResponseWriter, r *http.Request, dig name.Dig
 	blob := remote.LazyBlob(dig, cachedUrl, setCookie, opts...)
 	prefix := strings.TrimPrefix(ref, "/")
 	fs := soci.FS(index, blob, prefix, dig.String(), respTooBig, types.MediaType(mt), renderHeader)
+	fs.SetFlagged(h.flagged(dig.DigestStr()))
+	fs.SetContext(r.Context())
 
 	return fs, nil
 }
@@ -1453,7 +1656,7 @@ func (h *handler) multiFS(w http.ResponseWriter, r *http.Request, dig name.Diges
 					return err
 				}
 
-				index, err = h.createIndex(r.Context(), rc, size, digest.String(), 0, string(mediaType))
+				index, err = h.createIndex(r.Context(), rc, size, digest.String(), 0, string(mediaType), extractImageContext(layerRef))
 				if err != nil {
 					return fmt.Errorf("createIndex: %w", err)
 				}
@@ -1739,6 +1942,22 @@ func renderHeader(w http.ResponseWriter, r *http.Request, fname string, prefix s
 		header.Filename = filename
 	}
 
+	// So we can pivot to everywhere else this exact file has been indexed.
+	if sf, ok := f.(interface{ SHA256() string }); ok {
+		header.SHA256 = sf.SHA256()
+	}
+
+	if !stat.IsDir() && soci.IsArchive(filename) {
+		header.Browse = (&url.URL{Path: path.Base(r.URL.Path) + "!/"}).String()
+	}
+	header.Git = gitLink(fname, stat)
+	if !stat.IsDir() {
+		header.Views = fileViews(filename, ctype)
+		if gf, ok := f.(interface{ GoVersion() string }); ok && gf.GoVersion() != "" {
+			header.Views = append(header.Views, FileView{"go build info", "buildinfo"})
+		}
+	}
+
 	if err := bodyTmpl.Execute(w, header); err != nil {
 		return err
 	}
@@ -1832,6 +2051,7 @@ func renderDir(w http.ResponseWriter, fname string, prefix string, mediaType typ
 		currentPath = currentPath + "/"
 	}
 	header.Path = currentPath
+	header.Git = gitLink(fname, stat)
 
 	return bodyTmpl.Execute(w, header)
 }
@@ -1921,7 +2141,7 @@ func (h *handler) renderZurl(w http.ResponseWriter, r *http.Request) error {
 				return err
 			}
 
-			index, err = h.createIndex(r.Context(), rc, layer.Size, digest.String(), 0, string(layer.MediaType))
+			index, err = h.createIndex(r.Context(), rc, layer.Size, digest.String(), 0, string(layer.MediaType), extractImageContext(layerRef))
 			if err != nil {
 				return fmt.Errorf("createIndex: %w", err)
 			}
@@ -0,0 +1,369 @@
+package explore
+
+import (
+	"archive/tar"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thesavant42/yolosint/internal/secrets"
+	"github.com/thesavant42/yolosint/internal/soci"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/authn"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/logs"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Bounds on background secret scanning.
+const (
+	scanQueueSize = 64
+	maxScanFiles  = 2000
+
+	// The index isn't readable until the indexer marks it complete,
+	// which happens just after OnTOC fires.
+	scanWaitTries = 30
+	scanWaitDelay = time.Second
+)
+
+// StoredFinding is a secrets.Finding as logged to the TocDB.
+type StoredFinding struct {
+	Layer string `json:"layer"`
+	Path  string `json:"path"`
+	secrets.Finding
+	FoundAt string `json:"found_at,omitempty"`
+}
+
+type scanJob struct {
+	dig    name.Digest
+	prefix string // index cache prefix
+	toc    *soci.TOC
+
+	profile string // the one the layer was fetched with
+}
+
+// queueScan schedules a secret scan for a freshly indexed layer. It never
+// blocks the indexer: if the queue is full, the layer is skipped.
+func (h *handler) queueScan(ctx context.Context, key string, toc *soci.TOC, imgCtx *ImageContext) {
+	if h.scans == nil || imgCtx == nil || imgCtx.Repository == "" || !strings.HasSuffix(key, ".0") {
+		return
+	}
+	repo, err := name.NewRepository(path.Join(imgCtx.Registry, imgCtx.Namespace, imgCtx.Repository))
+	if err != nil {
+		log.Printf("queueScan(%q): %v", key, err)
+		return
+	}
+
+	job := scanJob{
+		dig:    repo.Digest(layerDigest(key)),
+		prefix: strings.TrimSuffix(key, ".0"),
+		toc:    toc,
+
+		profile: profileName(ctx),
+	}
+	select {
+	case h.scans <- job:
+	default:
+		log.Printf("queueScan(%q): queue full, skipping", key)
+	}
+}
+
+func (h *handler) scanWorker() {
+	for job := range h.scans {
+		ctx := withProfile(context.Background(), job.profile)
+		if err := h.scanLayer(ctx, job); err != nil {
+			log.Printf("scanLayer(%s): %v", job.dig, err)
+		}
+	}
+}
+
+func (h *handler) scanLayer(ctx context.Context, job scanJob) error {
+	layer := job.dig.DigestStr()
+	if done, err := h.tocDB.Scanned(layer); err != nil {
+		return err
+	} else if done {
+		logs.Debug.Printf("scanLayer(%s): already scanned", layer)
+		return nil
+	}
+
+	candidates := []*soci.TOCFile{}
+	for i := range job.toc.Files {
+		tf := &job.toc.Files[i]
+		if tf.Typeflag != tar.TypeReg {
+			continue
+		}
+		if secrets.Candidate(tf.Name, tf.Size) {
+			candidates = append(candidates, tf)
+		}
+	}
+	if len(candidates) > maxScanFiles {
+		// Small files are cheaper to extract and more likely to be config.
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Size < candidates[j].Size
+		})
+		candidates = candidates[:maxScanFiles]
+	}
+
+	var (
+		index soci.Index
+		err   error
+	)
+	if len(candidates) != 0 {
+		for range scanWaitTries {
+			index, err = h.getIndex(ctx, job.prefix)
+			if err != nil || index != nil {
+				break
+			}
+			time.Sleep(scanWaitDelay)
+		}
+		if err == nil && index == nil {
+			err = fmt.Errorf("index %q never completed", job.prefix)
+		}
+	}
+
+	found := map[string][]secrets.Finding{}
+	if err == nil && index != nil {
+		opts := h.backgroundOptions(ctx, job.dig.Context())
+		opts = append(opts, remote.WithSize(job.toc.Csize))
+		blob := remote.LazyBlob(job.dig, "", nil, opts...)
+
+		for _, tf := range candidates {
+			data, ferr := readFile(ctx, index, blob, tf)
+			if ferr != nil {
+				err = fmt.Errorf("ExtractFile(%q): %w", tf.Name, ferr)
+				break
+			}
+			if fs := secrets.Scan(tf.Name, data); len(fs) != 0 {
+				found[tf.Name] = fs
+			}
+		}
+	}
+
+	return h.tocDB.InsertFindings(layer, len(candidates), found, err)
+}
+
+func readFile(ctx context.Context, index soci.Index, bs soci.BlobSeeker, tf *soci.TOCFile) ([]byte, error) {
+	rc, err := soci.ExtractFile(ctx, index, bs, tf)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, secrets.MaxFileSize))
+}
+
+// backgroundOptions are like remoteOptions, for work that outlives the request
+// that triggered it, so only the keychain is used for auth. repo is usually a
+// name.Repository, or a name.Registry for the catalog.
+func (h *handler) backgroundOptions(ctx context.Context, repo authn.Resource) []remote.Option {
+	auth := authn.Anonymous
+	if h.keychain != nil {
+		if maybeAuth, err := h.keychain.Resolve(repo); err == nil {
+			auth = maybeAuth
+		} else {
+			logs.Debug.Printf("Resolve(%q) = %v", repo, err)
+		}
+	}
+
+	t := h.transport(ctx)
+
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuth(auth),
+		remote.WithTransport(t),
+	}
+}
+
+// Scanned reports whether layer has already been scanned for secrets.
+func (t *TocDB) Scanned(layer string) (bool, error) {
+	if err := t.init(); err != nil {
+		return false, err
+	}
+	var n int
+	if err := t.db.QueryRow(`SELECT COUNT(*) FROM scans WHERE layer_digest = ? AND error IS NULL`, layer).Scan(&n); err != nil {
+		return false, err
+	}
+	return n != 0, nil
+}
+
+// InsertFindings records the result of scanning layer. A non-nil scanErr is
+// logged alongside whatever was found before it, so the layer is retried
+// the next time it's indexed.
+func (t *TocDB) InsertFindings(layer string, files int, found map[string][]secrets.Finding, scanErr error) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO findings (layer_digest, path, offset, rule_id, preview) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	total := 0
+	for p, fs := range found {
+		for _, f := range fs {
+			if _, err := stmt.Exec(layer, p, f.Offset, f.Rule, f.Preview); err != nil {
+				return err
+			}
+			total++
+		}
+	}
+
+	var errStr *string
+	if scanErr != nil {
+		s := scanErr.Error()
+		errStr = &s
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO scans (layer_digest, files, findings, error) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(layer_digest) DO UPDATE SET files = excluded.files, findings = excluded.findings, error = excluded.error, scanned_at = CURRENT_TIMESTAMP`,
+		layer, files, total, errStr,
+	); err != nil {
+		return err
+	}
+
+	log.Printf("[DB] InsertFindings: %s scanned %d files, %d findings", layer, files, total)
+	return errors.Join(tx.Commit(), scanErr)
+}
+
+// Findings returns everything found in layer, or in every layer if layer is
+// empty, narrowed to one file if file isn't empty.
+func (t *TocDB) Findings(layer, file string) ([]StoredFinding, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT layer_digest, path, offset, rule_id, preview, found_at FROM findings`
+	where, args := []string{}, []any{}
+	if layer != "" {
+		where = append(where, `layer_digest = ?`)
+		args = append(args, layerDigest(layer))
+	}
+	if file != "" {
+		where = append(where, `(CASE WHEN path LIKE './%' THEN substr(path, 3) ELSE ltrim(path, '/') END) = ?`)
+		args = append(args, cleanTarName(file))
+	}
+	if len(where) != 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY found_at DESC, layer_digest, path, offset LIMIT ?`
+	args = append(args, maxSearchLimit)
+
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []StoredFinding{}
+	for rows.Next() {
+		var (
+			f                StoredFinding
+			preview, foundAt sql.NullString
+		)
+		if err := rows.Scan(&f.Layer, &f.Path, &f.Offset, &f.Rule, &preview, &foundAt); err != nil {
+			return nil, err
+		}
+		f.Preview = preview.String
+		f.FoundAt = foundAt.String
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// FlaggedFiles maps TOC names in layer to the rules they tripped, for marking
+// directory listings.
+func (t *TocDB) FlaggedFiles(layer string) (map[string]string, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := t.db.Query(`SELECT path, group_concat(DISTINCT rule_id) FROM findings WHERE layer_digest = ? GROUP BY path`, layerDigest(layer))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flagged := map[string]string{}
+	for rows.Next() {
+		var p, rules string
+		if err := rows.Scan(&p, &rules); err != nil {
+			return nil, err
+		}
+		flagged[p] = rules
+	}
+	return flagged, rows.Err()
+}
+
+// flagged is FlaggedFiles for createFs, which shouldn't fail over it.
+func (h *handler) flagged(layer string) map[string]string {
+	if h.tocDB == nil {
+		return nil
+	}
+	flagged, err := h.tocDB.FlaggedFiles(layer)
+	if err != nil {
+		log.Printf("FlaggedFiles(%q): %v", layer, err)
+		return nil
+	}
+	return flagged
+}
+
+// Everything the secret scanner has found, optionally for one ?layer=.
+func (h *handler) renderFindings(w http.ResponseWriter, r *http.Request) error {
+	layer := r.URL.Query().Get("layer")
+	findings, err := h.tocDB.Findings(layer, r.URL.Query().Get("path"))
+	if err != nil {
+		return fmt.Errorf("Findings: %w", err)
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, findings)
+	}
+
+	title := "findings"
+	if layer != "" {
+		title += " " + layer
+	}
+	if err := headerTmpl.Execute(w, TitleData{title}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "<p>no findings</p>\n")
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, f := range findings {
+		short := f.Layer
+		if _, after, ok := strings.Cut(short, ":"); ok && len(after) > 8 {
+			short = after[:8]
+		}
+		fmt.Fprintf(w, "<a title=%q href=\"/search?layer=%s\">%s</a> %-24s %8d %s\n    %s\n",
+			f.Layer, url.QueryEscape(f.Layer), short, f.Rule, f.Offset, html.EscapeString(f.Path), html.EscapeString(f.Preview))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	fmt.Fprint(w, footer)
+	return nil
+}
@@ -0,0 +1,577 @@
+package explore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/authn"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// How long a registry report is served from the cache before re-probing.
+const registryReportTTL = 24 * time.Hour
+
+// RegistryReport is /?registry=<host>: what the registry seems to be
+// running and what it lets anonymous clients do.
+type RegistryReport struct {
+	Registry     string            `json:"registry"`
+	Software     string            `json:"software,omitempty"` // best guess, "" if nothing gave it away
+	Evidence     []string          `json:"evidence"`
+	Status       int               `json:"status"` // of GET /v2/
+	Auth         string            `json:"auth"`   // "none", "bearer" or "basic"
+	Realm        string            `json:"realm,omitempty"`
+	Service      string            `json:"service,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`    // the revealing ones
+	Repository   string            `json:"repository,omitempty"` // what per-repository capabilities were probed on
+	Capabilities []Capability      `json:"capabilities"`
+	CheckedAt    string            `json:"checked_at"`
+}
+
+// Capability is one read-only feature and whether the registry has it.
+type Capability struct {
+	Name   string `json:"name"`
+	Result string `json:"result"` // "yes", "no" or "unknown"
+	Detail string `json:"detail,omitempty"`
+}
+
+// Response headers worth keeping in a report.
+var revealingHeaders = []string{
+	"Server",
+	"Docker-Distribution-Api-Version",
+	"Www-Authenticate",
+	"X-Powered-By",
+	"X-Artifactory-Id",
+	"X-Artifactory-Node-Id",
+	"X-Jfrog-Version",
+	"X-Harbor-Csrf-Token",
+	"X-Request-Id",
+	"X-Amzn-Requestid",
+	"X-Ms-Correlation-Request-Id",
+	"X-Ms-Request-Id",
+	"X-Gitlab-Meta",
+	"Via",
+}
+
+// fingerprintRule names the software that shows itself by a match in the
+// GET /v2/ response, the first to match wins.
+type fingerprintRule struct {
+	software string
+	match    func(host string, h http.Header, realm, service string, body []byte) string // evidence, "" if no match
+}
+
+func headerContains(h http.Header, key, substr string) bool {
+	return strings.Contains(strings.ToLower(h.Get(key)), strings.ToLower(substr))
+}
+
+var (
+	ecrHost = regexp.MustCompile(`\.dkr\.ecr(-fips)?\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+	garHost = regexp.MustCompile(`(^|\.)[a-z0-9-]+-docker\.pkg\.dev$`)
+)
+
+var fingerprintRules = []fingerprintRule{
+	{"Artifactory", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case h.Get("X-Artifactory-Id") != "" || h.Get("X-Jfrog-Version") != "":
+			return "X-Artifactory-Id / X-JFrog-Version header"
+		case headerContains(h, "Server", "artifactory"):
+			return "Server: " + h.Get("Server")
+		case strings.Contains(realm, "/artifactory/"):
+			return "token realm under /artifactory/"
+		case strings.HasSuffix(host, ".jfrog.io"):
+			return "*.jfrog.io host"
+		}
+		return ""
+	}},
+	{"Nexus", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case headerContains(h, "Server", "nexus"):
+			return "Server: " + h.Get("Server")
+		case strings.Contains(strings.ToLower(realm), "sonatype nexus"):
+			return "basic realm " + realm
+		}
+		return ""
+	}},
+	{"Harbor", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case h.Get("X-Harbor-Csrf-Token") != "":
+			return "X-Harbor-CSRF-Token header"
+		case strings.HasSuffix(realm, "/service/token"):
+			return "token realm /service/token"
+		case service == "harbor-registry":
+			return "service harbor-registry"
+		}
+		return ""
+	}},
+	{"GitLab", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case strings.HasSuffix(realm, "/jwt/auth"):
+			return "token realm /jwt/auth"
+		case service == "container_registry":
+			return "service container_registry"
+		case h.Get("X-Gitlab-Meta") != "":
+			return "X-Gitlab-Meta header"
+		}
+		return ""
+	}},
+	{"Quay", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case strings.HasSuffix(realm, "/v2/auth") && service == host:
+			return "token realm /v2/auth with the host as service"
+		case host == "quay.io":
+			return "quay.io"
+		}
+		return ""
+	}},
+	{"ECR", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case service == "ecr.amazonaws.com":
+			return "service ecr.amazonaws.com"
+		case ecrHost.MatchString(host):
+			return "*.dkr.ecr.<region>.amazonaws.com host"
+		case host == "public.ecr.aws":
+			return "public.ecr.aws"
+		}
+		return ""
+	}},
+	{"ACR", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case strings.HasSuffix(host, ".azurecr.io") || strings.HasSuffix(host, ".azurecr.cn") || strings.HasSuffix(host, ".azurecr.us"):
+			return "*.azurecr.io host"
+		case strings.HasSuffix(realm, "/oauth2/token"):
+			return "token realm /oauth2/token"
+		case h.Get("X-Ms-Correlation-Request-Id") != "":
+			return "X-Ms-Correlation-Request-Id header"
+		}
+		return ""
+	}},
+	{"GAR", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case garHost.MatchString(host):
+			return "*-docker.pkg.dev host"
+		case isGoogle(host):
+			return "Google registry host"
+		}
+		return ""
+	}},
+	{"Zot", func(host string, h http.Header, realm, service string, body []byte) string {
+		switch {
+		case strings.EqualFold(realm, "zot"):
+			return "basic realm zot"
+		case headerContains(h, "Server", "zot"):
+			return "Server: " + h.Get("Server")
+		}
+		return ""
+	}},
+	{"Docker Hub", func(host string, h http.Header, realm, service string, body []byte) string {
+		if service == "registry.docker.io" {
+			return "service registry.docker.io"
+		}
+		return ""
+	}},
+	{"GitHub", func(host string, h http.Header, realm, service string, body []byte) string {
+		if host == "ghcr.io" || service == "ghcr.io" {
+			return "ghcr.io"
+		}
+		return ""
+	}},
+	{"distribution", func(host string, h http.Header, realm, service string, body []byte) string {
+		// What everything else is built on, so only a guess of last resort.
+		if h.Get("Docker-Distribution-Api-Version") == "registry/2.0" {
+			return "Docker-Distribution-API-Version: registry/2.0"
+		}
+		return ""
+	}},
+}
+
+// authChallenge parses a WWW-Authenticate header into its scheme and
+// parameters, lowercasing the keys.
+func authChallenge(s string) (scheme string, params map[string]string) {
+	params = map[string]string{}
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		var val string
+		if strings.HasPrefix(after, `"`) {
+			val, rest, _ = strings.Cut(after[1:], `"`)
+		} else {
+			val, rest, _ = strings.Cut(after, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = val
+	}
+	return strings.ToLower(scheme), params
+}
+
+// identify fills in what the GET /v2/ response tells about the registry.
+func (rr *RegistryReport) identify(host string, status int, h http.Header, body []byte) {
+	rr.Status = status
+	rr.Auth = "none"
+	if wa := h.Get("Www-Authenticate"); wa != "" {
+		scheme, params := authChallenge(wa)
+		rr.Auth = scheme
+		rr.Realm = params["realm"]
+		rr.Service = params["service"]
+	}
+
+	rr.Headers = map[string]string{}
+	for _, k := range revealingHeaders {
+		if v := h.Get(k); v != "" {
+			rr.Headers[k] = v
+		}
+	}
+
+	rr.Evidence = []string{}
+	for _, rule := range fingerprintRules {
+		if ev := rule.match(host, h, rr.Realm, rr.Service, body); ev != "" {
+			if rr.Software == "" {
+				rr.Software = rule.software
+			}
+			rr.Evidence = append(rr.Evidence, rule.software+": "+ev)
+		}
+	}
+
+	var errs struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &errs) == nil && len(errs.Errors) != 0 {
+		rr.Evidence = append(rr.Evidence, fmt.Sprintf("error body: %s %q", errs.Errors[0].Code, errs.Errors[0].Message))
+	}
+}
+
+// fingerprint probes reg anonymously. repo, if not empty, is where to probe
+// per-repository capabilities; otherwise the first repository the catalog
+// shows is used.
+func (h *handler) fingerprint(ctx context.Context, reg name.Registry, repo string) (*RegistryReport, error) {
+	t := h.transport(ctx)
+	rr := &RegistryReport{Registry: reg.Name(), Capabilities: []Capability{}}
+
+	// The ping is GET /v2/, which is most of what gives a registry away.
+	pr, err := h.ping(ctx, reg, t)
+	var terr *transport.Error
+	switch {
+	case errors.As(err, &terr):
+		// Neither 200 nor 401, which is worth reporting too.
+		rr.identify(reg.RegistryStr(), terr.StatusCode, http.Header{}, nil)
+		return rr, nil
+	case err != nil:
+		return nil, err
+	}
+	rr.identify(reg.RegistryStr(), pr.StatusCode, pr.Header, pr.Body)
+
+	catalog := Capability{Name: "anonymous catalog"}
+	if rt, _, err := transport.NewBearer(ctx, pr, reg, authn.Anonymous, t, []string{reg.Scope(transport.PullScope)}); err != nil {
+		catalog.Result, catalog.Detail = "no", err.Error()
+	} else if cat, err := remote.CatalogPage(reg, "", remote.WithContext(ctx), remote.WithTransport(rt), remote.WithPageSize(5)); err != nil {
+		catalog.Result, catalog.Detail = "no", err.Error()
+	} else {
+		catalog.Result, catalog.Detail = "yes", fmt.Sprintf("%d repositories on the first page", len(cat.Repos))
+		if repo == "" && len(cat.Repos) != 0 {
+			repo = cat.Repos[0]
+		}
+	}
+	rr.Capabilities = append(rr.Capabilities, catalog)
+
+	if repo == "" {
+		for _, name := range []string{"tag list pagination", "referrers API", "_chainguard history API", "blob range requests"} {
+			rr.Capabilities = append(rr.Capabilities, Capability{Name: name, Result: "unknown", Detail: "no repository to probe, add &repo="})
+		}
+		return rr, nil
+	}
+	r, err := name.NewRepository(reg.RegistryStr() + "/" + repo)
+	if err != nil {
+		return nil, err
+	}
+	rr.Repository = r.RepositoryStr()
+	rr.Capabilities = append(rr.Capabilities, h.probeRepository(ctx, t, pr, r)...)
+	return rr, nil
+}
+
+// probeRepository checks the capabilities that need a repository to
+// check on, pulling anonymously with what pinging the registry said.
+func (h *handler) probeRepository(ctx context.Context, t http.RoundTripper, pr *transport.PingResp, repo name.Repository) []Capability {
+	caps := []Capability{
+		{Name: "tag list pagination", Result: "unknown"},
+		{Name: "referrers API", Result: "unknown"},
+		{Name: "_chainguard history API", Result: "unknown"},
+		{Name: "blob range requests", Result: "unknown"},
+	}
+	fail := func(err error) []Capability {
+		for i := range caps {
+			caps[i].Detail = err.Error()
+		}
+		return caps
+	}
+
+	rt, _, err := transport.NewBearer(ctx, pr, repo.Registry, authn.Anonymous, t, []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return fail(err)
+	}
+	client := &http.Client{Transport: rt}
+	base := fmt.Sprintf("%s://%s/v2/%s", repo.Scheme(), repo.RegistryStr(), repo.RepositoryStr())
+	get := func(u string, hdr http.Header) (*http.Response, []byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range hdr {
+			req.Header[k] = v
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(io.LimitReader(resp.Body, tooBig))
+		return resp, b, err
+	}
+
+	// Tags, asking for one at a time.
+	resp, b, err := get(base+"/tags/list?n=1", nil)
+	if err != nil {
+		return fail(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fail(fmt.Errorf("listing tags: %s", resp.Status))
+	}
+	var tags struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return fail(fmt.Errorf("listing tags: %w", err))
+	}
+	switch {
+	case resp.Header.Get("Link") != "":
+		caps[0].Result, caps[0].Detail = "yes", "Link: "+resp.Header.Get("Link")
+	case len(tags.Tags) > 1:
+		caps[0].Result, caps[0].Detail = "no", fmt.Sprintf("asked for 1 tag, got %d", len(tags.Tags))
+	case len(tags.Tags) == 1:
+		// No Link header, but n and last may still work.
+		caps[0].Detail = "1 tag and no Link header"
+		if resp, b, err := get(base+"/tags/list?n=1&last="+url.QueryEscape(tags.Tags[0]), nil); err == nil && resp.StatusCode == http.StatusOK {
+			var next struct {
+				Tags []string `json:"tags"`
+			}
+			if json.Unmarshal(b, &next) == nil && len(next.Tags) == 1 && next.Tags[0] != tags.Tags[0] {
+				caps[0].Result, caps[0].Detail = "yes", "n and last work, but there is no Link header"
+			}
+		}
+	default:
+		caps[0].Detail = "no tags and no Link header"
+	}
+	if len(tags.Tags) == 0 {
+		return fail(fmt.Errorf("no tags to probe with"))
+	}
+	tag := tags.Tags[0]
+
+	// The manifest, for a digest and a blob.
+	resp, b, err = get(base+"/manifests/"+tag, http.Header{"Accept": {
+		"application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json, application/vnd.oci.image.index.v1+json, application/vnd.docker.distribution.manifest.list.v2+json",
+	}})
+	if err != nil {
+		return fail(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fail(fmt.Errorf("fetching %s: %s", tag, resp.Status))
+	}
+	manifest := b
+	dig := resp.Header.Get("Docker-Content-Digest")
+	if dig == "" {
+		hash, _, err := v1.SHA256(bytes.NewReader(manifest))
+		if err != nil {
+			return fail(err)
+		}
+		dig = hash.String()
+	}
+
+	// Some registries leave out the Content-Type, so look at the body.
+	resp, b, err = get(base+"/referrers/"+dig, nil)
+	var index struct {
+		MediaType string            `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+	}
+	switch {
+	case err != nil:
+		caps[1].Detail = err.Error()
+	case resp.StatusCode == http.StatusOK && json.Unmarshal(b, &index) == nil && (strings.Contains(index.MediaType, "index") || index.Manifests != nil):
+		caps[1].Result, caps[1].Detail = "yes", fmt.Sprintf("%d referrers", len(index.Manifests))
+	case resp.StatusCode == http.StatusNotFound:
+		caps[1].Result, caps[1].Detail = "no", "404, clients fall back to sha256-<digest> tags"
+	default:
+		caps[1].Result, caps[1].Detail = "no", resp.Status
+	}
+
+	resp, _, err = get(base+"/_chainguard/history/"+tag, nil)
+	switch {
+	case err != nil:
+		caps[2].Detail = err.Error()
+	case resp.StatusCode == http.StatusOK:
+		caps[2].Result = "yes"
+	default:
+		caps[2].Result, caps[2].Detail = "no", resp.Status
+	}
+
+	var m v1.Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil || m.Config.Digest.Hex == "" {
+		caps[3].Detail = fmt.Sprintf("%s is an index or has no config blob", tag)
+		return caps
+	}
+	resp, b, err = get(base+"/blobs/"+m.Config.Digest.String(), http.Header{"Range": {"bytes=0-0"}})
+	switch {
+	case err != nil:
+		caps[3].Detail = err.Error()
+	case resp.StatusCode == http.StatusPartialContent && len(b) == 1:
+		caps[3].Result, caps[3].Detail = "yes", resp.Header.Get("Content-Range")
+	case resp.StatusCode == http.StatusOK:
+		caps[3].Result, caps[3].Detail = "no", "Range ignored, got the whole blob"
+	default:
+		caps[3].Result, caps[3].Detail = "no", resp.Status
+	}
+	return caps
+}
+
+// RegistryReport returns the cached report for registry, nil if there is
+// none newer than maxAge.
+func (t *TocDB) RegistryReport(registry string, maxAge time.Duration) (*RegistryReport, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	var b string
+	err := t.db.QueryRow(
+		`SELECT report FROM registry_reports WHERE registry = ? AND checked_at > datetime('now', ?)`,
+		registry, fmt.Sprintf("-%d seconds", int(maxAge.Seconds())),
+	).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var rr RegistryReport
+	if err := json.Unmarshal([]byte(b), &rr); err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+// PutRegistryReport caches rr.
+func (t *TocDB) PutRegistryReport(rr *RegistryReport) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(rr)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.db.Exec(
+		`INSERT INTO registry_reports (registry, report, checked_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(registry) DO UPDATE SET report = excluded.report, checked_at = excluded.checked_at`,
+		rr.Registry, string(b),
+	)
+	return err
+}
+
+// Identify a registry and what it allows, from the cache unless ?refresh.
+func (h *handler) renderRegistry(w http.ResponseWriter, r *http.Request, host string) error {
+	reg, err := name.NewRegistry(strings.TrimSuffix(host, "/"))
+	if err != nil {
+		return err
+	}
+	qs := r.URL.Query()
+	repo := strings.Trim(qs.Get("repo"), "/")
+
+	var rr *RegistryReport
+	if qs.Get("refresh") == "" && repo == "" {
+		if rr, err = h.tocDB.RegistryReport(reg.Name(), registryReportTTL); err != nil {
+			return err
+		}
+	}
+	if rr == nil {
+		if qs.Get("refresh") != "" {
+			// Ping it again too.
+			h.Lock()
+			delete(h.pings, reg.String())
+			h.Unlock()
+		}
+		if rr, err = h.fingerprint(r.Context(), reg, repo); err != nil {
+			return err
+		}
+		rr.CheckedAt = time.Now().UTC().Format(time.DateTime)
+		if err := h.tocDB.PutRegistryReport(rr); err != nil {
+			return err
+		}
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, rr)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"registry " + rr.Registry}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	software := rr.Software
+	if software == "" {
+		software = "unknown"
+	}
+	refresh := url.Values{"registry": {rr.Registry}, "refresh": {"1"}}
+	fmt.Fprintf(w, "<h2>%s: %s</h2>\n", html.EscapeString(rr.Registry), html.EscapeString(software))
+	fmt.Fprintf(w, "<p>checked %s UTC (<a href=\"/?%s\">again</a>), <a href=\"/?repo=%s\">catalog</a></p>\n", html.EscapeString(rr.CheckedAt), html.EscapeString(refresh.Encode()), url.QueryEscape(rr.Registry))
+
+	fmt.Fprintf(w, "<pre>\n")
+	fmt.Fprintf(w, "GET /v2/  %d\nauth      %s\n", rr.Status, html.EscapeString(rr.Auth))
+	if rr.Realm != "" {
+		fmt.Fprintf(w, "realm     %s\n", html.EscapeString(rr.Realm))
+	}
+	if rr.Service != "" {
+		fmt.Fprintf(w, "service   %s\n", html.EscapeString(rr.Service))
+	}
+	for _, k := range revealingHeaders {
+		if v, ok := rr.Headers[k]; ok {
+			fmt.Fprintf(w, "%s: %s\n", html.EscapeString(k), html.EscapeString(v))
+		}
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	if len(rr.Evidence) != 0 {
+		fmt.Fprintf(w, "<h3>evidence</h3>\n<ul>\n")
+		for _, ev := range rr.Evidence {
+			fmt.Fprintf(w, "<li>%s</li>\n", html.EscapeString(ev))
+		}
+		fmt.Fprintf(w, "</ul>\n")
+	}
+
+	fmt.Fprintf(w, "<h3>capabilities")
+	if rr.Repository != "" {
+		fmt.Fprintf(w, " (probed on <a href=\"/?repo=%s\">%s</a>)", url.QueryEscape(rr.Registry+"/"+rr.Repository), html.EscapeString(rr.Repository))
+	}
+	fmt.Fprintf(w, "</h3>\n<table>\n")
+	for _, c := range rr.Capabilities {
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n", html.EscapeString(c.Name), html.EscapeString(c.Result), html.EscapeString(c.Detail))
+	}
+	fmt.Fprintf(w, "</table>\n")
+
+	fmt.Fprint(w, footer)
+	return nil
+}
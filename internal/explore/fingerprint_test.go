@@ -0,0 +1,138 @@
+package explore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/registry"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+func TestIdentify(t *testing.T) {
+	for _, tc := range []struct {
+		host    string
+		headers map[string]string
+		want    string
+	}{
+		{"harbor.example.com", map[string]string{"Www-Authenticate": `Bearer realm="https://harbor.example.com/service/token",service="harbor-registry"`}, "Harbor"},
+		{"registry.gitlab.com", map[string]string{"Www-Authenticate": `Bearer realm="https://gitlab.com/jwt/auth",service="container_registry"`}, "GitLab"},
+		{"acme.jfrog.io", map[string]string{"X-Artifactory-Id": "abc", "Www-Authenticate": `Bearer realm="https://acme.jfrog.io/artifactory/api/docker/docker/v2/token"`}, "Artifactory"},
+		{"nexus.example.com", map[string]string{"Server": "Nexus/3.61.0-02 (OSS)", "Www-Authenticate": `BASIC realm="Sonatype Nexus Repository Manager"`}, "Nexus"},
+		{"quay.example.com", map[string]string{"Www-Authenticate": `Bearer realm="https://quay.example.com/v2/auth",service="quay.example.com"`}, "Quay"},
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com", map[string]string{"Www-Authenticate": `Basic realm="https://123456789012.dkr.ecr.us-east-1.amazonaws.com/",service="ecr.amazonaws.com"`}, "ECR"},
+		{"acme.azurecr.io", map[string]string{"Www-Authenticate": `Bearer realm="https://acme.azurecr.io/oauth2/token",service="acme.azurecr.io"`}, "ACR"},
+		{"us-docker.pkg.dev", map[string]string{"Www-Authenticate": `Bearer realm="https://us-docker.pkg.dev/v2/token"`}, "GAR"},
+		{"zot.example.com", map[string]string{"Www-Authenticate": `Basic realm="zot"`}, "Zot"},
+		{"index.docker.io", map[string]string{"Www-Authenticate": `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`}, "Docker Hub"},
+		{"registry.example.com", map[string]string{"Docker-Distribution-Api-Version": "registry/2.0"}, "distribution"},
+		{"mystery.example.com", nil, ""},
+	} {
+		h := http.Header{}
+		for k, v := range tc.headers {
+			h.Set(k, v)
+		}
+		var rr RegistryReport
+		rr.identify(tc.host, http.StatusUnauthorized, h, []byte(`{"errors":[{"code":"UNAUTHORIZED","message":"authentication required"}]}`))
+		if rr.Software != tc.want {
+			t.Errorf("%s: Software = %q, want %q (evidence %v)", tc.host, rr.Software, tc.want, rr.Evidence)
+		}
+	}
+}
+
+func TestAuthChallenge(t *testing.T) {
+	scheme, params := authChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope=repository:library/busybox:pull`)
+	if scheme != "bearer" || params["realm"] != "https://auth.docker.io/token" || params["service"] != "registry.docker.io" || params["scope"] != "repository:library/busybox:pull" {
+		t.Errorf("authChallenge = %q, %v", scheme, params)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	reg := registry.New(registry.WithReferrersSupport(true))
+	var pings atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			pings.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	ref, err := name.ParseReference(host + "/acme/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Tag(ref.Context().Tag("v2"), img); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handler{profiles: builtinProfiles(), tocDB: NewTocDB(filepath.Join(t.TempDir(), "log.db")), pings: map[string]*transport.PingResp{}}
+	defer h.tocDB.Close()
+
+	pings.Store(0)
+	r, err := name.NewRegistry(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := h.fingerprint(context.Background(), r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Status != http.StatusOK || rr.Auth != "none" || rr.Software != "distribution" {
+		t.Errorf("report = %+v", rr)
+	}
+	// Everything goes on the one ping, which is kept for later.
+	if n := pings.Load(); n != 1 {
+		t.Errorf("pinged %d times", n)
+	}
+	if _, err := h.fingerprint(context.Background(), r, "acme/app"); err != nil || pings.Load() != 1 {
+		t.Errorf("fingerprinting again: %v, %d pings", err, pings.Load())
+	}
+	if rr.Repository != "acme/app" {
+		t.Errorf("probed %q, want the repository the catalog showed", rr.Repository)
+	}
+	got := map[string]string{}
+	for _, c := range rr.Capabilities {
+		got[c.Name] = c.Result
+	}
+	for cap, want := range map[string]string{
+		"anonymous catalog":       "yes",
+		"tag list pagination":     "yes",
+		"referrers API":           "yes",
+		"_chainguard history API": "no",
+	} {
+		if got[cap] != want {
+			t.Errorf("%s = %q, want %q (%+v)", cap, got[cap], want, rr.Capabilities)
+		}
+	}
+
+	if err := h.tocDB.PutRegistryReport(rr); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := h.tocDB.RegistryReport(rr.Registry, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached == nil || cached.Software != rr.Software || len(cached.Capabilities) != len(rr.Capabilities) {
+		t.Errorf("cached report = %+v", cached)
+	}
+	if stale, err := h.tocDB.RegistryReport(rr.Registry, -time.Hour); err != nil || stale != nil {
+		t.Errorf("RegistryReport past its age = %v, %v", stale, err)
+	}
+}
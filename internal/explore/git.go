@@ -0,0 +1,152 @@
+package explore
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/thesavant42/yolosint/internal/forks/rsc.io/gitfs"
+	"github.com/thesavant42/yolosint/internal/git"
+)
+
+// renderGit hands a .git directory found in a layer (/git/fs/...) or in an
+// image's combined filesystem (/git/layers/...) to the git explorer:
+//
+//	/git/fs/<repo>@<layer>/<path>/.git/<view>
+//
+// See git.ServeLocal for the views. Without a .git in the path, it lists
+// the repositories it can find instead.
+func (h *handler) renderGit(w http.ResponseWriter, r *http.Request) error {
+	p := strings.TrimPrefix(r.URL.Path, "/git")
+	if !strings.HasPrefix(p, "/fs/") && !strings.HasPrefix(p, "/layers/") {
+		return fmt.Errorf("expected /git/fs/ or /git/layers/, got %q", r.URL.Path)
+	}
+
+	// Everything below only looks at the path, so pretend this is the
+	// request for the filesystem the repository lives in.
+	inner := r.Clone(r.Context())
+	inner.URL.Path = p
+
+	dig, ref, err := h.getDigest(w, inner)
+	if err != nil {
+		return err
+	}
+
+	var fsys interface {
+		fs.FS
+		Everything() ([]fs.DirEntry, error)
+	}
+	if strings.HasPrefix(p, "/fs/") {
+		index, err := h.getIndex(r.Context(), dig.Identifier())
+		if err != nil {
+			return fmt.Errorf("indexCache.Index(%s) = %w", dig.Identifier(), err)
+		}
+		if index == nil {
+			return fmt.Errorf("%s has not been indexed yet, open it under %s/ first", dig, ref)
+		}
+		if fsys, err = h.indexedFS(w, inner, dig, ref, index); err != nil {
+			return err
+		}
+	} else {
+		desc, err := h.fetchManifest(w, inner, dig)
+		if err != nil {
+			return err
+		}
+		if fsys, err = h.multiFS(w, inner, dig, desc, ref); err != nil {
+			return err
+		}
+	}
+
+	dir, view, ok := splitGitDir(strings.TrimPrefix(p, ref))
+	if !ok {
+		des, err := fsys.Everything()
+		if err != nil {
+			return err
+		}
+		return h.renderGitDirs(w, r, dig.String(), "/git"+ref, gitDirs(des))
+	}
+
+	repo, err := gitfs.OpenLocal(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	// Repositories in an image don't change, but this does fetch a lot.
+	w.Header().Set("Cache-Control", "max-age=3600, immutable")
+
+	return git.ServeLocal(w, r, repo, dig.String()+"/"+dir, "/git"+ref+"/"+dir+"/", view)
+}
+
+// splitGitDir splits "/app/.git/commit/abc" into "app/.git" and "commit/abc".
+// The git directory is the first element named .git or ending in .git, which
+// covers bare repositories like "repo.git" too.
+func splitGitDir(p string) (dir, view string, ok bool) {
+	p = strings.TrimPrefix(p, "/")
+	for i := 0; i < len(p); {
+		j := strings.IndexByte(p[i:], '/')
+		if j < 0 {
+			j = len(p) - i
+		}
+		if strings.HasSuffix(p[i:i+j], ".git") {
+			return p[:i+j], strings.TrimPrefix(p[i+j:], "/"), true
+		}
+		i += j + 1
+	}
+	return "", "", false
+}
+
+// gitDirs finds the git directories in des by looking for their HEAD files.
+func gitDirs(des []fs.DirEntry) []string {
+	dirs := []string{}
+	for _, de := range des {
+		name := strings.TrimPrefix(path.Clean("/"+de.Name()), "/")
+		if path.Base(name) != "HEAD" {
+			continue
+		}
+		dir := path.Dir(name)
+		if !strings.HasSuffix(dir, ".git") || slices.Contains(dirs, dir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	return dirs
+}
+
+func (h *handler) renderGitDirs(w http.ResponseWriter, r *http.Request, title, base string, dirs []string) error {
+	if wantsJSON(r) {
+		return writeJSON(w, dirs)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"git " + title}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, "<p>%d git repositories in %s</p>\n", len(dirs), html.EscapeString(title))
+	if len(dirs) != 0 {
+		fmt.Fprintf(w, "<pre>\n")
+		for _, dir := range dirs {
+			href := (&url.URL{Path: base + "/" + dir + "/"}).String()
+			fmt.Fprintf(w, "<a href=%q>%s</a>\n", href, html.EscapeString(dir))
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// gitLink points .git directories at renderGit.
+func gitLink(fname string, stat fs.FileInfo) string {
+	if !stat.IsDir() || !strings.HasSuffix(strings.TrimSuffix(fname, "/"), ".git") {
+		return ""
+	}
+	if !strings.HasPrefix(fname, "/fs/") && !strings.HasPrefix(fname, "/layers/") {
+		return ""
+	}
+	return (&url.URL{Path: "/git" + path.Clean(fname) + "/"}).String()
+}
@@ -0,0 +1,55 @@
+package explore
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitGitDir(t *testing.T) {
+	for _, tc := range []struct {
+		in, dir, view string
+		ok            bool
+	}{
+		{"/app/.git/", "app/.git", "", true},
+		{"/app/.git", "app/.git", "", true},
+		{"/app/.git/commit/abc", "app/.git", "commit/abc", true},
+		{"/app/.git/tree/abc/src/", "app/.git", "tree/abc/src/", true},
+		{"/srv/repo.git/log/main", "srv/repo.git", "log/main", true},
+		{"/.git/", ".git", "", true},
+		{"/app/src/", "", "", false},
+		{"/", "", "", false},
+	} {
+		dir, view, ok := splitGitDir(tc.in)
+		if dir != tc.dir || view != tc.view || ok != tc.ok {
+			t.Errorf("splitGitDir(%q) = %q, %q, %v; want %q, %q, %v", tc.in, dir, view, ok, tc.dir, tc.view, tc.ok)
+		}
+	}
+}
+
+func TestGitDirs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/.git/HEAD":             {},
+		"app/.git/refs/heads/main":  {},
+		"srv/repo.git/HEAD":         {},
+		"app/.git/modules/lib/HEAD": {},
+		"app/HEAD":                  {},
+	}
+	var des []fs.DirEntry
+	fs.WalkDir(fsys, ".", func(p string, de fs.DirEntry, err error) error {
+		des = append(des, namedEntry{de, p})
+		return nil
+	})
+	got := gitDirs(des)
+	if len(got) != 2 || got[0] != "app/.git" || got[1] != "srv/repo.git" {
+		t.Errorf("gitDirs() = %q", got)
+	}
+}
+
+// namedEntry has the full path as its name, like soci's Everything.
+type namedEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e namedEntry) Name() string { return e.name }
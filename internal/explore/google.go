@@ -9,7 +9,6 @@ import (
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/logs"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/google"
-	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"golang.org/x/oauth2"
 )
@@ -28,9 +27,7 @@ func (h *handler) googleOptions(w http.ResponseWriter, r *http.Request, repo str
 	opts := []google.Option{}
 	opts = append(opts, google.WithContext(ctx))
 	if repo == "mirror.gcr.io" {
-		t := remote.DefaultTransport
-		t = transport.NewRetry(t)
-		t = transport.NewUserAgent(t, h.userAgent)
+		t := h.transport(ctx)
 		if r.URL.Query().Get("trace") != "" {
 			t = transport.NewTracer(t)
 		}
@@ -64,7 +61,7 @@ func (h *handler) googleOptions(w http.ResponseWriter, r *http.Request, repo str
 				tok.RefreshToken = rt.Value
 			}
 			if h.oauth != nil {
-				ts := h.oauth.TokenSource(r.Context(), tok)
+				ts := h.oauth.TokenSource(h.oauthContext(r.Context()), tok)
 				auth = google.NewTokenSourceAuthenticator(ts)
 			}
 		}
@@ -74,6 +71,7 @@ func (h *handler) googleOptions(w http.ResponseWriter, r *http.Request, repo str
 
 	if t, err := h.transportFromCookie(w, r, repo, auth); err != nil {
 		log.Printf("failed to get transport from cookie: %v", err)
+		opts = append(opts, google.WithTransport(h.transport(ctx)))
 	} else {
 		opts = append(opts, google.WithTransport(t))
 	}
@@ -0,0 +1,362 @@
+package explore
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+)
+
+// Where the Docker Hub API is, unless WithHubAPI says otherwise.
+const defaultHubAPI = "https://hub.docker.com"
+
+// Bounds on namespace reports.
+const (
+	maxHubTagPages = 10 // per repository
+	hubConcurrency = 4  // repositories whose tags are listed at a time
+)
+
+// How long a namespace report is reused, so sorting or exporting it doesn't
+// list the whole namespace again.
+const hubReportTTL = 10 * time.Minute
+
+type hubReport struct {
+	Expires time.Time
+	ns      *HubNamespace
+}
+
+// WithHubAPI points Docker Hub API calls at base instead of hub.docker.com.
+func WithHubAPI(base string) Option {
+	return func(h *handler) {
+		h.hubAPI = strings.TrimSuffix(base, "/")
+	}
+}
+
+// hubURL is p on the Hub API, with rawQuery.
+func (h *handler) hubURL(p, rawQuery string) string {
+	u := h.hubAPI + p
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	return u
+}
+
+// HubNamespace is /?hub=<namespace>: every repository in a Docker Hub
+// namespace, with every tag.
+type HubNamespace struct {
+	Namespace    string    `json:"namespace"`
+	Repositories []HubRepo `json:"repositories"`
+	Truncated    bool      `json:"truncated,omitempty"` // more repositories than we page through
+}
+
+// HubRepo is a repository as the Hub API describes it.
+type HubRepo struct {
+	Name          string   `json:"name"`
+	Description   string   `json:"description,omitempty"`
+	PullCount     int64    `json:"pull_count"`
+	StarCount     int64    `json:"star_count"`
+	LastUpdated   string   `json:"last_updated,omitempty"`
+	Tags          []HubTag `json:"tags"`
+	TagsTruncated bool     `json:"tags_truncated,omitempty"`
+	Error         string   `json:"error,omitempty"` // listing the tags
+}
+
+// HubTag is a tag from the Hub tags API, with one image per platform.
+type HubTag struct {
+	Name        string     `json:"name"`
+	LastUpdated string     `json:"last_updated,omitempty"`
+	Digest      string     `json:"digest,omitempty"`
+	FullSize    int64      `json:"full_size"`
+	Images      []HubImage `json:"images"`
+}
+
+// HubImage is one platform of a HubTag.
+type HubImage struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	Digest       string `json:"digest,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+func (img HubImage) platform() string {
+	p := img.OS + "/" + img.Architecture
+	if img.Variant != "" {
+		p += "/" + img.Variant
+	}
+	return p
+}
+
+// hubList follows a Hub API listing from first for at most maxPages pages,
+// and reports whether there was more. Pages that aren't under base aren't
+// followed, so a response can't send our requests (and credentials)
+// somewhere else.
+func hubList[T any](ctx context.Context, t http.RoundTripper, base, first string, maxPages int) ([]T, bool, error) {
+	results := []T{}
+	next := first
+	for range maxPages {
+		if next == "" {
+			return results, false, nil
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		resp, err := t.RoundTrip(req)
+		if err != nil {
+			return nil, false, err
+		}
+		b, err := io.ReadAll(io.LimitReader(resp.Body, tooBig))
+		resp.Body.Close()
+		if err != nil {
+			return nil, false, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, false, fmt.Errorf("GET %s: %s", next, resp.Status)
+		}
+
+		var page struct {
+			Next    string `json:"next"`
+			Results []T    `json:"results"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return nil, false, err
+		}
+		results = append(results, page.Results...)
+		next = page.Next
+		if next != "" && !strings.HasPrefix(next, base+"/") {
+			log.Printf("hubList: not following %q, outside %s", next, base)
+			return results, true, nil
+		}
+	}
+	return results, next != "", nil
+}
+
+// hubNamespace lists every repository in namespace, then every tag of each.
+// Repositories whose tags can't be listed say why instead.
+func (h *handler) hubNamespace(ctx context.Context, namespace string) (*HubNamespace, error) {
+	t := transport.Wrap(h.transport(ctx))
+
+	repos, more, err := hubList[HubRepo](ctx, t, h.hubAPI, h.hubURL(fmt.Sprintf("/v2/repositories/%s/", namespace), fmt.Sprintf("page_size=%d", hubPageSize)), maxHubPages)
+	if err != nil {
+		return nil, err
+	}
+	ns := &HubNamespace{Namespace: namespace, Repositories: repos, Truncated: more}
+
+	var g errgroup.Group
+	g.SetLimit(hubConcurrency)
+	for i := range ns.Repositories {
+		repo := &ns.Repositories[i]
+		g.Go(func() error {
+			u := h.hubURL(fmt.Sprintf("/v2/repositories/%s/%s/tags", namespace, url.PathEscape(repo.Name)), fmt.Sprintf("page_size=%d", hubPageSize))
+			tags, more, err := hubList[HubTag](ctx, t, h.hubAPI, u, maxHubTagPages)
+			if err != nil {
+				repo.Tags, repo.Error = []HubTag{}, err.Error()
+				return nil
+			}
+			repo.Tags, repo.TagsTruncated = tags, more
+			return nil
+		})
+	}
+	g.Wait()
+	return ns, nil
+}
+
+// cachedHubNamespace is hubNamespace, reusing what the same profile
+// fetched within hubReportTTL. Callers mustn't modify what it returns.
+func (h *handler) cachedHubNamespace(ctx context.Context, namespace string) (*HubNamespace, error) {
+	key := profileName(ctx) + " " + namespace
+	h.Lock()
+	report, ok := h.hubReports[key]
+	h.Unlock()
+	if ok && time.Now().Before(report.Expires) {
+		return report.ns, nil
+	}
+
+	ns, err := h.hubNamespace(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	h.Lock()
+	defer h.Unlock()
+	if h.hubReports == nil {
+		h.hubReports = map[string]hubReport{}
+	}
+	for k, report := range h.hubReports {
+		if !now.Before(report.Expires) {
+			delete(h.hubReports, k)
+		}
+	}
+	h.hubReports[key] = hubReport{Expires: now.Add(hubReportTTL), ns: ns}
+	return ns, nil
+}
+
+// How a namespace report can be sorted: by name, or the most of something
+// first.
+var hubSorts = map[string]func(a, b HubRepo) int{
+	"name":    func(a, b HubRepo) int { return 0 },
+	"pulls":   func(a, b HubRepo) int { return cmp.Compare(b.PullCount, a.PullCount) },
+	"stars":   func(a, b HubRepo) int { return cmp.Compare(b.StarCount, a.StarCount) },
+	"updated": func(a, b HubRepo) int { return strings.Compare(b.LastUpdated, a.LastUpdated) },
+	"tags":    func(a, b HubRepo) int { return cmp.Compare(len(b.Tags), len(a.Tags)) },
+}
+
+func sortHubRepos(repos []HubRepo, by string) error {
+	f, ok := hubSorts[by]
+	if !ok {
+		return fmt.Errorf("can't sort by %q", by)
+	}
+	slices.SortFunc(repos, func(a, b HubRepo) int {
+		return cmp.Or(f(a, b), strings.Compare(a.Name, b.Name))
+	})
+	return nil
+}
+
+// writeHubCSV writes a row per repository, tag and platform.
+func writeHubCSV(w io.Writer, ns *HubNamespace) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"repository", "pulls", "stars", "repository_updated", "tag", "tag_updated", "platform", "digest", "size", "description"})
+	for _, repo := range ns.Repositories {
+		row := func(tag, updated, platform, digest string, size int64) {
+			sz := ""
+			if size != 0 {
+				sz = strconv.FormatInt(size, 10)
+			}
+			cw.Write([]string{ns.Namespace + "/" + repo.Name, strconv.FormatInt(repo.PullCount, 10), strconv.FormatInt(repo.StarCount, 10),
+				repo.LastUpdated, tag, updated, platform, digest, sz, repo.Description})
+		}
+		if len(repo.Tags) == 0 {
+			row("", "", "", "", 0)
+		}
+		for _, tag := range repo.Tags {
+			if len(tag.Images) == 0 {
+				row(tag.Name, tag.LastUpdated, "", tag.Digest, tag.FullSize)
+			}
+			for _, img := range tag.Images {
+				row(tag.Name, tag.LastUpdated, img.platform(), img.Digest, img.Size)
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Every repository and tag in a Docker Hub namespace.
+func (h *handler) renderHubNamespace(w http.ResponseWriter, r *http.Request, namespace string) error {
+	if err := validateWatch("namespace", namespace); err != nil {
+		return err
+	}
+	qs := r.URL.Query()
+	by := cmp.Or(qs.Get("sort"), "pulls")
+	if _, ok := hubSorts[by]; !ok {
+		return fmt.Errorf("can't sort by %q", by)
+	}
+
+	cached, err := h.cachedHubNamespace(r.Context(), namespace)
+	if err != nil {
+		return err
+	}
+	// Sort a copy, the cached report is shared.
+	ns := *cached
+	ns.Repositories = slices.Clone(cached.Repositories)
+	if err := sortHubRepos(ns.Repositories, by); err != nil {
+		return err
+	}
+
+	if qs.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", namespace+".csv"))
+		return writeHubCSV(w, &ns)
+	}
+	if wantsJSON(r) {
+		return writeJSON(w, &ns)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"hub " + namespace}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	link := func(v url.Values) string {
+		q := url.Values{"hub": {namespace}, "sort": {by}}
+		for k, vs := range v {
+			q[k] = vs
+		}
+		return "/?" + html.EscapeString(q.Encode())
+	}
+	fmt.Fprintf(w, "<h2><a href=\"/?repo=%s\">%s</a></h2>\n", url.QueryEscape("docker.io/"+namespace), html.EscapeString(namespace))
+	fmt.Fprintf(w, "<p>%d repositories", len(ns.Repositories))
+	if ns.Truncated {
+		fmt.Fprintf(w, " (the first %d, there are more)", maxHubPages*hubPageSize)
+	}
+	fmt.Fprintf(w, ", export as <a href=\"%s\">json</a> or <a href=\"%s\">csv</a></p>\n", link(url.Values{"format": {"json"}}), link(url.Values{"format": {"csv"}}))
+
+	fmt.Fprintf(w, "<table>\n<tr>")
+	for _, col := range []string{"name", "pulls", "stars", "updated", "tags"} {
+		if col == by {
+			fmt.Fprintf(w, "<th>%s</th>", col)
+		} else {
+			fmt.Fprintf(w, "<th><a href=\"%s\">%s</a></th>", link(url.Values{"sort": {col}}), col)
+		}
+	}
+	fmt.Fprintf(w, "<th>description</th></tr>\n")
+	for _, repo := range ns.Repositories {
+		tags := strconv.Itoa(len(repo.Tags))
+		if repo.TagsTruncated {
+			tags += "+"
+		}
+		fmt.Fprintf(w, "<tr><td><a href=\"/?repo=%s\">%s</a></td><td>%s</td><td>%d</td><td>%s</td><td><a href=\"#%s\">%s</a></td><td>%s</td></tr>\n",
+			url.QueryEscape(namespace+"/"+repo.Name), html.EscapeString(repo.Name), humanize.Comma(repo.PullCount), repo.StarCount,
+			html.EscapeString(repo.LastUpdated), html.EscapeString(repo.Name), tags, html.EscapeString(repo.Description))
+	}
+	fmt.Fprintf(w, "</table>\n")
+
+	for _, repo := range ns.Repositories {
+		full := namespace + "/" + repo.Name
+		fmt.Fprintf(w, "<h3 id=\"%s\">%s</h3>\n", html.EscapeString(repo.Name), html.EscapeString(full))
+		if repo.Error != "" {
+			fmt.Fprintf(w, "<p><span class=\"flag\">error</span> %s</p>\n", html.EscapeString(repo.Error))
+			continue
+		}
+		if len(repo.Tags) == 0 {
+			fmt.Fprintf(w, "<p>no tags</p>\n")
+			continue
+		}
+		fmt.Fprintf(w, "<pre>\n")
+		for _, tag := range repo.Tags {
+			ref := full + ":" + tag.Name
+			fmt.Fprintf(w, "<a href=\"/?image=%s\">%s</a> <small>%s</small>\n", url.QueryEscape(ref), html.EscapeString(tag.Name), html.EscapeString(tag.LastUpdated))
+			for _, img := range tag.Images {
+				fmt.Fprintf(w, "  %-20s ", html.EscapeString(img.platform()))
+				if _, err := v1.NewHash(img.Digest); err == nil {
+					fmt.Fprintf(w, "<a title=\"%s\" href=\"/?image=%s\">%s</a>", img.Digest, url.QueryEscape(full+"@"+img.Digest), shortLayer(img.Digest))
+				}
+				fmt.Fprintf(w, " %s\n", humanize.IBytes(uint64(img.Size)))
+			}
+		}
+		if repo.TagsTruncated {
+			fmt.Fprintf(w, "... and more\n")
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
@@ -0,0 +1,176 @@
+package explore
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A digest that's fit to link to; the others in fakeHub aren't.
+var hubDigest = "sha256:" + strings.Repeat("c", 64)
+
+// fakeHub serves a namespace of three repositories, two to a page, and
+// counts how many times it's listed from the start.
+func fakeHub(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	mux := http.NewServeMux()
+	var s *httptest.Server
+	var listings atomic.Int64
+	mux.HandleFunc("/v2/repositories/acme/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			listings.Add(1)
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"next":null,"results":[{"name":"web","pull_count":5,"star_count":9,"last_updated":"2024-01-01T00:00:00Z"}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"next":%q,"results":[
+			{"name":"api","description":"the api","pull_count":1200,"star_count":1,"last_updated":"2025-06-01T00:00:00Z"},
+			{"name":"gone","pull_count":0,"star_count":0,"last_updated":"2020-01-01T00:00:00Z"}]}`,
+			s.URL+"/v2/repositories/acme/?page=2&page_size=100")
+	})
+	mux.HandleFunc("/v2/repositories/acme/api/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"next":null,"results":[{"name":"v1","last_updated":"2025-06-01T00:00:00Z","digest":"sha256:aaaa","full_size":300,"images":[
+			{"os":"linux","architecture":"amd64","digest":"sha256:bbbb","size":100},
+			{"os":"linux","architecture":"arm","variant":"v7","digest":%q,"size":200}]}]}`, hubDigest)
+	})
+	mux.HandleFunc("/v2/repositories/acme/web/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"next":null,"results":[{"name":"latest","images":[{"os":"linux","architecture":"amd64","digest":"\"><script>alert(1)</script>","size":50}]},{"name":"old","images":[]}]}`)
+	})
+	mux.HandleFunc("/v2/repositories/acme/gone/tags", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	s = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s, &listings
+}
+
+func TestHubNamespace(t *testing.T) {
+	s, _ := fakeHub(t)
+	h := &handler{profiles: builtinProfiles(), hubAPI: s.URL}
+
+	ns, err := h.hubNamespace(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ns.Repositories) != 3 || ns.Truncated {
+		t.Fatalf("repositories = %+v", ns.Repositories)
+	}
+	if err := sortHubRepos(ns.Repositories, "stars"); err != nil {
+		t.Fatal(err)
+	}
+	if got := []string{ns.Repositories[0].Name, ns.Repositories[1].Name, ns.Repositories[2].Name}; strings.Join(got, " ") != "web api gone" {
+		t.Errorf("by stars = %v", got)
+	}
+	api := ns.Repositories[1]
+	if len(api.Tags) != 1 || len(api.Tags[0].Images) != 2 || api.Tags[0].Images[1].platform() != "linux/arm/v7" || api.Tags[0].Images[1].Size != 200 {
+		t.Errorf("api tags = %+v", api.Tags)
+	}
+	if gone := ns.Repositories[2]; gone.Error == "" || len(gone.Tags) != 0 {
+		t.Errorf("gone = %+v", gone)
+	}
+	if err := sortHubRepos(ns.Repositories, "size"); err == nil {
+		t.Errorf("sorting by an unknown key worked")
+	}
+
+	repos, err := h.hubRepositories(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(repos, " ") != "acme/api acme/gone acme/web" {
+		t.Errorf("hubRepositories = %v", repos)
+	}
+}
+
+func TestRenderHubNamespace(t *testing.T) {
+	s, listings := fakeHub(t)
+	h := &handler{profiles: builtinProfiles(), hubAPI: s.URL}
+
+	w := httptest.NewRecorder()
+	if err := h.renderHubNamespace(w, httptest.NewRequest(http.MethodGet, "/?hub=acme&format=csv", nil), "acme"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A header, two platforms of api:v1, one of web:latest, web:old without
+	// any, and gone without tags.
+	if len(rows) != 6 {
+		t.Fatalf("csv = %v", rows)
+	}
+	if got := strings.Join(rows[1], ","); got != "acme/api,1200,1,2025-06-01T00:00:00Z,v1,2025-06-01T00:00:00Z,linux/amd64,sha256:bbbb,100,the api" {
+		t.Errorf("first row, by pulls = %s", got)
+	}
+
+	w = httptest.NewRecorder()
+	if err := h.renderHubNamespace(w, httptest.NewRequest(http.MethodGet, "/?hub=acme", nil), "acme"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`href="/?image=acme%2Fapi%3Av1"`, `href="/?image=` + url.QueryEscape("acme/api@"+hubDigest) + `"`, "linux/arm/v7"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("page is missing %s", want)
+		}
+	}
+	if strings.Contains(w.Body.String(), "<script>") {
+		t.Errorf("page links to a digest that isn't one")
+	}
+
+	// Sorting and exporting again reuse the report, without reordering it
+	// for anyone else.
+	for _, u := range []string{"/?hub=acme&sort=name", "/?hub=acme&sort=stars&format=json"} {
+		if err := h.renderHubNamespace(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u, nil), "acme"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := listings.Load(); n != 1 {
+		t.Errorf("namespace listed %d times, want 1", n)
+	}
+	ns, err := h.cachedHubNamespace(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := []string{ns.Repositories[0].Name, ns.Repositories[1].Name, ns.Repositories[2].Name}; strings.Join(got, " ") != "api gone web" {
+		t.Errorf("cached report reordered to %v", got)
+	}
+
+	// Until it expires.
+	for k, report := range h.hubReports {
+		report.Expires = time.Now()
+		h.hubReports[k] = report
+	}
+	if err := h.renderHubNamespace(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?hub=acme", nil), "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if n := listings.Load(); n != 2 {
+		t.Errorf("namespace listed %d times after expiry, want 2", n)
+	}
+}
+
+func TestHubListStaysOnAPI(t *testing.T) {
+	var s *httptest.Server
+	requests := 0
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		next := "https://elsewhere.example/v2/repositories/acme/?page=2"
+		if r.URL.Query().Get("page") == "" {
+			next = s.URL + "/v2/repositories/acme/?page=1"
+		}
+		fmt.Fprintf(w, `{"next":%q,"results":[{"name":"api"}]}`, next)
+	}))
+	defer s.Close()
+
+	repos, more, err := hubList[HubRepo](context.Background(), http.DefaultTransport, s.URL, s.URL+"/v2/repositories/acme/", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || !more || requests != 2 {
+		t.Errorf("hubList() = %d repositories, more=%v, after %d requests", len(repos), more, requests)
+	}
+}
@@ -0,0 +1,185 @@
+package explore
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LayerImage is one tag (and platform) that shipped a given layer.
+type LayerImage struct {
+	Registry     string `json:"registry"`
+	Namespace    string `json:"namespace,omitempty"`
+	Repository   string `json:"repository"`
+	Tag          string `json:"tag"`
+	Image        string `json:"image"`    // digest the tag resolved to
+	Manifest     string `json:"manifest"` // platform-specific manifest digest
+	OS           string `json:"os,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+	Variant      string `json:"variant,omitempty"`
+	Position     int    `json:"position"`
+	LastSeen     string `json:"last_seen,omitempty"`
+}
+
+// Ref returns e.g. "index.docker.io/robdisney/fauxpilotgov:latest".
+func (l *LayerImage) Ref() string {
+	repo := l.Repository
+	if l.Namespace != "" {
+		repo = l.Namespace + "/" + repo
+	}
+	return l.Registry + "/" + repo + ":" + l.Tag
+}
+
+// Platform returns e.g. "linux/arm64/v8", or "" for single-platform images.
+func (l *LayerImage) Platform() string {
+	return strings.TrimRight(strings.Join([]string{l.OS, l.Architecture, l.Variant}, "/"), "/")
+}
+
+// referenceContext is like extractImageContext but keeps the tag when there is one.
+func referenceContext(ref name.Reference) *ImageContext {
+	imgCtx := repoContext(ref.Context())
+	if tag, ok := ref.(name.Tag); ok {
+		imgCtx.Tag = tag.TagStr()
+		imgCtx.ImageRef = imgCtx.ImageRef + ":" + imgCtx.Tag
+	}
+	return imgCtx
+}
+
+// RecordManifest logs which tag resolved to desc and, for indexes and images,
+// which platform manifests and layers they point at.
+func (t *TocDB) RecordManifest(ref name.Reference, desc v1.Descriptor, manifest []byte) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+
+	imgCtx := referenceContext(ref)
+	seen := imgCtx.ImageRef + "@" + desc.Digest.String()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seen == nil {
+		t.seen = map[string]struct{}{}
+	}
+	if _, ok := t.seen[seen]; ok {
+		return nil
+	}
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if imgCtx.Tag != "" {
+		if _, err := tx.Exec(
+			`INSERT INTO images (registry, namespace, repository, tag, digest, media_type) VALUES (?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(registry, namespace, repository, tag, digest) DO UPDATE SET last_seen = CURRENT_TIMESTAMP`,
+			imgCtx.Registry, imgCtx.Namespace, imgCtx.Repository, imgCtx.Tag, desc.Digest.String(), desc.MediaType,
+		); err != nil {
+			return fmt.Errorf("images: %w", err)
+		}
+	}
+
+	if err := insertManifest(tx, imgCtx, desc, "", manifest); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	t.seen[seen] = struct{}{}
+	return nil
+}
+
+// insertManifest records desc (as a child of parent, if set). When the
+// manifest body is available, it also records an index's children or an
+// image's config and layers.
+func insertManifest(tx *sql.Tx, imgCtx *ImageContext, desc v1.Descriptor, parent string, manifest []byte) error {
+	var platformOS, arch, variant string
+	if desc.Platform != nil {
+		platformOS, arch, variant = desc.Platform.OS, desc.Platform.Architecture, desc.Platform.Variant
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO manifests (digest, media_type, size, registry, namespace, repository, index_digest, os, architecture, variant) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(registry, namespace, repository, digest, index_digest) DO NOTHING`,
+		desc.Digest.String(), desc.MediaType, desc.Size, imgCtx.Registry, imgCtx.Namespace, imgCtx.Repository, parent, platformOS, arch, variant,
+	); err != nil {
+		return fmt.Errorf("manifests: %w", err)
+	}
+
+	if manifest == nil {
+		return nil
+	}
+
+	switch {
+	case desc.MediaType.IsIndex():
+		im, err := v1.ParseIndexManifest(bytes.NewReader(manifest))
+		if err != nil {
+			return fmt.Errorf("ParseIndexManifest: %w", err)
+		}
+		for _, child := range im.Manifests {
+			if err := insertManifest(tx, imgCtx, child, desc.Digest.String(), nil); err != nil {
+				return err
+			}
+		}
+	case desc.MediaType.IsImage():
+		m, err := v1.ParseManifest(bytes.NewReader(manifest))
+		if err != nil {
+			return fmt.Errorf("ParseManifest: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE manifests SET config_digest = ? WHERE digest = ?`, m.Config.Digest.String(), desc.Digest.String()); err != nil {
+			return fmt.Errorf("config_digest: %w", err)
+		}
+		for i, layer := range m.Layers {
+			if _, err := tx.Exec(
+				`INSERT OR IGNORE INTO manifest_layers (manifest_digest, position, layer_digest, size, media_type) VALUES (?, ?, ?, ?, ?)`,
+				desc.Digest.String(), i, layer.Digest.String(), layer.Size, layer.MediaType,
+			); err != nil {
+				return fmt.Errorf("manifest_layers: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// LayerImages answers "which tags ship this layer".
+func (t *TocDB) LayerImages(digest string) ([]LayerImage, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := t.db.Query(
+		`SELECT registry, namespace, repository, tag, image_digest, manifest_digest, os, architecture, variant, position, last_seen
+		 FROM image_layers WHERE layer_digest = ?
+		 ORDER BY last_seen DESC, registry, namespace, repository, tag, os, architecture, variant`,
+		layerDigest(digest),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []LayerImage{}
+	for rows.Next() {
+		var (
+			li       LayerImage
+			lastSeen sql.NullString
+		)
+		if err := rows.Scan(&li.Registry, &li.Namespace, &li.Repository, &li.Tag, &li.Image, &li.Manifest,
+			&li.OS, &li.Architecture, &li.Variant, &li.Position, &lastSeen); err != nil {
+			return nil, err
+		}
+		li.LastSeen = lastSeen.String
+		images = append(images, li)
+	}
+
+	log.Printf("[DB] LayerImages: %s -> %d images", digest, len(images))
+	return images, rows.Err()
+}
@@ -0,0 +1,112 @@
+package explore
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/internal/soci"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func fakeHash(c string) v1.Hash {
+	return v1.Hash{Algorithm: "sha256", Hex: strings.Repeat(c, 64)}
+}
+
+func TestLayerImages(t *testing.T) {
+	db := NewTocDB(filepath.Join(t.TempDir(), "log.db"))
+	defer db.Close()
+
+	layer := fakeHash("a")
+	image := v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		Config:        v1.Descriptor{MediaType: types.OCIConfigJSON, Digest: fakeHash("c")},
+		Layers:        []v1.Descriptor{{MediaType: types.OCILayer, Digest: layer, Size: 1234}},
+	}
+	imageBytes, err := json.Marshal(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageDesc := v1.Descriptor{
+		MediaType: types.OCIManifestSchema1,
+		Digest:    fakeHash("b"),
+		Size:      int64(len(imageBytes)),
+		Platform:  &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}
+	index := v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests:     []v1.Descriptor{imageDesc},
+	}
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexDesc := v1.Descriptor{MediaType: types.OCIImageIndex, Digest: fakeHash("d"), Size: int64(len(indexBytes))}
+
+	// What happens when browsing ?image=robdisney/fauxpilotgov:latest and
+	// then clicking through to the arm64 manifest.
+	tag := name.MustParseReference("robdisney/fauxpilotgov:latest")
+	if err := db.RecordManifest(tag, indexDesc, indexBytes); err != nil {
+		t.Fatal(err)
+	}
+	dig := tag.Context().Digest(imageDesc.Digest.String())
+	imageDesc.Platform = nil
+	if err := db.RecordManifest(dig, imageDesc, imageBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := db.LayerImages(layer.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("LayerImages() = %+v, want 1 image", images)
+	}
+	if got, want := images[0].Ref(), "index.docker.io/robdisney/fauxpilotgov:latest"; got != want {
+		t.Errorf("Ref() = %q, want %q", got, want)
+	}
+	if got, want := images[0].Platform(), "linux/arm64/v8"; got != want {
+		t.Errorf("Platform() = %q, want %q", got, want)
+	}
+	if got, want := images[0].Image, indexDesc.Digest.String(); got != want {
+		t.Errorf("Image = %q, want %q", got, want)
+	}
+
+	// The layer is later indexed by digest alone, but the tag is recovered.
+	toc := &soci.TOC{Csize: 1234, Files: []soci.TOCFile{{Name: "etc/shadow", Size: 512}}}
+	if err := db.Insert(layer.String()+".0", toc, extractImageContext(tag.Context().Digest(layer.String()))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, q := range []SearchQuery{
+		{Query: "shadow", Tag: "latest"},
+		{Query: "shadow", Namespace: "robdisney", Repository: "fauxpilotgov", Tag: "latest"},
+	} {
+		hits, err := db.Search(&q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != 1 {
+			t.Fatalf("Search(%+v) = %+v, want 1 hit", q, hits)
+		}
+		if hits[0].Tag != "latest" || hits[0].ImageRef != "robdisney/fauxpilotgov:latest" {
+			t.Errorf("Search(%+v) tag = %q, image_ref = %q", q, hits[0].Tag, hits[0].ImageRef)
+		}
+		if !strings.HasPrefix(hits[0].URL, "/fs/index.docker.io/robdisney/fauxpilotgov@"+layer.String()+"/etc/shadow") {
+			t.Errorf("Search(%+v) URL = %q", q, hits[0].URL)
+		}
+	}
+
+	hits, err := db.Search(&SearchQuery{Query: "shadow", Tag: "nope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 0 {
+		t.Errorf("Search(tag=nope) = %+v, want none", hits)
+	}
+}
@@ -48,7 +48,7 @@ func (h *handler) oauthHandler(w http.ResponseWriter, r *http.Request) {
 
 	qs := r.URL.Query()
 	code := qs.Get("code")
-	tok, err := h.oauth.Exchange(r.Context(), code)
+	tok, err := h.oauth.Exchange(h.oauthContext(r.Context()), code)
 	if err != nil {
 		log.Printf("Exchange: %v", err)
 		return
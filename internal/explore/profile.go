@@ -0,0 +1,375 @@
+package explore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/oauth2"
+)
+
+// defaultProfile is the only profile when none are configured: straight out,
+// honoring HTTP_PROXY and friends like it always did.
+const defaultProfile = "default"
+
+// profileCookie remembers the profile picked with ?profile=.
+const profileCookie = "profile"
+
+// Profile is how requests leave this server: which proxy they go through,
+// what they claim to be, and how fast they're sent. It is the bottom of
+// every round tripper registry traffic goes through, see handler.transport.
+type Profile struct {
+	Name      string
+	UserAgent string      // replaces ours and go-containerregistry's entirely
+	Headers   http.Header // set on every request
+	Delay     time.Duration
+	Jitter    time.Duration // up to this much is added to Delay, at random
+
+	proxies []hostProxy
+	base    http.RoundTripper
+
+	mu   sync.Mutex
+	next time.Time // when the next request may go out
+}
+
+// hostProxy sends requests to hosts matching pattern through proxy, or
+// directly if proxy is nil. An empty pattern matches every host.
+type hostProxy struct {
+	pattern string
+	proxy   *url.URL
+}
+
+// Profiles are the configured opsec profiles, by name.
+type Profiles struct {
+	Default  string
+	profiles map[string]*Profile
+}
+
+type rawProfile struct {
+	Proxy   string `json:"proxy"` // for hosts no entry in Proxies matches
+	Proxies []struct {
+		Host  string `json:"host"` // e.g. "ghcr.io" or "*.gcr.io"
+		Proxy string `json:"proxy"`
+	} `json:"proxies"`
+	UserAgent string            `json:"userAgent"`
+	Headers   map[string]string `json:"headers"`
+	Delay     string            `json:"delay"`
+	Jitter    string            `json:"jitter"`
+}
+
+// LoadProfiles reads opsec profiles from a JSON file, see ParseProfiles.
+func LoadProfiles(path string) (*Profiles, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProfiles(b)
+}
+
+// ParseProfiles parses opsec profiles:
+//
+//	{
+//	  "default": "tor",
+//	  "profiles": {
+//	    "tor": {
+//	      "proxy": "socks5h://127.0.0.1:9050",
+//	      "proxies": [{"host": "*.internal.example", "proxy": "direct"}],
+//	      "userAgent": "Mozilla/5.0 ...",
+//	      "headers": {"Accept-Language": "en-US"},
+//	      "delay": "2s",
+//	      "jitter": "3s"
+//	    }
+//	  }
+//	}
+//
+// Proxies are http, https, socks5 or socks5h URLs, or "direct"; a profile
+// without one connects directly. Without "default" the only profile is.
+func ParseProfiles(b []byte) (*Profiles, error) {
+	var raw struct {
+		Default  string                `json:"default"`
+		Profiles map[string]rawProfile `json:"profiles"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles")
+	}
+
+	ps := &Profiles{Default: raw.Default, profiles: map[string]*Profile{}}
+	for name, rp := range raw.Profiles {
+		p, err := newProfile(name, rp)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		ps.profiles[name] = p
+	}
+	if ps.Default == "" {
+		if len(ps.profiles) != 1 {
+			return nil, fmt.Errorf("%d profiles but no default", len(ps.profiles))
+		}
+		for name := range ps.profiles {
+			ps.Default = name
+		}
+	}
+	if _, ok := ps.profiles[ps.Default]; !ok {
+		return nil, fmt.Errorf("default profile %q does not exist", ps.Default)
+	}
+	return ps, nil
+}
+
+func newProfile(name string, rp rawProfile) (*Profile, error) {
+	p := &Profile{
+		Name:      name,
+		UserAgent: rp.UserAgent,
+		Headers:   http.Header{},
+	}
+	for k, v := range rp.Headers {
+		p.Headers.Set(k, v)
+	}
+
+	var err error
+	if rp.Delay != "" {
+		if p.Delay, err = time.ParseDuration(rp.Delay); err != nil {
+			return nil, fmt.Errorf("delay: %w", err)
+		}
+	}
+	if rp.Jitter != "" {
+		if p.Jitter, err = time.ParseDuration(rp.Jitter); err != nil {
+			return nil, fmt.Errorf("jitter: %w", err)
+		}
+	}
+
+	for _, hp := range rp.Proxies {
+		if hp.Host == "" {
+			return nil, fmt.Errorf("proxy %q has no host", hp.Proxy)
+		}
+		if _, err := path.Match(hp.Host, ""); err != nil {
+			return nil, fmt.Errorf("host %q: %w", hp.Host, err)
+		}
+		u, err := parseProxy(hp.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, hostProxy{pattern: strings.ToLower(hp.Host), proxy: u})
+	}
+	u, err := parseProxy(rp.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	p.proxies = append(p.proxies, hostProxy{proxy: u})
+
+	t := remote.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = p.proxy
+	if p.UserAgent != "" {
+		// Otherwise CONNECT goes out as Go-http-client.
+		t.ProxyConnectHeader = http.Header{"User-Agent": {p.UserAgent}}
+	}
+	p.base = t
+	return p, nil
+}
+
+// parseProxy parses a proxy URL, nil for "direct" or nothing.
+func parseProxy(s string) (*url.URL, error) {
+	if s == "" || s == "direct" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy %q: unsupported scheme %q", s, u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %q: no host", s)
+	}
+	return u, nil
+}
+
+// proxy picks the proxy for req: the first entry whose pattern matches its
+// host wins.
+func (p *Profile) proxy(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	for _, hp := range p.proxies {
+		if hp.pattern == "" {
+			return hp.proxy, nil
+		}
+		if ok, _ := path.Match(hp.pattern, host); ok {
+			return hp.proxy, nil
+		}
+	}
+	return nil, nil
+}
+
+// wait blocks until the profile's pacing lets another request out.
+func (p *Profile) wait(ctx context.Context) error {
+	if p.Delay == 0 && p.Jitter == 0 {
+		return nil
+	}
+	gap := p.Delay
+	if p.Jitter > 0 {
+		gap += rand.N(p.Jitter)
+	}
+
+	p.mu.Lock()
+	at := p.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(gap)
+	p.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Profile) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := p.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if p.UserAgent != "" || len(p.Headers) != 0 {
+		req = req.Clone(req.Context())
+		for k, v := range p.Headers {
+			req.Header[k] = v
+		}
+		if p.UserAgent != "" {
+			req.Header.Set("User-Agent", p.UserAgent)
+		}
+	}
+	return p.base.RoundTrip(req)
+}
+
+// Get returns the profile called name, or the default one for "".
+func (ps *Profiles) Get(name string) (*Profile, error) {
+	if name == "" {
+		name = ps.Default
+	}
+	p, ok := ps.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("no such profile %q", name)
+	}
+	return p, nil
+}
+
+// Names lists the profiles, sorted.
+func (ps *Profiles) Names() []string {
+	names := make([]string, 0, len(ps.profiles))
+	for name := range ps.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// builtinProfiles is what's used when no profiles are configured.
+func builtinProfiles() *Profiles {
+	t := remote.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	return &Profiles{
+		Default: defaultProfile,
+		profiles: map[string]*Profile{
+			defaultProfile: {Name: defaultProfile, base: t},
+		},
+	}
+}
+
+// WithProfiles sets the opsec profiles all registry traffic goes out with.
+func WithProfiles(ps *Profiles) Option {
+	return func(h *handler) {
+		h.profiles = ps
+	}
+}
+
+type profileKey struct{}
+
+// withProfile makes requests made with ctx use the profile called name.
+func withProfile(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, profileKey{}, name)
+}
+
+// profileName is the profile requests made with ctx use, "" for the default.
+func profileName(ctx context.Context) string {
+	name, _ := ctx.Value(profileKey{}).(string)
+	return name
+}
+
+// failTransport refuses to send anything, for when the chosen profile
+// can't be had: nothing goes out without it.
+type failTransport struct {
+	err error
+}
+
+func (f failTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, f.err
+}
+
+// transport is what every outgoing request is sent with: the profile
+// chosen for ctx, with retries and our user agent on top.
+func (h *handler) transport(ctx context.Context) http.RoundTripper {
+	var t http.RoundTripper
+	if p, err := h.profiles.Get(profileName(ctx)); err != nil {
+		t = failTransport{err}
+	} else {
+		t = p
+	}
+	if l := crawlLimiter(ctx); l != nil {
+		t = &limitedTransport{inner: t, limiter: l}
+	}
+	t = transport.NewRetry(t)
+	t = transport.NewUserAgent(t, h.userAgent)
+	return t
+}
+
+// oauthContext is ctx with an oauth2.HTTPClient that goes out through the
+// selected profile, for token exchanges and refreshes.
+func (h *handler) oauthContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: h.transport(ctx)})
+}
+
+// selectProfile picks the profile for r from ?profile=, remembering it in a
+// cookie, or from that cookie, and puts it in r's context.
+func (h *handler) selectProfile(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
+	name := r.URL.Query().Get("profile")
+	if name != "" {
+		if _, err := h.profiles.Get(name); err != nil {
+			return nil, err
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     profileCookie,
+			Value:    name,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	} else if c, err := r.Cookie(profileCookie); err == nil {
+		name = c.Value
+		if _, err := h.profiles.Get(name); err != nil {
+			return nil, fmt.Errorf("%w (from cookie, pick another with ?profile=)", err)
+		}
+	}
+	return r.WithContext(withProfile(r.Context(), name)), nil
+}
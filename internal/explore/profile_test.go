@@ -0,0 +1,212 @@
+package explore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProfiles(t *testing.T) {
+	ps, err := ParseProfiles([]byte(`{
+		"default": "tor",
+		"profiles": {
+			"tor": {
+				"proxy": "socks5h://127.0.0.1:9050",
+				"proxies": [
+					{"host": "*.internal.example", "proxy": "direct"},
+					{"host": "ghcr.io", "proxy": "http://squid:3128"}
+				],
+				"delay": "1s",
+				"jitter": "500ms"
+			},
+			"direct": {}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(ps.Names(), ","), "direct,tor"; got != want {
+		t.Errorf("Names() = %s, want %s", got, want)
+	}
+	p, err := ps.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "tor" || p.Delay != time.Second || p.Jitter != 500*time.Millisecond {
+		t.Errorf("default profile = %+v", p)
+	}
+
+	for host, want := range map[string]string{
+		"index.docker.io":           "socks5h://127.0.0.1:9050",
+		"ghcr.io":                   "http://squid:3128",
+		"GHCR.io":                   "http://squid:3128",
+		"registry.internal.example": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "https://"+host+"/v2/", nil)
+		u, err := p.proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != want {
+			t.Errorf("proxy(%s) = %q, want %q", host, got, want)
+		}
+	}
+
+	if _, err := ps.Get("nope"); err == nil {
+		t.Errorf("Get(nope) succeeded")
+	}
+
+	for _, bad := range []string{
+		`{"profiles": {}}`,
+		`{"profiles": {"a": {}, "b": {}}}`,
+		`{"default": "c", "profiles": {"a": {}}}`,
+		`{"profiles": {"a": {"proxy": "ftp://x"}}}`,
+		`{"profiles": {"a": {"proxies": [{"proxy": "direct"}]}}}`,
+		`{"profiles": {"a": {"delay": "soon"}}}`,
+	} {
+		if _, err := ParseProfiles([]byte(bad)); err == nil {
+			t.Errorf("ParseProfiles(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestProfileTransport(t *testing.T) {
+	// An HTTP proxy that records what it was asked for.
+	var got *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		io.WriteString(w, "ok")
+	}))
+	defer proxy.Close()
+
+	ps, err := ParseProfiles([]byte(`{"profiles": {"quiet": {
+		"proxy": "` + proxy.URL + `",
+		"userAgent": "Mozilla/5.0",
+		"headers": {"accept-language": "en-US"}
+	}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handler{profiles: ps, userAgent: "yolosint"}
+
+	req, err := http.NewRequest(http.MethodGet, "http://registry.example/v2/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := h.transport(context.Background()).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got == nil {
+		t.Fatal("request didn't go through the proxy")
+	}
+	if got.Host != "registry.example" {
+		t.Errorf("proxied host = %q", got.Host)
+	}
+	if ua := got.Header.Get("User-Agent"); ua != "Mozilla/5.0" {
+		t.Errorf("User-Agent = %q, want the profile's", ua)
+	}
+	if al := got.Header.Get("Accept-Language"); al != "en-US" {
+		t.Errorf("Accept-Language = %q", al)
+	}
+
+	// An unknown profile sends nothing rather than falling back.
+	got = nil
+	ctx := withProfile(context.Background(), "loud")
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "http://registry.example/v2/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.transport(ctx).RoundTrip(req); err == nil {
+		t.Errorf("RoundTrip with unknown profile succeeded")
+	}
+	if got != nil {
+		t.Errorf("unknown profile reached the proxy")
+	}
+}
+
+func TestProfilePacing(t *testing.T) {
+	p := &Profile{Delay: 50 * time.Millisecond}
+	start := time.Now()
+	for range 3 {
+		if err := p.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("3 paced requests took %s, want at least 100ms", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p = &Profile{Delay: time.Hour}
+	p.wait(ctx)
+	if err := p.wait(ctx); err == nil {
+		t.Errorf("wait on a cancelled context succeeded")
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	ps, err := ParseProfiles([]byte(`{"default": "a", "profiles": {"a": {}, "b": {}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handler{profiles: ps}
+
+	w := httptest.NewRecorder()
+	r, err := h.selectProfile(w, httptest.NewRequest(http.MethodGet, "/?profile=b", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := profileName(r.Context()); got != "b" {
+		t.Errorf("profile = %q, want b", got)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "b" {
+		t.Fatalf("cookies = %v", cookies)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	if r, err = h.selectProfile(httptest.NewRecorder(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := profileName(r.Context()); got != "b" {
+		t.Errorf("profile from cookie = %q, want b", got)
+	}
+
+	if _, err := h.selectProfile(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?profile=c", nil)); err == nil {
+		t.Errorf("selectProfile(c) succeeded")
+	}
+}
+
+func TestWatchProfile(t *testing.T) {
+	db := NewTocDB(filepath.Join(t.TempDir(), "log.db"))
+	defer db.Close()
+
+	if err := db.AddWatch("repository", "ghcr.io/example/app", "tor"); err != nil {
+		t.Fatal(err)
+	}
+	// Adding it again changes the profile rather than duplicating it.
+	if err := db.AddWatch("repository", "ghcr.io/example/app", "direct"); err != nil {
+		t.Fatal(err)
+	}
+	watches, err := db.Watches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(watches) != 1 || watches[0].Profile != "direct" {
+		t.Errorf("Watches() = %+v", watches)
+	}
+}
@@ -92,11 +92,62 @@ func (p *purl) url(repo string) (string, error) {
 			arch := p.qualifiers.Get("arch")
 			return fmt.Sprintf("https://apk.dag.dev/https/packages.wolfi.dev/os/%s/%s-%s.apk", arch, p.name, p.version), nil
 		}
+	// Packages installed from these link to the files the inventory reads
+	// them from, which finds every indexed image that has them.
+	case "deb":
+		// var/lib/dpkg/info/curl.list, or libc6:amd64.list for multiarch.
+		return packageSearch("glob", "var/lib/dpkg/info/"+p.name+"[.:]*list"), nil
+	case "pypi":
+		// Wheels use underscores, and any case, in dist-info directory names;
+		// substring matches ignore case.
+		dist := strings.ReplaceAll(p.name, "-", "_")
+		if p.version == "" {
+			return packageSearch("substring", "/"+dist+"-"), nil
+		}
+		return packageSearch("substring", "/"+dist+"-"+p.version+".dist-info/"), nil
+	case "npm":
+		name := p.name
+		if p.namespace != "" {
+			name = p.namespace + "/" + name
+		}
+		return packageSearch("substring", "node_modules/"+name+"/package.json"), nil
 	}
 
 	return "", fmt.Errorf("TODO: implement %q", p.tipe)
 }
 
+// packageSearch links to a file search across every indexed layer.
+func packageSearch(match, q string) string {
+	return "/search?" + url.Values{"q": {q}, "match": {match}}.Encode()
+}
+
+// String encodes p as scheme:type/namespace/name@version?qualifiers#subpath.
+func (p *purl) String() string {
+	var sb strings.Builder
+	sb.WriteString("pkg:" + p.tipe + "/")
+	if p.namespace != "" {
+		for _, seg := range strings.Split(p.namespace, "/") {
+			sb.WriteString(purlEscape(seg) + "/")
+		}
+	}
+	sb.WriteString(purlEscape(p.name))
+	if p.version != "" {
+		sb.WriteString("@" + purlEscape(p.version))
+	}
+	if len(p.qualifiers) != 0 {
+		sb.WriteString("?" + p.qualifiers.Encode())
+	}
+	if p.subpath != "" {
+		sb.WriteString("#" + p.subpath)
+	}
+	return sb.String()
+}
+
+// purlEscape percent-encodes a segment, including the "@" of npm scopes.
+func purlEscape(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), "@", "%40")
+}
+
 // scheme:type/namespace/name@version?qualifiers#subpath
 func parsePurl(s string) (*purl, error) {
 	if !strings.HasPrefix(s, "pkg:") {
@@ -159,5 +210,12 @@ func parsePurl(s string) (*purl, error) {
 		p.name = chunks[0]
 	}
 
+	// Namespace, name and version are percent-encoded, e.g. npm's %40scope.
+	for _, field := range []*string{&p.namespace, &p.name, &p.version} {
+		if unescaped, err := url.PathUnescape(*field); err == nil {
+			*field = unescaped
+		}
+	}
+
 	return p, nil
 }
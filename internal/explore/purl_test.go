@@ -1,7 +1,13 @@
 package explore
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"testing"
+
+	"github.com/thesavant42/yolosint/internal/soci"
 )
 
 func FuzzPurl(f *testing.F) {
@@ -43,8 +49,9 @@ func TestPurl(t *testing.T) {
 	}{{
 		"pkg:bitbucket/birkenfeld/pygments-main@244fd47e07d1014f0aed9c",
 		"https://www.bitbucket.org/birkenfeld/pygments-main/changeset/244fd47e07d1014f0aed9c",
-		// }, {
-		// 	"pkg:deb/debian/curl@7.50.3-1?arch=i386&distro=jessie", "",
+	}, {
+		"pkg:deb/debian/curl@7.50.3-1?arch=i386&distro=jessie",
+		"/search?match=glob&q=var%2Flib%2Fdpkg%2Finfo%2Fcurl%5B.%3A%5D%2Alist",
 	}, {
 		"pkg:docker/cassandra@sha256:244fd47e07d1004f0aed9c",
 		"/?image=index.docker.io/library/cassandra@sha256:244fd47e07d1004f0aed9c",
@@ -68,20 +75,28 @@ func TestPurl(t *testing.T) {
 		//}, {
 		//"pkg:apk/alpine/foo@1.2.3?arch=x86_64",
 		//"https://pkgs.alpinelinux.org/packages?name=foo&branch=edge&arch=x86_64",
-		//}, {
-		//	"pkg:golang/google.golang.org/genproto#googleapis/api/annotations", "",
+	}, {
+		// Modules live inside binaries, so there's no file to find.
+		"pkg:golang/google.golang.org/genproto#googleapis/api/annotations",
+		"",
 		//}, {
 		//	"pkg:maven/org.apache.xmlgraphics/batik-anim@1.9.1?packaging=sources", "",
 		//}, {
 		//	"pkg:maven/org.apache.xmlgraphics/batik-anim@1.9.1?repository_url=repo.spring.io%2Frelease", "",
-		//}, {
-		//	"pkg:npm/%40angular/animation@12.3.1", "",
-		//}, {
-		//	"pkg:npm/foobar@12.3.1", "",
+	}, {
+		"pkg:npm/%40angular/animation@12.3.1",
+		"/search?match=substring&q=node_modules%2F%40angular%2Fanimation%2Fpackage.json",
+	}, {
+		"pkg:npm/foobar@12.3.1",
+		"/search?match=substring&q=node_modules%2Ffoobar%2Fpackage.json",
 		//}, {
 		//	"pkg:nuget/EnterpriseLibrary.Common@6.0.1304", "",
-		//}, {
-		//	"pkg:pypi/django@1.11.1", "",
+	}, {
+		"pkg:pypi/django@1.11.1",
+		"/search?match=substring&q=%2Fdjango-1.11.1.dist-info%2F",
+	}, {
+		"pkg:pypi/django",
+		"/search?match=substring&q=%2Fdjango-",
 		//}, {
 		//	"pkg:rpm/fedora/curl@7.50.3-1.fc25?arch=i386&distro=fedora-25", "",
 		//}, {
@@ -92,6 +107,12 @@ func TestPurl(t *testing.T) {
 			t.Fatal(err)
 		}
 		got, err := p.url("example.com")
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("purl(%q).url() = %q, want an error", tc.input, got)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("purl(%q).url(): %v", tc.input, err)
 		}
@@ -100,3 +121,81 @@ func TestPurl(t *testing.T) {
 		}
 	}
 }
+
+// TestPurlSearch checks package purls link to searches that find them.
+func TestPurlSearch(t *testing.T) {
+	db := NewTocDB(filepath.Join(t.TempDir(), "log.db"))
+	defer db.Close()
+
+	toc := &soci.TOC{Files: []soci.TOCFile{}}
+	for _, name := range []string{
+		"./var/lib/dpkg/info/curl.list",
+		"./var/lib/dpkg/info/curl.md5sums",
+		"./var/lib/dpkg/info/curl-dev.list",
+		"./var/lib/dpkg/info/libc6:amd64.list",
+		"usr/lib/python3/site-packages/PyYAML-6.0.1.dist-info/METADATA",
+		"usr/lib/python3/site-packages/typing_extensions-4.9.0.dist-info/METADATA",
+		"app/node_modules/@babel/core/package.json",
+		"app/node_modules/@babel/core/node_modules/debug/package.json",
+	} {
+		toc.Files = append(toc.Files, soci.TOCFile{Name: name, Size: 1})
+	}
+	if err := db.Insert("sha256:abc.0", toc, &ImageContext{Registry: "index.docker.io", Namespace: "library", Repository: "app"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		purl string
+		want []string
+	}{
+		{"pkg:deb/debian/curl@7.88.1-10", []string{"./var/lib/dpkg/info/curl.list"}},
+		{"pkg:deb/debian/libc6@2.36-9?arch=amd64", []string{"./var/lib/dpkg/info/libc6:amd64.list"}},
+		{"pkg:pypi/pyyaml@6.0.1", []string{"usr/lib/python3/site-packages/PyYAML-6.0.1.dist-info/METADATA"}},
+		{"pkg:pypi/typing-extensions@4.9.0", []string{"usr/lib/python3/site-packages/typing_extensions-4.9.0.dist-info/METADATA"}},
+		{"pkg:pypi/pyyaml@5.4", []string{}},
+		{"pkg:npm/%40babel/core@7.24.0", []string{"app/node_modules/@babel/core/package.json"}},
+		{"pkg:npm/debug@4.3.4", []string{"app/node_modules/@babel/core/node_modules/debug/package.json"}},
+	} {
+		p, err := parsePurl(tc.purl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		href, err := p.url("")
+		if err != nil {
+			t.Fatalf("purl(%q).url(): %v", tc.purl, err)
+		}
+		q, err := parseSearchQuery(httptest.NewRequest(http.MethodGet, href, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", href, err)
+		}
+		hits, err := db.Search(q)
+		if err != nil {
+			t.Fatalf("%s: %v", href, err)
+		}
+		got := []string{}
+		for _, hit := range hits {
+			got = append(got, hit.Path)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s (%s) found %v, want %v", tc.purl, href, got, tc.want)
+		}
+	}
+}
+
+func TestPurlString(t *testing.T) {
+	for _, want := range []string{
+		"pkg:deb/debian/curl@7.50.3-1?arch=i386&distro=jessie",
+		"pkg:golang/google.golang.org/genproto#googleapis/api/annotations",
+		"pkg:npm/%40angular/animation@12.3.1",
+		"pkg:pypi/django@1.11.1",
+		"pkg:rpm/fedora/curl@1:7.50.3-1.fc25?arch=i386&distro=fedora-25",
+	} {
+		p, err := parsePurl(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
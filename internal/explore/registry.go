@@ -68,7 +68,7 @@ func (h *handler) remoteOptions(w http.ResponseWriter, r *http.Request, repo str
 				tok.RefreshToken = rt.Value
 			}
 			if h.oauth != nil {
-				ts := h.oauth.TokenSource(r.Context(), tok)
+				ts := h.oauth.TokenSource(h.oauthContext(r.Context()), tok)
 				auth = google.NewTokenSourceAuthenticator(ts)
 			}
 
@@ -79,6 +79,7 @@ func (h *handler) remoteOptions(w http.ResponseWriter, r *http.Request, repo str
 
 	if t, err := h.transportFromCookie(w, r, repo, auth); err != nil {
 		log.Printf("failed to get transport from cookie: %v", err)
+		opts = append(opts, remote.WithTransport(h.transport(ctx)))
 	} else {
 		opts = append(opts, remote.WithTransport(t))
 	}
@@ -102,6 +103,9 @@ func (h *handler) fetchManifest(w http.ResponseWriter, r *http.Request, ref name
 	opts := h.remoteOptions(w, r, ref.Context().Name())
 	opts = append(opts, remote.WithMaxSize(tooBig))
 
+	// Keep the tag around for logging, it's lost in the rewrite below.
+	orig := ref
+
 	if _, ok := ref.(name.Digest); !ok && isDockerHub(ref.Context()) {
 		// To avoid DockerHub rate limits, HEAD and rewrite ref to be a name.Digest.
 		desc, err := remote.Head(ref, opts...)
@@ -112,6 +116,7 @@ func (h *handler) fetchManifest(w http.ResponseWriter, r *http.Request, ref name
 	}
 	if _, ok := ref.(name.Digest); ok {
 		if desc, ok := h.manifests[ref.Identifier()]; ok {
+			h.logManifest(orig, desc)
 			return desc, nil
 		}
 	}
@@ -123,6 +128,7 @@ func (h *handler) fetchManifest(w http.ResponseWriter, r *http.Request, ref name
 	if allowCache(r, ref) {
 		h.manifests[desc.Digest.String()] = desc
 	}
+	h.logManifest(orig, desc)
 	return desc, nil
 }
 
@@ -233,7 +239,7 @@ func (h *handler) fetchBlob(w http.ResponseWriter, r *http.Request) (*sizeBlob,
 	}
 
 	if root == "/http/" || root == "/https/" {
-		return h.fetchUrl(root, ref, digest, chunks, expectedSize)
+		return h.fetchUrl(r.Context(), root, ref, digest, chunks, expectedSize)
 	}
 
 	blobRef, err := name.NewDigest(ref)
@@ -318,7 +324,7 @@ func (h *handler) resolveUrl(w http.ResponseWriter, r *http.Request) (string, er
 	return l.Url, nil
 }
 
-func (h *handler) fetchUrl(root, ref, digest string, chunks []string, expectedSize int64) (*sizeBlob, string, error) {
+func (h *handler) fetchUrl(ctx context.Context, root, ref, digest string, chunks []string, expectedSize int64) (*sizeBlob, string, error) {
 	u, err := url.PathUnescape(chunks[0])
 	if err != nil {
 		return nil, "", err
@@ -331,7 +337,12 @@ func (h *handler) fetchUrl(root, ref, digest string, chunks []string, expectedSi
 	u = scheme + u
 	log.Printf("GET %v", u)
 
-	resp, err := http.Get(u)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &http.Client{Transport: h.transport(ctx)}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, "", err
 	}
@@ -409,7 +409,7 @@ func renderManifestTables(w *jsonOutputter, m map[string]interface{}) error {
 	}
 
 	// Combined layers link with icon (same row as config)
-	w.Print(` <a href="/layers/` + image + `/"><img src="/f7--layers-alt-fill.png" alt="layers" style="height:16px;vertical-align:middle"/></a><a href="/layers/` + image + `/"> combined layers view</a>`)
+	w.Print(` <a href="/layers/` + image + `/"><img src="/f7--layers-alt-fill.png" alt="layers" style="height:16px;vertical-align:middle"/></a><a href="/layers/` + image + `/"> combined layers view</a> <a href="/deleted/` + image + `/">deleted files</a> <a href="/buildinfo/` + image + `/">go binaries</a> <a href="/sbom/` + image + `/">packages</a> <a href="/vulns/` + image + `/">vulns</a> <a href="/diff/?a=` + url.QueryEscape(image) + `">diff</a>`)
 
 	// Layers section with labels
 	w.Print(`<table>`)
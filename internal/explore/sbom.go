@@ -0,0 +1,330 @@
+package explore
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/thesavant42/yolosint/internal/inventory"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+)
+
+// InventoryJSON is /sbom/<image>/?format=json.
+type InventoryJSON struct {
+	Image    string             `json:"image"`
+	Distro   inventory.Distro   `json:"distro"`
+	Packages []InventoryPackage `json:"packages"`
+	Errors   []string           `json:"errors,omitempty"`
+}
+
+// InventoryPackage is an inventory.Package with its purl spelled out.
+type InventoryPackage struct {
+	inventory.Package
+	Purl string `json:"purl"`
+}
+
+// packagePurl builds the purl of a package found in an image with distro.
+func packagePurl(p *inventory.Package, distro inventory.Distro) *purl {
+	q := url.Values{}
+	if p.Arch != "" {
+		q.Set("arch", p.Arch)
+	}
+	if p.Epoch != "" {
+		q.Set("epoch", p.Epoch)
+	}
+	switch p.Type {
+	case "apk", "deb", "rpm":
+		if distro.ID != "" && distro.VersionID != "" {
+			q.Set("distro", distro.ID+"-"+distro.VersionID)
+		}
+	}
+	return &purl{tipe: p.Type, namespace: p.Namespace, name: p.Name, version: p.Version, qualifiers: q}
+}
+
+// imageInventory scans the image in the request path for packages.
+func (h *handler) imageInventory(w http.ResponseWriter, r *http.Request) (name.Digest, *InventoryJSON, error) {
+	dig, ref, err := h.getDigest(w, r)
+	if err != nil {
+		return dig, nil, err
+	}
+
+	desc, err := h.fetchManifest(w, r, dig)
+	if err != nil {
+		return dig, nil, err
+	}
+
+	mfs, err := h.multiFS(w, r, dig, desc, ref)
+	if err != nil {
+		return dig, nil, err
+	}
+
+	inv, err := inventory.Scan(r.Context(), mfs)
+	if err != nil {
+		return dig, nil, err
+	}
+
+	out := &InventoryJSON{
+		Image:    dig.String(),
+		Distro:   inv.Distro,
+		Packages: make([]InventoryPackage, 0, len(inv.Packages)),
+		Errors:   inv.Errors,
+	}
+	for _, p := range inv.Packages {
+		out.Packages = append(out.Packages, InventoryPackage{p, packagePurl(&p, inv.Distro).String()})
+	}
+	return dig, out, nil
+}
+
+// renderInventory lists the packages installed in an image, from its
+// package databases rather than from an attestation.
+func (h *handler) renderInventory(w http.ResponseWriter, r *http.Request) error {
+	dig, out, err := h.imageInventory(w, r)
+	if err != nil {
+		return err
+	}
+
+	// Allow this to be cached for an hour.
+	w.Header().Set("Cache-Control", "max-age=3600, immutable")
+
+	switch r.URL.Query().Get("format") {
+	case "spdx":
+		ns := (&url.URL{Scheme: "https", Host: r.Host, Path: "/sbom/" + dig.String() + "/"}).String()
+		return writeJSON(w, toSPDX(out, ns, time.Now()))
+	case "cyclonedx":
+		return writeJSON(w, toCycloneDX(out, time.Now()))
+	}
+	if wantsJSON(r) {
+		return writeJSON(w, out)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"sbom " + dig.String()}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	export := func(format string) string {
+		u := *r.URL
+		qs := u.Query()
+		qs.Set("format", format)
+		u.RawQuery = qs.Encode()
+		return html.EscapeString(u.String())
+	}
+	fmt.Fprintf(w, "<p>%d packages in <a href=\"/layers/%s/\">%s</a> (<a href=\"%s\">json</a>, <a href=\"%s\">spdx</a>, <a href=\"%s\">cyclonedx</a>, <a href=\"/vulns/%s/\">vulnerabilities</a>)</p>\n",
+		len(out.Packages), dig.String(), html.EscapeString(dig.String()), export("json"), export("spdx"), export("cyclonedx"), dig.String())
+	if d := out.Distro; d.ID != "" {
+		fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(cmp.Or(d.Name, d.ID+" "+d.VersionID)))
+	}
+	if len(out.Packages) == 0 {
+		fmt.Fprintf(w, "<p>No package databases found. Go binaries only show up in layers indexed since their build info was recorded.</p>\n")
+	} else {
+		fmt.Fprintf(w, "<table>\n<tr><th>type</th><th>name</th><th>version</th><th>license</th><th>purl</th><th>found in</th></tr>\n")
+		for _, p := range out.Packages {
+			name := p.Name
+			if p.Namespace != "" && (p.Type == "npm" || p.Type == "golang") {
+				name = p.Namespace + "/" + p.Name
+			}
+
+			// Link the purl wherever purl.go knows to send it.
+			purlHTML := html.EscapeString(p.Purl)
+			if href, err := packagePurl(&p.Package, out.Distro).url(dig.Context().String()); err == nil {
+				purlHTML = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(href), purlHTML)
+			}
+
+			where := &url.URL{Path: path.Join("/fs/", p.Layer, p.Path)}
+			if p.Type == "golang" {
+				where.RawQuery = "render=buildinfo"
+			}
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td><a href=\"%s\" title=\"%s\">%s</a></td></tr>\n",
+				p.Type, html.EscapeString(name), html.EscapeString(p.Version), html.EscapeString(p.License), purlHTML,
+				html.EscapeString(where.String()), html.EscapeString(p.Layer), html.EscapeString(p.Path))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+
+	if len(out.Errors) != 0 {
+		fmt.Fprintf(w, "<p>Couldn't read:</p>\n<pre>\n")
+		for _, e := range out.Errors {
+			fmt.Fprintf(w, "%s\n", html.EscapeString(e))
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// SPDX 2.3, see https://spdx.github.io/spdx-spec/v2.3/
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	LicenseComments  string            `json:"licenseComments,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	Category string `json:"referenceCategory"`
+	Type     string `json:"referenceType"`
+	Locator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+func toSPDX(inv *InventoryJSON, namespace string, created time.Time) *spdxDocument {
+	const noassertion = "NOASSERTION"
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              inv.Image,
+		DocumentNamespace: namespace,
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: yolosint"},
+		},
+		Packages: []spdxPackage{{
+			Name:             inv.Image,
+			SPDXID:           "SPDXRef-Image",
+			DownloadLocation: noassertion,
+			LicenseConcluded: noassertion,
+			LicenseDeclared:  noassertion,
+			PrimaryPurpose:   "CONTAINER",
+		}},
+		Relationships: []spdxRelationship{{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Image"}},
+	}
+	for i, p := range inv.Packages {
+		id := "SPDXRef-Package-" + strconv.Itoa(i)
+		// Distro license fields are rarely valid SPDX expressions, so
+		// they're kept as comments rather than declared.
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             p.Name,
+			SPDXID:           id,
+			VersionInfo:      p.Version,
+			DownloadLocation: noassertion,
+			LicenseConcluded: noassertion,
+			LicenseDeclared:  noassertion,
+			LicenseComments:  p.License,
+			SourceInfo:       fmt.Sprintf("%s in %s", p.Path, p.Layer),
+			ExternalRefs:     []spdxExternalRef{{"PACKAGE-MANAGER", "purl", p.Purl}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-Image", "CONTAINS", id})
+	}
+	return doc
+}
+
+// CycloneDX 1.5, see https://cyclonedx.org/docs/1.5/json/
+type cdxBOM struct {
+	BOMFormat   string         `json:"bomFormat"`
+	SpecVersion string         `json:"specVersion"`
+	Version     int            `json:"version"`
+	Metadata    cdxMetadata    `json:"metadata"`
+	Components  []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type        string        `json:"type"`
+	BOMRef      string        `json:"bom-ref,omitempty"`
+	Name        string        `json:"name"`
+	Group       string        `json:"group,omitempty"`
+	Version     string        `json:"version,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Purl        string        `json:"purl,omitempty"`
+	Licenses    []cdxLicense  `json:"licenses,omitempty"`
+	Properties  []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxLicense struct {
+	License cdxLicenseName `json:"license"`
+}
+
+type cdxLicenseName struct {
+	Name string `json:"name"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func toCycloneDX(inv *InventoryJSON, created time.Time) *cdxBOM {
+	bom := &cdxBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{[]cdxComponent{{Type: "application", Name: "yolosint"}}},
+			Component: cdxComponent{Type: "container", BOMRef: "image", Name: inv.Image},
+		},
+		Components: []cdxComponent{},
+	}
+	if d := inv.Distro; d.ID != "" {
+		bom.Components = append(bom.Components, cdxComponent{
+			Type:        "operating-system",
+			BOMRef:      "os",
+			Name:        d.ID,
+			Version:     d.VersionID,
+			Description: d.Name,
+		})
+	}
+	for i, p := range inv.Packages {
+		c := cdxComponent{
+			Type:    "library",
+			BOMRef:  "pkg-" + strconv.Itoa(i),
+			Name:    p.Name,
+			Group:   p.Namespace,
+			Version: p.Version,
+			Purl:    p.Purl,
+			Properties: []cdxProperty{
+				{"yolosint:path", p.Path},
+				{"yolosint:layer", p.Layer},
+			},
+		}
+		if p.License != "" {
+			c.Licenses = []cdxLicense{{cdxLicenseName{p.License}}}
+		}
+		bom.Components = append(bom.Components, c)
+	}
+	return bom
+}
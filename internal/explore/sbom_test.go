@@ -0,0 +1,60 @@
+package explore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thesavant42/yolosint/internal/inventory"
+)
+
+func TestPackagePurl(t *testing.T) {
+	distro := inventory.Distro{ID: "debian", VersionID: "12"}
+	for _, tc := range []struct {
+		pkg  inventory.Package
+		want string
+	}{
+		{inventory.Package{Type: "deb", Namespace: "debian", Name: "libc6", Version: "2.36-9+deb12u4", Arch: "amd64"},
+			"pkg:deb/debian/libc6@2.36-9+deb12u4?arch=amd64&distro=debian-12"},
+		{inventory.Package{Type: "rpm", Namespace: "fedora", Name: "bash", Version: "5.2.15-5.fc39", Epoch: "1", Arch: "x86_64"},
+			"pkg:rpm/fedora/bash@5.2.15-5.fc39?arch=x86_64&distro=debian-12&epoch=1"},
+		{inventory.Package{Type: "npm", Namespace: "@babel", Name: "core", Version: "7.23.0"},
+			"pkg:npm/%40babel/core@7.23.0"},
+		{inventory.Package{Type: "golang", Namespace: "golang.org/x", Name: "sys", Version: "v0.18.0"},
+			"pkg:golang/golang.org/x/sys@v0.18.0"},
+	} {
+		if got := packagePurl(&tc.pkg, distro).String(); got != tc.want {
+			t.Errorf("packagePurl(%+v) = %q, want %q", tc.pkg, got, tc.want)
+		}
+	}
+}
+
+func TestSBOMExports(t *testing.T) {
+	inv := &InventoryJSON{
+		Image:  "example.com/app@sha256:abc",
+		Distro: inventory.Distro{ID: "alpine", VersionID: "3.19.1"},
+		Packages: []InventoryPackage{{
+			Package: inventory.Package{Type: "apk", Namespace: "alpine", Name: "musl", Version: "1.2.4-r2", License: "MIT", Path: "/lib/apk/db/installed", Layer: "example.com/app@sha256:def"},
+			Purl:    "pkg:apk/alpine/musl@1.2.4-r2",
+		}},
+	}
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	doc := toSPDX(inv, "https://example.com/sbom/", now)
+	if len(doc.Packages) != 2 || doc.Packages[1].ExternalRefs[0].Locator != "pkg:apk/alpine/musl@1.2.4-r2" {
+		t.Errorf("toSPDX() packages = %+v", doc.Packages)
+	}
+	if len(doc.Relationships) != 2 || doc.Relationships[1] != (spdxRelationship{"SPDXRef-Image", "CONTAINS", "SPDXRef-Package-0"}) {
+		t.Errorf("toSPDX() relationships = %+v", doc.Relationships)
+	}
+	if doc.CreationInfo.Created != "2024-03-01T00:00:00Z" {
+		t.Errorf("toSPDX() created = %s", doc.CreationInfo.Created)
+	}
+
+	bom := toCycloneDX(inv, now)
+	if len(bom.Components) != 2 || bom.Components[0].Type != "operating-system" {
+		t.Fatalf("toCycloneDX() components = %+v", bom.Components)
+	}
+	if c := bom.Components[1]; c.Purl != "pkg:apk/alpine/musl@1.2.4-r2" || c.Licenses[0].License.Name != "MIT" {
+		t.Errorf("toCycloneDX() component = %+v", c)
+	}
+}
@@ -0,0 +1,504 @@
+package explore
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+)
+
+// Bounds on how many hits a single search page may return.
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// SearchQuery describes a file search across every layer logged to the TocDB.
+type SearchQuery struct {
+	Query string // path, glob or substring depending on Match
+	Match string // "exact", "glob" or "substring" (default)
+
+	Registry   string
+	Namespace  string
+	Repository string
+	Tag        string
+
+	MinSize int64
+	MaxSize int64 // 0 means unbounded
+	Mode    int64 // permission bits that must all be set, e.g. 04000 for setuid
+
+	SHA256 string // hex content digest, for finding copies of a file
+
+	Limit  int
+	Offset int
+}
+
+// empty reports whether q has nothing to search for, as when the form is
+// first shown.
+func (q *SearchQuery) empty() bool {
+	return q.Query == "" && q.Registry == "" && q.Namespace == "" && q.Repository == "" && q.Tag == "" &&
+		q.MinSize == 0 && q.MaxSize == 0 && q.Mode == 0 && q.SHA256 == ""
+}
+
+// SearchHit is a single file in a single indexed layer.
+type SearchHit struct {
+	Layer      string    `json:"layer"`
+	MediaType  string    `json:"mediaType,omitempty"`
+	Csize      int64     `json:"csize,omitempty"`
+	Registry   string    `json:"registry,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Repository string    `json:"repository,omitempty"`
+	Tag        string    `json:"tag,omitempty"`
+	ImageRef   string    `json:"image_ref,omitempty"`
+	Path       string    `json:"path"`
+	Typeflag   byte      `json:"typeflag"`
+	Size       int64     `json:"size"`
+	Mode       int64     `json:"mode"`
+	ModTime    time.Time `json:"mod,omitempty"`
+	Linkname   string    `json:"linkname,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"`
+	URL        string    `json:"url,omitempty"`
+}
+
+// layerDigest recovers the layer digest from an index cache key.
+// Keys look like "sha256:abc.0", or "repo@sha256:abc.0" when indexed via /size/.
+func layerDigest(key string) string {
+	if _, after, ok := strings.Cut(key, "@"); ok {
+		key = after
+	}
+	if i := strings.LastIndex(key, "."); i != -1 {
+		key = key[:i]
+	}
+	return key
+}
+
+// repoFor returns the repository to use in /fs/ links for a hit.
+func (s *SearchHit) repoFor() string {
+	if s.Registry != "" && s.Repository != "" {
+		return path.Join(s.Registry, s.Namespace, s.Repository)
+	}
+	if s.Tag != "" {
+		return strings.TrimSuffix(s.ImageRef, ":"+s.Tag)
+	}
+	return s.ImageRef
+}
+
+func (s *SearchHit) link() string {
+	repo := s.repoFor()
+	if repo == "" {
+		return ""
+	}
+	u := url.URL{
+		Path: fmt.Sprintf("/fs/%s@%s/%s", repo, s.Layer, strings.TrimPrefix(cleanTarName(s.Path), "/")),
+	}
+	qs := url.Values{}
+	if s.MediaType != "" {
+		qs.Set("mt", s.MediaType)
+	}
+	if s.Csize != 0 {
+		qs.Set("size", strconv.FormatInt(s.Csize, 10))
+	}
+	u.RawQuery = qs.Encode()
+	return u.String()
+}
+
+// cleanTarName strips the "./" and "/" prefixes that tar writers disagree about.
+func cleanTarName(name string) string {
+	name = strings.TrimPrefix(name, "./")
+	return strings.TrimLeft(name, "/")
+}
+
+// Mirrors cleanTarName in SQL so patterns don't have to care about prefixes.
+const normalizedName = `(CASE WHEN f.name LIKE './%' THEN substr(f.name, 3) ELSE ltrim(f.name, '/') END)`
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Matches image_layers rows to the layer l, see layerDigest.
+const layerKeyMatch = `il.layer_digest || '.0' = substr(l.digest, instr(l.digest, '@') + 1)`
+
+// Older rows were logged without a tag, so fall back to the most recent tag
+// that referenced the layer from the same repository.
+const hitTag = `COALESCE(NULLIF(l.tag, ''), (SELECT il.tag FROM image_layers il WHERE ` + layerKeyMatch + `
+		       AND il.registry = l.registry AND il.namespace = COALESCE(l.namespace, '') AND il.repository = l.repository
+		       ORDER BY il.last_seen DESC LIMIT 1))`
+
+// Search finds files by path across all indexed layers.
+func (t *TocDB) Search(q *SearchQuery) ([]SearchHit, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+
+	// Only ".0" keys are real layers, the rest are indexes of indexes.
+	where := []string{`l.digest LIKE '%.0'`}
+	args := []any{}
+
+	if needle := cleanTarName(q.Query); needle != "" {
+		switch q.Match {
+		case "exact":
+			where = append(where, normalizedName+` = ?`)
+			args = append(args, needle)
+		case "glob":
+			where = append(where, normalizedName+` GLOB ?`)
+			args = append(args, needle)
+		default:
+			where = append(where, normalizedName+` LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+likeEscaper.Replace(needle)+"%")
+		}
+	}
+
+	if q.Tag != "" {
+		// A layer belongs to a tag if any manifest the tag resolved to lists it,
+		// regardless of which repository it happened to be browsed under.
+		sub := []string{layerKeyMatch, `il.tag = ?`}
+		args = append(args, q.Tag)
+		for col, v := range map[string]string{
+			"il.registry":   q.Registry,
+			"il.namespace":  q.Namespace,
+			"il.repository": q.Repository,
+		} {
+			if v != "" {
+				sub = append(sub, col+` = ?`)
+				args = append(args, v)
+			}
+		}
+		where = append(where, `EXISTS (SELECT 1 FROM image_layers il WHERE `+strings.Join(sub, " AND ")+`)`)
+	} else {
+		for col, v := range map[string]string{
+			"l.registry":   q.Registry,
+			"l.namespace":  q.Namespace,
+			"l.repository": q.Repository,
+		} {
+			if v != "" {
+				where = append(where, col+` = ?`)
+				args = append(args, v)
+			}
+		}
+	}
+
+	if q.MinSize > 0 {
+		where = append(where, `f.size >= ?`)
+		args = append(args, q.MinSize)
+	}
+	if q.MaxSize > 0 {
+		where = append(where, `f.size <= ?`)
+		args = append(args, q.MaxSize)
+	}
+	if q.Mode != 0 {
+		where = append(where, `(f.mode & ?) = ?`)
+		args = append(args, q.Mode, q.Mode)
+	}
+	if q.SHA256 != "" {
+		where = append(where, `f.sha256 = ?`)
+		args = append(args, q.SHA256)
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+	args = append(args, limit, q.Offset)
+
+	query := `SELECT DISTINCT l.digest, l.media_type, l.csize, l.registry, l.namespace, l.repository, ` + hitTag + `, l.image_ref,
+		       f.name, f.typeflag, f.size, f.mode, f.mod, f.linkname, f.sha256
+		FROM files f JOIN layers l ON f.layer_id = l.id
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY f.size DESC, f.name
+		LIMIT ? OFFSET ?`
+
+	log.Printf("[DB] Search: q=%q match=%q", q.Query, q.Match)
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	for rows.Next() {
+		var (
+			hit                                                SearchHit
+			mt, registry, namespace, repository, tag, imageRef sql.NullString
+			linkname, sha                                      sql.NullString
+			csize, size, mode                                  sql.NullInt64
+			typeflag                                           sql.NullInt64
+			mod                                                sql.NullTime
+		)
+		if err := rows.Scan(&hit.Layer, &mt, &csize, &registry, &namespace, &repository, &tag, &imageRef,
+			&hit.Path, &typeflag, &size, &mode, &mod, &linkname, &sha); err != nil {
+			return nil, err
+		}
+		hit.Layer = layerDigest(hit.Layer)
+		hit.MediaType = mt.String
+		hit.Csize = csize.Int64
+		hit.Registry = registry.String
+		hit.Namespace = namespace.String
+		hit.Repository = repository.String
+		hit.Tag = tag.String
+		hit.ImageRef = imageRef.String
+		hit.Typeflag = byte(typeflag.Int64)
+		hit.Size = size.Int64
+		hit.Mode = mode.Int64
+		hit.ModTime = mod.Time
+		hit.Linkname = linkname.String
+		hit.SHA256 = sha.String
+		hit.URL = hit.link()
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+// wantsJSON reports whether the client asked for JSON instead of HTML,
+// either with ?format=json or an Accept header.
+func wantsJSON(r *http.Request) bool {
+	return httpserve.WantsJSON(r)
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func parseSearchQuery(r *http.Request) (*SearchQuery, error) {
+	qs := r.URL.Query()
+	q := &SearchQuery{
+		Query:      strings.TrimSpace(qs.Get("q")),
+		Match:      qs.Get("match"),
+		Registry:   qs.Get("registry"),
+		Namespace:  qs.Get("namespace"),
+		Repository: qs.Get("repository"),
+		Tag:        qs.Get("tag"),
+	}
+
+	// e.g. ?image=robdisney/fauxpilotgov:latest as shorthand for the fields above.
+	if v := strings.TrimSpace(qs.Get("image")); v != "" {
+		tag, err := name.NewTag(v, name.WeakValidation)
+		if err != nil {
+			return nil, fmt.Errorf("image: %w", err)
+		}
+		imgCtx := referenceContext(tag)
+		q.Registry, q.Namespace, q.Repository, q.Tag = imgCtx.Registry, imgCtx.Namespace, imgCtx.Repository, imgCtx.Tag
+	}
+
+	if v := qs.Get("min_size"); v != "" {
+		n, err := humanize.ParseBytes(v)
+		if err != nil {
+			return nil, fmt.Errorf("min_size: %w", err)
+		}
+		q.MinSize = int64(n)
+	}
+	if v := qs.Get("max_size"); v != "" {
+		n, err := humanize.ParseBytes(v)
+		if err != nil {
+			return nil, fmt.Errorf("max_size: %w", err)
+		}
+		q.MaxSize = int64(n)
+	}
+	if v := qs.Get("mode"); v != "" {
+		n, err := strconv.ParseInt(v, 8, 64)
+		if err != nil {
+			return nil, fmt.Errorf("mode must be octal: %w", err)
+		}
+		q.Mode = n
+	}
+	if v := strings.TrimSpace(qs.Get("sha256")); v != "" {
+		v = strings.ToLower(strings.TrimPrefix(v, "sha256:"))
+		if _, err := hex.DecodeString(v); err != nil || len(v) != 64 {
+			return nil, fmt.Errorf("sha256 must be 64 hex characters: %q", v)
+		}
+		q.SHA256 = v
+	}
+	if v := qs.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("limit: %w", err)
+		}
+		q.Limit = n
+	}
+	if v := qs.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("offset: %w", err)
+		}
+		q.Offset = n
+	}
+	if q.Limit <= 0 || q.Limit > maxSearchLimit {
+		q.Limit = defaultSearchLimit
+	}
+
+	return q, nil
+}
+
+// Search every file we've ever indexed.
+func (h *handler) renderSearch(w http.ResponseWriter, r *http.Request) error {
+	if layer := r.URL.Query().Get("layer"); layer != "" {
+		return h.renderLayerImages(w, r, layer)
+	}
+	if r.URL.Query().Get("scope") == "config" {
+		return h.renderConfigSearch(w, r)
+	}
+
+	q, err := parseSearchQuery(r)
+	if err != nil {
+		return err
+	}
+
+	hits := []SearchHit{}
+	if !q.empty() {
+		hits, err = h.tocDB.Search(q)
+		if err != nil {
+			return fmt.Errorf("Search: %w", err)
+		}
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, hits)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"search " + q.Query}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, searchForm, html.EscapeString(q.Query),
+		selected(q.Match, "substring", true), selected(q.Match, "glob", false), selected(q.Match, "exact", false),
+		html.EscapeString(q.Registry), html.EscapeString(q.Namespace), html.EscapeString(q.Repository), html.EscapeString(q.Tag),
+		html.EscapeString(r.URL.Query().Get("min_size")), html.EscapeString(r.URL.Query().Get("max_size")), html.EscapeString(r.URL.Query().Get("mode")),
+		html.EscapeString(q.SHA256))
+
+	if len(hits) == 0 {
+		if !q.empty() {
+			fmt.Fprintf(w, "<p>no matches</p>\n")
+		}
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, hit := range hits {
+		mode := fs.FileMode(hit.Mode).String()
+		ts := hit.ModTime.Format("2006-01-02 15:04")
+		short := hit.Layer
+		if _, after, ok := strings.Cut(short, ":"); ok && len(after) > 8 {
+			short = after[:8]
+		}
+		where := hit.repoFor()
+		if hit.Tag != "" {
+			where += ":" + hit.Tag
+		}
+		short = fmt.Sprintf("<a title=%q href=\"/search?layer=%s\">%s</a>", hit.Layer, url.QueryEscape(hit.Layer), short)
+		name := html.EscapeString(hit.Path)
+		if hit.URL != "" {
+			name = fmt.Sprintf("<a href=%q>%s</a>", hit.URL, name)
+		}
+		if hit.Linkname != "" {
+			name += " -> " + html.EscapeString(hit.Linkname)
+		}
+		if hit.SHA256 != "" && hit.SHA256 != q.SHA256 {
+			name += fmt.Sprintf(" <a class=\"mt\" title=\"sha256:%s\" href=\"/search?sha256=%s\">[=]</a>", hit.SHA256, hit.SHA256)
+		}
+		fmt.Fprintf(w, "%s %s <span title=%q>%12d</span> %s %s <small>%s</small>\n", short, mode, humanize.IBytes(uint64(hit.Size)), hit.Size, ts, name, html.EscapeString(where))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	if len(hits) == q.Limit {
+		next := *r.URL
+		qs := next.Query()
+		qs.Set("offset", strconv.Itoa(q.Offset+len(hits)))
+		next.RawQuery = qs.Encode()
+		fmt.Fprintf(w, "<p><a href=%q>next</a></p>\n", next.String())
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// Which tags ship this layer?
+func (h *handler) renderLayerImages(w http.ResponseWriter, r *http.Request, layer string) error {
+	images, err := h.tocDB.LayerImages(layer)
+	if err != nil {
+		return fmt.Errorf("LayerImages: %w", err)
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, images)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{layer}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, "<h2>%s</h2>\n", html.EscapeString(layer))
+
+	if len(images) == 0 {
+		fmt.Fprintf(w, "<p>no tags seen referencing this layer</p>\n")
+		fmt.Fprint(w, footer)
+		return nil
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, li := range images {
+		ref := li.Ref()
+		fmt.Fprintf(w, "<a href=\"/?image=%s\">%s</a> %s layer %d of <a href=\"/?image=%s\">%s</a>\n",
+			url.QueryEscape(ref), html.EscapeString(ref), li.Platform(), li.Position,
+			url.QueryEscape(strings.TrimSuffix(ref, ":"+li.Tag)+"@"+li.Manifest), li.Manifest)
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+func selected(got, want string, dflt bool) string {
+	if got == want || (got == "" && dflt) {
+		return "selected"
+	}
+	return ""
+}
+
+const searchHeader = `
+<body>
+<div>
+<h1><a class="top" href="/"><img class="crane" src="/docdork-32.png"/> <span class="link"></span></a></h1>
+</div>
+`
+
+const searchForm = `
+<form action="/search" method="GET" autocomplete="off" spellcheck="false">
+<p>
+<input size="40" type="text" name="q" value="%s" placeholder=".aws/credentials"/>
+<select name="match">
+  <option value="substring" %s>substring</option>
+  <option value="glob" %s>glob</option>
+  <option value="exact" %s>exact</option>
+</select>
+<input type="submit" value="search"/>
+</p>
+<p>
+<input size="16" type="text" name="registry" value="%s" placeholder="registry"/>
+<input size="16" type="text" name="namespace" value="%s" placeholder="namespace"/>
+<input size="16" type="text" name="repository" value="%s" placeholder="repository"/>
+<input size="16" type="text" name="tag" value="%s" placeholder="tag"/>
+</p>
+<p>
+<input size="8" type="text" name="min_size" value="%s" placeholder="min size"/>
+<input size="8" type="text" name="max_size" value="%s" placeholder="max size"/>
+<input size="6" type="text" name="mode" value="%s" placeholder="mode"/>
+<input size="40" type="text" name="sha256" value="%s" placeholder="sha256"/>
+</p>
+<p><a href="/search?scope=config">search configs</a> <a href="/watch">watchlist</a></p>
+</form>
+`
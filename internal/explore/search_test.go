@@ -0,0 +1,134 @@
+package explore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thesavant42/yolosint/internal/soci"
+)
+
+func TestSearch(t *testing.T) {
+	db := NewTocDB(filepath.Join(t.TempDir(), "log.db"))
+	defer db.Close()
+
+	toc := &soci.TOC{
+		Csize:     1234,
+		Type:      "tar+gzip",
+		MediaType: "application/vnd.oci.image.layer.v1.tar+gzip",
+		Files: []soci.TOCFile{{
+			Name:    "./root/.aws/credentials",
+			Size:    116,
+			Mode:    0600,
+			ModTime: time.Unix(1700000000, 0).UTC(),
+			SHA256:  "5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5",
+		}, {
+			Name: "usr/bin/sudo",
+			Size: 232416,
+			Mode: 04755,
+		}, {
+			Name: "etc/passwd",
+			Size: 1024,
+			Mode: 0644,
+		}},
+	}
+	imgCtx := &ImageContext{
+		Registry:   "index.docker.io",
+		Namespace:  "robdisney",
+		Repository: "fauxpilotgov",
+		ImageRef:   "index.docker.io/robdisney/fauxpilotgov",
+	}
+	if err := db.Insert("sha256:abc.0", toc, imgCtx); err != nil {
+		t.Fatal(err)
+	}
+	// Indexes of indexes should never show up in results.
+	if err := db.Insert("sha256:abc.1", toc, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		q    SearchQuery
+		want []string
+	}{{
+		q:    SearchQuery{Query: ".aws/credentials"},
+		want: []string{"./root/.aws/credentials"},
+	}, {
+		q:    SearchQuery{Query: "/root/.aws/credentials", Match: "exact"},
+		want: []string{"./root/.aws/credentials"},
+	}, {
+		q:    SearchQuery{Query: ".aws/credentials", Match: "exact"},
+		want: []string{},
+	}, {
+		q:    SearchQuery{Query: "*/passwd", Match: "glob"},
+		want: []string{"etc/passwd"},
+	}, {
+		q:    SearchQuery{Mode: 04000, Namespace: "robdisney"},
+		want: []string{"usr/bin/sudo"},
+	}, {
+		q:    SearchQuery{Mode: 04000},
+		want: []string{"usr/bin/sudo"},
+	}, {
+		q:    SearchQuery{Namespace: "robdisney", MinSize: 100, MaxSize: 2000},
+		want: []string{"etc/passwd", "./root/.aws/credentials"},
+	}, {
+		q:    SearchQuery{SHA256: "5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5"},
+		want: []string{"./root/.aws/credentials"},
+	}, {
+		q:    SearchQuery{Query: "passwd", Namespace: "library"},
+		want: []string{},
+	}} {
+		hits, err := db.Search(&tc.q)
+		if err != nil {
+			t.Fatalf("Search(%+v): %v", tc.q, err)
+		}
+		got := []string{}
+		for _, hit := range hits {
+			got = append(got, hit.Path)
+			if hit.Layer != "sha256:abc" {
+				t.Errorf("Search(%+v): layer = %q", tc.q, hit.Layer)
+			}
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("Search(%+v) = %v, want %v", tc.q, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("Search(%+v) = %v, want %v", tc.q, got, tc.want)
+			}
+		}
+	}
+
+	hits, err := db.Search(&SearchQuery{Query: "credentials"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/fs/index.docker.io/robdisney/fauxpilotgov@sha256:abc/root/.aws/credentials?mt=application%2Fvnd.oci.image.layer.v1.tar%2Bgzip&size=1234"; len(hits) != 1 || hits[0].URL != want {
+		t.Errorf("URL = %v, want %q", hits, want)
+	}
+}
+
+func TestSearchQueryEmpty(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		empty bool
+	}{
+		{"", true},
+		{"match=glob&limit=10", true},
+		{"q=passwd", false},
+		{"mode=4000", false},
+		{"min_size=1024", false},
+		{"max_size=1024", false},
+		{"sha256=5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5", false},
+	} {
+		q, err := parseSearchQuery(httptest.NewRequest(http.MethodGet, "/search?"+tc.query, nil))
+		if err != nil {
+			t.Fatalf("parseSearchQuery(%q): %v", tc.query, err)
+		}
+		if got := q.empty(); got != tc.empty {
+			t.Errorf("parseSearchQuery(%q).empty() = %v, want %v", tc.query, got, tc.empty)
+		}
+	}
+}
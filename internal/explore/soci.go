@@ -29,7 +29,10 @@ func indexKey(prefix string, idx int) string {
 
 // extractImageContext extracts searchable metadata from a name.Digest reference
 func extractImageContext(dig name.Digest) *ImageContext {
-	ctx := dig.Context()
+	return repoContext(dig.Context())
+}
+
+func repoContext(ctx name.Repository) *ImageContext {
 	repoStr := ctx.RepositoryStr()
 
 	// Parse namespace and repository from path
@@ -48,7 +51,7 @@ func extractImageContext(dig name.Digest) *ImageContext {
 		Registry:   ctx.RegistryStr(),
 		Namespace:  namespace,
 		Repository: repository,
-		Tag:        "", // Tag not available from Digest reference
+		Tag:        "", // Tag not available from Digest reference, see TocDB.Insert
 		ImageRef:   ctx.String(),
 	}
 }
@@ -110,7 +113,7 @@ func (h *handler) tryNewIndex(w http.ResponseWriter, r *http.Request, dig name.D
 		imgCtx := extractImageContext(dig)
 		idx.Key = key
 		idx.OnTOC = func(k string, t *soci.TOC) {
-			h.logTOC(k, t, imgCtx)
+			h.logTOC(r.Context(), k, t, imgCtx)
 		}
 
 		indexer = idx
@@ -131,7 +134,7 @@ func (h *handler) tryNewIndex(w http.ResponseWriter, r *http.Request, dig name.D
 	// Render FS the old way while generating the index.
 	fs := h.newLayerFS(tr, blob.size, ref, dig.String(), kind, types.MediaType(mt))
 
-	if !inflight {
+	if !inflight && !wantsJSON(r) {
 		blob.h = h
 		blob.w = w
 		blob.total = loadingBarSize(dig.String())
@@ -243,7 +246,7 @@ func (h *handler) getIndexN(ctx context.Context, prefix string, idx int) (index
 		if err != nil {
 			return nil, fmt.Errorf("indexCache.Reader: %w", err)
 		}
-		sub, err = h.createIndex(ctx, rc, size, prefix, idx+1, "application/tar+gzip")
+		sub, err = h.createIndex(ctx, rc, size, prefix, idx+1, "application/tar+gzip", nil)
 		if err != nil {
 			return nil, fmt.Errorf("createIndex(%q, %d): %w", prefix, idx+1, err)
 		}
@@ -255,7 +258,7 @@ func (h *handler) getIndexN(ctx context.Context, prefix string, idx int) (index
 	return soci.NewIndex(bs, toc, sub)
 }
 
-func (h *handler) createIndex(ctx context.Context, rc io.ReadCloser, size int64, prefix string, idx int, mediaType string) (soci.Index, error) {
+func (h *handler) createIndex(ctx context.Context, rc io.ReadCloser, size int64, prefix string, idx int, mediaType string, imgCtx *ImageContext) (soci.Index, error) {
 	key := indexKey(prefix, idx)
 	cw, err := h.indexCache.Writer(ctx, key)
 	if err != nil {
@@ -273,11 +276,11 @@ func (h *handler) createIndex(ctx context.Context, rc io.ReadCloser, size int64,
 	}
 
 	// Set callback to log TOC to SQLite when it's written
-	// Note: createIndex is used for nested indexes (index-of-index) which don't have
-	// the original image reference context, so we pass nil for ImageContext
+	// Note: createIndex is also used for nested indexes (index-of-index) which don't have
+	// the original image reference context, so callers pass nil for ImageContext there
 	indexer.Key = key
 	indexer.OnTOC = func(k string, t *soci.TOC) {
-		h.logTOC(k, t, nil)
+		h.logTOC(ctx, k, t, imgCtx)
 	}
 
 	for {
@@ -326,5 +329,7 @@ func (h *handler) createFs(w http.ResponseWriter, r *http.Request, ref string, d
 	// We never saw a non-nil Body, we can do the range.
 	prefix := strings.TrimPrefix(ref, "/")
 	fs := soci.FS(index, blob, prefix, dig.String(), respTooBig, mt, renderHeader)
+	fs.SetFlagged(h.flagged(dig.DigestStr()))
+	fs.SetContext(r.Context())
 	return fs, nil
 }
@@ -0,0 +1,310 @@
+package explore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	unicodeutf8 "unicode/utf8"
+
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+)
+
+const (
+	// Databases are copied out of the layer before they're opened,
+	// so don't copy anything silly.
+	maxSQLiteSize = 512 << 20
+
+	sqlitePageSize = 100
+	sqliteMaxCell  = 256 // characters of a value shown before it's cut off
+	sqliteTimeout  = 30 * time.Second
+)
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+func init() {
+	httpserve.RegisterViewer("sqlite", viewSQLite)
+}
+
+// SQLiteJSON is ?render=sqlite for a database file.
+type SQLiteJSON struct {
+	Objects []SQLiteObject `json:"objects"` // the schema, from sqlite_master
+
+	// Only set when looking at a table (?table=).
+	Table   string   `json:"table,omitempty"`
+	Columns []string `json:"columns,omitempty"`
+	Rows    [][]any  `json:"rows,omitempty"`
+	Total   int64    `json:"total,omitempty"` // rows matching the filter
+	Next    string   `json:"next,omitempty"`  // pass back as ?offset= for the next page
+}
+
+// SQLiteObject is a table, index, view or trigger.
+type SQLiteObject struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	SQL  string `json:"sql,omitempty"`
+	Rows *int64 `json:"rows,omitempty"` // tables only
+}
+
+// viewSQLite shows the schema of a SQLite database in a layer, and pages
+// through its tables with ?table=, ?col= and ?q= (substring match).
+func viewSQLite(w http.ResponseWriter, r *http.Request, f httpserve.File, fi fs.FileInfo) error {
+	if fi.Size() > maxSQLiteSize {
+		return fmt.Errorf("%d bytes is too big to open, download it instead", fi.Size())
+	}
+
+	magic := make([]byte, len(sqliteMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, sqliteMagic) {
+		return fmt.Errorf("not a SQLite 3 database")
+	}
+
+	// Never hand the database itself to the browser, or open it where it
+	// lives: copy it somewhere private and open that read-only.
+	tmp, err := extractTemp(io.MultiReader(bytes.NewReader(magic), f), "yolosint-*.db", maxSQLiteSize)
+	if err != nil {
+		return fmt.Errorf("extracting database: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	ctx, cancel := context.WithTimeout(r.Context(), sqliteTimeout)
+	defer cancel()
+
+	db, err := sql.Open("sqlite", "file:"+tmp+"?mode=ro&immutable=1&_pragma=query_only(1)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	sv, err := querySQLite(ctx, db, r.URL.Query())
+	if err != nil {
+		return err
+	}
+	if wantsJSON(r) {
+		return writeJSON(w, sv)
+	}
+	writeSQLite(w, r, sv)
+	return nil
+}
+
+func querySQLite(ctx context.Context, db *sql.DB, qs url.Values) (*SQLiteJSON, error) {
+	sv := &SQLiteJSON{Objects: []SQLiteObject{}}
+
+	rows, err := db.QueryContext(ctx, `SELECT type, name, coalesce(sql, '') FROM sqlite_master ORDER BY type = 'table' DESC, type, name`)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema: %w", err)
+	}
+	for rows.Next() {
+		var o SQLiteObject
+		if err := rows.Scan(&o.Type, &o.Name, &o.SQL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sv.Objects = append(sv.Objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	table := qs.Get("table")
+	for i, o := range sv.Objects {
+		if o.Type != "table" {
+			continue
+		}
+		var n int64
+		if err := db.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdent(o.Name)).Scan(&n); err == nil {
+			sv.Objects[i].Rows = &n
+		}
+		if o.Name == table {
+			sv.Table = table
+		}
+	}
+	if table == "" {
+		return sv, nil
+	}
+	if sv.Table == "" {
+		return nil, fmt.Errorf("no table %q", table)
+	}
+
+	// Only ever put column names we got from the database into SQL.
+	colRows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	for colRows.Next() {
+		var c string
+		if err := colRows.Scan(&c); err != nil {
+			colRows.Close()
+			return nil, err
+		}
+		sv.Columns = append(sv.Columns, c)
+	}
+	colRows.Close()
+
+	where, args := "", []any{}
+	if col, q := qs.Get("col"), qs.Get("q"); q != "" {
+		cols := sv.Columns
+		if col != "" {
+			cols = []string{col}
+			if !slices.Contains(sv.Columns, col) {
+				return nil, fmt.Errorf("no column %q in %q", col, table)
+			}
+		}
+		var ors []string
+		for _, c := range cols {
+			ors = append(ors, "instr(CAST("+quoteIdent(c)+" AS TEXT), ?) > 0")
+			args = append(args, q)
+		}
+		where = " WHERE " + strings.Join(ors, " OR ")
+	}
+
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdent(table)+where, args...).Scan(&sv.Total); err != nil {
+		return nil, err
+	}
+
+	offset, _ := strconv.ParseInt(qs.Get("offset"), 10, 64)
+	offset = max(offset, 0)
+	rows, err = db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s%s LIMIT %d OFFSET %d", quoteIdent(table), where, sqlitePageSize, offset), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	sv.Columns = cols
+	sv.Rows = [][]any{}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range vals {
+			// []byte would be base64 in JSON; text is more useful when it is text.
+			if b, ok := v.([]byte); ok && unicodeutf8.Valid(b) {
+				vals[i] = string(b)
+			}
+		}
+		sv.Rows = append(sv.Rows, vals)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if next := offset + int64(len(sv.Rows)); next < sv.Total {
+		sv.Next = strconv.FormatInt(next, 10)
+	}
+	return sv, nil
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func writeSQLite(w http.ResponseWriter, r *http.Request, sv *SQLiteJSON) {
+	link := func(set ...string) string {
+		u := *r.URL
+		qs := u.Query()
+		for i := 0; i+1 < len(set); i += 2 {
+			if set[i+1] == "" {
+				qs.Del(set[i])
+			} else {
+				qs.Set(set[i], set[i+1])
+			}
+		}
+		u.RawQuery = qs.Encode()
+		return u.String()
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, o := range sv.Objects {
+		if o.Type != "table" {
+			continue
+		}
+		rows := "?"
+		if o.Rows != nil {
+			rows = strconv.FormatInt(*o.Rows, 10)
+		}
+		fmt.Fprintf(w, "%10s  <a href=%q>%s</a>\n", rows, link("table", o.Name, "offset", "", "col", "", "q", ""), html.EscapeString(o.Name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+
+	if sv.Table == "" {
+		fmt.Fprintf(w, "<details><summary>schema</summary><pre>\n")
+		for _, o := range sv.Objects {
+			if o.SQL != "" {
+				fmt.Fprintf(w, "%s;\n\n", html.EscapeString(o.SQL))
+			}
+		}
+		fmt.Fprintf(w, "</pre></details>\n")
+		return
+	}
+
+	fmt.Fprintf(w, "<h3>%s</h3>\n", html.EscapeString(sv.Table))
+	fmt.Fprintf(w, `<form method="GET">`)
+	for _, k := range []string{"render", "table", "mt", "size"} {
+		if v := r.URL.Query().Get(k); v != "" {
+			fmt.Fprintf(w, `<input type="hidden" name="%s" value="%s"/>`, k, html.EscapeString(v))
+		}
+	}
+	fmt.Fprintf(w, `<select name="col"><option value="">any column</option>`)
+	for _, c := range sv.Columns {
+		selected := ""
+		if c == r.URL.Query().Get("col") {
+			selected = " selected"
+		}
+		fmt.Fprintf(w, `<option value="%s"%s>%s</option>`, html.EscapeString(c), selected, html.EscapeString(c))
+	}
+	fmt.Fprintf(w, `</select> contains <input type="text" name="q" value="%s"/> <input type="submit" value="filter"/></form>`+"\n", html.EscapeString(r.URL.Query().Get("q")))
+
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	fmt.Fprintf(w, "<p>rows %d-%d of %d", offset+1, offset+int64(len(sv.Rows)), sv.Total)
+	if sv.Next != "" {
+		fmt.Fprintf(w, ` <a href=%q>next</a>`, link("offset", sv.Next))
+	}
+	fmt.Fprintf(w, "</p>\n")
+
+	fmt.Fprintf(w, "<table>\n<tr>")
+	for _, c := range sv.Columns {
+		fmt.Fprintf(w, "<th>%s</th>", html.EscapeString(c))
+	}
+	fmt.Fprintf(w, "</tr>\n")
+	for _, row := range sv.Rows {
+		fmt.Fprintf(w, "<tr>")
+		for _, v := range row {
+			fmt.Fprintf(w, "<td>%s</td>", html.EscapeString(sqliteCell(v)))
+		}
+		fmt.Fprintf(w, "</tr>\n")
+	}
+	fmt.Fprintf(w, "</table>\n")
+}
+
+func sqliteCell(v any) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		s = fmt.Sprintf("x'%x'", v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if unicodeutf8.RuneCountInString(s) > sqliteMaxCell {
+		s = string([]rune(s)[:sqliteMaxCell]) + "…"
+	}
+	return s
+}
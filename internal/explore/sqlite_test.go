@@ -0,0 +1,77 @@
+package explore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestViewSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE "user ""accounts""" (id INTEGER PRIMARY KEY, email TEXT, token BLOB)`,
+		`INSERT INTO "user ""accounts""" (email, token) VALUES ('alice@example.com', x'00ff'), ('bob@example.com', 'hunter2'), ('carol@example.org', NULL)`,
+		`CREATE INDEX by_email ON "user ""accounts"""(email)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	view := func(query string) (*SQLiteJSON, string) {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/fs/x/app.db?render=sqlite&"+query, nil)
+		if err := viewSQLite(w, r, f, fi); err != nil {
+			return nil, err.Error()
+		}
+		if !strings.Contains(query, "format=json") {
+			return nil, w.Body.String()
+		}
+		var sv SQLiteJSON
+		if err := json.Unmarshal(w.Body.Bytes(), &sv); err != nil {
+			t.Fatal(err)
+		}
+		return &sv, ""
+	}
+
+	sv, _ := view("format=json")
+	if len(sv.Objects) != 2 || sv.Objects[0].Type != "table" || sv.Objects[0].Rows == nil || *sv.Objects[0].Rows != 3 {
+		t.Errorf("objects = %+v", sv.Objects)
+	}
+
+	sv, _ = view(`format=json&table=user+"accounts"&col=email&q=example.com`)
+	if sv.Total != 2 || len(sv.Rows) != 2 || sv.Rows[1][2] != "hunter2" {
+		t.Errorf("filtered = %+v", sv)
+	}
+
+	if _, msg := view("table=user&col=email"); !strings.Contains(msg, "no table") {
+		t.Errorf("missing table: %s", msg)
+	}
+	if _, msg := view(`table=user+"accounts"&col=nope&q=x`); !strings.Contains(msg, "no column") {
+		t.Errorf("missing column: %s", msg)
+	}
+
+	_, page := view(`table=user+"accounts"`)
+	if !strings.Contains(page, "x&#39;00ff&#39;") || !strings.Contains(page, "NULL") {
+		t.Errorf("page = %s", page)
+	}
+}
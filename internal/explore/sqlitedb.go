@@ -2,6 +2,7 @@ package explore
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -28,6 +29,9 @@ type TocDB struct {
 	path string
 	once sync.Once
 	err  error
+
+	// manifests already recorded by this process, see RecordManifest
+	seen map[string]struct{}
 }
 
 func NewTocDB(path string) *TocDB {
@@ -98,6 +102,7 @@ func (t *TocDB) init() error {
 		          mod DATETIME,
 		          offset INTEGER,
 		          linkname TEXT,
+		          sha256 TEXT,
 		          FOREIGN KEY(layer_id) REFERENCES layers(id)
 		      );
 		      CREATE INDEX IF NOT EXISTS idx_files_name ON files(name);
@@ -106,6 +111,214 @@ func (t *TocDB) init() error {
 		      CREATE INDEX IF NOT EXISTS idx_layers_namespace ON layers(namespace);
 		      CREATE INDEX IF NOT EXISTS idx_layers_repository ON layers(repository);
 		      CREATE INDEX IF NOT EXISTS idx_layers_image_ref ON layers(image_ref);
+		      CREATE TABLE IF NOT EXISTS images (
+		          id INTEGER PRIMARY KEY,
+		          registry TEXT NOT NULL,
+		          namespace TEXT NOT NULL DEFAULT '',
+		          repository TEXT NOT NULL,
+		          tag TEXT NOT NULL,
+		          digest TEXT NOT NULL,
+		          media_type TEXT,
+		          first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          UNIQUE(registry, namespace, repository, tag, digest)
+		      );
+		      CREATE TABLE IF NOT EXISTS manifests (
+		          id INTEGER PRIMARY KEY,
+		          digest TEXT NOT NULL,
+		          media_type TEXT,
+		          size INTEGER,
+		          registry TEXT NOT NULL,
+		          namespace TEXT NOT NULL DEFAULT '',
+		          repository TEXT NOT NULL,
+		          index_digest TEXT NOT NULL DEFAULT '',
+		          os TEXT NOT NULL DEFAULT '',
+		          architecture TEXT NOT NULL DEFAULT '',
+		          variant TEXT NOT NULL DEFAULT '',
+		          config_digest TEXT,
+		          seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          UNIQUE(registry, namespace, repository, digest, index_digest)
+		      );
+		      CREATE TABLE IF NOT EXISTS manifest_layers (
+		          manifest_digest TEXT NOT NULL,
+		          position INTEGER NOT NULL,
+		          layer_digest TEXT NOT NULL,
+		          size INTEGER,
+		          media_type TEXT,
+		          PRIMARY KEY(manifest_digest, position)
+		      );
+		      CREATE INDEX IF NOT EXISTS idx_images_digest ON images(digest);
+		      CREATE INDEX IF NOT EXISTS idx_images_tag ON images(tag);
+		      CREATE INDEX IF NOT EXISTS idx_manifests_digest ON manifests(digest);
+		      CREATE INDEX IF NOT EXISTS idx_manifests_index_digest ON manifests(index_digest);
+		      CREATE INDEX IF NOT EXISTS idx_manifest_layers_layer ON manifest_layers(layer_digest);
+		      CREATE TABLE IF NOT EXISTS findings (
+		          id INTEGER PRIMARY KEY,
+		          layer_digest TEXT NOT NULL,
+		          path TEXT NOT NULL,
+		          offset INTEGER NOT NULL,
+		          rule_id TEXT NOT NULL,
+		          preview TEXT,
+		          found_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          UNIQUE(layer_digest, path, offset, rule_id)
+		      );
+		      CREATE TABLE IF NOT EXISTS scans (
+		          layer_digest TEXT PRIMARY KEY,
+		          files INTEGER,
+		          findings INTEGER,
+		          error TEXT,
+		          scanned_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		      );
+		      CREATE INDEX IF NOT EXISTS idx_findings_layer ON findings(layer_digest);
+		      CREATE INDEX IF NOT EXISTS idx_findings_rule ON findings(rule_id);
+		      CREATE TABLE IF NOT EXISTS configs (
+		          digest TEXT PRIMARY KEY,
+		          media_type TEXT,
+		          registry TEXT NOT NULL,
+		          namespace TEXT NOT NULL DEFAULT '',
+		          repository TEXT NOT NULL,
+		          os TEXT,
+		          architecture TEXT,
+		          created DATETIME,
+		          author TEXT,
+		          user TEXT,
+		          working_dir TEXT,
+		          entrypoint TEXT,
+		          cmd TEXT,
+		          seen_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		      );
+		      -- Every repository a config has been seen in; configs only has the first.
+		      CREATE TABLE IF NOT EXISTS config_repos (
+		          config_digest TEXT NOT NULL,
+		          registry TEXT NOT NULL,
+		          namespace TEXT NOT NULL DEFAULT '',
+		          repository TEXT NOT NULL,
+		          seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          PRIMARY KEY(config_digest, registry, namespace, repository)
+		      );
+		      INSERT OR IGNORE INTO config_repos (config_digest, registry, namespace, repository, seen_at)
+		          SELECT digest, registry, namespace, repository, seen_at FROM configs
+		          WHERE NOT EXISTS (SELECT 1 FROM config_repos);
+		      CREATE TABLE IF NOT EXISTS config_env (
+		          config_digest TEXT NOT NULL,
+		          name TEXT NOT NULL,
+		          value TEXT
+		      );
+		      CREATE TABLE IF NOT EXISTS config_ports (
+		          config_digest TEXT NOT NULL,
+		          port TEXT NOT NULL,
+		          number INTEGER,
+		          protocol TEXT
+		      );
+		      CREATE TABLE IF NOT EXISTS config_labels (
+		          config_digest TEXT NOT NULL,
+		          key TEXT NOT NULL,
+		          value TEXT
+		      );
+		      CREATE TABLE IF NOT EXISTS config_history (
+		          config_digest TEXT NOT NULL,
+		          position INTEGER NOT NULL,
+		          created DATETIME,
+		          created_by TEXT,
+		          comment TEXT,
+		          empty_layer INTEGER
+		      );
+		      CREATE INDEX IF NOT EXISTS idx_config_env ON config_env(config_digest);
+		      CREATE INDEX IF NOT EXISTS idx_config_env_name ON config_env(name);
+		      CREATE INDEX IF NOT EXISTS idx_config_ports ON config_ports(config_digest);
+		      CREATE INDEX IF NOT EXISTS idx_config_ports_number ON config_ports(number);
+		      CREATE INDEX IF NOT EXISTS idx_config_labels ON config_labels(config_digest);
+		      CREATE INDEX IF NOT EXISTS idx_config_labels_key ON config_labels(key);
+		      CREATE INDEX IF NOT EXISTS idx_config_history ON config_history(config_digest);
+		      CREATE INDEX IF NOT EXISTS idx_manifests_config_digest ON manifests(config_digest);
+		      CREATE TABLE IF NOT EXISTS watches (
+		          id INTEGER PRIMARY KEY,
+		          kind TEXT NOT NULL,
+		          target TEXT NOT NULL,
+		          added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          checked_at DATETIME,
+		          error TEXT,
+		          profile TEXT NOT NULL DEFAULT '',
+		          UNIQUE(kind, target)
+		      );
+		      CREATE TABLE IF NOT EXISTS watched_tags (
+		          repository TEXT NOT NULL,
+		          tag TEXT NOT NULL,
+		          digest TEXT NOT NULL,
+		          indexed_digest TEXT,
+		          first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          PRIMARY KEY(repository, tag)
+		      );
+		      CREATE TABLE IF NOT EXISTS tag_events (
+		          id INTEGER PRIMARY KEY,
+		          repository TEXT NOT NULL,
+		          tag TEXT NOT NULL,
+		          change TEXT NOT NULL,
+		          old_digest TEXT,
+		          new_digest TEXT,
+		          at DATETIME DEFAULT CURRENT_TIMESTAMP
+		      );
+		      CREATE INDEX IF NOT EXISTS idx_tag_events_repo ON tag_events(repository, tag);
+		      CREATE TABLE IF NOT EXISTS registry_reports (
+		          registry TEXT PRIMARY KEY,
+		          report TEXT NOT NULL,
+		          checked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		      );
+		      -- Whole-registry crawls and how far they got, see crawl.go.
+		      CREATE TABLE IF NOT EXISTS crawls (
+		          id INTEGER PRIMARY KEY,
+		          registry TEXT NOT NULL,
+		          profile TEXT NOT NULL DEFAULT '',
+		          concurrency INTEGER NOT NULL,
+		          rate REAL NOT NULL,
+		          index_layers INTEGER NOT NULL DEFAULT 0,
+		          state TEXT NOT NULL,
+		          next TEXT NOT NULL DEFAULT '',
+		          listed INTEGER NOT NULL DEFAULT 0,
+		          error TEXT,
+		          started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		          updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		      );
+		      CREATE TABLE IF NOT EXISTS crawl_repos (
+		          crawl_id INTEGER NOT NULL,
+		          repository TEXT NOT NULL,
+		          state TEXT NOT NULL DEFAULT 'pending',
+		          tags INTEGER NOT NULL DEFAULT 0,
+		          manifests INTEGER NOT NULL DEFAULT 0,
+		          layers INTEGER NOT NULL DEFAULT 0,
+		          error TEXT,
+		          updated_at DATETIME,
+		          PRIMARY KEY(crawl_id, repository)
+		      );
+		      CREATE INDEX IF NOT EXISTS idx_crawl_repos_state ON crawl_repos(crawl_id, state);
+		      -- OSV records imported with "oci osv", see vulns.go.
+		      CREATE TABLE IF NOT EXISTS osv_vulns (
+		          id TEXT PRIMARY KEY,
+		          modified TEXT,
+		          summary TEXT,
+		          aliases TEXT,
+		          severity TEXT,
+		          imported_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		      );
+		      CREATE TABLE IF NOT EXISTS osv_affected (
+		          vuln_id TEXT NOT NULL,
+		          ecosystem TEXT NOT NULL,
+		          name TEXT NOT NULL,
+		          affected TEXT NOT NULL
+		      );
+		      CREATE INDEX IF NOT EXISTS idx_osv_affected_name ON osv_affected(name);
+		      CREATE INDEX IF NOT EXISTS idx_osv_affected_vuln ON osv_affected(vuln_id);
+		      -- Every (tag, platform manifest, layer) triple we've seen, whether the
+		      -- tag points straight at an image or at an index of them.
+		      CREATE VIEW IF NOT EXISTS image_layers AS
+		          SELECT i.registry, i.namespace, i.repository, i.tag, i.digest AS image_digest, i.last_seen,
+		                 m.digest AS manifest_digest, m.os, m.architecture, m.variant,
+		                 ml.position, ml.layer_digest
+		          FROM images i
+		          JOIN manifests m ON m.registry = i.registry AND m.namespace = i.namespace AND m.repository = i.repository
+		              AND ((m.digest = i.digest AND m.index_digest = '') OR m.index_digest = i.digest)
+		          JOIN manifest_layers ml ON ml.manifest_digest = m.digest;
 		      `
 
 		log.Printf("[DB] init: executing schema")
@@ -117,6 +330,19 @@ func (t *TocDB) init() error {
 		}
 		log.Printf("[DB] init: schema exec succeeded")
 
+		if err := migrate(db); err != nil {
+			log.Printf("[DB] init: migration failed, err=%v", err)
+			db.Close()
+			t.err = err
+			return
+		}
+		if err := normalizeOSVNames(db); err != nil {
+			log.Printf("[DB] init: normalizing OSV names failed, err=%v", err)
+			db.Close()
+			t.err = err
+			return
+		}
+
 		log.Printf("[DB] init: checking database file after schema")
 		if info, err := os.Stat(t.path); err != nil {
 			log.Printf("[DB] init: database file STILL does not exist after schema, err=%v", err)
@@ -130,6 +356,37 @@ func (t *TocDB) init() error {
 	return t.err
 }
 
+// Columns added since their tables were first created, which CREATE TABLE IF
+// NOT EXISTS won't add to an existing database.
+var migrations = []struct {
+	table, column, decl string
+	after               string // run once the column exists
+}{
+	{"files", "sha256", "TEXT", `CREATE INDEX IF NOT EXISTS idx_files_sha256 ON files(sha256)`},
+	{"watches", "profile", "TEXT NOT NULL DEFAULT ''", ""},
+}
+
+func migrate(db *sql.DB) error {
+	for _, m := range migrations {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, m.table, m.column).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			log.Printf("[DB] migrate: adding %s.%s", m.table, m.column)
+			if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.table, m.column, m.decl)); err != nil {
+				return err
+			}
+		}
+		if m.after != "" {
+			if _, err := db.Exec(m.after); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (t *TocDB) Insert(digest string, toc *soci.TOC, imgCtx *ImageContext) error {
 	log.Printf("[DB] Insert: called for digest=%s", digest)
 	if err := t.init(); err != nil {
@@ -165,6 +422,22 @@ func (t *TocDB) Insert(digest string, toc *soci.TOC, imgCtx *ImageContext) error
 		if imgCtx.ImageRef != "" {
 			imageRef = &imgCtx.ImageRef
 		}
+
+		// Layers are always fetched by digest, so recover the tag from
+		// whichever manifest referenced this layer most recently.
+		if tag == nil && imgCtx.Repository != "" {
+			var found string
+			err := tx.QueryRow(
+				`SELECT tag FROM image_layers WHERE layer_digest = ? AND registry = ? AND namespace = ? AND repository = ? ORDER BY last_seen DESC LIMIT 1`,
+				layerDigest(digest), imgCtx.Registry, imgCtx.Namespace, imgCtx.Repository,
+			).Scan(&found)
+			if err == nil {
+				ref := imgCtx.ImageRef + ":" + found
+				tag, imageRef = &found, &ref
+			} else if err != sql.ErrNoRows {
+				log.Printf("[DB] Insert: tag lookup failed, err=%v", err)
+			}
+		}
 	}
 
 	res, err := tx.Exec(
@@ -180,7 +453,7 @@ func (t *TocDB) Insert(digest string, toc *soci.TOC, imgCtx *ImageContext) error
 		return err
 	}
 
-	stmt, err := tx.Prepare(`INSERT INTO files (layer_id, name, typeflag, size, mode, mod, offset, linkname) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(`INSERT INTO files (layer_id, name, typeflag, size, mode, mod, offset, linkname, sha256) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
@@ -191,7 +464,11 @@ func (t *TocDB) Insert(digest string, toc *soci.TOC, imgCtx *ImageContext) error
 		if !f.ModTime.IsZero() {
 			modTime = &f.ModTime
 		}
-		if _, err := stmt.Exec(layerID, f.Name, f.Typeflag, f.Size, f.Mode, modTime, f.Offset, f.Linkname); err != nil {
+		var sha *string
+		if f.SHA256 != "" {
+			sha = &f.SHA256
+		}
+		if _, err := stmt.Exec(layerID, f.Name, f.Typeflag, f.Size, f.Mode, modTime, f.Offset, f.Linkname, sha); err != nil {
 			return err
 		}
 	}
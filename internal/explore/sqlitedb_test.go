@@ -0,0 +1,68 @@
+package explore
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/thesavant42/yolosint/internal/secrets"
+	"github.com/thesavant42/yolosint/internal/soci"
+)
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.db")
+
+	// A files table from before content digests were recorded.
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Exec(`CREATE TABLE files (id INTEGER PRIMARY KEY, layer_id INTEGER NOT NULL, name TEXT NOT NULL, typeflag INTEGER, size INTEGER, mode INTEGER, mod DATETIME, offset INTEGER, linkname TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	db := NewTocDB(path)
+	defer db.Close()
+
+	sum := "5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5"
+	toc := &soci.TOC{Files: []soci.TOCFile{{Name: "etc/passwd", Size: 1, SHA256: sum}}}
+	if err := db.Insert("sha256:abc.0", toc, nil); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := db.Search(&SearchQuery{SHA256: sum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].SHA256 != sum {
+		t.Errorf("Search(sha256) = %+v, want etc/passwd", hits)
+	}
+}
+
+func TestFindingsByPath(t *testing.T) {
+	db := NewTocDB(filepath.Join(t.TempDir(), "log.db"))
+	defer db.Close()
+
+	// More findings than a page, with the one we want sorting last.
+	found := map[string][]secrets.Finding{"./zz/.env": {{Rule: "aws-access-key", Offset: 7}}}
+	for i := range maxSearchLimit {
+		found[fmt.Sprintf("a/%04d", i)] = []secrets.Finding{{Rule: "github-token"}}
+	}
+	if err := db.InsertFindings("sha256:abc", len(found), found, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"zz/.env", "/zz/.env", "./zz/.env"} {
+		got, err := db.Findings("sha256:abc", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].Rule != "aws-access-key" || got[0].Offset != 7 {
+			t.Errorf("Findings(%q) = %+v", file, got)
+		}
+	}
+	if got, err := db.Findings("", "nope"); err != nil || len(got) != 0 {
+		t.Errorf("Findings(nope) = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,384 @@
+package explore
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+)
+
+const (
+	defaultMinString = 6
+	maxStringLen     = 1024 // characters kept of a single string
+	maxStrings       = 20000
+
+	defaultEntropyWindow = 1024
+	entropyBars          = 512
+	maxEntropyRegions    = 1000
+)
+
+// highEntropy is how many bits per byte make a window of the file look
+// random. Random (or compressed, or encrypted) data measures about 7.8 over
+// 1KiB and code and text stay well below 7.2, but random data measures less
+// the smaller the window (a 64 byte window can't get over 6), so smaller
+// windows are held to the same fraction of what random data measures in them.
+func highEntropy(window int) float64 {
+	if window >= 1024 {
+		return 7.2
+	}
+	return 7.2 * randomEntropy(window) / randomEntropy(1024)
+}
+
+// randomEntropy is what n uniformly random bytes measure on average: each of
+// the 256 byte values turns up c times with binomial probability.
+func randomEntropy(n int) float64 {
+	const p = 1.0 / 256
+	ln, _ := math.Lgamma(float64(n + 1))
+	h := 0.0
+	for c := 1; c <= n; c++ {
+		lc, _ := math.Lgamma(float64(c + 1))
+		lnc, _ := math.Lgamma(float64(n - c + 1))
+		pc := math.Exp(ln - lc - lnc + float64(c)*math.Log(p) + float64(n-c)*math.Log1p(-p))
+		q := float64(c) / float64(n)
+		h -= 256 * pc * q * math.Log2(q)
+	}
+	return h
+}
+
+func init() {
+	httpserve.RegisterViewer("strings", viewStrings)
+}
+
+// StringsJSON is ?render=strings.
+type StringsJSON struct {
+	Size    int64         `json:"size"`
+	Min     int           `json:"min"`
+	Strings []FoundString `json:"strings"`
+	Next    string        `json:"next,omitempty"` // pass back as ?from= for more
+
+	Window  int             `json:"window"`  // bytes per entropy measurement
+	High    float64         `json:"high"`    // bits per byte that look random at this window
+	Bar     int64           `json:"bar"`     // bytes per entry of Entropy
+	Entropy []float64       `json:"entropy"` // bits per byte, the max over each bar of the chart
+	Regions []EntropyRegion `json:"regions"` // runs of windows at or over High
+}
+
+// FoundString is a run of printable characters.
+type FoundString struct {
+	Offset   int64  `json:"offset"`
+	Encoding string `json:"encoding"` // "ascii" or "utf-16le"
+	Text     string `json:"text"`
+}
+
+// EntropyRegion is a stretch of the file that looks random.
+type EntropyRegion struct {
+	Offset  int64   `json:"offset"`
+	Length  int64   `json:"length"`
+	Entropy float64 `json:"entropy"` // the highest window in it
+	Kind    string  `json:"kind"`    // a guess at what it is
+}
+
+func queryInt(r *http.Request, key string, def, lo, hi int64) int64 {
+	v, err := strconv.ParseInt(r.URL.Query().Get(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return min(max(v, lo), hi)
+}
+
+// viewStrings is strings(1) for a file in a layer, ASCII and UTF-16, with
+// a chart of how random each part of the file is. Both come from a single
+// pass over the file, so nothing is copied out of the layer.
+func viewStrings(w http.ResponseWriter, r *http.Request, f httpserve.File, fi fs.FileInfo) error {
+	ss := &stringScanner{
+		min:   int(queryInt(r, "min", defaultMinString, 3, maxStringLen)),
+		from:  queryInt(r, "from", 0, 0, math.MaxInt64),
+		found: []FoundString{},
+	}
+	em := newEntropyMeter(fi.Size(), int(queryInt(r, "window", defaultEntropyWindow, 64, 1<<20)))
+
+	buf := make([]byte, 32<<10)
+	for {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		n, err := f.Read(buf)
+		ss.Write(buf[:n])
+		em.Write(buf[:n])
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	ss.flush()
+	em.flush()
+
+	sv := &StringsJSON{
+		Size:    fi.Size(),
+		Min:     ss.min,
+		Strings: ss.found,
+		Window:  em.window,
+		High:    em.high,
+		Bar:     int64(em.window) * int64(em.perBar),
+		Entropy: em.bars,
+		Regions: em.regions,
+	}
+	if ss.next > 0 {
+		sv.Next = strconv.FormatInt(ss.next, 10)
+	}
+	if wantsJSON(r) {
+		return writeJSON(w, sv)
+	}
+	writeStrings(w, r, sv)
+	return nil
+}
+
+// stringScanner finds runs of printable ASCII, and of printable ASCII as
+// UTF-16LE (which is how Windows binaries keep most of their strings),
+// in what's written to it.
+type stringScanner struct {
+	min  int
+	from int64 // ignore strings before this offset
+
+	off   int64
+	ascii stringRun
+	wide  [2]stringRun // one per alignment
+	prev  byte
+
+	found []FoundString
+	next  int64 // where to pick up, if we stopped early
+}
+
+type stringRun struct {
+	start int64
+	n     int
+	text  []byte
+}
+
+func (s *stringRun) add(start int64, c byte) {
+	if s.n == 0 {
+		s.start = start
+	}
+	s.n++
+	if len(s.text) < maxStringLen {
+		s.text = append(s.text, c)
+	}
+}
+
+func printable(c byte) bool {
+	return c >= 0x20 && c < 0x7f || c == '\t'
+}
+
+func (s *stringScanner) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if printable(c) {
+			s.ascii.add(s.off, c)
+		} else {
+			s.end(&s.ascii, "ascii")
+		}
+
+		// Each UTF-16 character ends on a byte of the other alignment.
+		if s.off > 0 {
+			run := &s.wide[(s.off-1)&1]
+			if c == 0 && printable(s.prev) {
+				run.add(s.off-1, s.prev)
+			} else {
+				s.end(run, "utf-16le")
+			}
+		}
+		s.prev = c
+		s.off++
+	}
+	return len(p), nil
+}
+
+func (s *stringScanner) end(run *stringRun, enc string) {
+	if run.n >= s.min && run.start >= s.from && s.next == 0 {
+		if len(s.found) == maxStrings {
+			s.next = run.start
+		} else {
+			text := string(run.text)
+			if run.n > len(run.text) {
+				text += "…"
+			}
+			s.found = append(s.found, FoundString{run.start, enc, text})
+		}
+	}
+	run.n = 0
+	run.text = run.text[:0]
+}
+
+func (s *stringScanner) flush() {
+	s.end(&s.ascii, "ascii")
+	s.end(&s.wide[0], "utf-16le")
+	s.end(&s.wide[1], "utf-16le")
+
+	// The two encodings are found at slightly different times.
+	sort.SliceStable(s.found, func(i, j int) bool {
+		return s.found[i].Offset < s.found[j].Offset
+	})
+}
+
+// entropyMeter measures the Shannon entropy of each window of a file.
+type entropyMeter struct {
+	window  int
+	high    float64 // highEntropy(window)
+	perBar  int     // windows summarized by each bar of the chart
+	counts  [256]int
+	n       int
+	windows int
+
+	bars    []float64
+	regions []EntropyRegion
+	run     *EntropyRegion
+}
+
+func newEntropyMeter(size int64, window int) *entropyMeter {
+	windows := max((size+int64(window)-1)/int64(window), 1)
+	return &entropyMeter{
+		window:  window,
+		high:    highEntropy(window),
+		perBar:  int((windows + entropyBars - 1) / entropyBars),
+		bars:    []float64{},
+		regions: []EntropyRegion{},
+	}
+}
+
+func (e *entropyMeter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		k := min(len(p), e.window-e.n)
+		for _, c := range p[:k] {
+			e.counts[c]++
+		}
+		e.n += k
+		p = p[k:]
+		if e.n == e.window {
+			e.measure()
+		}
+	}
+	return n, nil
+}
+
+func entropy(counts *[256]int, n int) float64 {
+	h := 0.0
+	for _, c := range counts {
+		if c != 0 {
+			p := float64(c) / float64(n)
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+func (e *entropyMeter) measure() {
+	h := entropy(&e.counts, e.n)
+	start := int64(e.windows) * int64(e.window)
+
+	if e.windows%e.perBar == 0 {
+		e.bars = append(e.bars, h)
+	} else if last := len(e.bars) - 1; h > e.bars[last] {
+		e.bars[last] = h
+	}
+
+	if h >= e.high {
+		if e.run == nil {
+			e.run = &EntropyRegion{Offset: start}
+		}
+		e.run.Length = start + int64(e.n) - e.run.Offset
+		e.run.Entropy = max(e.run.Entropy, h)
+	} else {
+		e.endRun()
+	}
+
+	e.windows++
+	e.counts = [256]int{}
+	e.n = 0
+}
+
+func (e *entropyMeter) endRun() {
+	if e.run == nil {
+		return
+	}
+	if len(e.regions) < maxEntropyRegions {
+		e.run.Kind = "compressed, encrypted or packed"
+		if e.run.Length <= 4*int64(e.window) {
+			e.run.Kind = "small: a key, certificate or hash?"
+		}
+		e.regions = append(e.regions, *e.run)
+	}
+	e.run = nil
+}
+
+func (e *entropyMeter) flush() {
+	// A short tail can't be very random, but measure it anyway.
+	if e.n > 0 {
+		e.measure()
+	}
+	e.endRun()
+}
+
+func writeStrings(w http.ResponseWriter, r *http.Request, sv *StringsJSON) {
+	hex := func(off int64) string {
+		return fmt.Sprintf(`<a href="?offset=%d">%08x</a>`, off, off)
+	}
+	link := func(key, value string) string {
+		u := *r.URL
+		qs := u.Query()
+		qs.Set(key, value)
+		u.RawQuery = qs.Encode()
+		return html.EscapeString(u.String())
+	}
+
+	// One bar per chunk of the file, as tall as it is random.
+	const height = 64
+	fmt.Fprintf(w, "<h3>entropy</h3>\n")
+	fmt.Fprintf(w, `<svg viewBox="0 0 %d %d" preserveAspectRatio="none" width="100%%" height="%d" style="background:#222">`, max(len(sv.Entropy), 1), height, height)
+	for i, h := range sv.Entropy {
+		color := "#6a9"
+		if h >= sv.High {
+			color = "#e55"
+		}
+		bh := h / 8 * height
+		off := int64(i) * sv.Bar
+		fmt.Fprintf(w, `<a href="?offset=%d"><rect x="%d" y="%.2f" width="1" height="%.2f" fill="%s"><title>%08x: %.2f bits/byte</title></rect></a>`, off, i, height-bh, bh, color, off, h)
+	}
+	fmt.Fprintf(w, "</svg>\n")
+
+	fmt.Fprintf(w, "<p>%d bytes measured %d at a time (<a href=\"%s\">finer</a>). Red is %.1f bits per byte or more.</p>\n", sv.Size, sv.Window, link("window", strconv.Itoa(max(sv.Window/4, 64))), sv.High)
+	if len(sv.Regions) != 0 {
+		fmt.Fprintf(w, "<pre>\n")
+		for _, reg := range sv.Regions {
+			fmt.Fprintf(w, "%s %10d bytes  %.2f  %s\n", hex(reg.Offset), reg.Length, reg.Entropy, html.EscapeString(reg.Kind))
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	fmt.Fprintf(w, "<h3>strings</h3>\n")
+	fmt.Fprintf(w, `<form method="GET">`)
+	for _, k := range []string{"render", "window", "mt", "size"} {
+		if v := r.URL.Query().Get(k); v != "" {
+			fmt.Fprintf(w, `<input type="hidden" name="%s" value="%s"/>`, k, html.EscapeString(v))
+		}
+	}
+	fmt.Fprintf(w, `at least <input type="number" name="min" min="3" value="%d" style="width:4em"/> characters <input type="submit" value="go"/></form>`+"\n", sv.Min)
+	fmt.Fprintf(w, "<pre>\n")
+	for _, s := range sv.Strings {
+		enc := "  "
+		if s.Encoding == "utf-16le" {
+			enc = "u "
+		}
+		fmt.Fprintf(w, "%s %s%s\n", hex(s.Offset), enc, html.EscapeString(s.Text))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+	if sv.Next != "" {
+		fmt.Fprintf(w, "<p>Stopped after %d strings, <a href=\"%s\">more</a>.</p>\n", len(sv.Strings), link("from", sv.Next))
+	}
+}
@@ -0,0 +1,104 @@
+package explore
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestStringScanner(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("\x00\x01hi\x00/etc/passwd\x00\x7fELF")
+	b.WriteByte(0xff) // so the UTF-16 starts on an odd offset
+	for _, c := range utf16.Encode([]rune("C:\\Windows\\System32")) {
+		b.WriteByte(byte(c))
+		b.WriteByte(byte(c >> 8))
+	}
+	b.WriteString("\x00\x00tail string")
+
+	ss := &stringScanner{min: 4}
+	// Byte at a time, so nothing depends on where writes split.
+	for _, c := range b.Bytes() {
+		ss.Write([]byte{c})
+	}
+	ss.flush()
+
+	want := []FoundString{
+		{5, "ascii", "/etc/passwd"},
+		{22, "utf-16le", `C:\Windows\System32`},
+		{62, "ascii", "tail string"},
+	}
+	if len(ss.found) != len(want) {
+		t.Fatalf("found %+v", ss.found)
+	}
+	for i := range want {
+		if ss.found[i] != want[i] {
+			t.Errorf("found[%d] = %+v, want %+v", i, ss.found[i], want[i])
+		}
+	}
+
+	ss = &stringScanner{min: 4, from: 6}
+	ss.Write(b.Bytes())
+	ss.flush()
+	if len(ss.found) != 2 || ss.found[0].Offset != 22 {
+		t.Errorf("from 6: %+v", ss.found)
+	}
+}
+
+func TestEntropyMeter(t *testing.T) {
+	// Text, then 8KiB of noise, then a 1KiB "key", then more text.
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 400)
+	noise := make([]byte, 8<<10)
+	rand.New(rand.NewSource(1)).Read(noise)
+
+	var b bytes.Buffer
+	b.Write(text[:16<<10])
+	b.Write(noise)
+	b.Write(text[:16<<10])
+	b.Write(noise[:1<<10])
+	b.Write(text[:3<<10])
+
+	em := newEntropyMeter(int64(b.Len()), 1024)
+	em.Write(b.Bytes())
+	em.flush()
+
+	if len(em.regions) != 2 {
+		t.Fatalf("regions = %+v", em.regions)
+	}
+	if r := em.regions[0]; r.Offset != 16<<10 || r.Length != 8<<10 || r.Kind != "compressed, encrypted or packed" {
+		t.Errorf("noise = %+v", r)
+	}
+	if r := em.regions[1]; r.Offset != 40<<10 || r.Length != 1<<10 || r.Kind != "small: a key, certificate or hash?" {
+		t.Errorf("key = %+v", r)
+	}
+	if len(em.bars) != 44 {
+		t.Errorf("%d bars", len(em.bars))
+	}
+}
+
+func TestEntropyMeterWindows(t *testing.T) {
+	// However finely it's measured, 8KiB of noise in text is one region.
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 400)
+	noise := make([]byte, 8<<10)
+	rand.New(rand.NewSource(1)).Read(noise)
+
+	var b bytes.Buffer
+	b.Write(text[:16<<10])
+	b.Write(noise)
+	b.Write(text[:16<<10])
+
+	for _, window := range []int{64, 128, 256, 1024, 4096} {
+		em := newEntropyMeter(int64(b.Len()), window)
+		em.Write(b.Bytes())
+		em.flush()
+
+		if len(em.regions) != 1 {
+			t.Errorf("window %d: regions = %+v", window, em.regions)
+			continue
+		}
+		if r := em.regions[0]; r.Offset != 16<<10 || r.Length != 8<<10 {
+			t.Errorf("window %d: noise = %+v", window, r)
+		}
+	}
+}
@@ -87,6 +87,7 @@ details > summary::-webkit-details-marker {
   <option value="image" selected>Image</option>
   <option value="repo">Repository</option>
   <option value="dockerhub">Docker Hub</option>
+  <option value="search">Indexed files</option>
 </select> <input type="submit" />
 </form>
 
@@ -107,6 +108,11 @@ function updateSearch() {
     inp.placeholder = 'ubuntu';
     inp.value = 'ubuntu';
     frm.action = '/';
+  } else if (v === 'search') {
+    inp.name = 'q';
+    inp.placeholder = '.aws/credentials';
+    inp.value = '';
+    frm.action = '/search';
   } else {
     inp.name = 'q';
     inp.placeholder = 'Search Docker Hub...';
@@ -198,6 +204,11 @@ If you trust <a class="mt" href="https://github.com/jonjohnsonjr">me</a>, click
 	text-decoration: underline;
 }
 
+.flag {
+	color: #d33;
+	font-weight: bold;
+}
+
 .mt {
 	color: inherit;
 	text-decoration: inherit;
@@ -261,6 +272,10 @@ td:first-child {
 {{if .Subject}}<table><tr><td>OCI-Subject</td><td></td><td><a class="mt" href="/?image={{$.Repo}}@{{.Subject}}">{{.Subject}}</a></td></tr></table>{{end}}
 {{if .Path}}<p>path: {{.Path}}</p>{{end}}
 {{if .Filename}}<h3>{{.Filename}}</h3>{{end}}
+{{if .SHA256}}<p>sha256: <a href="/search?sha256={{.SHA256}}" title="where else has this file been seen?">{{.SHA256}}</a></p>{{end}}
+{{if .Browse}}<p><a href="{{.Browse}}">browse archive contents</a></p>{{end}}
+{{if .Git}}<p><a href="{{.Git}}">browse git history</a></p>{{end}}
+{{if .Views}}<p>view as:{{range .Views}} <a href="?render={{.Render}}">{{.Name}}</a>{{end}}</p>{{end}}
 </div>
 `
 
@@ -306,6 +321,10 @@ type HeaderData struct {
 	Subject              string
 	SaveURL              string
 	Filename             string
+	SHA256               string
+	Browse               string // relative link into an archive, see soci.NestedSep
+	Git                  string // the git explorer, for .git directories
+	Views                []FileView
 	AbbreviatedMediaType string
 	Path                 string
 }
@@ -0,0 +1,222 @@
+package explore
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+
+	"github.com/thesavant42/yolosint/internal/cosign"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// WithTrustedRoot sets what /verify/ checks certificates, log entries and
+// timestamps against. Without one only the signatures themselves are.
+func WithTrustedRoot(tr *cosign.TrustedRoot) Option {
+	return func(h *handler) {
+		h.trustedRoot = tr
+	}
+}
+
+// cosign's artifactType for signatures pushed as referrers, before bundles.
+const cosignSigArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+
+// sha256-<hex>.sig and friends, the tags cosign pushes next to an image.
+var cosignTag = regexp.MustCompile(`^(sha256)-([0-9a-f]{64})\.(sig|att)$`)
+
+// VerifyJSON is /verify/<signature manifest>/?format=json.
+type VerifyJSON struct {
+	Manifest    string           `json:"manifest"`
+	Subject     string           `json:"subject,omitempty"` // what the signatures should be of
+	TrustedRoot bool             `json:"trustedRoot"`       // whether one is configured
+	Signatures  []SignatureCheck `json:"signatures"`
+}
+
+// SignatureCheck is one signature in a manifest and how it fared.
+type SignatureCheck struct {
+	Layer     string `json:"layer"`
+	MediaType string `json:"mediaType"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"` // if it couldn't even be read
+	*cosign.Result
+}
+
+// isSignatureLayer is whether a layer of mediaType is something /verify/
+// knows how to check.
+func isSignatureLayer(mediaType types.MediaType) bool {
+	mt := string(mediaType)
+	return mt == cosign.SimpleSigningMediaType || mt == cosign.DSSEMediaType || cosign.IsBundle(mt)
+}
+
+// hasSignatures is whether the manifest m has any layers /verify/ can check.
+func hasSignatures(b []byte) bool {
+	m, err := v1.ParseManifest(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+	for _, l := range m.Layers {
+		if isSignatureLayer(l.MediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyLink is where the signatures in sig are checked, against subject
+// if it's known.
+func verifyLink(sig name.Digest, subject string) string {
+	u := url.URL{Path: "/verify/" + sig.String() + "/"}
+	if subject != "" {
+		u.RawQuery = url.Values{"subject": {subject}}.Encode()
+	}
+	return u.String()
+}
+
+// tagSubject is the digest a cosign tag like sha256-<hex>.sig is for.
+func tagSubject(ref name.Reference) string {
+	if tag, ok := ref.(name.Tag); ok {
+		if m := cosignTag.FindStringSubmatch(tag.TagStr()); m != nil {
+			return m[1] + ":" + m[2]
+		}
+	}
+	return ""
+}
+
+// renderVerify checks every signature in a cosign signature manifest or
+// Sigstore bundle referrer, entirely offline: only the manifest and its
+// layers are fetched, from the registry they're in.
+func (h *handler) renderVerify(w http.ResponseWriter, r *http.Request) error {
+	dig, _, err := h.getDigest(w, r)
+	if err != nil {
+		return err
+	}
+	desc, err := h.fetchManifest(w, r, dig)
+	if err != nil {
+		return err
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return err
+	}
+
+	out := &VerifyJSON{
+		Manifest:    dig.String(),
+		Subject:     r.URL.Query().Get("subject"),
+		TrustedRoot: h.trustedRoot != nil,
+		Signatures:  []SignatureCheck{},
+	}
+	if m.Subject != nil {
+		out.Subject = m.Subject.Digest.String()
+	}
+
+	opts := h.remoteOptions(w, r, dig.Context().Name())
+	opts = append(opts, remote.WithMaxSize(tooBig))
+	for _, l := range m.Layers {
+		if !isSignatureLayer(l.MediaType) {
+			continue
+		}
+		sc := SignatureCheck{Layer: l.Digest.String(), MediaType: string(l.MediaType)}
+		if s, err := h.readSignature(dig.Context().Digest(l.Digest.String()), l, opts); err != nil {
+			sc.Error = err.Error()
+		} else {
+			sc.Result = verifyBound(s, h.trustedRoot, out.Subject)
+			sc.OK = sc.Result.OK()
+		}
+		out.Signatures = append(out.Signatures, sc)
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, out)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"verify " + dig.String()}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	u := *r.URL
+	qs := u.Query()
+	qs.Set("format", "json")
+	u.RawQuery = qs.Encode()
+	fmt.Fprintf(w, "<p>%d signatures in <a href=\"/?image=%s\">%s</a>", len(out.Signatures), url.QueryEscape(dig.String()), html.EscapeString(dig.String()))
+	if out.Subject != "" {
+		subject := dig.Context().Digest(out.Subject).String()
+		fmt.Fprintf(w, " of <a href=\"/?image=%s\">%s</a>", url.QueryEscape(subject), html.EscapeString(out.Subject))
+	}
+	fmt.Fprintf(w, " (<a href=\"%s\">json</a>)</p>\n", html.EscapeString(u.String()))
+	if !out.TrustedRoot {
+		fmt.Fprintf(w, "<p>No trusted root is configured (<code>COSIGN_TRUSTED_ROOT</code>), so only the signatures themselves are checked.</p>\n")
+	}
+
+	for _, sc := range out.Signatures {
+		verdict := "FAIL"
+		if sc.OK {
+			verdict = "PASS"
+		}
+		fmt.Fprintf(w, "<h3>%s %s</h3>\n<p>%s", verdict, html.EscapeString(sc.Layer), html.EscapeString(sc.MediaType))
+		if sc.Result != nil && sc.Identity != nil {
+			fmt.Fprintf(w, ", signed by <strong>%s</strong>", html.EscapeString(sc.Identity.SAN))
+			if sc.Identity.Issuer != "" {
+				fmt.Fprintf(w, " via %s", html.EscapeString(sc.Identity.Issuer))
+			}
+		}
+		fmt.Fprintf(w, "</p>\n")
+		if sc.Error != "" {
+			fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(sc.Error))
+			continue
+		}
+		fmt.Fprintf(w, "<table>\n<tr><th>check</th><th>result</th><th>detail</th></tr>\n")
+		for _, c := range sc.Checks {
+			result := "<strong>fail</strong>"
+			if c.OK {
+				result = "pass"
+			}
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>\n", html.EscapeString(c.Name), result, html.EscapeString(c.Detail))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// verifyBound is cosign.Verify, except that a signature with no subject to
+// check it against can't pass: a valid signature of some other image is
+// no use to whoever's looking at this one.
+func verifyBound(s *cosign.Signature, root *cosign.TrustedRoot, subject string) *cosign.Result {
+	res := cosign.Verify(s, root, subject)
+	if subject == "" {
+		unbound := cosign.Check{Name: cosign.CheckSubject, Detail: "unbound: no subject to check it against, pass ?subject=<digest>"}
+		res.Checks = slices.Insert(res.Checks, min(1, len(res.Checks)), unbound)
+	}
+	return res
+}
+
+// readSignature fetches a signature layer and reads it with its
+// annotations.
+func (h *handler) readSignature(ref name.Digest, desc v1.Descriptor, opts []remote.Option) (*cosign.Signature, error) {
+	l, err := remote.Layer(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, tooBig))
+	if err != nil {
+		return nil, err
+	}
+	if cosign.IsBundle(string(desc.MediaType)) {
+		return cosign.ParseBundle(b)
+	}
+	return cosign.FromLayer(string(desc.MediaType), b, desc.Annotations)
+}
@@ -0,0 +1,59 @@
+package explore
+
+import (
+	"testing"
+
+	"github.com/thesavant42/yolosint/internal/cosign"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestTagSubject(t *testing.T) {
+	hex := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for _, tc := range []struct {
+		ref, want string
+	}{
+		{"example.com/app:sha256-" + hex + ".sig", "sha256:" + hex},
+		{"example.com/app:sha256-" + hex + ".att", "sha256:" + hex},
+		{"example.com/app:sha256-" + hex + ".sbom", ""},
+		{"example.com/app:latest", ""},
+		{"example.com/app@sha256:" + hex, ""},
+	} {
+		ref, err := name.ParseReference(tc.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tagSubject(ref); got != tc.want {
+			t.Errorf("tagSubject(%s) = %q, want %q", tc.ref, got, tc.want)
+		}
+	}
+}
+
+func TestHasSignatures(t *testing.T) {
+	sig := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},"layers":[{"mediaType":"application/vnd.dev.cosign.simplesigning.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}]}`
+	if !hasSignatures([]byte(sig)) {
+		t.Errorf("hasSignatures(simplesigning) = false")
+	}
+	img := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}]}`
+	if hasSignatures([]byte(img)) {
+		t.Errorf("hasSignatures(image) = true")
+	}
+}
+
+func TestVerifyBound(t *testing.T) {
+	s := &cosign.Signature{Kind: cosign.KindSimpleSigning, Payload: []byte(`{}`), Signed: []byte(`{}`)}
+	for _, subject := range []string{"", "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"} {
+		res := verifyBound(s, nil, subject)
+		var got []cosign.Check
+		for _, c := range res.Checks {
+			if c.Name == cosign.CheckSubject {
+				got = append(got, c)
+			}
+		}
+		if len(got) != 1 || got[0].OK || res.OK() {
+			t.Errorf("verifyBound(%q) = %+v", subject, res.Checks)
+		}
+		if res.Checks[1].Name != cosign.CheckSubject {
+			t.Errorf("verifyBound(%q) checks out of order: %+v", subject, res.Checks)
+		}
+	}
+}
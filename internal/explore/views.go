@@ -0,0 +1,67 @@
+package explore
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Binaries are copied out of the layer for viewers that need to seek
+// around in them, so don't copy anything silly.
+const maxBinarySize = 1 << 30
+
+// A FileView is another way to look at a file in a layer, linked from its
+// header. Each is an httpserve.Viewer registered under Render.
+type FileView struct {
+	Name   string
+	Render string
+}
+
+// Browser profiles keep their SQLite databases in files with no extension.
+var sqliteNames = map[string]bool{
+	"Cookies":    true,
+	"History":    true,
+	"Login Data": true,
+	"Web Data":   true,
+	"Favicons":   true,
+	"Top Sites":  true,
+	"Shortcuts":  true,
+}
+
+// fileViews are the views that make sense for filename, or for ctype as
+// sniffed by serveContent.
+func fileViews(filename, ctype string) []FileView {
+	var views []FileView
+	switch ext := strings.ToLower(path.Ext(filename)); {
+	case ext == ".db", ext == ".sqlite", ext == ".sqlite3", ext == ".db3", sqliteNames[path.Base(filename)]:
+		views = append(views, FileView{"sqlite", "sqlite"})
+	case ctype == "pe", ext == ".exe", ext == ".dll", ext == ".sys", ext == ".efi":
+		views = append(views, FileView{"pe", "pe"})
+	case ctype == "macho", ext == ".dylib":
+		views = append(views, FileView{"mach-o", "macho"})
+	case strings.HasSuffix(filename, ".intoto.jsonl"), strings.HasSuffix(filename, ".intoto.json"), ext == ".dsse":
+		views = append(views, FileView{"attestation", "attestation"})
+	}
+	return append(views, FileView{"strings", "strings"})
+}
+
+// extractTemp copies up to limit bytes of r into a new temp file (see
+// os.CreateTemp for pattern), for viewers that need a real file to open.
+// The caller removes it.
+func extractTemp(r io.Reader, pattern string, limit int64) (string, error) {
+	tmp, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, io.LimitReader(r, limit)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,371 @@
+package explore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thesavant42/yolosint/internal/osv"
+)
+
+// osvBatch is how many records are imported per transaction.
+const osvBatch = 1000
+
+// OSVImport counts what ImportOSV did.
+type OSVImport struct {
+	Vulns     int `json:"vulns"`
+	Affected  int `json:"affected"`  // package entries across them
+	Withdrawn int `json:"withdrawn"` // removed instead
+	Stale     int `json:"stale"`     // skipped, older than what was already imported
+}
+
+// ImportOSV loads OSV records from each path (see osv.Read) into the
+// database, replacing any copy of the same record that isn't newer.
+func (t *TocDB) ImportOSV(ctx context.Context, paths []string) (OSVImport, error) {
+	var stats OSVImport
+	if err := t.init(); err != nil {
+		return stats, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := []*osv.Vuln{}
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		tx, err := t.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, v := range pending {
+			var modified sql.NullString
+			if err := tx.QueryRow(`SELECT modified FROM osv_vulns WHERE id = ?`, v.ID).Scan(&modified); err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if newerOSV(modified.String, v.Modified) {
+				stats.Stale++
+				continue
+			}
+			if _, err := tx.Exec(`DELETE FROM osv_affected WHERE vuln_id = ?`, v.ID); err != nil {
+				return err
+			}
+			if v.Withdrawn != "" {
+				if _, err := tx.Exec(`DELETE FROM osv_vulns WHERE id = ?`, v.ID); err != nil {
+					return err
+				}
+				stats.Withdrawn++
+				continue
+			}
+			if _, err := tx.Exec(
+				`INSERT OR REPLACE INTO osv_vulns (id, modified, summary, aliases, severity) VALUES (?, ?, ?, ?, ?)`,
+				v.ID, v.Modified, v.Title(), strings.Join(v.Aliases, " "), v.Rating(),
+			); err != nil {
+				return err
+			}
+			for _, a := range v.Affected {
+				if a.Package.Name == "" {
+					continue
+				}
+				b, err := json.Marshal(a)
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec(`INSERT INTO osv_affected (vuln_id, ecosystem, name, affected) VALUES (?, ?, ?, ?)`,
+					v.ID, a.Package.Ecosystem, osv.PackageName(a.Package.Ecosystem, a.Package.Name), string(b)); err != nil {
+					return err
+				}
+				stats.Affected++
+			}
+			stats.Vulns++
+		}
+		pending = pending[:0]
+		return tx.Commit()
+	}
+
+	for _, p := range paths {
+		if err := osv.Read(p, func(v *osv.Vuln) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pending = append(pending, v)
+			if len(pending) == osvBatch {
+				return flush()
+			}
+			return nil
+		}); err != nil {
+			return stats, err
+		}
+	}
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	log.Printf("[DB] ImportOSV: %d vulns, %d affected packages, %d withdrawn", stats.Vulns, stats.Affected, stats.Withdrawn)
+	return stats, nil
+}
+
+// newerOSV reports whether the stored modified time is later than the one
+// being imported. Records that don't say are always replaced.
+func newerOSV(stored, importing string) bool {
+	a, err := time.Parse(time.RFC3339Nano, stored)
+	if err != nil {
+		return false
+	}
+	b, err := time.Parse(time.RFC3339Nano, importing)
+	if err != nil {
+		return false
+	}
+	return a.After(b)
+}
+
+// normalizeOSVNames rewrites PyPI names imported before they were
+// normalized, see osv.PackageName. Once they all are, nothing matches.
+func normalizeOSVNames(db *sql.DB) error {
+	rows, err := db.Query(`SELECT rowid, name FROM osv_affected WHERE ecosystem = 'PyPI' AND name GLOB '*[A-Z_.]*'`)
+	if err != nil {
+		return err
+	}
+	fixes := map[int64]string{}
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		fixes[id] = osv.PackageName("PyPI", name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(fixes) == 0 {
+		return err
+	}
+
+	log.Printf("[DB] normalizeOSVNames: %d PyPI names", len(fixes))
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, name := range fixes {
+		if _, err := tx.Exec(`UPDATE osv_affected SET name = ? WHERE rowid = ?`, name, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// OSVCount is how many OSV records have been imported.
+func (t *TocDB) OSVCount() (int, error) {
+	if err := t.init(); err != nil {
+		return 0, err
+	}
+	var n int
+	err := t.db.QueryRow(`SELECT COUNT(*) FROM osv_vulns`).Scan(&n)
+	return n, err
+}
+
+// osvCandidate is an imported record that names a package, whether or not
+// the version matches.
+type osvCandidate struct {
+	ID       string
+	Aliases  []string
+	Summary  string
+	Severity string
+	Affected osv.Affected
+}
+
+// OSVCandidates returns the records for name in ecosystem, or in any
+// ecosystem that starts with it and a colon ("Ubuntu:22.04:LTS" for
+// "Ubuntu:22.04").
+func (t *TocDB) OSVCandidates(ecosystem, name string) ([]osvCandidate, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	name = osv.PackageName(ecosystem, name)
+	rows, err := t.db.Query(
+		`SELECT a.vuln_id, v.aliases, v.summary, v.severity, a.affected
+		 FROM osv_affected a JOIN osv_vulns v ON v.id = a.vuln_id
+		 WHERE a.name = ? AND (a.ecosystem = ? OR substr(a.ecosystem, 1, ?) = ?)`,
+		name, ecosystem, len(ecosystem)+1, ecosystem+":",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cands []osvCandidate
+	for rows.Next() {
+		var (
+			c               osvCandidate
+			aliases, affect string
+		)
+		if err := rows.Scan(&c.ID, &aliases, &c.Summary, &c.Severity, &affect); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(affect), &c.Affected); err != nil {
+			return nil, err
+		}
+		c.Aliases = strings.Fields(aliases)
+		cands = append(cands, c)
+	}
+	return cands, rows.Err()
+}
+
+// VulnsJSON is /vulns/<image>/?format=json.
+type VulnsJSON struct {
+	Image    string `json:"image"`
+	Packages int    `json:"packages"` // found in the image
+	Checked  int    `json:"checked"`  // in an ecosystem OSV covers
+	Records  int    `json:"records"`  // OSV records imported
+
+	Matches []VulnMatch `json:"matches"`
+}
+
+// VulnMatch is a package in an image that an OSV record says is vulnerable.
+type VulnMatch struct {
+	Package   InventoryPackage `json:"package"`
+	Ecosystem string           `json:"ecosystem"`
+	ID        string           `json:"id"`
+	CVEs      []string         `json:"cves,omitempty"`
+	Severity  string           `json:"severity,omitempty"`
+	Fixed     []string         `json:"fixed,omitempty"` // versions that fix it, none if there's no fix yet
+	Summary   string           `json:"summary,omitempty"`
+}
+
+// severityRank sorts the worst first.
+func severityRank(s string) int {
+	word, _, _ := strings.Cut(s, " ")
+	switch word {
+	case "CRITICAL":
+		return 0
+	case "HIGH", "IMPORTANT":
+		return 1
+	case "MODERATE", "MEDIUM":
+		return 2
+	case "LOW", "NEGLIGIBLE":
+		return 3
+	}
+	return 4
+}
+
+// renderVulns matches the packages in an image against the OSV records
+// imported with "oci osv". Nothing leaves the machine.
+func (h *handler) renderVulns(w http.ResponseWriter, r *http.Request) error {
+	if h.tocDB == nil {
+		return fmt.Errorf("no database to match against")
+	}
+
+	dig, inv, err := h.imageInventory(w, r)
+	if err != nil {
+		return err
+	}
+
+	records, err := h.tocDB.OSVCount()
+	if err != nil {
+		return err
+	}
+	out := &VulnsJSON{
+		Image:    dig.String(),
+		Packages: len(inv.Packages),
+		Records:  records,
+		Matches:  []VulnMatch{},
+	}
+
+	for _, p := range inv.Packages {
+		eco, name, version := osv.Ecosystem(&p.Package, inv.Distro)
+		if eco == "" {
+			continue
+		}
+		out.Checked++
+		cands, err := h.tocDB.OSVCandidates(eco, name)
+		if err != nil {
+			return err
+		}
+		for _, c := range cands {
+			hit, fixed := osv.Affects(&c.Affected, version)
+			if !hit {
+				continue
+			}
+			v := osv.Vuln{ID: c.ID, Aliases: c.Aliases}
+			sev := c.Severity
+			if sev == "" {
+				sev = osv.Rating(c.Affected.Severity)
+			}
+			out.Matches = append(out.Matches, VulnMatch{
+				Package:   p,
+				Ecosystem: c.Affected.Package.Ecosystem,
+				ID:        c.ID,
+				CVEs:      v.CVEs(),
+				Severity:  sev,
+				Fixed:     fixed,
+				Summary:   c.Summary,
+			})
+		}
+	}
+	sort.SliceStable(out.Matches, func(i, j int) bool {
+		a, b := out.Matches[i], out.Matches[j]
+		if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		if a.Package.Name != b.Package.Name {
+			return a.Package.Name < b.Package.Name
+		}
+		return a.ID < b.ID
+	})
+
+	if wantsJSON(r) {
+		return writeJSON(w, out)
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"vulns " + dig.String()}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+
+	u := *r.URL
+	qs := u.Query()
+	qs.Set("format", "json")
+	u.RawQuery = qs.Encode()
+	fmt.Fprintf(w, "<p>%d matches in <a href=\"/sbom/%s/\">%d packages</a> of %s, %d of them in ecosystems OSV covers, against %d imported records (<a href=\"%s\">json</a>)</p>\n",
+		len(out.Matches), dig.String(), out.Packages, html.EscapeString(dig.String()), out.Checked, out.Records, html.EscapeString(u.String()))
+	if out.Records == 0 {
+		fmt.Fprintf(w, "<p>No OSV records have been imported; load a dump with <code>oci osv all.zip</code>.</p>\n")
+	}
+
+	if len(out.Matches) != 0 {
+		fmt.Fprintf(w, "<table>\n<tr><th>severity</th><th>package</th><th>version</th><th>vulnerability</th><th>fixed in</th><th>summary</th><th>found in</th></tr>\n")
+		for _, m := range out.Matches {
+			id := html.EscapeString(m.ID)
+			if len(m.CVEs) != 0 && (len(m.CVEs) > 1 || m.CVEs[0] != m.ID) {
+				id += "<br>" + html.EscapeString(strings.Join(m.CVEs, " "))
+			}
+			fixed := strings.Join(m.Fixed, " ")
+			if fixed == "" {
+				fixed = "not fixed"
+			}
+			where := &url.URL{Path: path.Join("/fs/", m.Package.Layer, m.Package.Path)}
+			fmt.Fprintf(w, "<tr><td>%s</td><td title=\"%s\">%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td><a href=\"%s\">%s</a></td></tr>\n",
+				html.EscapeString(m.Severity), html.EscapeString(m.Package.Purl), html.EscapeString(m.Package.Name), html.EscapeString(m.Package.Version),
+				id, html.EscapeString(fixed), html.EscapeString(m.Summary), html.EscapeString(where.String()), html.EscapeString(m.Package.Path))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+
+	fmt.Fprint(w, footer)
+	return nil
+}
@@ -0,0 +1,112 @@
+package explore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportOSV(t *testing.T) {
+	dir := t.TempDir()
+	db := NewTocDB(filepath.Join(dir, "log.db"))
+	defer db.Close()
+
+	dump := filepath.Join(dir, "osv.json")
+	os.WriteFile(dump, []byte(`[
+	  {"id": "DEBIAN-CVE-2024-0001", "modified": "2024-01-01T00:00:00Z", "summary": "bad thing",
+	   "affected": [{"package": {"ecosystem": "Debian:12", "name": "openssl"},
+	                 "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.0.13-1~deb12u1"}]}]}]},
+	  {"id": "USN-1", "aliases": ["CVE-2024-0002"],
+	   "affected": [{"package": {"ecosystem": "Ubuntu:22.04:LTS", "name": "openssl"}}]},
+	  {"id": "GHSA-8q59-q68h-6hv4", "modified": "2024-01-01T00:00:00Z",
+	   "affected": [{"package": {"ecosystem": "PyPI", "name": "PyYAML"}}]},
+	  {"id": "GONE-1", "withdrawn": "2024-02-01T00:00:00Z"}
+	]`), 0644)
+
+	stats, err := db.ImportOSV(context.Background(), []string{dump})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Vulns != 3 || stats.Affected != 3 || stats.Withdrawn != 1 {
+		t.Errorf("ImportOSV() = %+v", stats)
+	}
+
+	// Importing again replaces rather than duplicates.
+	if _, err := db.ImportOSV(context.Background(), []string{dump}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.OSVCount(); err != nil || n != 3 {
+		t.Errorf("OSVCount() = %d, %v", n, err)
+	}
+
+	// An older copy of a record doesn't replace a newer one.
+	old := filepath.Join(dir, "old.json")
+	os.WriteFile(old, []byte(`{"id": "DEBIAN-CVE-2024-0001", "modified": "2023-06-01T00:00:00Z", "summary": "stale thing"}`), 0644)
+	if stats, err := db.ImportOSV(context.Background(), []string{old}); err != nil || stats.Stale != 1 || stats.Vulns != 0 {
+		t.Errorf("ImportOSV(old) = %+v, %v", stats, err)
+	}
+
+	cands, err := db.OSVCandidates("Debian:12", "openssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 1 || cands[0].ID != "DEBIAN-CVE-2024-0001" || cands[0].Summary != "bad thing" || len(cands[0].Affected.Ranges) != 1 {
+		t.Errorf("OSVCandidates(Debian:12) = %+v", cands)
+	}
+
+	cands, err = db.OSVCandidates("Ubuntu:22.04", "openssl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 1 || cands[0].ID != "USN-1" || cands[0].Aliases[0] != "CVE-2024-0002" {
+		t.Errorf("OSVCandidates(Ubuntu:22.04) = %+v", cands)
+	}
+
+	if cands, err := db.OSVCandidates("Ubuntu:22", "openssl"); err != nil || len(cands) != 0 {
+		t.Errorf("OSVCandidates(Ubuntu:22) = %+v, %v", cands, err)
+	}
+
+	// PyPI names match however the record or the package spells them.
+	for _, tc := range []struct {
+		name string
+		want int
+	}{{"pyyaml", 1}, {"PyYAML", 1}, {"py.yaml", 0}} {
+		if cands, err := db.OSVCandidates("PyPI", tc.name); err != nil || len(cands) != tc.want {
+			t.Errorf("OSVCandidates(PyPI, %s) = %+v, %v", tc.name, cands, err)
+		}
+	}
+}
+
+func TestNormalizeOSVNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.db")
+	db := NewTocDB(path)
+	if err := db.init(); err != nil {
+		t.Fatal(err)
+	}
+	// Rows imported before names were normalized.
+	for _, a := range [][2]string{{"PyPI", "Zope.Interface"}, {"PyPI", "pyyaml"}, {"Debian:12", "libc6_dev"}} {
+		if _, err := db.db.Exec(`INSERT INTO osv_vulns (id, summary, aliases, severity) VALUES (?, '', '[]', '[]')`, "OSV-"+a[1]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.db.Exec(`INSERT INTO osv_affected (vuln_id, ecosystem, name, affected) VALUES (?, ?, ?, '{}')`, "OSV-"+a[1], a[0], a[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	db = NewTocDB(path)
+	defer db.Close()
+	for _, tc := range []struct {
+		ecosystem, name, want string
+	}{
+		{"PyPI", "zope-interface", "OSV-Zope.Interface"},
+		{"PyPI", "pyyaml", "OSV-pyyaml"},
+		{"Debian:12", "libc6_dev", "OSV-libc6_dev"},
+	} {
+		cands, err := db.OSVCandidates(tc.ecosystem, tc.name)
+		if err != nil || len(cands) != 1 || cands[0].ID != tc.want {
+			t.Errorf("OSVCandidates(%s, %s) = %+v, %v", tc.ecosystem, tc.name, cands, err)
+		}
+	}
+}
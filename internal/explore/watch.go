@@ -0,0 +1,623 @@
+package explore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Bounds on the watchlist scheduler.
+const (
+	defaultWatchInterval = 6 * time.Hour
+	watchConcurrency     = 2
+	watchIndexLimit      = 100 // tags indexed per pass, the rest wait for the next one
+	maxHubPages          = 20
+	hubPageSize          = 100
+)
+
+// Watch is a repository on any registry, or a Docker Hub namespace, whose
+// tags are periodically checked and indexed.
+type Watch struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"` // "repository" or "namespace"
+	Target    string `json:"target"`
+	AddedAt   string `json:"added_at,omitempty"`
+	CheckedAt string `json:"checked_at,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Profile   string `json:"profile,omitempty"` // opsec profile it's checked with, "" for the default
+}
+
+// TagEvent is a watched tag appearing, moving to another digest, or going away.
+type TagEvent struct {
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Change     string `json:"change"` // "added", "moved" or "removed"
+	OldDigest  string `json:"old_digest,omitempty"`
+	NewDigest  string `json:"new_digest,omitempty"`
+	At         string `json:"at,omitempty"`
+}
+
+type watchedTag struct {
+	repo, tag, digest string
+}
+
+func WithWatchInterval(d time.Duration) Option {
+	return func(h *handler) {
+		h.watchInterval = d
+	}
+}
+
+// AddWatch adds target to the watchlist, checked with profile; adding it
+// again just changes the profile.
+func (t *TocDB) AddWatch(kind, target, profile string) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.db.Exec(
+		`INSERT INTO watches (kind, target, profile) VALUES (?, ?, ?)
+		 ON CONFLICT(kind, target) DO UPDATE SET profile = excluded.profile`,
+		kind, target, profile,
+	)
+	return err
+}
+
+// RemoveWatch stops watching id. Tag history is kept.
+func (t *TocDB) RemoveWatch(id int64) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.db.Exec(`DELETE FROM watches WHERE id = ?`, id)
+	return err
+}
+
+func (t *TocDB) Watches() ([]Watch, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	rows, err := t.db.Query(`SELECT id, kind, target, added_at, checked_at, error, profile FROM watches ORDER BY kind, target`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := []Watch{}
+	for rows.Next() {
+		var (
+			w                       Watch
+			added, checked, errText sql.NullString
+		)
+		if err := rows.Scan(&w.ID, &w.Kind, &w.Target, &added, &checked, &errText, &w.Profile); err != nil {
+			return nil, err
+		}
+		w.AddedAt, w.CheckedAt, w.Error = added.String, checked.String, errText.String
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+// CheckedWatch records when id was last checked and how that went.
+func (t *TocDB) CheckedWatch(id int64, checkErr error) error {
+	if err := t.init(); err != nil {
+		return err
+	}
+	var errText *string
+	if checkErr != nil {
+		s := checkErr.Error()
+		errText = &s
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.db.Exec(`UPDATE watches SET checked_at = CURRENT_TIMESTAMP, error = ? WHERE id = ?`, errText, id)
+	return err
+}
+
+// RecordTags compares the current tag -> digest listing of repo with the
+// last one and logs what changed. An empty digest means the tag couldn't be
+// resolved this time, so it's left alone rather than treated as removed.
+func (t *TocDB) RecordTags(repo string, tags map[string]string) ([]TagEvent, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	old := map[string]string{}
+	rows, err := tx.Query(`SELECT tag, digest FROM watched_tags WHERE repository = ?`, repo)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tag, digest string
+		if err := rows.Scan(&tag, &digest); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		old[tag] = digest
+	}
+	rows.Close()
+
+	events := []TagEvent{}
+	for tag, digest := range tags {
+		if digest == "" {
+			continue
+		}
+		prev, ok := old[tag]
+		switch {
+		case !ok:
+			events = append(events, TagEvent{Repository: repo, Tag: tag, Change: "added", NewDigest: digest})
+		case prev != digest:
+			events = append(events, TagEvent{Repository: repo, Tag: tag, Change: "moved", OldDigest: prev, NewDigest: digest})
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO watched_tags (repository, tag, digest) VALUES (?, ?, ?)
+			 ON CONFLICT(repository, tag) DO UPDATE SET digest = excluded.digest, last_seen = CURRENT_TIMESTAMP`,
+			repo, tag, digest,
+		); err != nil {
+			return nil, err
+		}
+	}
+	for tag, prev := range old {
+		if _, ok := tags[tag]; ok {
+			continue
+		}
+		events = append(events, TagEvent{Repository: repo, Tag: tag, Change: "removed", OldDigest: prev})
+		if _, err := tx.Exec(`DELETE FROM watched_tags WHERE repository = ? AND tag = ?`, repo, tag); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range events {
+		if _, err := tx.Exec(
+			`INSERT INTO tag_events (repository, tag, change, old_digest, new_digest) VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))`,
+			e.Repository, e.Tag, e.Change, e.OldDigest, e.NewDigest,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, tx.Commit()
+}
+
+// unindexedTags returns watched tags whose current digest hasn't been indexed.
+func (t *TocDB) unindexedTags(limit int) ([]watchedTag, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+	rows, err := t.db.Query(
+		`SELECT repository, tag, digest FROM watched_tags WHERE indexed_digest IS NULL OR indexed_digest != digest
+		 ORDER BY last_seen DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []watchedTag{}
+	for rows.Next() {
+		var wt watchedTag
+		if err := rows.Scan(&wt.repo, &wt.tag, &wt.digest); err != nil {
+			return nil, err
+		}
+		tags = append(tags, wt)
+	}
+	return tags, rows.Err()
+}
+
+func (t *TocDB) markIndexed(wt watchedTag) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.db.Exec(`UPDATE watched_tags SET indexed_digest = ? WHERE repository = ? AND tag = ?`, wt.digest, wt.repo, wt.tag)
+	return err
+}
+
+// TagEvents returns the most recent changes, optionally for one repo (and tag).
+func (t *TocDB) TagEvents(repo, tag string, limit int) ([]TagEvent, error) {
+	if err := t.init(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT repository, tag, change, old_digest, new_digest, at FROM tag_events`
+	where := []string{}
+	args := []any{}
+	if repo != "" {
+		where = append(where, `repository = ?`)
+		args = append(args, repo)
+	}
+	if tag != "" {
+		where = append(where, `tag = ?`)
+		args = append(args, tag)
+	}
+	if len(where) != 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := t.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []TagEvent{}
+	for rows.Next() {
+		var (
+			e                    TagEvent
+			oldDig, newDig, when sql.NullString
+		)
+		if err := rows.Scan(&e.Repository, &e.Tag, &e.Change, &oldDig, &newDig, &when); err != nil {
+			return nil, err
+		}
+		e.OldDigest, e.NewDigest, e.At = oldDig.String, newDig.String, when.String
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// watchLoop checks every watch, then indexes whatever changed, forever.
+func (h *handler) watchLoop() {
+	for {
+		h.checkWatches(context.Background())
+		time.Sleep(h.watchInterval)
+	}
+}
+
+func (h *handler) checkWatches(ctx context.Context) {
+	watches, err := h.tocDB.Watches()
+	if err != nil {
+		log.Printf("[watch] Watches: %v", err)
+		return
+	}
+	// Tags are indexed with the profile of the watch that found them.
+	profiles := map[string]string{}
+	for _, w := range watches {
+		checkErr := h.checkWatch(withProfile(ctx, w.Profile), w, profiles)
+		if checkErr != nil {
+			log.Printf("[watch] %s %s: %v", w.Kind, w.Target, checkErr)
+		}
+		if err := h.tocDB.CheckedWatch(w.ID, checkErr); err != nil {
+			log.Printf("[watch] CheckedWatch: %v", err)
+		}
+	}
+
+	tags, err := h.tocDB.unindexedTags(watchIndexLimit)
+	if err != nil {
+		log.Printf("[watch] unindexedTags: %v", err)
+		return
+	}
+	if len(tags) == 0 {
+		return
+	}
+	if h.watchBatch == nil {
+		h.watchBatch = newBatch(h, watchConcurrency)
+	}
+
+	byProfile := map[string][]watchedTag{}
+	for _, wt := range tags {
+		// Tags of repositories no longer watched wait until they are again.
+		if profile, ok := profiles[wt.repo]; ok {
+			byProfile[profile] = append(byProfile[profile], wt)
+		}
+	}
+	for profile, tags := range byProfile {
+		h.indexWatchedTags(withProfile(ctx, profile), tags)
+	}
+}
+
+func (h *handler) indexWatchedTags(ctx context.Context, tags []watchedTag) {
+	// One tag per batch, so any failure (a child manifest, config or layer)
+	// is pinned on the tag it came from, which is then retried next pass.
+	// The digest is what was just listed, in case the tag moves meanwhile.
+	var layers, indexed, failures int
+	for _, wt := range tags {
+		report := h.watchBatch.Index(ctx, []string{wt.repo + "@" + wt.digest})
+		layers += report.Layers
+		indexed += report.Indexed
+		if len(report.Failed) != 0 {
+			failures++
+			continue
+		}
+		if err := h.tocDB.markIndexed(wt); err != nil {
+			log.Printf("[watch] markIndexed: %v", err)
+		}
+	}
+	log.Printf("[watch] indexed %d tags: %d layers (%d new), %d failed", len(tags), layers, indexed, failures)
+}
+
+// checkWatch lists w's tags, noting the profile each repository was
+// listed with in profiles.
+func (h *handler) checkWatch(ctx context.Context, w Watch, profiles map[string]string) error {
+	repos := []string{w.Target}
+	if w.Kind == "namespace" {
+		var err error
+		repos, err = h.hubRepositories(ctx, w.Target)
+		if err != nil {
+			return err
+		}
+	}
+
+	errs := []error{}
+	for _, repo := range repos {
+		r, err := name.NewRepository(repo)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		profiles[r.String()] = w.Profile
+		if err := h.checkRepo(ctx, r); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", repo, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *handler) checkRepo(ctx context.Context, r name.Repository) error {
+	opts := h.backgroundOptions(ctx, r)
+
+	tags, err := remote.List(r, opts...)
+	if err != nil {
+		return err
+	}
+
+	digests := map[string]string{}
+	for _, tag := range tags.Tags {
+		digests[tag] = ""
+		desc, err := remote.Head(r.Tag(tag), opts...)
+		if err != nil {
+			log.Printf("[watch] Head(%s:%s): %v", r, tag, err)
+			continue
+		}
+		digests[tag] = desc.Digest.String()
+	}
+
+	events, err := h.tocDB.RecordTags(r.String(), digests)
+	if err != nil {
+		return err
+	}
+	if len(events) != 0 {
+		log.Printf("[watch] %s: %d tag changes", r, len(events))
+	}
+	return nil
+}
+
+// hubRepositories lists a Docker Hub namespace via the same API as renderDockerHub.
+func (h *handler) hubRepositories(ctx context.Context, namespace string) ([]string, error) {
+	t := transport.Wrap(h.transport(ctx))
+	results, _, err := hubList[HubRepo](ctx, t, h.hubAPI, h.hubURL(fmt.Sprintf("/v2/repositories/%s/", namespace), fmt.Sprintf("page_size=%d", hubPageSize)), maxHubPages)
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]string, 0, len(results))
+	for _, res := range results {
+		repos = append(repos, namespace+"/"+res.Name)
+	}
+	return repos, nil
+}
+
+// Manage the watchlist and show recent tag changes.
+func (h *handler) renderWatch(w http.ResponseWriter, r *http.Request) error {
+	if r.Method == http.MethodPost {
+		if !sameOrigin(r) {
+			http.Error(w, "cross-origin request", http.StatusForbidden)
+			return nil
+		}
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		switch r.PostForm.Get("action") {
+		case "add":
+			kind, target := r.PostForm.Get("kind"), strings.TrimSpace(r.PostForm.Get("target"))
+			target = strings.TrimPrefix(target, "https://")
+			if err := validateWatch(kind, target); err != nil {
+				return err
+			}
+			profile := r.PostForm.Get("profile")
+			if _, err := h.profiles.Get(profile); err != nil {
+				return err
+			}
+			if err := h.tocDB.AddWatch(kind, target, profile); err != nil {
+				return err
+			}
+		case "remove":
+			id, err := strconv.ParseInt(r.PostForm.Get("id"), 10, 64)
+			if err != nil {
+				return fmt.Errorf("id: %w", err)
+			}
+			if err := h.tocDB.RemoveWatch(id); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown action %q", r.PostForm.Get("action"))
+		}
+		http.Redirect(w, r, "/watch", http.StatusSeeOther)
+		return nil
+	}
+
+	qs := r.URL.Query()
+	if repo := qs.Get("repo"); repo != "" {
+		return h.renderTagHistory(w, r, repo, qs.Get("tag"))
+	}
+
+	watches, err := h.tocDB.Watches()
+	if err != nil {
+		return fmt.Errorf("Watches: %w", err)
+	}
+	events, err := h.tocDB.TagEvents("", "", defaultSearchLimit)
+	if err != nil {
+		return fmt.Errorf("TagEvents: %w", err)
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, struct {
+			Watches []Watch    `json:"watches"`
+			Events  []TagEvent `json:"events"`
+		}{watches, events})
+	}
+
+	if err := headerTmpl.Execute(w, TitleData{"watchlist"}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, watchForm, h.profileSelect())
+
+	if len(watches) == 0 {
+		fmt.Fprintf(w, "<p>nothing watched yet</p>\n")
+	} else {
+		fmt.Fprintf(w, "<pre>\n")
+		for _, wt := range watches {
+			checked := wt.CheckedAt
+			if checked == "" {
+				checked = "never checked"
+			}
+			fmt.Fprintf(w, "<form style=\"display:inline\" method=\"POST\" action=\"/watch\"><input type=\"hidden\" name=\"action\" value=\"remove\"/><input type=\"hidden\" name=\"id\" value=\"%d\"/><input type=\"submit\" value=\"x\"/></form> %-10s <a href=\"/?repo=%s\">%s</a> <small>%s</small>",
+				wt.ID, wt.Kind, url.QueryEscape(wt.Target), html.EscapeString(wt.Target), html.EscapeString(checked))
+			if wt.Profile != "" {
+				fmt.Fprintf(w, " <small>via %s</small>", html.EscapeString(wt.Profile))
+			}
+			if wt.Error != "" {
+				fmt.Fprintf(w, " <span class=\"flag\" title=\"%s\">error</span>", html.EscapeString(wt.Error))
+			}
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "</pre>\n")
+	}
+
+	fmt.Fprintf(w, "<h2>recent changes</h2>\n")
+	writeTagEvents(w, events)
+
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+// Tag history from the watchlist, for registries without a history API.
+func (h *handler) renderTagHistory(w http.ResponseWriter, r *http.Request, repo, tag string) error {
+	if ref, err := name.NewRepository(repo); err == nil {
+		repo = ref.String()
+	}
+	events, err := h.tocDB.TagEvents(repo, tag, maxSearchLimit)
+	if err != nil {
+		return fmt.Errorf("TagEvents: %w", err)
+	}
+
+	if wantsJSON(r) {
+		return writeJSON(w, events)
+	}
+
+	title := repo
+	if tag != "" {
+		title += ":" + tag
+	}
+	if err := headerTmpl.Execute(w, TitleData{"history " + title}); err != nil {
+		return err
+	}
+	fmt.Fprint(w, searchHeader)
+	fmt.Fprintf(w, "<h2>%s</h2>\n", html.EscapeString(title))
+	if len(events) == 0 {
+		fmt.Fprintf(w, "<p>no history recorded, <a href=\"/watch\">watch</a> this repository to start recording it</p>\n")
+	} else {
+		writeTagEvents(w, events)
+	}
+	fmt.Fprint(w, footer)
+	return nil
+}
+
+func writeTagEvents(w io.Writer, events []TagEvent) {
+	if len(events) == 0 {
+		fmt.Fprintf(w, "<p>none yet</p>\n")
+		return
+	}
+	short := func(dig string) string {
+		if _, after, ok := strings.Cut(dig, ":"); ok && len(after) > 8 {
+			return after[:8]
+		}
+		return dig
+	}
+	link := func(repo, dig string) string {
+		if dig == "" {
+			return fmt.Sprintf("%8s", "")
+		}
+		return fmt.Sprintf("<a title=\"%s\" href=\"/?image=%s\">%s</a>", html.EscapeString(dig), url.QueryEscape(repo+"@"+dig), html.EscapeString(short(dig)))
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	for _, e := range events {
+		ref := e.Repository + ":" + e.Tag
+		fmt.Fprintf(w, "%s %-7s %s -> %s <a href=\"/?image=%s\">%s</a> <a href=\"/watch?repo=%s&tag=%s\">history</a>\n",
+			e.At, e.Change, link(e.Repository, e.OldDigest), link(e.Repository, e.NewDigest),
+			url.QueryEscape(ref), html.EscapeString(ref), url.QueryEscape(e.Repository), url.QueryEscape(e.Tag))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+func validateWatch(kind, target string) error {
+	switch kind {
+	case "repository":
+		if _, err := name.NewRepository(target); err != nil {
+			return err
+		}
+	case "namespace":
+		if target == "" || strings.ContainsAny(target, "/:@") {
+			return fmt.Errorf("not a Docker Hub namespace: %q", target)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+	return nil
+}
+
+// profileSelect picks the profile a new watch is checked with, if there's
+// more than one.
+func (h *handler) profileSelect() string {
+	names := h.profiles.Names()
+	if len(names) < 2 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("<select name=\"profile\">\n")
+	for _, name := range names {
+		selected := ""
+		if name == h.profiles.Default {
+			selected = " selected"
+		}
+		fmt.Fprintf(&sb, "  <option value=\"%s\"%s>%s</option>\n", html.EscapeString(name), selected, html.EscapeString(name))
+	}
+	sb.WriteString("</select>\n")
+	return sb.String()
+}
+
+const watchForm = `
+<form action="/watch" method="POST" autocomplete="off" spellcheck="false">
+<p>
+<input type="hidden" name="action" value="add"/>
+<select name="kind">
+  <option value="repository">repository</option>
+  <option value="namespace">docker hub namespace</option>
+</select>
+<input size="40" type="text" name="target" placeholder="ghcr.io/org/app or tonistiigi"/>
+%s<input type="submit" value="watch"/>
+</p>
+</form>
+`
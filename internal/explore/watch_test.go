@@ -0,0 +1,195 @@
+package explore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/name"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/registry"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestRecordTags(t *testing.T) {
+	db := NewTocDB(filepath.Join(t.TempDir(), "log.db"))
+	defer db.Close()
+
+	const repo = "index.docker.io/library/busybox"
+	events, err := db.RecordTags(repo, map[string]string{
+		"latest": "sha256:aaaa",
+		"1.36":   "sha256:aaaa",
+		"1.35":   "sha256:bbbb",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("first listing: got %d events, want 3: %v", len(events), events)
+	}
+
+	tags, err := db.unindexedTags(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 3 {
+		t.Fatalf("unindexedTags: got %d, want 3", len(tags))
+	}
+	for _, wt := range tags {
+		if err := db.markIndexed(wt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// latest moves, 1.35 goes away, 1.36 couldn't be resolved this time.
+	events, err = db.RecordTags(repo, map[string]string{
+		"latest": "sha256:cccc",
+		"1.36":   "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Tag < events[j].Tag })
+	want := []TagEvent{
+		{Repository: repo, Tag: "1.35", Change: "removed", OldDigest: "sha256:bbbb"},
+		{Repository: repo, Tag: "latest", Change: "moved", OldDigest: "sha256:aaaa", NewDigest: "sha256:cccc"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("second listing: got %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d: got %+v, want %+v", i, events[i], want[i])
+		}
+	}
+
+	tags, err = db.unindexedTags(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].tag != "latest" || tags[0].digest != "sha256:cccc" {
+		t.Errorf("unindexedTags after move: got %+v", tags)
+	}
+
+	history, err := db.TagEvents(repo, "latest", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Change != "moved" || history[1].Change != "added" {
+		t.Errorf("TagEvents(latest): got %+v", history)
+	}
+}
+
+func TestIndexWatchedTags(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	h := &handler{profiles: builtinProfiles(), tocDB: NewTocDB(filepath.Join(t.TempDir(), "log.db"))}
+	defer h.tocDB.Close()
+	h.watchBatch = newBatch(h, 1)
+
+	// "empty" has no layers to fail, "broken" has lost its only layer.
+	digests := map[string]string{}
+	for tag, layers := range map[string]int64{"empty": 0, "broken": 1} {
+		ref, err := name.NewTag(host + "/acme/app:" + tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := random.Image(1024, layers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, img); err != nil {
+			t.Fatal(err)
+		}
+		dig, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests[tag] = dig.String()
+
+		ls, err := img.Layers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range ls {
+			ld, err := l.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := http.NewRequest(http.MethodDelete, s.URL+"/v2/acme/app/blobs/"+ld.String(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+	}
+
+	repo := host + "/acme/app"
+	if _, err := h.tocDB.RecordTags(repo, digests); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := h.tocDB.unindexedTags(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.indexWatchedTags(context.Background(), tags)
+
+	left, err := h.tocDB.unindexedTags(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].tag != "broken" {
+		t.Errorf("unindexed after a failed layer = %+v, want just broken", left)
+	}
+}
+
+func TestRenderWatchOrigin(t *testing.T) {
+	h := &handler{profiles: builtinProfiles(), tocDB: NewTocDB(filepath.Join(t.TempDir(), "log.db"))}
+	defer h.tocDB.Close()
+
+	add := url.Values{"action": {"add"}, "kind": {"repository"}, "target": {"ghcr.io/acme/app"}}
+	for _, tc := range []struct {
+		origin, site string
+		code         int
+		watches      int
+	}{
+		{"https://evil.example", "", http.StatusForbidden, 0},
+		{"", "cross-site", http.StatusForbidden, 0},
+		{"http://example.com", "same-origin", http.StatusSeeOther, 1},
+		{"", "", http.StatusSeeOther, 1},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/watch", strings.NewReader(add.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.site != "" {
+			req.Header.Set("Sec-Fetch-Site", tc.site)
+		}
+		w := httptest.NewRecorder()
+		if err := h.renderWatch(w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != tc.code {
+			t.Errorf("Origin %q, Sec-Fetch-Site %q: %d, want %d", tc.origin, tc.site, w.Code, tc.code)
+		}
+		watches, err := h.tocDB.Watches()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(watches) != tc.watches {
+			t.Errorf("Origin %q, Sec-Fetch-Site %q: %d watches, want %d", tc.origin, tc.site, len(watches), tc.watches)
+		}
+	}
+}
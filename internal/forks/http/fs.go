@@ -29,6 +29,7 @@ import (
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/thesavant42/yolosint/internal/binfmt"
 	"github.com/thesavant42/yolosint/internal/forks/elf"
 	"github.com/thesavant42/yolosint/internal/forks/safefilepath"
 	"github.com/thesavant42/yolosint/internal/xxd"
@@ -143,6 +144,7 @@ type anyDirs interface {
 	whiteout(i int) string
 	overwritten(i int) string
 	index(i int) int
+	flagged(i int) string
 }
 
 type fileInfoDirs []fs.FileInfo
@@ -155,6 +157,7 @@ func (d fileInfoDirs) layer(i int) string              { return "" }
 func (d fileInfoDirs) whiteout(i int) string           { return "" }
 func (d fileInfoDirs) overwritten(i int) string        { return "" }
 func (d fileInfoDirs) index(i int) int                 { return 0 }
+func (d fileInfoDirs) flagged(i int) string            { return "" }
 
 type dirEntryDirs []fs.DirEntry
 
@@ -186,6 +189,12 @@ func (d dirEntryDirs) index(i int) int {
 	}
 	return 0
 }
+func (d dirEntryDirs) flagged(i int) string {
+	if fe, ok := d[i].(flaggedEntry); ok {
+		return fe.Flagged()
+	}
+	return ""
+}
 
 type withLayer interface {
 	Layer() string
@@ -197,6 +206,24 @@ type sociEntry interface {
 	Index() int
 }
 
+type flaggedEntry interface {
+	Flagged() string
+}
+
+// flagLink calls out files that tripped the secret scanner.
+func flagLink(layer, name, rules string) string {
+	if rules == "" {
+		return ""
+	}
+	qs := url.Values{}
+	if _, after, ok := strings.Cut(layer, "@"); ok {
+		qs.Set("layer", after)
+	}
+	qs.Set("path", name)
+	u := url.URL{Path: "/findings", RawQuery: qs.Encode()}
+	return fmt.Sprintf(" <a class=\"flag\" href=%q title=%q>[!]</a>", u.String(), rules)
+}
+
 func DirList(w http.ResponseWriter, r *http.Request, fsys FileSystem, prefix string, des []fs.DirEntry, render func() error) error {
 	logs.Debug.Printf("DirList: %q", prefix)
 
@@ -330,6 +357,10 @@ func DirList(w http.ResponseWriter, r *http.Request, fsys FileSystem, prefix str
 		dirs = dirs[0:TooBig]
 	}
 
+	if WantsJSON(r) {
+		return writeDirJSON(w, prefix, dirs, apks)
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	if render != nil {
@@ -435,6 +466,13 @@ func dirList(w http.ResponseWriter, r *http.Request, fname string, f File, rende
 	}
 	sort.Slice(dirs, less)
 
+	if WantsJSON(r) {
+		if err := writeDirJSON(w, fname, dirs, nil); err != nil {
+			logs.Debug.Printf("writeDirJSON: %v", err)
+		}
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	if render != nil {
@@ -519,7 +557,7 @@ func tarListAll(i int, dirs anyDirs, fi fs.FileInfo, u url.URL, uprefix, fprefix
 		}
 	}
 
-	s += fmt.Sprintf(" <a href=\"%s?all=true\">%s</a>\n", u.String(), htmlReplacer.Replace(name))
+	s += fmt.Sprintf(" <a href=\"%s?all=true\">%s</a>%s\n", u.String(), htmlReplacer.Replace(name), flagLink(dirs.layer(i), header.Name, dirs.flagged(i)))
 	if pax {
 		for k, v := range header.PAXRecords {
 			s += fmt.Sprintf("    %s: %s\n", htmlReplacer.Replace(k), htmlReplacer.Replace(v))
@@ -535,6 +573,7 @@ func tarList(i int, dirs anyDirs, showlayer bool, fi fs.FileInfo, u url.URL, upr
 	layer := dirs.layer(i)
 	whiteout := dirs.whiteout(i)
 	overwritten := dirs.overwritten(i)
+	flagged := dirs.flagged(i)
 
 	prefix := "        "
 
@@ -601,7 +640,7 @@ func tarList(i int, dirs anyDirs, showlayer bool, fi fs.FileInfo, u url.URL, upr
 				title = fmt.Sprintf("deleted by %s", after[:8])
 			}
 		}
-		s += fmt.Sprintf(" <a href=\"%s\"><strike title=%q>%s</strike></a>\n", u.String(), title, htmlReplacer.Replace(name))
+		s += fmt.Sprintf(" <a href=\"%s\"><strike title=%q>%s</strike></a>%s\n", u.String(), title, htmlReplacer.Replace(name), flagLink(layer, header.Name, flagged))
 	} else if overwritten != "" {
 		u.Path = path.Join("/fs/", layer, header.Name)
 		title := fmt.Sprintf("overwritten by %s", overwritten)
@@ -610,9 +649,9 @@ func tarList(i int, dirs anyDirs, showlayer bool, fi fs.FileInfo, u url.URL, upr
 				title = fmt.Sprintf("overwritten by %s", after[:8])
 			}
 		}
-		s += fmt.Sprintf(" <a href=\"%s\"><strike title=%q>%s</strike></a>\n", u.String(), title, htmlReplacer.Replace(name))
+		s += fmt.Sprintf(" <a href=\"%s\"><strike title=%q>%s</strike></a>%s\n", u.String(), title, htmlReplacer.Replace(name), flagLink(layer, header.Name, flagged))
 	} else {
-		s += fmt.Sprintf(" <a href=\"%s\">%s</a>\n", u.String(), htmlReplacer.Replace(name))
+		s += fmt.Sprintf(" <a href=\"%s\">%s</a>%s\n", u.String(), htmlReplacer.Replace(name), flagLink(layer, header.Name, flagged))
 	}
 	return s
 }
@@ -621,6 +660,7 @@ func tarListSize(i int, dirs anyDirs, showlayer bool, fi fs.FileInfo, u url.URL,
 	layer := dirs.layer(i)
 	whiteout := dirs.whiteout(i)
 	overwritten := dirs.overwritten(i)
+	flagged := dirs.flagged(i)
 
 	prefix := "        "
 
@@ -690,7 +730,7 @@ func tarListSize(i int, dirs anyDirs, showlayer bool, fi fs.FileInfo, u url.URL,
 				title = fmt.Sprintf("deleted by %s", after[:8])
 			}
 		}
-		s += fmt.Sprintf(" <strike title=%q><small>%s</small></strike>", title, htmlReplacer.Replace(name))
+		s += fmt.Sprintf(" <strike title=%q><small>%s</small></strike>%s", title, htmlReplacer.Replace(name), flagLink(layer, header.Name, flagged))
 	} else if overwritten != "" {
 		u.Path = path.Join("/fs/", layer, header.Name)
 		title := fmt.Sprintf("overwritten by %s", overwritten)
@@ -699,9 +739,9 @@ func tarListSize(i int, dirs anyDirs, showlayer bool, fi fs.FileInfo, u url.URL,
 				title = fmt.Sprintf("overwritten by %s", after[:8])
 			}
 		}
-		s += fmt.Sprintf(" <strike title=%q><small>%s</small></strike>", title, htmlReplacer.Replace(name))
+		s += fmt.Sprintf(" <strike title=%q><small>%s</small></strike>%s", title, htmlReplacer.Replace(name), flagLink(layer, header.Name, flagged))
 	} else {
-		s += fmt.Sprintf(" %s", htmlReplacer.Replace(name))
+		s += fmt.Sprintf(" %s%s", htmlReplacer.Replace(name), flagLink(layer, header.Name, flagged))
 	}
 	return s
 }
@@ -860,6 +900,16 @@ var errSeeker = errors.New("seeker can't seek")
 // all of the byte-range-spec values is greater than the content size.
 var errNoOverlap = errors.New("invalid range: failed to overlap")
 
+// hexOffset is where ?offset= asks the hex dump to start, rounded down to
+// a line.
+func hexOffset(r *http.Request, size int64) int64 {
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset < 0 || offset >= size {
+		return 0
+	}
+	return offset &^ 15
+}
+
 // TODO: Define sentinel error to return early.
 type renderFunc func(w http.ResponseWriter, r *http.Request, ctype string) error
 
@@ -902,6 +952,13 @@ func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime t
 					ctype = "elf"
 				}
 			}
+			if !isElf {
+				// Windows and macOS binaries get a hex dump too, with
+				// ?render=pe or ?render=macho offered by the header.
+				if kind := binfmt.Sniff(buf); kind != "" {
+					ctype = kind
+				}
+			}
 		} else {
 			logs.Debug.Printf("ByExtension = %s", ctype)
 		}
@@ -1027,7 +1084,22 @@ func serveContent(w http.ResponseWriter, r *http.Request, name string, modtime t
 				sendSize = TooBig
 			}
 
-			if isElf {
+			if offset := hexOffset(r, size); offset > 0 && len(ranges) == 0 {
+				// A hex dump from further into the file, e.g. from a render=strings link.
+				if _, err := io.CopyN(io.Discard, sendContent, offset); err != nil {
+					logs.Debug.Printf("CopyN: %v", err)
+					return
+				}
+				n := min(size-offset, TooBig)
+				fmt.Fprintf(w, "<a href=\"?offset=%d\">previous</a>", max(offset-TooBig, 0))
+				if offset+n < size {
+					fmt.Fprintf(w, " <a href=\"?offset=%d\">next</a>", offset+n)
+				}
+				fmt.Fprintf(w, "\n")
+				if _, err := io.CopyN(xxd.NewWriterAt(w, offset, n), sendContent, n); err != nil {
+					logs.Debug.Printf("CopyN: %v", err)
+				}
+			} else if isElf {
 				key := r.URL.Path
 				if r.URL.Query().Get("render") == "elf" {
 					err := elf.Print(w, size, br, key)
@@ -1421,6 +1493,18 @@ func serveFile(w http.ResponseWriter, r *http.Request, fsys FileSystem, name str
 		return
 	}
 
+	if name, v, ok := viewer(r); ok {
+		serveViewer(w, r, name, v, f, d, render)
+		return
+	}
+
+	if WantsJSON(r) {
+		if err := writeFileJSON(w, f, d); err != nil {
+			logs.Debug.Printf("writeFileJSON: %v", err)
+		}
+		return
+	}
+
 	// serveContent will check modification time
 	sizeFunc := func() (int64, error) { return d.Size(), nil }
 	serveContent(w, r, d.Name(), d.ModTime(), sizeFunc, f, render)
@@ -1439,6 +1523,13 @@ func renderFiles(w http.ResponseWriter, r *http.Request, fname string, f File, r
 
 	logs.Debug.Printf("rendering Files")
 
+	if WantsJSON(r) {
+		if err := writeFilesJSON(w, fname, files.Files()); err != nil {
+			logs.Debug.Printf("writeFilesJSON: %v", err)
+		}
+		return
+	}
+
 	if render != nil {
 		if err := render(w, r, ""); err != nil {
 			logs.Debug.Printf("render(): %v", err)
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io/fs"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Entry is a file or directory as served to JSON clients. The field names
+// are part of the API, so only ever add to them.
+type Entry struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Type     string    `json:"type"` // file, dir, symlink, hardlink, char, block, fifo or unknown
+	Mode     string    `json:"mode"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Uid      int       `json:"uid"`
+	Gid      int       `json:"gid"`
+	Uname    string    `json:"uname,omitempty"`
+	Gname    string    `json:"gname,omitempty"`
+	Linkname string    `json:"linkname,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+
+	// Only set for merged (multi-layer) views.
+	Layer       string `json:"layer,omitempty"`       // layer the entry comes from
+	Whiteout    string `json:"whiteout,omitempty"`    // whiteout file that deleted it
+	Overwritten string `json:"overwritten,omitempty"` // layer that replaced it
+
+	Flagged string `json:"flagged,omitempty"` // secret scanner rules it tripped
+	Package string `json:"package,omitempty"` // apk that owns it, for size views
+}
+
+// Listing is a directory listing as served to JSON clients.
+type Listing struct {
+	Path    string  `json:"path"`
+	Entries []Entry `json:"entries"`
+}
+
+// WantsJSON reports whether r asked for JSON via ?format=json or Accept.
+func WantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mt := range strings.Split(accept, ",") {
+			mt, _, _ = strings.Cut(mt, ";")
+			if strings.TrimSpace(mt) == "application/json" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func infoEntry(fi fs.FileInfo) Entry {
+	e := Entry{
+		Name:    fi.Name(),
+		Path:    fi.Name(),
+		Type:    "unknown",
+		Mode:    fi.Mode().String(),
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}
+	if fi.IsDir() {
+		e.Type = "dir"
+	}
+
+	header, ok := fi.Sys().(*tar.Header)
+	if !ok {
+		return e
+	}
+	e.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(header.Name, "./"), "/")
+	e.Type = typeName(header.Typeflag)
+	e.Mode = modeStr(header)
+	e.Size = header.Size
+	e.ModTime = header.ModTime
+	e.Uid, e.Gid = header.Uid, header.Gid
+	e.Uname, e.Gname = header.Uname, header.Gname
+	e.Linkname = header.Linkname
+	return e
+}
+
+func dirEntry(i int, dirs anyDirs) (Entry, bool) {
+	info, err := dirs.info(i)
+	if err != nil || info == nil {
+		return Entry{}, false
+	}
+	e := infoEntry(info)
+	e.Name = dirs.name(i)
+	e.Layer = dirs.layer(i)
+	e.Whiteout = dirs.whiteout(i)
+	e.Overwritten = dirs.overwritten(i)
+	e.Flagged = dirs.flagged(i)
+	return e, true
+}
+
+func writeDirJSON(w http.ResponseWriter, name string, dirs anyDirs, apks map[string]string) error {
+	l := Listing{Path: "/" + strings.TrimPrefix(name, "/"), Entries: []Entry{}}
+	for i, n := 0, dirs.len(); i < n; i++ {
+		if dirs.name(i) == ".." {
+			continue
+		}
+		e, ok := dirEntry(i, dirs)
+		if !ok {
+			continue
+		}
+		e.Package = apks[strings.TrimPrefix(e.Path, "/")]
+		l.Entries = append(l.Entries, e)
+	}
+	return writeJSON(w, l)
+}
+
+func writeFilesJSON(w http.ResponseWriter, name string, files iter.Seq2[fs.FileInfo, error]) error {
+	l := Listing{Path: "/" + strings.TrimPrefix(name, "/"), Entries: []Entry{}}
+	for fi, err := range files {
+		if err != nil {
+			return err
+		}
+		l.Entries = append(l.Entries, infoEntry(fi))
+	}
+	return writeJSON(w, l)
+}
+
+func writeFileJSON(w http.ResponseWriter, f File, fi fs.FileInfo) error {
+	e := infoEntry(fi)
+	if h, ok := f.(interface{ SHA256() string }); ok {
+		e.SHA256 = h.SHA256()
+	}
+	if wl, ok := f.(withLayer); ok {
+		e.Layer = wl.Layer()
+	}
+	return writeJSON(w, e)
+}
+
+func typeName(t byte) string {
+	switch t {
+	case tar.TypeReg:
+		return "file"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeFifo:
+		return "fifo"
+	}
+	return "unknown"
+}
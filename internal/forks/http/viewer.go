@@ -0,0 +1,61 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// A Viewer shows a file some way other than its raw contents, when asked
+// for with ?render=<name>. For HTML it writes the page body after the
+// header; for JSON (see WantsJSON) it writes the whole response.
+type Viewer func(w http.ResponseWriter, r *http.Request, f File, fi fs.FileInfo) error
+
+var (
+	viewersMu sync.RWMutex
+	viewers   = map[string]Viewer{}
+)
+
+// RegisterViewer makes ?render=name show files with v.
+func RegisterViewer(name string, v Viewer) {
+	viewersMu.Lock()
+	defer viewersMu.Unlock()
+	viewers[name] = v
+}
+
+func viewer(r *http.Request) (string, Viewer, bool) {
+	if r.URL.Query().Get("dl") != "" {
+		return "", nil, false
+	}
+	name := r.URL.Query().Get("render")
+	viewersMu.RLock()
+	defer viewersMu.RUnlock()
+	v, ok := viewers[name]
+	return name, v, ok
+}
+
+func serveViewer(w http.ResponseWriter, r *http.Request, name string, v Viewer, f File, fi fs.FileInfo, render renderFunc) {
+	asJSON := WantsJSON(r)
+	if !asJSON && render != nil {
+		if err := render(w, r, ""); err != nil {
+			log.Printf("render=%s: header: %v", name, err)
+		}
+	}
+	if err := v(w, r, f, fi); err != nil {
+		log.Printf("render=%s: %v", name, err)
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		fmt.Fprintf(w, "<p>render=%s: %s</p>\n", html.EscapeString(name), html.EscapeString(err.Error()))
+	}
+	if !asJSON {
+		fmt.Fprintf(w, "</body>\n</html>\n")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"io/fs"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -159,6 +160,11 @@ type store struct {
 	sha1  hashpkg.Hash    // reused hash state
 	index map[Hash]stored // lookup index
 	data  []byte          // concatenation of all object data
+
+	// loose, if set, is consulted for objects missing from index.
+	// Objects it finds are added to the store, so mu guards lookups.
+	loose func(Hash) (ObjType, []byte, error)
+	mu    sync.Mutex
 }
 
 // A stored describes a single stored object.
@@ -197,8 +203,20 @@ func (s *store) add(typ ObjType, data []byte) (Hash, []byte) {
 // Object returns the type and data for the Object with hash h.
 // If there is no Object with hash h, Object returns 0, nil.
 func (s *store) Object(h Hash) (typ ObjType, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	d, ok := s.index[h]
 	if !ok {
+		if s.loose == nil {
+			return 0, nil
+		}
+		typ, data, err := s.loose(h)
+		if err != nil {
+			return 0, nil
+		}
+		if got, data := s.add(typ, data); got == h {
+			return typ, data
+		}
 		return 0, nil
 	}
 	return d.typ, s.data[d.off : d.off+d.len]
@@ -0,0 +1,454 @@
+package gitfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Packs are read into memory whole, so these bound what OpenLocal will load:
+// maxPackSize for any one pack file and maxPacksSize for all of them
+// together, which is also roughly the memory one Local can cost.
+// They are variables for tests.
+var (
+	maxPackSize  int64 = 256 << 20
+	maxPacksSize int64 = 512 << 20
+)
+
+// A Local is a Git repository read straight out of a .git directory
+// in an fs.FS, e.g. one that was shipped inside a container image.
+//
+// Packed objects are loaded when the Local is opened; loose objects
+// are read from fsys as they are needed, so fsys must stay usable for
+// as long as the Local is.
+type Local struct {
+	fsys fs.FS
+	dir  string
+	s    store
+}
+
+// OpenLocal opens the repository whose git directory is dir within fsys.
+// That is the .git directory itself, or the root of a bare repository.
+func OpenLocal(fsys fs.FS, dir string) (*Local, error) {
+	l := &Local{fsys: fsys, dir: path.Clean(dir)}
+	l.s.loose = l.looseObject
+
+	if _, err := l.readFile("HEAD"); err != nil {
+		return nil, fmt.Errorf("%s: not a git directory: %w", l.dir, err)
+	}
+
+	des, err := fs.ReadDir(fsys, path.Join(l.dir, "objects/pack"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	total := int64(0)
+	for _, de := range des {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".pack") {
+			continue
+		}
+		name := path.Join("objects/pack", de.Name())
+		if info, err := de.Info(); err == nil {
+			if info.Size() > maxPackSize {
+				return nil, fmt.Errorf("%s: pack is too big (%d bytes)", name, info.Size())
+			}
+			if total+info.Size() > maxPacksSize {
+				return nil, fmt.Errorf("%s: packs are too big (over %d bytes)", name, maxPacksSize)
+			}
+		}
+		// Don't trust the listing's size, read no more than is left either way.
+		data, err := l.readFileMax(name, min(maxPackSize, maxPacksSize-total))
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(data))
+		if err := unpack(&l.s, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return l, nil
+}
+
+// readFile reads name relative to the git directory.
+// Some file systems hand back a directory for paths that don't exist,
+// so anything that isn't a regular file counts as missing.
+func (l *Local) readFile(name string) ([]byte, error) {
+	return l.readFileMax(name, -1)
+}
+
+// readFileMax is readFile, failing once more than max bytes have been
+// read. A negative max is no limit.
+func (l *Local) readFileMax(name string, max int64) ([]byte, error) {
+	f, err := l.fsys.Open(path.Join(l.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if max < 0 {
+		return io.ReadAll(f)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%s: too big (over %d bytes)", name, max)
+	}
+	return data, nil
+}
+
+// looseObject reads an object from objects/xx/xxxx...
+// See https://git-scm.com/book/en/v2/Git-Internals-Git-Objects.
+func (l *Local) looseObject(h Hash) (ObjType, []byte, error) {
+	hex := h.String()
+	data, err := l.readFile(path.Join("objects", hex[:2], hex[2:]))
+	if err != nil {
+		return 0, nil, err
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// "<type> <size>\x00<content>"
+	hdr, content, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return 0, nil, fmt.Errorf("object %s: malformed header", h)
+	}
+	kind, size, _ := strings.Cut(string(hdr), " ")
+	if n, err := strconv.Atoi(size); err != nil || n != len(content) {
+		return 0, nil, fmt.Errorf("object %s: bad size %q", h, size)
+	}
+	typ := ObjType(slices.Index(objTypes[:], kind))
+	if typ <= objNone {
+		return 0, nil, fmt.Errorf("object %s: unknown type %q", h, kind)
+	}
+	return typ, content, nil
+}
+
+// Refs returns HEAD followed by every loose and packed ref, sorted by name.
+// Symbolic refs other than HEAD are left out.
+func (l *Local) Refs() ([]Ref, error) {
+	found, err := l.refs()
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]Ref, 0, len(found)+1)
+	for name, h := range found {
+		refs = append(refs, Ref{name, h})
+	}
+	slices.SortFunc(refs, func(a, b Ref) int { return strings.Compare(a.Name, b.Name) })
+
+	if h, err := l.Resolve("HEAD"); err == nil {
+		refs = slices.Insert(refs, 0, Ref{"HEAD", h})
+	}
+	return refs, nil
+}
+
+func (l *Local) refs() (map[string]Hash, error) {
+	found := map[string]Hash{}
+
+	if data, err := l.readFile("packed-refs"); err == nil {
+		for line := range strings.Lines(string(data)) {
+			line = strings.TrimSpace(line)
+			if line == "" || line[0] == '#' || line[0] == '^' {
+				continue
+			}
+			hex, name, ok := strings.Cut(line, " ")
+			if !ok {
+				continue
+			}
+			if h, err := ParseHash(hex); err == nil {
+				found[name] = h
+			}
+		}
+	}
+
+	// Loose refs win over packed ones.
+	if err := l.walkRefs("refs", found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (l *Local) walkRefs(dir string, found map[string]Hash) error {
+	des, err := fs.ReadDir(l.fsys, path.Join(l.dir, dir))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, de := range des {
+		// Some file systems list ".." too.
+		if n := de.Name(); n == "." || n == ".." || strings.Contains(n, "/") {
+			continue
+		}
+		name := path.Join(dir, de.Name())
+		if de.IsDir() {
+			if err := l.walkRefs(name, found); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := l.readFile(name)
+		if err != nil {
+			continue
+		}
+		if h, err := ParseHash(strings.TrimSpace(string(data))); err == nil {
+			found[name] = h
+		}
+	}
+	return nil
+}
+
+// Head returns what HEAD points at: a ref name like "refs/heads/main",
+// or a hash for a detached HEAD.
+func (l *Local) Head() (string, error) {
+	data, err := l.readFile("HEAD")
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(data))
+	if target, ok := strings.CutPrefix(head, "ref: "); ok {
+		return target, nil
+	}
+	return head, nil
+}
+
+// Resolve returns the commit that ref names. Ref may be a full hash,
+// HEAD, a full ref name, or a branch or tag name. Annotated tags are
+// peeled to the commit they point at.
+func (l *Local) Resolve(ref string) (Hash, error) {
+	h, err := l.resolve(ref, 0)
+	if err != nil {
+		return Hash{}, err
+	}
+	return l.peel(h)
+}
+
+// peel follows annotated tags to what they tag.
+func (l *Local) peel(h Hash) (Hash, error) {
+	for range 10 {
+		typ, data := l.s.Object(h)
+		if typ != objTag {
+			return h, nil
+		}
+		obj, ok := commitKeyValue(data, "object")
+		if !ok {
+			return Hash{}, fmt.Errorf("tag %s: no object", h)
+		}
+		next, err := ParseHash(string(obj))
+		if err != nil {
+			return Hash{}, fmt.Errorf("tag %s: bad object %q", h, obj)
+		}
+		h = next
+	}
+	return Hash{}, fmt.Errorf("tag %s: too many tags", h)
+}
+
+func (l *Local) resolve(ref string, depth int) (Hash, error) {
+	if h, err := ParseHash(ref); err == nil {
+		return h, nil
+	}
+	if depth > 5 {
+		return Hash{}, fmt.Errorf("resolve %s: too many symbolic refs", ref)
+	}
+	if !fs.ValidPath(ref) {
+		return Hash{}, fmt.Errorf("invalid ref %q", ref)
+	}
+	if ref == "HEAD" {
+		head, err := l.Head()
+		if err != nil {
+			return Hash{}, err
+		}
+		return l.resolve(head, depth+1)
+	}
+
+	var packed map[string]Hash
+	for _, name := range []string{ref, "refs/" + ref, "refs/heads/" + ref, "refs/tags/" + ref, "refs/remotes/" + ref} {
+		if data, err := l.readFile(name); err == nil {
+			text := strings.TrimSpace(string(data))
+			if target, ok := strings.CutPrefix(text, "ref: "); ok {
+				return l.resolve(target, depth+1)
+			}
+			return ParseHash(text)
+		}
+		if packed == nil {
+			var err error
+			if packed, err = l.refs(); err != nil {
+				return Hash{}, err
+			}
+		}
+		if h, ok := packed[name]; ok {
+			return h, nil
+		}
+	}
+	return Hash{}, fmt.Errorf("unknown ref %q", ref)
+}
+
+// Config returns the raw contents of the repository's config file,
+// which is where remote URLs (and sometimes credentials) live.
+func (l *Local) Config() ([]byte, error) {
+	return l.readFile("config")
+}
+
+// Object returns the type name and content of the object with hash h.
+func (l *Local) Object(h Hash) (string, []byte, error) {
+	typ, data := l.s.Object(h)
+	if typ == objNone {
+		return "", nil, fmt.Errorf("object %s: not found", h)
+	}
+	return typ.String(), data, nil
+}
+
+// Commit returns the file tree of commit h along with the raw commit object.
+func (l *Local) Commit(h Hash) (fs.FS, []byte, error) {
+	return l.s.Commit(h)
+}
+
+// A Commit is a parsed commit object.
+type Commit struct {
+	Hash      Hash
+	Tree      Hash
+	Parents   []Hash
+	Author    string // "Name <email>"
+	Committer string
+	Time      time.Time // commit time
+	Message   string
+	Missing   bool // the object isn't in the repository, e.g. past a shallow clone
+}
+
+// ParseCommit parses the raw commit object data with hash h.
+func ParseCommit(h Hash, data []byte) (*Commit, error) {
+	c := &Commit{Hash: h}
+	hdr, msg, _ := bytes.Cut(data, []byte("\n\n"))
+	c.Message = string(msg)
+	sc := bufio.NewScanner(bytes.NewReader(hdr))
+	for sc.Scan() {
+		key, val, _ := strings.Cut(sc.Text(), " ")
+		switch key {
+		case "tree":
+			t, err := ParseHash(val)
+			if err != nil {
+				return nil, fmt.Errorf("commit %s: bad tree: %w", h, err)
+			}
+			c.Tree = t
+		case "parent":
+			p, err := ParseHash(val)
+			if err != nil {
+				return nil, fmt.Errorf("commit %s: bad parent: %w", h, err)
+			}
+			c.Parents = append(c.Parents, p)
+		case "author":
+			c.Author, _ = splitIdent(val)
+		case "committer":
+			c.Committer, c.Time = splitIdent(val)
+		}
+	}
+	return c, sc.Err()
+}
+
+// splitIdent splits "Name <email> 1700000000 +0100".
+func splitIdent(s string) (string, time.Time) {
+	i := strings.LastIndex(s, ">")
+	if i < 0 {
+		return s, time.Time{}
+	}
+	who, when := s[:i+1], strings.Fields(s[i+1:])
+	if len(when) == 0 {
+		return who, time.Time{}
+	}
+	sec, err := strconv.ParseInt(when[0], 10, 64)
+	if err != nil {
+		return who, time.Time{}
+	}
+	t := time.Unix(sec, 0)
+	if len(when) > 1 {
+		if tz, err := time.Parse("-0700", when[1]); err == nil {
+			t = t.In(tz.Location())
+		}
+	}
+	return who, t
+}
+
+// Log walks history back from the commits (or tags) in start, newest first,
+// returning at most n commits. Parents that are missing from the
+// repository are included with Missing set rather than failing the walk.
+func (l *Local) Log(n int, start ...Hash) ([]*Commit, error) {
+	seen := map[Hash]bool{}
+	q := &commitQueue{}
+	push := func(h Hash) error {
+		if seen[h] {
+			return nil
+		}
+		seen[h] = true
+		typ, data := l.s.Object(h)
+		if typ != objCommit {
+			heap.Push(q, &Commit{Hash: h, Missing: true})
+			return nil
+		}
+		c, err := ParseCommit(h, data)
+		if err != nil {
+			return err
+		}
+		heap.Push(q, c)
+		return nil
+	}
+	for _, h := range start {
+		h, err := l.peel(h)
+		if err != nil {
+			return nil, err
+		}
+		if err := push(h); err != nil {
+			return nil, err
+		}
+	}
+
+	var log []*Commit
+	for q.Len() > 0 && len(log) < n {
+		c := heap.Pop(q).(*Commit)
+		log = append(log, c)
+		for _, p := range c.Parents {
+			if err := push(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return log, nil
+}
+
+// commitQueue is a max-heap of commits by time.
+type commitQueue []*Commit
+
+func (q commitQueue) Len() int           { return len(q) }
+func (q commitQueue) Less(i, j int) bool { return q[i].Time.After(q[j].Time) }
+func (q commitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)        { *q = append(*q, x.(*Commit)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,172 @@
+package gitfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// addLoose writes an object to fsys the way git does for loose objects.
+func addLoose(t *testing.T, fsys fstest.MapFS, typ ObjType, data []byte) Hash {
+	t.Helper()
+	var s store
+	h, _ := s.add(typ, data)
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	fmt.Fprintf(zw, "%s %d\x00", typ, len(data))
+	zw.Write(data)
+	zw.Close()
+
+	hex := h.String()
+	fsys["app/.git/objects/"+hex[:2]+"/"+hex[2:]] = &fstest.MapFile{Data: buf.Bytes()}
+	return h
+}
+
+func TestLocal(t *testing.T) {
+	pack, err := os.ReadFile("testdata/scratch.pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A commit in scratch.pack, see TestPack.
+	old := Hash{0xf6, 0xf7, 0x39, 0x2a, 0x99, 0x9b, 0x3d, 0x75, 0xe2, 0x1c, 0xae, 0xe3, 0x3a, 0xeb, 0x6d, 0x01, 0x92, 0xe8, 0xdc, 0x6b}
+
+	fsys := fstest.MapFS{
+		"app/.git/HEAD":                      {Data: []byte("ref: refs/heads/main\n")},
+		"app/.git/config":                    {Data: []byte("[remote \"origin\"]\n\turl = https://example.com/app.git\n")},
+		"app/.git/packed-refs":               {Data: []byte("# pack-refs with: peeled\n" + old.String() + " refs/tags/old\n")},
+		"app/.git/objects/pack/scratch.pack": {Data: pack},
+	}
+
+	blob := addLoose(t, fsys, objBlob, []byte("hunter2\n"))
+	tree := addLoose(t, fsys, objTree, append([]byte("100644 secret.txt\x00"), blob[:]...))
+	head := addLoose(t, fsys, objCommit, fmt.Appendf(nil,
+		"tree %s\nparent %s\nauthor Jane Doe <jane@example.com> 4102444800 +0100\ncommitter Jane Doe <jane@example.com> 4102444800 +0100\n\nadd secret\n",
+		tree, old))
+	tag := addLoose(t, fsys, objTag, fmt.Appendf(nil, "object %s\ntype commit\ntag v1\n\nv1\n", head))
+	fsys["app/.git/refs/heads/main"] = &fstest.MapFile{Data: []byte(head.String() + "\n")}
+	fsys["app/.git/refs/tags/v1"] = &fstest.MapFile{Data: []byte(tag.String() + "\n")}
+
+	l, err := OpenLocal(fsys, "app/.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, want := range map[string]Hash{
+		"HEAD":          head,
+		"main":          head,
+		"refs/tags/old": old,
+		"old":           old,
+		"v1":            head, // peeled
+		head.String():   head,
+	} {
+		if got, err := l.Resolve(ref); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %s, %v; want %s", ref, got, err, want)
+		}
+	}
+	if _, err := l.Resolve("../../etc/passwd"); err == nil {
+		t.Errorf("Resolve escaped the git directory")
+	}
+
+	refs, err := l.Refs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range refs {
+		names = append(names, r.Name)
+	}
+	if got, want := fmt.Sprint(names), "[HEAD refs/heads/main refs/tags/old refs/tags/v1]"; got != want {
+		t.Errorf("Refs() = %s, want %s", got, want)
+	}
+
+	log, err := l.Log(2, tag) // peeled to head
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].Hash != head || log[1].Hash != old {
+		t.Fatalf("Log() = %v", log)
+	}
+	if log[0].Author != "Jane Doe <jane@example.com>" || log[0].Time.Unix() != 4102444800 || log[0].Message != "add secret\n" {
+		t.Errorf("Log()[0] = %+v", log[0])
+	}
+
+	// The secret is in the loose commit; the older packed commit
+	// is still browsable too.
+	tfs, _, err := l.Commit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(tfs, "secret.txt"); err != nil || string(data) != "hunter2\n" {
+		t.Errorf("secret.txt = %q, %v", data, err)
+	}
+	tfs, _, err = l.Commit(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ReadFile(tfs, "rsc/greeting.go"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := OpenLocal(fsys, "app"); err == nil {
+		t.Errorf("OpenLocal(app) should fail without HEAD")
+	}
+}
+
+func TestLocalPackLimits(t *testing.T) {
+	pack, err := os.ReadFile("testdata/scratch.pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(one, all int64) { maxPackSize, maxPacksSize = one, all }(maxPackSize, maxPacksSize)
+
+	size := int64(len(pack))
+	for _, tc := range []struct {
+		packs    int
+		one, all int64
+		wantErr  string // "" for success
+	}{
+		{1, size, size, ""},
+		{2, size, 2 * size, ""},
+		{1, size - 1, 2 * size, "pack is too big"},
+		{2, size, 2*size - 1, "packs are too big"},
+		{3, size, 2 * size, "packs are too big"},
+	} {
+		maxPackSize, maxPacksSize = tc.one, tc.all
+		fsys := fstest.MapFS{"app/.git/HEAD": {Data: []byte("ref: refs/heads/main\n")}}
+		for i := range tc.packs {
+			fsys[fmt.Sprintf("app/.git/objects/pack/%d.pack", i)] = &fstest.MapFile{Data: pack}
+		}
+		_, err := OpenLocal(fsys, "app/.git")
+		if tc.wantErr == "" && err != nil || tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%d packs, limits %d/%d: %v, want %q", tc.packs, tc.one, tc.all, err, tc.wantErr)
+		}
+	}
+}
+
+// TestReadFileMax checks the limit is on what is read, not on what Stat says.
+func TestReadFileMax(t *testing.T) {
+	l := &Local{fsys: fstest.MapFS{"git/packed-refs": {Data: []byte("0123456789")}}, dir: "git"}
+	for _, tc := range []struct {
+		max     int64
+		wantErr bool
+	}{
+		{-1, false},
+		{10, false},
+		{9, true},
+		{0, true},
+	} {
+		data, err := l.readFileMax("packed-refs", tc.max)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("readFileMax(%d) = %q, %v", tc.max, data, err)
+		}
+		if err == nil && string(data) != "0123456789" {
+			t.Errorf("readFileMax(%d) = %q", tc.max, data)
+		}
+	}
+}
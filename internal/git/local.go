@@ -0,0 +1,465 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	httpserve "github.com/thesavant42/yolosint/internal/forks/http"
+	"github.com/thesavant42/yolosint/internal/forks/rsc.io/gitfs"
+)
+
+// How many commits a log page shows.
+const logLimit = 500
+
+// ServeLocal renders a repository that was found in a file system rather
+// than fetched over HTTP, e.g. a .git directory shipped inside an image.
+//
+// Every link is relative to base, which is the URL path the repository is
+// served under and must end in "/". view is what follows base:
+//
+//	""                   refs, remotes, identities and the log of every ref
+//	"log/<ref>"          the log starting at ref
+//	"commit/<hash>"      a single commit
+//	"tree/<hash>/<path>" the files as of a commit
+//
+// Each view also answers ?format=json.
+func ServeLocal(w http.ResponseWriter, r *http.Request, repo *gitfs.Local, title, base, view string) error {
+	l := &local{repo: repo, title: title, base: base, json: httpserve.WantsJSON(r)}
+
+	kind, rest, _ := strings.Cut(view, "/")
+	switch kind {
+	case "":
+		return l.overview(w)
+	case "log":
+		return l.log(w, rest)
+	case "commit":
+		return l.commit(w, rest)
+	case "tree":
+		hash, p, _ := strings.Cut(rest, "/")
+		return l.tree(w, r, hash, p)
+	}
+	return fmt.Errorf("unknown view %q", view)
+}
+
+type local struct {
+	repo  *gitfs.Local
+	title string
+	base  string
+	json  bool
+}
+
+// LocalRepo is the JSON for a repository's overview.
+type LocalRepo struct {
+	Head    string        `json:"head"`
+	Remotes []Remote      `json:"remotes"`
+	Refs    []LocalRef    `json:"refs"`
+	Idents  []Ident       `json:"identities"`
+	Log     []LocalCommit `json:"log"`
+}
+
+// LocalCommit is the JSON for a commit.
+type LocalCommit struct {
+	Hash      string    `json:"hash"`
+	Tree      string    `json:"tree,omitempty"`
+	Parents   []string  `json:"parents,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Committer string    `json:"committer,omitempty"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message,omitempty"`
+	Missing   bool      `json:"missing,omitempty"` // e.g. past the end of a shallow clone
+}
+
+func localCommits(log []*gitfs.Commit) []LocalCommit {
+	lcs := make([]LocalCommit, 0, len(log))
+	for _, c := range log {
+		lc := LocalCommit{
+			Hash:      c.Hash.String(),
+			Author:    c.Author,
+			Committer: c.Committer,
+			Time:      c.Time,
+			Message:   c.Message,
+			Missing:   c.Missing,
+		}
+		if !c.Missing {
+			lc.Tree = c.Tree.String()
+		}
+		for _, p := range c.Parents {
+			lc.Parents = append(lc.Parents, p.String())
+		}
+		lcs = append(lcs, lc)
+	}
+	return lcs
+}
+
+// LocalRef is the JSON for a ref.
+type LocalRef struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// Remote is a [remote "name"] section of .git/config.
+type Remote struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Ident is someone who authored or committed in the log.
+type Ident struct {
+	Ident   string `json:"ident"`
+	Commits int    `json:"commits"`
+}
+
+// parseRemotes pulls remote URLs out of a git config file.
+func parseRemotes(config []byte) []Remote {
+	remotes := []Remote{}
+	section := ""
+	sc := bufio.NewScanner(bytes.NewReader(config))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		name, ok := strings.CutPrefix(section, "remote ")
+		if !ok {
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != "url" {
+			continue
+		}
+		remotes = append(remotes, Remote{Name: strings.Trim(name, `"`), URL: strings.TrimSpace(val)})
+	}
+	return remotes
+}
+
+// identities counts everyone in log, most prolific first.
+func identities(log []*gitfs.Commit) []Ident {
+	counts := map[string]int{}
+	for _, c := range log {
+		if c.Author != "" {
+			counts[c.Author]++
+		}
+		if c.Committer != "" && c.Committer != c.Author {
+			counts[c.Committer]++
+		}
+	}
+	idents := []Ident{}
+	for ident, n := range counts {
+		idents = append(idents, Ident{ident, n})
+	}
+	slices.SortFunc(idents, func(a, b Ident) int {
+		return cmp.Or(b.Commits-a.Commits, strings.Compare(a.Ident, b.Ident))
+	})
+	return idents
+}
+
+func (l *local) link(parts ...string) string {
+	u := url.URL{Path: l.base + path.Join(parts...)}
+	return u.String()
+}
+
+func (l *local) header(w http.ResponseWriter, hd HeaderData) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := headerTmpl.Execute(w, TitleData{l.title}); err != nil {
+		return err
+	}
+	hd.Repo = l.title
+	hd.RepoLink = l.base
+	hd.RefsLink = l.base
+	return bodyTmpl.Execute(w, hd)
+}
+
+func (l *local) overview(w http.ResponseWriter) error {
+	refs, err := l.repo.Refs()
+	if err != nil {
+		return fmt.Errorf("Refs: %w", err)
+	}
+	head, _ := l.repo.Head()
+	config, _ := l.repo.Config()
+
+	// Walk from every ref, not just HEAD, so branches that were never
+	// merged (and stashes) show up too.
+	starts := make([]gitfs.Hash, 0, len(refs))
+	for _, ref := range refs {
+		starts = append(starts, ref.Hash)
+	}
+	log, err := l.repo.Log(logLimit, starts...)
+	if err != nil {
+		return fmt.Errorf("Log: %w", err)
+	}
+
+	if l.json {
+		lr := LocalRepo{Head: head, Remotes: parseRemotes(config), Refs: []LocalRef{}, Idents: identities(log), Log: localCommits(log)}
+		for _, ref := range refs {
+			lr.Refs = append(lr.Refs, LocalRef{ref.Name, ref.Hash.String()})
+		}
+		return writeJSON(w, lr)
+	}
+
+	if err := l.header(w, HeaderData{JQ: "git show-ref --head"}); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "<pre>\n")
+	fmt.Fprintf(w, "HEAD is %s\n\n", htmlEscape(head))
+	for _, ref := range refs {
+		fmt.Fprintf(w, "<a href=%q>%s</a>\t<a class=\"mt\" href=%q>%s</a>\n", l.link("commit", ref.Hash.String()), ref.Hash, l.link("log", ref.Name), htmlEscape(ref.Name))
+	}
+
+	if remotes := parseRemotes(config); len(remotes) != 0 {
+		fmt.Fprintf(w, "\n<b>remotes</b>\n")
+		for _, rem := range remotes {
+			fmt.Fprintf(w, "%s\t%s\n", htmlEscape(rem.Name), htmlEscape(rem.URL))
+		}
+	}
+	if len(config) != 0 {
+		fmt.Fprintf(w, "\n<b>config</b>\n%s", htmlEscape(string(config)))
+	}
+
+	fmt.Fprintf(w, "\n<b>identities</b>\n")
+	for _, id := range identities(log) {
+		fmt.Fprintf(w, "%6d\t%s\n", id.Commits, htmlEscape(id.Ident))
+	}
+
+	fmt.Fprintf(w, "\n<b>log</b>\n")
+	l.writeLog(w, log)
+	fmt.Fprintf(w, "</pre>\n")
+	fmt.Fprintf(w, footer)
+	return nil
+}
+
+func (l *local) writeLog(w io.Writer, log []*gitfs.Commit) {
+	for _, c := range log {
+		if c.Missing {
+			fmt.Fprintf(w, "%s (missing)\n", c.Hash)
+			continue
+		}
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		fmt.Fprintf(w, "<a href=%q>%s</a> %s %s\t%s\n", l.link("commit", c.Hash.String()), c.Hash.String()[:12], c.Time.Format("2006-01-02 15:04"), htmlEscape(c.Author), htmlEscape(subject))
+	}
+	if len(log) == logLimit {
+		fmt.Fprintf(w, "...\n")
+	}
+}
+
+func (l *local) log(w http.ResponseWriter, ref string) error {
+	h, err := l.repo.Resolve(ref)
+	if err != nil {
+		return err
+	}
+	log, err := l.repo.Log(logLimit, h)
+	if err != nil {
+		return fmt.Errorf("Log: %w", err)
+	}
+	if l.json {
+		return writeJSON(w, localCommits(log))
+	}
+
+	if err := l.header(w, HeaderData{Ref: ref, RefLink: l.link("log", ref), JQ: "git log " + ref}); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "<pre>\n")
+	l.writeLog(w, log)
+	fmt.Fprintf(w, "</pre>\n")
+	fmt.Fprintf(w, footer)
+	return nil
+}
+
+func (l *local) commit(w http.ResponseWriter, ref string) error {
+	h, err := l.repo.Resolve(ref)
+	if err != nil {
+		return err
+	}
+	_, cdata, err := l.repo.Commit(h)
+	if err != nil {
+		return err
+	}
+	if l.json {
+		c, err := gitfs.ParseCommit(h, cdata)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, localCommits([]*gitfs.Commit{c})[0])
+	}
+
+	hash := h.String()
+	if err := l.header(w, HeaderData{Ref: hash, RefLink: l.link("log", hash), JQ: "git cat-file -p " + hash}); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "<pre>\n")
+	scanner := bufio.NewScanner(bytes.NewReader(cdata))
+	headers := true // until the blank line before the message
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			headers = false
+		}
+		hdr, val, _ := strings.Cut(line, " ")
+		if !headers || (hdr != "tree" && hdr != "parent") {
+			fmt.Fprintf(w, "%s\n", htmlEscape(line))
+			continue
+		}
+		// The commit may come from anywhere, so only link what's a hash.
+		ph, err := gitfs.ParseHash(val)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "%s\n", htmlEscape(line))
+		case hdr == "tree":
+			fmt.Fprintf(w, "%s <a href=%q>%s</a>\n", hdr, l.link("tree", hash)+"/", ph)
+		default:
+			fmt.Fprintf(w, "%s <a href=%q>%s</a>\n", hdr, l.link("commit", ph.String()), ph)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	fmt.Fprintf(w, "</pre>\n")
+	fmt.Fprintf(w, footer)
+	return nil
+}
+
+// LocalEntry is the JSON for one entry of a tree.
+type LocalEntry struct {
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+	Name string `json:"name"`
+}
+
+func (l *local) tree(w http.ResponseWriter, r *http.Request, ref, p string) error {
+	h, err := l.repo.Resolve(ref)
+	if err != nil {
+		return err
+	}
+	fsys, _, err := l.repo.Commit(h)
+	if err != nil {
+		return err
+	}
+	hash := h.String()
+
+	name := path.Clean("/" + p)[1:]
+	if name == "" {
+		name = "."
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if d.IsDir() && !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusFound)
+		return nil
+	}
+
+	var des []fs.DirEntry
+	if d.IsDir() {
+		fdir, ok := f.(fs.ReadDirFile)
+		if !ok {
+			return fmt.Errorf("not a ReadDirFile: %T", f)
+		}
+		if des, err = fdir.ReadDir(-1); err != nil {
+			return fmt.Errorf("ReadDir: %w", err)
+		}
+	}
+
+	if l.json {
+		if !d.IsDir() {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, err := io.Copy(w, f)
+			return err
+		}
+		entries := []LocalEntry{}
+		for _, de := range des {
+			if e, ok := gitEntry(de); ok {
+				entries = append(entries, LocalEntry{fmt.Sprintf("%06o", e.Mode), entryType(e.Mode), e.Hash.String(), string(e.Name)})
+			}
+		}
+		return writeJSON(w, entries)
+	}
+
+	hd := HeaderData{Ref: hash, RefLink: l.link("commit", hash)}
+	if name != "." {
+		hd.Path = name
+		hd.PathLink = path.Dir(strings.TrimSuffix(r.URL.Path, "/")) + "/"
+	}
+	if sys, ok := d.Sys().(*gitfs.DirEntry); ok && sys != nil {
+		hd.JQ = "git cat-file -p " + sys.Hash.String()
+	}
+	if !d.IsDir() && d.Size() > tooBig {
+		hd.JQ = fmt.Sprintf("%s | head -c %d", hd.JQ, tooBig)
+	}
+	if err := l.header(w, hd); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "<pre>\n")
+	if d.IsDir() {
+		for _, de := range des {
+			e, ok := gitEntry(de)
+			if !ok {
+				continue
+			}
+			href := (&url.URL{Path: string(e.Name)}).String()
+			anchor := htmlEscape(string(e.Name))
+			switch entryType(e.Mode) {
+			case "commit":
+				// Submodules live in some other repository.
+				fmt.Fprintf(w, "%06o commit %s\t%s\n", e.Mode, e.Hash, anchor)
+			case "tree":
+				fmt.Fprintf(w, "%06o tree %s\t<a href=%q>%s</a>\n", e.Mode, e.Hash, href+"/", anchor)
+			default:
+				fmt.Fprintf(w, "%06o blob %s\t<a href=%q>%s</a>\n", e.Mode, e.Hash, href, anchor)
+			}
+		}
+	} else {
+		size := min(d.Size(), tooBig)
+		w := &dumbEscaper{buf: bufio.NewWriter(w)}
+		if _, err := io.CopyN(w, f, size); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "</pre>\n")
+	fmt.Fprintf(w, footer)
+	return nil
+}
+
+func gitEntry(de fs.DirEntry) (*gitfs.DirEntry, bool) {
+	info, err := de.Info()
+	if err != nil {
+		return nil, false
+	}
+	e, ok := info.Sys().(*gitfs.DirEntry)
+	return e, ok && e != nil
+}
+
+func entryType(mode int) string {
+	switch mode {
+	case 0o160000:
+		return "commit"
+	case 0o40000:
+		return "tree"
+	}
+	return "blob"
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -123,7 +123,7 @@ pre {
 <body>
 <div>
 <h1><a class="top" href="/">🪢 <span class="link">Git Explorer</span></a></h1>
-<h2><a class="mt" href="{{.RepoLink}}">{{.Repo}}</a>{{ if .Ref }}<a class="mt" href="/?url={{ .Repo }}">@</a><a class="mt" href="{{ .RefLink }}">{{ .Ref }}</a>{{if .Path }}/<a class="mt" href="{{ .PathLink }}">{{ .Path }}</a>{{ end }}{{ end }}</h2>
+<h2><a class="mt" href="{{.RepoLink}}">{{.Repo}}</a>{{ if .Ref }}<a class="mt" href="{{ if .RefsLink }}{{ .RefsLink }}{{ else }}/?url={{ .Repo }}{{ end }}">@</a><a class="mt" href="{{ .RefLink }}">{{ .Ref }}</a>{{if .Path }}/<a class="mt" href="{{ .PathLink }}">{{ .Path }}</a>{{ end }}{{ end }}</h2>
 </div>
 {{ if .Message }}<p>{{.Message}}</p>{{ end }}
 {{ if .JQ }}<h4><span class="noselect">$</span>{{.JQ}}</h4>{{ end }}`
@@ -146,6 +146,7 @@ type HeaderData struct {
 	RepoLink string
 	Ref      string
 	RefLink  string
+	RefsLink string // where "@" goes, if not /?url=Repo
 	Path     string
 	PathLink string
 }
@@ -0,0 +1,266 @@
+// Package inventory lists the software installed in an image by reading the
+// package databases and manifests left behind in its filesystem.
+package inventory
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/thesavant42/yolosint/internal/soci"
+	"golang.org/x/sync/errgroup"
+)
+
+// Where packages are found.
+const (
+	KindAPK  = "apk"    // /lib/apk/db/installed
+	KindDpkg = "dpkg"   // /var/lib/dpkg/status and status.d
+	KindRPM  = "rpm"    // rpmdb.sqlite
+	KindPyPI = "pypi"   // *.dist-info/METADATA, *.egg-info/PKG-INFO
+	KindNPM  = "npm"    // node_modules/*/package.json
+	KindGo   = "golang" // build info of Go binaries
+)
+
+const (
+	// MaxFileSize is the largest package database read into memory.
+	MaxFileSize = 64 << 20
+
+	// MaxRPMSize is the largest rpm database copied out of a layer.
+	MaxRPMSize = 1 << 30
+
+	concurrency = 8
+)
+
+// Package is one piece of installed software. The fields line up with
+// the parts of a purl (https://github.com/package-url/purl-spec).
+type Package struct {
+	Type      string `json:"type"`                // purl type: apk, deb, rpm, pypi, npm or golang
+	Namespace string `json:"namespace,omitempty"` // distro, npm scope or Go module path prefix
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Epoch     string `json:"epoch,omitempty"` // rpm only
+	Arch      string `json:"arch,omitempty"`
+	License   string `json:"license,omitempty"`
+	Source    string `json:"source,omitempty"` // source package it was built from
+
+	Path  string `json:"path"`  // file it was found in
+	Layer string `json:"layer"` // layer that file came from
+}
+
+// Distro is what /etc/os-release says about the image.
+type Distro struct {
+	ID        string `json:"id,omitempty"`         // e.g. "debian"
+	VersionID string `json:"version_id,omitempty"` // e.g. "12"
+	Name      string `json:"name,omitempty"`       // e.g. "Debian GNU/Linux 12 (bookworm)"
+}
+
+// Inventory is every package found in an image.
+type Inventory struct {
+	Distro   Distro    `json:"distro"`
+	Packages []Package `json:"packages"`
+	Errors   []string  `json:"errors,omitempty"` // files that couldn't be read
+}
+
+// Match reports which kind of package database name is, or "" if it
+// isn't one. Go binaries are recognized by their TOC entry instead.
+func Match(name string) string {
+	name = path.Clean("/" + name)
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+
+	switch {
+	case name == "/lib/apk/db/installed":
+		return KindAPK
+	case name == "/var/lib/dpkg/status":
+		return KindDpkg
+	case dir == "/var/lib/dpkg/status.d" && !strings.HasSuffix(base, ".md5sums"):
+		// Distroless writes one file per package here.
+		return KindDpkg
+	case base == "rpmdb.sqlite" && (dir == "/var/lib/rpm" || dir == "/usr/lib/sysimage/rpm"):
+		return KindRPM
+	case base == "METADATA" && strings.HasSuffix(dir, ".dist-info"):
+		return KindPyPI
+	case base == "PKG-INFO" && strings.HasSuffix(dir, ".egg-info"):
+		return KindPyPI
+	case base == "package.json":
+		// node_modules/name/package.json or node_modules/@scope/name/package.json,
+		// but not package.json files further down inside a package.
+		parent := path.Dir(dir)
+		if path.Base(parent) == "node_modules" {
+			return KindNPM
+		}
+		if strings.HasPrefix(path.Base(parent), "@") && path.Base(path.Dir(parent)) == "node_modules" {
+			return KindNPM
+		}
+	}
+	return ""
+}
+
+// Scan reads every package database in the flattened image. Files that
+// can't be parsed are reported in Errors rather than failing the scan.
+func Scan(ctx context.Context, mfs *soci.MultiFS) (*Inventory, error) {
+	files := mfs.Flatten()
+	inv := &Inventory{Packages: []Package{}}
+
+	for _, name := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		ff, ok := files[name]
+		if !ok {
+			continue
+		}
+		if ff.Typeflag == tar.TypeSymlink {
+			// Usually /etc/os-release -> ../usr/lib/os-release.
+			target := ff.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(name), target)
+			}
+			if ff, ok = files[path.Clean(target)]; !ok {
+				continue
+			}
+		}
+		data, err := readAll(ctx, ff)
+		if err != nil {
+			inv.Errors = append(inv.Errors, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		inv.Distro = parseOSRelease(data)
+		break
+	}
+
+	var (
+		mu sync.Mutex
+		g  errgroup.Group
+	)
+	g.SetLimit(concurrency)
+	for name, ff := range files {
+		kind := Match(name)
+		if ff.GoVersion != "" {
+			kind = KindGo
+		}
+		if kind == "" || ff.Typeflag != tar.TypeReg {
+			continue
+		}
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pkgs, err := scanFile(ctx, kind, ff, inv.Distro)
+			for i := range pkgs {
+				pkgs[i].Path = name
+				pkgs[i].Layer = ff.Layer
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			inv.Packages = append(inv.Packages, pkgs...)
+			if err != nil {
+				inv.Errors = append(inv.Errors, fmt.Sprintf("%s: %v", name, err))
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(inv.Packages, func(i, j int) bool {
+		a, b := inv.Packages[i], inv.Packages[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Path < b.Path
+	})
+	sort.Strings(inv.Errors)
+	return inv, nil
+}
+
+func scanFile(ctx context.Context, kind string, ff *soci.FlatFile, distro Distro) ([]Package, error) {
+	switch kind {
+	case KindGo:
+		return scanGo(ctx, ff)
+	case KindRPM:
+		return scanRPM(ctx, ff, distro)
+	}
+
+	data, err := readAll(ctx, ff)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case KindAPK:
+		return parseAPK(data, distro), nil
+	case KindDpkg:
+		return parseDpkg(data, distro), nil
+	case KindPyPI:
+		p, err := parsePyMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Package{p}, nil
+	case KindNPM:
+		p, err := parsePackageJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Package{p}, nil
+	}
+	return nil, fmt.Errorf("unknown kind %q", kind)
+}
+
+func readAll(ctx context.Context, ff *soci.FlatFile) ([]byte, error) {
+	if ff.Size > MaxFileSize {
+		return nil, fmt.Errorf("%d bytes is too big to read", ff.Size)
+	}
+	rc, err := ff.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, MaxFileSize))
+}
+
+// scanGo streams a binary through a GoSniffer until its build info turns
+// up, which is usually well before the end of the file.
+func scanGo(ctx context.Context, ff *soci.FlatFile) ([]Package, error) {
+	rc, err := ff.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	gs := &soci.GoSniffer{}
+	buf := make([]byte, 32<<10)
+	for !gs.Found() {
+		n, err := rc.Read(buf)
+		gs.Write(buf[:n])
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if !gs.Found() {
+		return nil, fmt.Errorf("no Go build info")
+	}
+	if gs.Old {
+		return nil, fmt.Errorf("built before Go 1.18, which didn't record modules inline")
+	}
+	bi, err := gs.BuildInfo()
+	if err != nil {
+		return nil, err
+	}
+	return goPackages(bi), nil
+}
@@ -0,0 +1,262 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"lib/apk/db/installed", KindAPK},
+		{"./var/lib/dpkg/status", KindDpkg},
+		{"var/lib/dpkg/status.d/base-files", KindDpkg},
+		{"var/lib/dpkg/status.d/base-files.md5sums", ""},
+		{"var/lib/dpkg/status-old", ""},
+		{"var/lib/rpm/rpmdb.sqlite", KindRPM},
+		{"usr/lib/sysimage/rpm/rpmdb.sqlite", KindRPM},
+		{"usr/lib/python3/dist-packages/requests-2.31.0.dist-info/METADATA", KindPyPI},
+		{"usr/lib/python3.11/site-packages/six.egg-info/PKG-INFO", KindPyPI},
+		{"app/node_modules/express/package.json", KindNPM},
+		{"app/node_modules/@babel/core/package.json", KindNPM},
+		{"app/node_modules/express/lib/package.json", ""},
+		{"app/package.json", ""},
+		{"etc/passwd", ""},
+	} {
+		if got := Match(tc.name); got != tc.want {
+			t.Errorf("Match(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	d := parseOSRelease([]byte("PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nNAME=\"Debian GNU/Linux\"\nVERSION_ID='12'\nID=debian\n"))
+	if want := (Distro{"debian", "12", "Debian GNU/Linux 12 (bookworm)"}); d != want {
+		t.Errorf("parseOSRelease() = %+v, want %+v", d, want)
+	}
+}
+
+func TestParseAPK(t *testing.T) {
+	db := `C:Q1abc=
+P:musl
+V:1.2.4-r2
+A:x86_64
+L:MIT
+o:musl
+F:lib
+R:ld-musl-x86_64.so.1
+
+P:busybox
+V:1.36.1-r5
+A:x86_64
+L:GPL-2.0-only
+o:busybox
+`
+	pkgs := parseAPK([]byte(db), Distro{ID: "alpine"})
+	if len(pkgs) != 2 {
+		t.Fatalf("parseAPK() = %+v", pkgs)
+	}
+	want := Package{Type: "apk", Namespace: "alpine", Name: "musl", Version: "1.2.4-r2", Arch: "x86_64", License: "MIT", Source: "musl"}
+	if pkgs[0] != want {
+		t.Errorf("parseAPK()[0] = %+v, want %+v", pkgs[0], want)
+	}
+}
+
+func TestParseDpkg(t *testing.T) {
+	status := `Package: libc6
+Status: install ok installed
+Priority: optional
+Architecture: amd64
+Source: glibc (2.36-9)
+Version: 2.36-9+deb12u4
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries that are used by nearly all programs on
+ the system.
+
+Package: oldthing
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+
+Package: tzdata
+Status: install ok installed
+Architecture: all
+Version: 2024a-0+deb12u1
+`
+	pkgs := parseDpkg([]byte(status), Distro{})
+	if len(pkgs) != 2 {
+		t.Fatalf("parseDpkg() = %+v", pkgs)
+	}
+	want := Package{Type: "deb", Namespace: "debian", Name: "libc6", Version: "2.36-9+deb12u4", Arch: "amd64", Source: "glibc"}
+	if pkgs[0] != want {
+		t.Errorf("parseDpkg()[0] = %+v, want %+v", pkgs[0], want)
+	}
+	if pkgs[1].Name != "tzdata" {
+		t.Errorf("parseDpkg()[1] = %+v, want tzdata", pkgs[1])
+	}
+
+	// Distroless status.d files have no Status.
+	pkgs = parseDpkg([]byte("Package: base-files\nVersion: 12.4+deb12u5\nArchitecture: amd64\n"), Distro{ID: "debian"})
+	if len(pkgs) != 1 || pkgs[0].Name != "base-files" {
+		t.Errorf("parseDpkg(status.d) = %+v", pkgs)
+	}
+}
+
+func TestParsePyMetadata(t *testing.T) {
+	p, err := parsePyMetadata([]byte("Metadata-Version: 2.1\nName: Typing_Extensions\nVersion: 4.9.0\nLicense: UNKNOWN\n\nName: not-this\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Package{Type: "pypi", Name: "typing-extensions", Version: "4.9.0"}); p != want {
+		t.Errorf("parsePyMetadata() = %+v, want %+v", p, want)
+	}
+	if _, err := parsePyMetadata([]byte("Metadata-Version: 2.1\n")); err == nil {
+		t.Errorf("no error without a name")
+	}
+}
+
+func TestPyPIName(t *testing.T) {
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"requests", "requests"},
+		{"Typing_Extensions", "typing-extensions"},
+		{"zope.interface", "zope-interface"},
+		{"Foo__-.Bar", "foo-bar"},
+		{"PyYAML", "pyyaml"},
+	} {
+		if got := PyPIName(tc.name); got != tc.want {
+			t.Errorf("PyPIName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParsePackageJSON(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Package
+	}{
+		{`{"name": "express", "version": "4.18.2", "license": "MIT"}`,
+			Package{Type: "npm", Name: "express", Version: "4.18.2", License: "MIT"}},
+		{`{"name": "@babel/core", "version": "7.23.0", "license": {"type": "MIT"}}`,
+			Package{Type: "npm", Namespace: "@babel", Name: "core", Version: "7.23.0", License: "MIT"}},
+		{`{"name": "old", "version": "0.1.0", "licenses": [{"type": "MIT"}, {"type": "Apache-2.0"}]}`,
+			Package{Type: "npm", Name: "old", Version: "0.1.0", License: "MIT OR Apache-2.0"}},
+	} {
+		p, err := parsePackageJSON([]byte(tc.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != tc.want {
+			t.Errorf("parsePackageJSON(%s) = %+v, want %+v", tc.in, p, tc.want)
+		}
+	}
+	if _, err := parsePackageJSON([]byte(`{"private": true}`)); err == nil {
+		t.Errorf("no error without a name")
+	}
+}
+
+// rpmHeader lays out a header blob the way rpm stores it.
+func rpmHeader(strs map[uint32]string, ints map[uint32]uint32) []byte {
+	be := binary.BigEndian
+	var index, data []byte
+	entry := func(tag, typ uint32) {
+		index = be.AppendUint32(index, tag)
+		index = be.AppendUint32(index, typ)
+		index = be.AppendUint32(index, uint32(len(data)))
+		index = be.AppendUint32(index, 1)
+	}
+	for tag, v := range ints {
+		entry(tag, rpmTypeInt32)
+		data = be.AppendUint32(data, v)
+	}
+	for tag, s := range strs {
+		entry(tag, rpmTypeString)
+		data = append(data, s+"\x00"...)
+	}
+	blob := be.AppendUint32(nil, uint32(len(index)/16))
+	blob = be.AppendUint32(blob, uint32(len(data)))
+	return append(append(blob, index...), data...)
+}
+
+func TestParseRPMHeader(t *testing.T) {
+	blob := rpmHeader(map[uint32]string{
+		rpmTagName:      "bash",
+		rpmTagVersion:   "5.2.15",
+		rpmTagRelease:   "5.fc39",
+		rpmTagArch:      "x86_64",
+		rpmTagLicense:   "GPL-3.0-or-later",
+		rpmTagSourceRPM: "bash-5.2.15-5.fc39.src.rpm",
+	}, map[uint32]uint32{rpmTagEpoch: 1})
+
+	p, err := parseRPMHeader(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Package{Type: "rpm", Name: "bash", Version: "5.2.15-5.fc39", Epoch: "1", Arch: "x86_64", License: "GPL-3.0-or-later", Source: "bash-5.2.15-5.fc39.src.rpm"}
+	if p != want {
+		t.Errorf("parseRPMHeader() = %+v, want %+v", p, want)
+	}
+
+	if _, err := parseRPMHeader(blob[:len(blob)-10]); err == nil {
+		t.Errorf("no error for a truncated header")
+	}
+}
+
+func TestReadRPMDB(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rpmdb.sqlite")
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bash", "gpg-pubkey"} {
+		blob := rpmHeader(map[uint32]string{rpmTagName: name, rpmTagVersion: "1", rpmTagRelease: "1"}, nil)
+		if _, err := db.Exec("INSERT INTO Packages (blob) VALUES (?)", blob); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkgs, err := readRPMDB(context.Background(), file, "fedora")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "bash" || pkgs[0].Namespace != "fedora" || pkgs[0].Version != "1-1" {
+		t.Errorf("readRPMDB() = %+v", pkgs)
+	}
+}
+
+func TestGoPackages(t *testing.T) {
+	bi := &debug.BuildInfo{
+		GoVersion: "go1.22.1",
+		Main:      debug.Module{Path: "github.com/example/tool", Version: "(devel)"},
+		Deps: []*debug.Module{
+			{Path: "golang.org/x/sys", Version: "v0.18.0"},
+			{Path: "github.com/old/dep", Version: "v1.0.0", Replace: &debug.Module{Path: "github.com/fork/dep", Version: "v1.0.1"}},
+		},
+	}
+	got := goPackages(bi)
+	want := []Package{
+		{Type: "golang", Name: "stdlib", Version: "1.22.1"},
+		{Type: "golang", Namespace: "github.com/example", Name: "tool", Version: "(devel)"},
+		{Type: "golang", Namespace: "golang.org/x", Name: "sys", Version: "v0.18.0"},
+		{Type: "golang", Namespace: "github.com/fork", Name: "dep", Version: "v1.0.1"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("goPackages() = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("goPackages()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// parseOSRelease reads os-release(5).
+func parseOSRelease(data []byte) Distro {
+	var d Distro
+	for _, line := range strings.Split(string(data), "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		if uq, err := strconv.Unquote(v); err == nil {
+			v = uq
+		} else {
+			v = strings.Trim(v, `'"`)
+		}
+		switch k {
+		case "ID":
+			d.ID = v
+		case "VERSION_ID":
+			d.VersionID = v
+		case "PRETTY_NAME":
+			d.Name = v
+		}
+	}
+	return d
+}
+
+// stanzas splits data into blank line separated records of "key<sep>value"
+// lines. Lines starting with whitespace continue the previous value and
+// are dropped, nothing we want spans lines.
+func stanzas(data []byte, sep string) []map[string]string {
+	var (
+		out []map[string]string
+		cur map[string]string
+	)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			cur = nil
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		k, v, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		if cur == nil {
+			cur = map[string]string{}
+			out = append(out, cur)
+		}
+		cur[k] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// parseAPK reads /lib/apk/db/installed, see
+// https://wiki.alpinelinux.org/wiki/Apk_spec#Package_Database
+func parseAPK(data []byte, distro Distro) []Package {
+	ns := distro.ID
+	if ns == "" {
+		ns = "alpine"
+	}
+	pkgs := []Package{}
+	for _, st := range stanzas(data, ":") {
+		if st["P"] == "" {
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Type:      "apk",
+			Namespace: ns,
+			Name:      st["P"],
+			Version:   st["V"],
+			Arch:      st["A"],
+			License:   st["L"],
+			Source:    st["o"],
+		})
+	}
+	return pkgs
+}
+
+// parseDpkg reads /var/lib/dpkg/status, or one of the files distroless
+// images keep in /var/lib/dpkg/status.d instead.
+func parseDpkg(data []byte, distro Distro) []Package {
+	ns := distro.ID
+	if ns == "" {
+		ns = "debian"
+	}
+	pkgs := []Package{}
+	for _, st := range stanzas(data, ":") {
+		if st["Package"] == "" {
+			continue
+		}
+		// e.g. "install ok installed", or "deinstall ok config-files" for
+		// something that was removed. status.d doesn't have this at all.
+		if status, ok := st["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+		// "Source: name (version)" when the versions differ.
+		source, _, _ := strings.Cut(st["Source"], " ")
+		pkgs = append(pkgs, Package{
+			Type:      "deb",
+			Namespace: ns,
+			Name:      st["Package"],
+			Version:   st["Version"],
+			Arch:      st["Architecture"],
+			Source:    source,
+		})
+	}
+	return pkgs
+}
+
+// PyPIName normalizes a Python project name as in PEP 503, which is also
+// the form purls and OSV lookups want: lowercase, with every run of "-",
+// "_" and "." collapsed to a single "-".
+func PyPIName(name string) string {
+	var sb strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(name) {
+		if r == '-' || r == '_' || r == '.' {
+			sep = true
+			continue
+		}
+		if sep {
+			sb.WriteByte('-')
+			sep = false
+		}
+		sb.WriteRune(r)
+	}
+	if sep {
+		sb.WriteByte('-')
+	}
+	return sb.String()
+}
+
+// parsePyMetadata reads the core metadata of an installed Python
+// distribution, see https://packaging.python.org/en/latest/specifications/core-metadata/
+func parsePyMetadata(data []byte) (Package, error) {
+	// The headers end at the first blank line, the description follows.
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		data = data[:i]
+	}
+	st := stanzas(data, ":")
+	if len(st) == 0 || st[0]["Name"] == "" || st[0]["Version"] == "" {
+		return Package{}, fmt.Errorf("no Name or Version")
+	}
+	h := st[0]
+	license := h["License-Expression"]
+	if license == "" && h["License"] != "UNKNOWN" {
+		license = h["License"]
+	}
+	return Package{
+		Type:    "pypi",
+		Name:    PyPIName(h["Name"]),
+		Version: h["Version"],
+		License: license,
+	}, nil
+}
+
+// parsePackageJSON reads the package.json of an installed npm package.
+func parsePackageJSON(data []byte) (Package, error) {
+	var pj struct {
+		Name     string          `json:"name"`
+		Version  string          `json:"version"`
+		License  json.RawMessage `json:"license"`
+		Licenses []struct {
+			Type string `json:"type"`
+		} `json:"licenses"`
+	}
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return Package{}, err
+	}
+	if pj.Name == "" || pj.Version == "" {
+		return Package{}, fmt.Errorf("no name or version")
+	}
+
+	// "license" is usually a string, but old packages have {"type": ...}
+	// or a "licenses" list.
+	var license string
+	if json.Unmarshal(pj.License, &license) != nil {
+		var obj struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(pj.License, &obj)
+		license = obj.Type
+	}
+	if license == "" {
+		var types []string
+		for _, l := range pj.Licenses {
+			types = append(types, l.Type)
+		}
+		license = strings.Join(types, " OR ")
+	}
+
+	p := Package{Type: "npm", Name: pj.Name, Version: pj.Version, License: license}
+	if scope, name, ok := strings.Cut(pj.Name, "/"); ok && strings.HasPrefix(scope, "@") {
+		p.Namespace, p.Name = scope, name
+	}
+	return p, nil
+}
+
+// goModule splits a module path into a purl namespace and name.
+func goModule(mod *debug.Module) Package {
+	if mod.Replace != nil {
+		mod = mod.Replace
+	}
+	p := Package{Type: "golang", Name: mod.Path, Version: mod.Version}
+	if i := strings.LastIndex(mod.Path, "/"); i >= 0 {
+		p.Namespace, p.Name = mod.Path[:i], path.Base(mod.Path)
+	}
+	return p
+}
+
+// goPackages lists the modules built into a Go binary, along with the
+// standard library (which is how OSV tracks toolchain vulnerabilities).
+func goPackages(bi *debug.BuildInfo) []Package {
+	pkgs := []Package{{Type: "golang", Name: "stdlib", Version: strings.TrimPrefix(bi.GoVersion, "go")}}
+	if bi.Main.Path != "" {
+		pkgs = append(pkgs, goModule(&bi.Main))
+	}
+	for _, dep := range bi.Deps {
+		pkgs = append(pkgs, goModule(dep))
+	}
+	return pkgs
+}
@@ -0,0 +1,184 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/thesavant42/yolosint/internal/soci"
+
+	_ "modernc.org/sqlite"
+)
+
+// Header tags we care about, from rpmtag.h.
+const (
+	rpmTagName      = 1000
+	rpmTagVersion   = 1001
+	rpmTagRelease   = 1002
+	rpmTagEpoch     = 1003
+	rpmTagLicense   = 1014
+	rpmTagArch      = 1022
+	rpmTagSourceRPM = 1044
+)
+
+// And their types.
+const (
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// The purl spec wants the vendor, which isn't always the os-release ID.
+var rpmVendors = map[string]string{
+	"rhel": "redhat",
+	"ol":   "oracle",
+}
+
+// scanRPM reads the sqlite rpm database that Fedora 33, RHEL 9 and their
+// descendants use. The older BerkeleyDB and ndb formats aren't supported.
+func scanRPM(ctx context.Context, ff *soci.FlatFile, distro Distro) ([]Package, error) {
+	if ff.Size > MaxRPMSize {
+		return nil, fmt.Errorf("%d bytes is too big to read", ff.Size)
+	}
+	rc, err := ff.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// The sqlite driver wants a file.
+	tmp, err := os.CreateTemp("", "yolosint-*.rpmdb")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, io.LimitReader(rc, MaxRPMSize)); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	ns := distro.ID
+	if v, ok := rpmVendors[ns]; ok {
+		ns = v
+	}
+	return readRPMDB(ctx, tmp.Name(), ns)
+}
+
+// readRPMDB lists the packages in the rpmdb.sqlite at file.
+func readRPMDB(ctx context.Context, file, ns string) ([]Package, error) {
+	db, err := sql.Open("sqlite", "file:"+file+"?mode=ro&immutable=1&_pragma=query_only(1)")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT blob FROM Packages")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pkgs := []Package{}
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return pkgs, err
+		}
+		p, err := parseRPMHeader(blob)
+		if err != nil {
+			return pkgs, err
+		}
+		// Imported signing keys are stored as packages too.
+		if p.Name == "gpg-pubkey" {
+			continue
+		}
+		p.Namespace = ns
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, rows.Err()
+}
+
+// parseRPMHeader decodes the header blob that rpm stores for each
+// installed package: a count of index entries, the size of the data
+// store, the entries themselves (tag, type, offset, count) and the data.
+func parseRPMHeader(blob []byte) (Package, error) {
+	be := binary.BigEndian
+	if len(blob) < 8 {
+		return Package{}, fmt.Errorf("rpm header: too short")
+	}
+	il, dl := int64(be.Uint32(blob)), int64(be.Uint32(blob[4:]))
+	if 8+16*il+dl > int64(len(blob)) {
+		return Package{}, fmt.Errorf("rpm header: %d entries and %d bytes of data don't fit in %d bytes", il, dl, len(blob))
+	}
+	index, data := blob[8:8+16*il], blob[8+16*il:8+16*il+dl]
+
+	str := func(off uint32) string {
+		if int64(off) >= dl {
+			return ""
+		}
+		s := data[off:]
+		for i, c := range s {
+			if c == 0 {
+				return string(s[:i])
+			}
+		}
+		return string(s)
+	}
+
+	var (
+		p                Package
+		version, release string
+	)
+	p.Type = "rpm"
+	for i := int64(0); i < il; i++ {
+		e := index[16*i:]
+		tag, typ, off := be.Uint32(e), be.Uint32(e[4:]), be.Uint32(e[8:])
+
+		var s string
+		switch typ {
+		case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+			// The first string of an array is all we want.
+			s = str(off)
+		case rpmTypeInt32:
+			if int64(off)+4 > dl {
+				continue
+			}
+			s = strconv.FormatUint(uint64(be.Uint32(data[off:])), 10)
+		default:
+			continue
+		}
+
+		switch tag {
+		case rpmTagName:
+			p.Name = s
+		case rpmTagVersion:
+			version = s
+		case rpmTagRelease:
+			release = s
+		case rpmTagEpoch:
+			p.Epoch = s
+		case rpmTagLicense:
+			p.License = s
+		case rpmTagArch:
+			p.Arch = s
+		case rpmTagSourceRPM:
+			p.Source = s
+		}
+	}
+	if p.Name == "" {
+		return Package{}, fmt.Errorf("rpm header: no name")
+	}
+	p.Version = version
+	if release != "" {
+		p.Version += "-" + release
+	}
+	return p, nil
+}
@@ -0,0 +1,97 @@
+package osv
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CVSS v3 base metric weights, from the specification:
+// https://www.first.org/cvss/v3.1/specification-document#7-4-Metric-Values
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// CVSS3 computes the base score of a CVSS v3.0 or v3.1 vector, e.g.
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H" is 9.8.
+func CVSS3(vector string) (float64, error) {
+	parts := strings.Split(vector, "/")
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, fmt.Errorf("not a CVSS v3 vector: %q", vector)
+	}
+
+	w := map[string]float64{}
+	changed := false
+	for _, part := range parts[1:] {
+		k, v, _ := strings.Cut(part, ":")
+		if k == "S" {
+			changed = v == "C"
+			continue
+		}
+		if weights, ok := cvss3Weights[k]; ok {
+			weight, ok := weights[v]
+			if !ok {
+				return 0, fmt.Errorf("bad value %q for %s in %q", v, k, vector)
+			}
+			w[k] = weight
+		}
+	}
+	if len(w) != len(cvss3Weights) {
+		return 0, fmt.Errorf("missing base metrics in %q", vector)
+	}
+
+	// Privileges matter more when the scope changes.
+	if changed {
+		switch w["PR"] {
+		case 0.62:
+			w["PR"] = 0.68
+		case 0.27:
+			w["PR"] = 0.5
+		}
+	}
+
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, nil
+	}
+	exploitability := 8.22 * w["AV"] * w["AC"] * w["PR"] * w["UI"]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), nil
+}
+
+// roundUp is the "Roundup" of CVSS v3.1 appendix A, which avoids
+// floating point surprises like 4.000000001 becoming 4.1.
+func roundUp(x float64) float64 {
+	i := int64(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+// CVSSRating is the qualitative severity of a CVSS score.
+func CVSSRating(score float64) string {
+	switch {
+	case score == 0:
+		return "NONE"
+	case score < 4:
+		return "LOW"
+	case score < 7:
+		return "MEDIUM"
+	case score < 9:
+		return "HIGH"
+	}
+	return "CRITICAL"
+}
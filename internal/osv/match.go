@@ -0,0 +1,174 @@
+package osv
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/thesavant42/yolosint/internal/inventory"
+)
+
+// PackageName is name as osv_affected stores and looks it up in ecosystem.
+// OSV records use whatever the project calls itself ("PyYAML") while
+// inventories normalize, so PyPI names are compared the PEP 503 way.
+func PackageName(ecosystem, name string) string {
+	if ecosystem == "PyPI" {
+		return inventory.PyPIName(name)
+	}
+	return name
+}
+
+// Ecosystem returns where OSV files vulns for p, as found in an image of
+// distro, and the name and version to look for there. The ecosystem is ""
+// if OSV doesn't cover it. Distro ecosystems carry their release, e.g.
+// "Debian:12", and may be followed by more in OSV, e.g. "Ubuntu:22.04:LTS".
+func Ecosystem(p *inventory.Package, distro inventory.Distro) (ecosystem, name, version string) {
+	name, version = p.Name, p.Version
+
+	// Distros file vulns by source package.
+	source := name
+	if p.Source != "" {
+		source = p.Source
+	}
+
+	// "12.4" is Debian 12, "3.19.1" is Alpine v3.19.
+	release := func(parts int) string {
+		fields := strings.SplitN(distro.VersionID, ".", parts+1)
+		return strings.Join(fields[:min(parts, len(fields))], ".")
+	}
+	withRelease := func(eco, rel string) string {
+		if distro.VersionID == "" {
+			return eco
+		}
+		return eco + ":" + rel
+	}
+
+	switch p.Type {
+	case "golang":
+		if p.Namespace != "" {
+			name = p.Namespace + "/" + p.Name
+		}
+		return "Go", name, strings.TrimPrefix(version, "v")
+	case "npm":
+		if p.Namespace != "" {
+			name = p.Namespace + "/" + p.Name
+		}
+		return "npm", name, version
+	case "pypi":
+		return "PyPI", name, version
+	case "deb":
+		switch p.Namespace {
+		case "debian":
+			return withRelease("Debian", release(1)), source, version
+		case "ubuntu":
+			return withRelease("Ubuntu", distro.VersionID), source, version
+		}
+	case "apk":
+		switch p.Namespace {
+		case "alpine":
+			return withRelease("Alpine", "v"+release(2)), source, version
+		case "wolfi":
+			return "Wolfi", source, version
+		case "chainguard":
+			return "Chainguard", source, version
+		}
+	case "rpm":
+		if p.Epoch != "" && p.Epoch != "0" {
+			version = p.Epoch + ":" + version
+		}
+		switch p.Namespace {
+		case "rocky":
+			return withRelease("Rocky Linux", release(1)), name, version
+		case "almalinux":
+			return withRelease("AlmaLinux", release(1)), name, version
+		case "redhat":
+			return "Red Hat", name, version
+		case "opensuse-leap":
+			return withRelease("openSUSE:Leap", distro.VersionID), name, version
+		}
+	}
+	return "", name, version
+}
+
+// Affects reports whether version of the package in a is vulnerable, and
+// which versions fix it, if any.
+func Affects(a *Affected, version string) (bool, []string) {
+	if version == "" || version == "(devel)" {
+		return false, nil
+	}
+	cmp := comparer(a.Package.Ecosystem)
+
+	affected := slices.Contains(a.Versions, version)
+	var fixed []string
+	for _, r := range a.Ranges {
+		rcmp := cmp
+		switch r.Type {
+		case "SEMVER":
+			rcmp = compareSemver
+		case "ECOSYSTEM":
+		default:
+			// GIT ranges are commits, which we don't have.
+			continue
+		}
+		if inRange(r.Events, version, rcmp) {
+			affected = true
+			for _, e := range r.Events {
+				if e.Fixed != "" && rcmp(e.Fixed, version) > 0 {
+					fixed = append(fixed, e.Fixed)
+				}
+			}
+		}
+	}
+	if !affected {
+		return false, nil
+	}
+	slices.Sort(fixed)
+	return true, slices.Compact(fixed)
+}
+
+// inRange walks the events in version order, the way the OSV schema
+// describes, to see whether version ends up affected.
+func inRange(events []Event, version string, cmp compareFunc) bool {
+	at := func(e Event) string {
+		switch {
+		case e.Introduced != "":
+			return e.Introduced
+		case e.Fixed != "":
+			return e.Fixed
+		case e.LastAffected != "":
+			return e.LastAffected
+		}
+		return e.Limit
+	}
+	sorted := slices.Clone(events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := at(sorted[i]), at(sorted[j])
+		if a == "0" || b == "0" {
+			return a == "0" && b != "0"
+		}
+		return cmp(a, b) < 0
+	})
+
+	affected := false
+	for _, e := range sorted {
+		switch {
+		case e.Introduced != "":
+			if e.Introduced == "0" || cmp(version, e.Introduced) >= 0 {
+				affected = true
+			}
+		case e.Fixed != "":
+			if cmp(version, e.Fixed) >= 0 {
+				affected = false
+			}
+		case e.LastAffected != "":
+			if cmp(version, e.LastAffected) > 0 {
+				affected = false
+			}
+		case e.Limit != "":
+			if e.Limit != "*" && cmp(version, e.Limit) >= 0 {
+				affected = false
+			}
+		}
+	}
+	return affected
+}
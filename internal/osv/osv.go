@@ -0,0 +1,231 @@
+// Package osv reads vulnerability records in the OSV format
+// (https://ossf.github.io/osv-schema/) and matches package versions
+// against them, without going to the network.
+package osv
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Vuln is one OSV record, trimmed to what matching and display need.
+type Vuln struct {
+	ID               string     `json:"id"`
+	Modified         string     `json:"modified,omitempty"`
+	Withdrawn        string     `json:"withdrawn,omitempty"`
+	Aliases          []string   `json:"aliases,omitempty"`
+	Summary          string     `json:"summary,omitempty"`
+	Details          string     `json:"details,omitempty"`
+	Severity         []Severity `json:"severity,omitempty"`
+	Affected         []Affected `json:"affected,omitempty"`
+	DatabaseSpecific struct {
+		Severity any `json:"severity,omitempty"` // GitHub: "HIGH", "MODERATE", ...
+	} `json:"database_specific"`
+}
+
+// Severity is a score in some scoring system, e.g. a CVSS vector.
+type Severity struct {
+	Type  string `json:"type"`  // "CVSS_V3", "CVSS_V4", "Ubuntu", ...
+	Score string `json:"score"` // e.g. "CVSS:3.1/AV:N/AC:L/..."
+}
+
+// Affected is a package and the versions of it a vuln affects.
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"` // e.g. "Debian:12", "PyPI"
+		Name      string `json:"name"`
+		Purl      string `json:"purl,omitempty"`
+	} `json:"package"`
+	Severity []Severity `json:"severity,omitempty"`
+	Ranges   []Range    `json:"ranges,omitempty"`
+	Versions []string   `json:"versions,omitempty"`
+}
+
+// Range is a list of events that turn a vuln on and off as versions go up.
+type Range struct {
+	Type   string  `json:"type"` // "SEMVER", "ECOSYSTEM" or "GIT"
+	Events []Event `json:"events"`
+}
+
+// Event has exactly one field set.
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+// CVEs returns the CVE IDs of v, its own and its aliases.
+func (v *Vuln) CVEs() []string {
+	var cves []string
+	for _, id := range append([]string{v.ID}, v.Aliases...) {
+		if strings.HasPrefix(id, "CVE-") {
+			cves = append(cves, id)
+		}
+	}
+	return cves
+}
+
+// Title is the summary, or the first line of the details if there isn't one.
+func (v *Vuln) Title() string {
+	if v.Summary != "" {
+		return v.Summary
+	}
+	title, _, _ := strings.Cut(strings.TrimSpace(v.Details), "\n")
+	if r := []rune(title); len(r) > 200 {
+		title = string(r[:200]) + "…"
+	}
+	return title
+}
+
+// Rating sums up how bad v is, e.g. "CRITICAL 9.8" or "MODERATE", or ""
+// if it doesn't say.
+func (v *Vuln) Rating() string {
+	if s, ok := v.DatabaseSpecific.Severity.(string); ok && s != "" {
+		// GitHub's own word for it, with the score if there is one.
+		if score, ok := cvss3Score(v.Severity); ok {
+			return fmt.Sprintf("%s %.1f", strings.ToUpper(s), score)
+		}
+		return strings.ToUpper(s)
+	}
+	return Rating(v.Severity)
+}
+
+func cvss3Score(sevs []Severity) (float64, bool) {
+	for _, s := range sevs {
+		if s.Type == "CVSS_V3" {
+			if score, err := CVSS3(s.Score); err == nil {
+				return score, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Rating picks the most useful of sevs: a CVSS v3 score, computed from
+// its vector, or whatever the distro says.
+func Rating(sevs []Severity) string {
+	if score, ok := cvss3Score(sevs); ok {
+		return fmt.Sprintf("%s %.1f", CVSSRating(score), score)
+	}
+	for _, s := range sevs {
+		switch s.Type {
+		case "CVSS_V2", "CVSS_V3", "CVSS_V4":
+		default:
+			return strings.ToUpper(s.Score)
+		}
+	}
+	if len(sevs) != 0 {
+		// A vector we don't score, but better than nothing.
+		return sevs[0].Score
+	}
+	return ""
+}
+
+// Read calls fn with every record in path, which can be a JSON file (one
+// record or an array of them), a zip of JSON files like the ones at
+// https://osv-vulnerabilities.storage.googleapis.com/<ecosystem>/all.zip,
+// or a directory of either.
+func Read(path string, fn func(*Vuln) error) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".json", ".zip":
+				return Read(p, fn)
+			}
+			return nil
+		})
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if !strings.EqualFold(filepath.Ext(f.Name), ".json") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = decode(rc, fn)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", path, f.Name, err)
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := decode(f, fn); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// decode reads a record, or an array of them, from r.
+func decode(r io.Reader, fn func(*Vuln) error) error {
+	br := bufio.NewReader(r)
+	var first byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			first = c
+			br.UnreadByte()
+			break
+		}
+	}
+
+	dec := json.NewDecoder(br)
+	switch first {
+	case '{':
+		v := &Vuln{}
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+		return fn(v)
+	case '[':
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		for dec.More() {
+			v := &Vuln{}
+			if err := dec.Decode(v); err != nil {
+				return err
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("expected an OSV record or an array of them")
+}
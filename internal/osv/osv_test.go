@@ -0,0 +1,220 @@
+package osv
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/thesavant42/yolosint/internal/inventory"
+)
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		cmp  compareFunc
+		a, b string
+		want int
+	}{
+		{compareDpkg, "1.2.3-1", "1.2.3-2", -1},
+		{compareDpkg, "1:1.0", "2.0", 1},
+		{compareDpkg, "1.0~rc1", "1.0", -1},
+		{compareDpkg, "2.36-9+deb12u4", "2.36-9+deb12u3", 1},
+		{compareDpkg, "1.0a", "1.0+", -1},
+		{compareDpkg, "1.010", "1.9", 1},
+		{compareRPM, "5.2.15-5.fc39", "5.2.15-10.fc39", -1},
+		{compareRPM, "1:1.0-1", "2.0-1", 1},
+		{compareRPM, "1.0~beta-1", "1.0-1", -1},
+		{compareRPM, "1.0^git1-1", "1.0-1", 1},
+		{compareRPM, "3.0.7-17.el9", "3.0.7", 0},
+		{compareAPK, "1.2.4-r2", "1.2.4-r10", -1},
+		{compareAPK, "1.36.1_rc1-r0", "1.36.1-r0", -1},
+		{compareAPK, "1.36.1_p2-r0", "1.36.1-r5", 1},
+		{compareAPK, "1.2.10", "1.2.9", 1},
+		{compareAPK, "3.0.12a-r0", "3.0.12-r0", 1},
+		{compareSemver, "v0.18.0", "0.17.1", 1},
+		{compareSemver, "1.22.0-0", "1.22.0", -1},
+		{compareSemver, "1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{compareSemver, "0.0.0-20230101-abcdef", "0.0.0-20240101-abcdef", -1},
+		{compareSemver, "2", "2.0.0", 0},
+		{comparePEP440, "1.0.dev1", "1.0a1", -1},
+		{comparePEP440, "1.0rc1", "1.0", -1},
+		{comparePEP440, "1.0", "1.0.post1", -1},
+		{comparePEP440, "1.0", "1.0.0", 0},
+		{comparePEP440, "2.31.0", "2.4.0", 1},
+		{comparePEP440, "1!0.1", "2.0", 1},
+	} {
+		if got := tc.cmp(tc.a, tc.b); got != tc.want {
+			t.Errorf("compare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := tc.cmp(tc.b, tc.a); got != -tc.want {
+			t.Errorf("compare(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestAffects(t *testing.T) {
+	a := &Affected{}
+	a.Package.Ecosystem = "Debian:12"
+	a.Ranges = []Range{{Type: "ECOSYSTEM", Events: []Event{
+		{Introduced: "0"}, {Fixed: "3.0.11-1~deb12u2"},
+	}}}
+	for _, tc := range []struct {
+		version string
+		want    bool
+	}{
+		{"3.0.11-1~deb12u1", true},
+		{"3.0.11-1~deb12u2", false},
+		{"3.0.13-1~deb12u1", false},
+		{"", false},
+	} {
+		got, fixed := Affects(a, tc.version)
+		if got != tc.want {
+			t.Errorf("Affects(%q) = %v, want %v", tc.version, got, tc.want)
+		}
+		if got && !slices.Equal(fixed, []string{"3.0.11-1~deb12u2"}) {
+			t.Errorf("Affects(%q) fixed = %v", tc.version, fixed)
+		}
+	}
+
+	// Two ranges of a Go module, the second with no fix.
+	g := &Affected{}
+	g.Package.Ecosystem = "Go"
+	g.Ranges = []Range{{Type: "SEMVER", Events: []Event{
+		{Introduced: "0"}, {Fixed: "0.17.0"}, {Introduced: "0.18.0"}, {LastAffected: "0.18.2"},
+	}}}
+	for _, tc := range []struct {
+		version string
+		want    bool
+	}{
+		{"0.16.0", true},
+		{"0.17.1", false},
+		{"0.18.1", true},
+		{"0.18.2", true},
+		{"0.18.3", false},
+	} {
+		if got, _ := Affects(g, tc.version); got != tc.want {
+			t.Errorf("Affects(Go %q) = %v, want %v", tc.version, got, tc.want)
+		}
+	}
+
+	// PyPI often just lists the versions.
+	p := &Affected{Versions: []string{"2.0.0", "2.0.1"}}
+	p.Package.Ecosystem = "PyPI"
+	if got, _ := Affects(p, "2.0.1"); !got {
+		t.Errorf("Affects(listed version) = false")
+	}
+}
+
+func TestTitle(t *testing.T) {
+	long := strings.Repeat("é", 250)
+	for _, tc := range []struct {
+		v    Vuln
+		want string
+	}{
+		{Vuln{Summary: "bad thing", Details: "more"}, "bad thing"},
+		{Vuln{Details: "\nfirst line\nsecond line"}, "first line"},
+		{Vuln{Details: long}, strings.Repeat("é", 200) + "…"},
+	} {
+		got := tc.v.Title()
+		if got != tc.want {
+			t.Errorf("Title() = %q, want %q", got, tc.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("Title() = %q, not UTF-8", got)
+		}
+	}
+}
+
+func TestEcosystem(t *testing.T) {
+	for _, tc := range []struct {
+		pkg    inventory.Package
+		distro inventory.Distro
+		want   [3]string
+	}{
+		{inventory.Package{Type: "deb", Namespace: "debian", Name: "libssl3", Source: "openssl", Version: "3.0.11-1~deb12u2"},
+			inventory.Distro{ID: "debian", VersionID: "12"}, [3]string{"Debian:12", "openssl", "3.0.11-1~deb12u2"}},
+		{inventory.Package{Type: "apk", Namespace: "alpine", Name: "libcrypto3", Source: "openssl", Version: "3.1.4-r5"},
+			inventory.Distro{ID: "alpine", VersionID: "3.19.1"}, [3]string{"Alpine:v3.19", "openssl", "3.1.4-r5"}},
+		{inventory.Package{Type: "deb", Namespace: "ubuntu", Name: "bash", Version: "5.1-6ubuntu1"},
+			inventory.Distro{ID: "ubuntu", VersionID: "22.04"}, [3]string{"Ubuntu:22.04", "bash", "5.1-6ubuntu1"}},
+		{inventory.Package{Type: "rpm", Namespace: "rocky", Name: "openssl", Epoch: "1", Version: "3.0.7-25.el9"},
+			inventory.Distro{ID: "rocky", VersionID: "9.3"}, [3]string{"Rocky Linux:9", "openssl", "1:3.0.7-25.el9"}},
+		{inventory.Package{Type: "golang", Namespace: "golang.org/x", Name: "net", Version: "v0.17.0"},
+			inventory.Distro{}, [3]string{"Go", "golang.org/x/net", "0.17.0"}},
+		{inventory.Package{Type: "npm", Namespace: "@babel", Name: "traverse", Version: "7.23.0"},
+			inventory.Distro{}, [3]string{"npm", "@babel/traverse", "7.23.0"}},
+		{inventory.Package{Type: "rpm", Namespace: "fedora", Name: "bash", Version: "5.2.15-5.fc39"},
+			inventory.Distro{ID: "fedora", VersionID: "39"}, [3]string{"", "bash", "5.2.15-5.fc39"}},
+	} {
+		eco, name, version := Ecosystem(&tc.pkg, tc.distro)
+		if got := [3]string{eco, name, version}; got != tc.want {
+			t.Errorf("Ecosystem(%+v) = %q, want %q", tc.pkg, got, tc.want)
+		}
+	}
+}
+
+func TestCVSS3(t *testing.T) {
+	for _, tc := range []struct {
+		vector string
+		want   float64
+	}{
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", 10.0},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", 6.1},
+		{"CVSS:3.0/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:N/A:N", 5.5},
+		{"CVSS:3.1/AV:N/AC:H/PR:N/UI:N/S:U/C:N/I:N/A:N", 0},
+	} {
+		got, err := CVSS3(tc.vector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("CVSS3(%q) = %v, want %v", tc.vector, got, tc.want)
+		}
+	}
+	if _, err := CVSS3("CVSS:3.1/AV:N/AC:L"); err == nil {
+		t.Errorf("no error for a partial vector")
+	}
+
+	v := &Vuln{Severity: []Severity{{"CVSS_V3", "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}}}
+	if got := v.Rating(); got != "CRITICAL 9.8" {
+		t.Errorf("Rating() = %q", got)
+	}
+	v.DatabaseSpecific.Severity = "moderate"
+	if got := v.Rating(); got != "MODERATE 9.8" {
+		t.Errorf("Rating() = %q", got)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	one := `{"id": "GHSA-1", "aliases": ["CVE-2024-0001"], "affected": [{"package": {"ecosystem": "npm", "name": "left-pad"}}]}`
+	many := `[{"id": "CVE-2024-0002"}, {"id": "CVE-2024-0003"}]`
+	os.WriteFile(filepath.Join(dir, "one.json"), []byte(one), 0644)
+	os.WriteFile(filepath.Join(dir, "many.json"), []byte("\n"+many), 0644)
+
+	zf, err := os.Create(filepath.Join(dir, "all.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zf)
+	w, _ := zw.Create("DSA-1.json")
+	w.Write([]byte(`{"id": "DSA-1"}`))
+	zw.Close()
+	zf.Close()
+
+	var ids []string
+	if err := Read(dir, func(v *Vuln) error {
+		ids = append(ids, v.ID)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	if want := []string{"CVE-2024-0002", "CVE-2024-0003", "DSA-1", "GHSA-1"}; !slices.Equal(ids, want) {
+		t.Errorf("Read() = %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,415 @@
+package osv
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// compareFunc orders two versions like strings.Compare.
+type compareFunc func(a, b string) int
+
+// comparer returns how versions are ordered in ecosystem, e.g. "Debian:12".
+func comparer(ecosystem string) compareFunc {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	switch base {
+	case "Debian", "Ubuntu":
+		return compareDpkg
+	case "Alpine", "Wolfi", "Chainguard":
+		return compareAPK
+	case "Red Hat", "Rocky Linux", "AlmaLinux", "openSUSE", "SUSE", "Mageia", "Photon OS", "openEuler":
+		return compareRPM
+	case "PyPI":
+		return comparePEP440
+	case "Go", "npm", "crates.io", "NuGet", "Hex", "Pub", "Packagist", "RubyGems":
+		return compareSemver
+	}
+	// rpm's comparison is a decent guess at anything else.
+	return rpmvercmp
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isAlpha(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// compareNumeric compares two runs of digits without parsing them, so
+// there's no overflow on long dates and hashes.
+func compareNumeric(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// compareDpkg orders [epoch:]upstream[-revision] like dpkg --compare-versions.
+func compareDpkg(a, b string) int {
+	ea, ua, ra := splitDpkg(a)
+	eb, ub, rb := splitDpkg(b)
+	if c := compareNumeric(ea, eb); c != 0 {
+		return c
+	}
+	if c := verrevcmp(ua, ub); c != 0 {
+		return c
+	}
+	return verrevcmp(ra, rb)
+}
+
+func splitDpkg(v string) (epoch, upstream, revision string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		epoch, v = e, rest
+	}
+	if i := strings.LastIndexByte(v, '-'); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// dpkgOrder sorts ~ before everything, even the end of the string, and
+// letters before other symbols.
+func dpkgOrder(s string) int {
+	if s == "" {
+		return 0
+	}
+	c := s[0]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+// verrevcmp is dpkg's lib/dpkg/version.c.
+func verrevcmp(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			if c := dpkgOrder(a) - dpkgOrder(b); c != 0 {
+				return sign(c)
+			}
+			if a != "" {
+				a = a[1:]
+			}
+			if b != "" {
+				b = b[1:]
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if c := compareNumeric(a[:i], b[:j]); c != 0 {
+			return c
+		}
+		a, b = a[i:], b[j:]
+	}
+	return 0
+}
+
+// compareRPM orders [epoch:]version[-release] like rpm.
+func compareRPM(a, b string) int {
+	ea, va, ra := splitDpkg(a)
+	eb, vb, rb := splitDpkg(b)
+	if c := compareNumeric(ea, eb); c != 0 {
+		return c
+	}
+	if c := rpmvercmp(va, vb); c != 0 {
+		return c
+	}
+	if ra == "" || rb == "" {
+		// A missing release matches any release.
+		return 0
+	}
+	return rpmvercmp(ra, rb)
+}
+
+// rpmvercmp is rpm's rpmio/rpmvercmp.c: alternating runs of digits and
+// letters, with ~ sorting before anything and ^ after.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSep := func(c byte) bool { return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^' }
+	for a != "" || b != "" {
+		for a != "" && isSep(a[0]) {
+			a = a[1:]
+		}
+		for b != "" && isSep(b[0]) {
+			b = b[1:]
+		}
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		run := isAlpha
+		if isDigit(a[0]) {
+			run = isDigit
+		}
+		i, j := 0, 0
+		for i < len(a) && run(a[i]) {
+			i++
+		}
+		for j < len(b) && run(b[j]) {
+			j++
+		}
+		if j == 0 {
+			// Numbers are newer than letters.
+			if isDigit(a[0]) {
+				return 1
+			}
+			return -1
+		}
+		var c int
+		if isDigit(a[0]) {
+			c = compareNumeric(a[:i], b[:j])
+		} else {
+			c = strings.Compare(a[:i], b[:j])
+		}
+		if c != 0 {
+			return c
+		}
+		a, b = a[i:], b[j:]
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	}
+	return 1
+}
+
+// apkSuffixes in order; a version without one sorts between rc and cvs.
+var apkSuffixes = map[string]int{
+	"alpha": -4, "beta": -3, "pre": -2, "rc": -1,
+	"cvs": 1, "svn": 2, "git": 3, "hg": 4, "p": 5,
+}
+
+var apkVersion = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)*)([a-z]?)((?:_[a-z]+[0-9]*)*)(?:-r([0-9]+))?$`)
+
+// compareAPK orders versions like apk-tools: dotted numbers, an optional
+// letter, _suffixes and a -rN package release.
+func compareAPK(a, b string) int {
+	ma, mb := apkVersion.FindStringSubmatch(a), apkVersion.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return rpmvercmp(a, b)
+	}
+
+	na, nb := strings.Split(ma[1], "."), strings.Split(mb[1], ".")
+	for i := 0; i < len(na) && i < len(nb); i++ {
+		if c := compareNumeric(na[i], nb[i]); c != 0 {
+			return c
+		}
+	}
+	if len(na) != len(nb) {
+		return sign(len(na) - len(nb))
+	}
+	if c := strings.Compare(ma[2], mb[2]); c != 0 {
+		return c
+	}
+
+	sa, sb := strings.Split(ma[3], "_")[1:], strings.Split(mb[3], "_")[1:]
+	for i := 0; i < len(sa) || i < len(sb); i++ {
+		var ra, rb int
+		var numa, numb string
+		if i < len(sa) {
+			name := strings.TrimRight(sa[i], "0123456789")
+			ra, numa = apkSuffixes[name], sa[i][len(name):]
+		}
+		if i < len(sb) {
+			name := strings.TrimRight(sb[i], "0123456789")
+			rb, numb = apkSuffixes[name], sb[i][len(name):]
+		}
+		if ra != rb {
+			return sign(ra - rb)
+		}
+		if c := compareNumeric(numa, numb); c != 0 {
+			return c
+		}
+	}
+
+	return compareNumeric(ma[4], mb[4])
+}
+
+// compareSemver orders semantic versions, with or without a leading v.
+// Missing minor and patch numbers count as 0; build metadata is ignored.
+func compareSemver(a, b string) int {
+	a, _, _ = strings.Cut(strings.TrimPrefix(a, "v"), "+")
+	b, _, _ = strings.Cut(strings.TrimPrefix(b, "v"), "+")
+	ca, pa, hasPa := strings.Cut(a, "-")
+	cb, pb, hasPb := strings.Cut(b, "-")
+
+	na, nb := strings.Split(ca, "."), strings.Split(cb, ".")
+	for i := 0; i < 3; i++ {
+		var x, y string
+		if i < len(na) {
+			x = na[i]
+		}
+		if i < len(nb) {
+			y = nb[i]
+		}
+		if c := compareNumeric(x, y); c != 0 {
+			return c
+		}
+	}
+
+	// A pre-release comes before the release.
+	switch {
+	case !hasPa && !hasPb:
+		return 0
+	case !hasPa:
+		return 1
+	case !hasPb:
+		return -1
+	}
+	ia, ib := strings.Split(pa, "."), strings.Split(pb, ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		x, y := ia[i], ib[i]
+		xn, yn := isNumber(x), isNumber(y)
+		var c int
+		switch {
+		case xn && yn:
+			c = compareNumeric(x, y)
+		case xn:
+			c = -1
+		case yn:
+			c = 1
+		default:
+			c = strings.Compare(x, y)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return sign(len(ia) - len(ib))
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+var pep440 = regexp.MustCompile(`^v?(?:([0-9]+)!)?([0-9]+(?:\.[0-9]+)*)` +
+	`(?:[-_.]?(a|alpha|b|beta|c|rc|pre|preview)[-_.]?([0-9]*))?` +
+	`(?:-([0-9]+)|[-_.]?(post|rev|r)[-_.]?([0-9]*))?` +
+	`(?:[-_.]?(dev)[-_.]?([0-9]*))?` +
+	`(?:\+[a-z0-9.]*)?$`)
+
+// comparePEP440 orders Python versions, see
+// https://packaging.python.org/en/latest/specifications/version-specifiers/
+func comparePEP440(a, b string) int {
+	ma := pep440.FindStringSubmatch(strings.ToLower(strings.TrimSpace(a)))
+	mb := pep440.FindStringSubmatch(strings.ToLower(strings.TrimSpace(b)))
+	if ma == nil || mb == nil {
+		return rpmvercmp(a, b)
+	}
+	if c := compareNumeric(ma[1], mb[1]); c != 0 {
+		return c
+	}
+
+	// 1.0 == 1.0.0
+	ra, rb := strings.Split(ma[2], "."), strings.Split(mb[2], ".")
+	for i := 0; i < len(ra) || i < len(rb); i++ {
+		var x, y string
+		if i < len(ra) {
+			x = ra[i]
+		}
+		if i < len(rb) {
+			y = rb[i]
+		}
+		if c := compareNumeric(x, y); c != 0 {
+			return c
+		}
+	}
+
+	ka, kb := pep440Key(ma), pep440Key(mb)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return sign(ka[i] - kb[i])
+		}
+	}
+	return 0
+}
+
+// pep440Key orders what follows the release: 1.0.dev1 < 1.0a1 < 1.0rc1 <
+// 1.0 < 1.0.post1, each with an optional .devN of its own.
+func pep440Key(m []string) [6]int {
+	num := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	var k [6]int
+
+	pre := m[3]
+	post := m[5] != "" || m[6] != ""
+	dev := m[8] != ""
+	switch {
+	case pre != "":
+		k[0] = map[string]int{"a": 1, "alpha": 1, "b": 2, "beta": 2, "c": 3, "rc": 3, "pre": 3, "preview": 3}[pre]
+		k[1] = num(m[4])
+	case dev && !post:
+		k[0] = 0
+	default:
+		k[0] = 4
+	}
+	if post {
+		k[2] = 1
+		k[3] = num(m[5] + m[7])
+	}
+	if dev {
+		k[5] = num(m[9])
+	} else {
+		k[4] = 1
+	}
+	return k
+}
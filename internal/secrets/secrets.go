@@ -0,0 +1,329 @@
+// Package secrets finds credentials that were left behind in image layers.
+package secrets
+
+import (
+	"bytes"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxFileSize is the largest file worth pulling out of a layer to scan.
+const MaxFileSize = 1 << 20
+
+// Finding is a single secret in a single file.
+type Finding struct {
+	Rule    string `json:"rule"`
+	Offset  int64  `json:"offset"`  // byte offset of the secret within the file
+	Preview string `json:"preview"` // surrounding line with the secret redacted
+}
+
+// Rule is a built-in detector.
+type Rule struct {
+	ID          string
+	Description string
+
+	re *regexp.Regexp
+	// Submatch that holds the secret itself, 0 means the match isn't
+	// sensitive on its own (e.g. a PEM header) and is shown as-is.
+	group int
+	// If set, only files for which this returns true are checked.
+	match func(name string) bool
+}
+
+// Rules are checked in order against every candidate file.
+var Rules = []Rule{{
+	ID:          "aws-access-key-id",
+	Description: "AWS access key ID",
+	re:          regexp.MustCompile(`\b((?:AKIA|ASIA|ABIA|ACCA|A3T[A-Z0-9])[A-Z2-7]{16})\b`),
+	group:       1,
+}, {
+	ID:          "aws-secret-access-key",
+	Description: "AWS secret access key",
+	re:          regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`),
+	group:       1,
+}, {
+	ID:          "gcp-service-account",
+	Description: "GCP service account key",
+	re:          regexp.MustCompile(`"private_key_id"\s*:\s*"([0-9a-f]{40})"`),
+	group:       1,
+}, {
+	ID:          "gcp-api-key",
+	Description: "Google API key",
+	re:          regexp.MustCompile(`\b(AIza[0-9A-Za-z_\-]{35})`),
+	group:       1,
+}, {
+	ID:          "azure-storage-key",
+	Description: "Azure storage account key",
+	re:          regexp.MustCompile(`(?i)AccountKey=([A-Za-z0-9+/]{86}==)`),
+	group:       1,
+}, {
+	ID:          "azure-shared-access-key",
+	Description: "Azure shared access key",
+	re:          regexp.MustCompile(`(?i)SharedAccessKey=([A-Za-z0-9+/]{42,}=?)`),
+	group:       1,
+}, {
+	ID:          "private-key",
+	Description: "PEM private key",
+	re:          regexp.MustCompile(`-----BEGIN (?:RSA |DSA |EC |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`),
+}, {
+	ID:          "jwt",
+	Description: "JSON web token",
+	re:          regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`),
+	group:       1,
+}, {
+	ID:          "npmrc-auth",
+	Description: "npm registry credentials",
+	re:          regexp.MustCompile(`(?m)_(?:authToken|auth|password)\s*=\s*["']?([^\s"']+)`),
+	group:       1,
+	match:       baseIs(".npmrc"),
+}, {
+	ID:          "pypirc-password",
+	Description: "PyPI credentials",
+	re:          regexp.MustCompile(`(?m)^\s*password\s*[:=]\s*(\S+)`),
+	group:       1,
+	match:       baseIs(".pypirc"),
+}, {
+	ID:          "docker-config-auth",
+	Description: "Docker registry credentials",
+	re:          regexp.MustCompile(`"(?:auth|identitytoken)"\s*:\s*"([A-Za-z0-9+/=._-]{4,})"`),
+	group:       1,
+	match:       isDockerConfig,
+}, {
+	ID:          "dotenv-secret",
+	Description: "Secret in a .env file",
+	re:          regexp.MustCompile(`(?mi)^[ \t]*(?:export[ \t]+)?[A-Z0-9_]*(?:SECRET|PASSWORD|PASSWD|TOKEN|API_?KEY|PRIVATE_?KEY|ACCESS_?KEY|CREDENTIALS?)[A-Z0-9_]*[ \t]*=[ \t]*["']?([^\s"'#]{4,})`),
+	group:       1,
+	match:       isDotenv,
+}}
+
+// EntropyRule is reported for long random-looking strings assigned to
+// something that sounds secret, when no other rule matched them.
+const EntropyRule = "high-entropy-string"
+
+var (
+	entropyToken = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{32,}`)
+	entropyHint  = regexp.MustCompile(`(?i)(secret|passw|pwd|token|auth|credential|api_?key|access_?key|private)`)
+)
+
+// Hex tops out at 4 bits per character, so this also skips checksums.
+const entropyThreshold = 4.5
+
+func baseIs(want string) func(string) bool {
+	return func(name string) bool {
+		return path.Base(name) == want
+	}
+}
+
+func isDockerConfig(name string) bool {
+	return path.Base(name) == "config.json" && path.Base(path.Dir(name)) == ".docker"
+}
+
+func isDotenv(name string) bool {
+	base := path.Base(name)
+	return base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env")
+}
+
+// Files that are interesting no matter where they live.
+var secretFiles = map[string]bool{
+	".npmrc":           true,
+	".pypirc":          true,
+	".netrc":           true,
+	".git-credentials": true,
+	".htpasswd":        true,
+	".pgpass":          true,
+	"credentials":      true,
+	"id_rsa":           true,
+	"id_dsa":           true,
+	"id_ecdsa":         true,
+	"id_ed25519":       true,
+	"wp-config.php":    true,
+}
+
+// Text formats where secrets tend to be pasted.
+var scanExts = map[string]bool{
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true,
+	".cfg": true, ".conf": true, ".config": true, ".properties": true, ".xml": true,
+	".env": true, ".tf": true, ".tfvars": true, ".txt": true, ".pem": true, ".key": true,
+	".sh": true, ".bash": true, ".zsh": true, ".ps1": true,
+	".py": true, ".js": true, ".mjs": true, ".cjs": true, ".ts": true, ".rb": true,
+	".php": true, ".go": true, ".java": true, ".cs": true,
+}
+
+// Lockfiles are full of base64 integrity hashes.
+var skipFiles = map[string]bool{
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"pnpm-lock.yaml":    true,
+	"go.sum":            true,
+	"Cargo.lock":        true,
+	"poetry.lock":       true,
+	"composer.lock":     true,
+	"Gemfile.lock":      true,
+}
+
+// Vendored and distro-owned trees are huge and almost never interesting.
+var skipDirs = []string{
+	"usr/share/", "usr/include/", "usr/lib/", "usr/lib64/", "usr/libexec/", "lib/", "lib64/",
+	"var/lib/dpkg/", "var/lib/apk/", "var/lib/rpm/", "var/cache/", "etc/ssl/certs/", "proc/", "sys/",
+}
+
+var skipSegments = []string{"/node_modules/", "/site-packages/", "/dist-packages/", "/go/pkg/mod/", "/.cache/"}
+
+// Candidate reports whether a file from a layer's TOC is worth extracting.
+func Candidate(name string, size int64) bool {
+	if size <= 0 || size > MaxFileSize {
+		return false
+	}
+	name = strings.TrimLeft(strings.TrimPrefix(name, "./"), "/")
+	base := path.Base(name)
+
+	if secretFiles[base] || isDotenv(name) || isDockerConfig(name) {
+		return true
+	}
+	if skipFiles[base] {
+		return false
+	}
+	for _, dir := range skipDirs {
+		if strings.HasPrefix(name, dir) {
+			return false
+		}
+	}
+	for _, seg := range skipSegments {
+		if strings.Contains("/"+name, seg) {
+			return false
+		}
+	}
+	return scanExts[path.Ext(base)]
+}
+
+// Scan runs every rule that applies to name against its contents.
+func Scan(name string, data []byte) []Finding {
+	name = strings.TrimLeft(strings.TrimPrefix(name, "./"), "/")
+
+	// Don't bother with binaries.
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) != -1 {
+		return nil
+	}
+
+	findings := []Finding{}
+	spans := [][2]int{}
+	for _, rule := range Rules {
+		if rule.match != nil && !rule.match(name) {
+			continue
+		}
+		for _, m := range rule.re.FindAllSubmatchIndex(data, -1) {
+			start, end := m[2*rule.group], m[2*rule.group+1]
+			if start < 0 {
+				continue
+			}
+			spans = append(spans, [2]int{start, end})
+			findings = append(findings, Finding{
+				Rule:    rule.ID,
+				Offset:  int64(start),
+				Preview: preview(data, start, end, rule.group != 0),
+			})
+		}
+	}
+
+	for _, m := range entropyToken.FindAllIndex(data, -1) {
+		start, end := m[0], m[1]
+		if overlaps(spans, start, end) {
+			continue
+		}
+		line := lineAt(data, start)
+		if !entropyHint.Match(line) {
+			continue
+		}
+		// Subresource integrity and friends, e.g. "sha512-...".
+		if prefix := data[max(0, start-7):start]; bytes.Contains(prefix, []byte("sha")) {
+			continue
+		}
+		if Entropy(data[start:end]) < entropyThreshold {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:    EntropyRule,
+			Offset:  int64(start),
+			Preview: preview(data, start, end, true),
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Offset < findings[j].Offset
+	})
+	return findings
+}
+
+func overlaps(spans [][2]int, start, end int) bool {
+	for _, s := range spans {
+		if start < s[1] && s[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// Entropy returns the Shannon entropy of b in bits per byte.
+func Entropy(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+	counts := [256]int{}
+	for _, c := range b {
+		counts[c]++
+	}
+	e := 0.0
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / float64(len(b))
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+func lineAt(data []byte, off int) []byte {
+	start := bytes.LastIndexByte(data[:off], '\n') + 1
+	end := bytes.IndexByte(data[off:], '\n')
+	if end == -1 {
+		end = len(data)
+	} else {
+		end += off
+	}
+	return data[start:end]
+}
+
+// Keep previews to a single, reasonably short line.
+const previewContext = 40
+
+func preview(data []byte, start, end int, sensitive bool) string {
+	lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+	lineStart = max(lineStart, start-previewContext)
+
+	lineEnd := bytes.IndexByte(data[end:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(data)
+	} else {
+		lineEnd += end
+	}
+	lineEnd = min(lineEnd, end+previewContext)
+
+	secret := string(data[start:end])
+	if sensitive {
+		secret = Redact(secret)
+	}
+	s := string(data[lineStart:start]) + secret + string(data[end:lineEnd])
+	return strings.TrimSpace(strings.ToValidUTF8(s, "?"))
+}
+
+// Redact keeps just enough of a secret to recognize it.
+func Redact(s string) string {
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + strings.Repeat("*", min(len(s)-6, 16)) + s[len(s)-2:]
+}
@@ -0,0 +1,168 @@
+package soci
+
+import (
+	"bytes"
+	"encoding/binary"
+	"runtime/debug"
+	"strings"
+)
+
+// Go binaries carry their build info (toolchain, modules, build settings)
+// in a blob that starts with this magic, see debug/buildinfo.
+var goBuildInfoMagic = []byte("\xff Go buildinf:")
+
+const (
+	goBuildInfoHeader = 32
+	maxGoModInfo      = 1 << 20
+)
+
+// GoSniffer looks for Go build info in the bytes written to it, so it can
+// be found while a file streams past rather than by seeking around in it.
+// It only looks in files that start like an ELF, PE or Mach-O executable.
+//
+// Only the inline format that Go 1.18 and later write can be decoded this
+// way; older binaries are recognized, see Old.
+type GoSniffer struct {
+	head []byte // first four bytes
+	tail []byte // end of the last write, in case the magic straddles two
+	buf  []byte // from a candidate magic onwards
+	done bool
+
+	// Set once found.
+	Version string // e.g. "go1.22.1"
+	ModInfo string // runtime/debug.BuildInfo text, without the sentinels
+	Old     bool   // found, but in the pre-1.18 format
+}
+
+func (g *GoSniffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(g.head) < 4 {
+		k := min(4-len(g.head), len(p))
+		g.head = append(g.head, p[:k]...)
+		if len(g.head) < 4 {
+			return n, nil
+		}
+		if !isExecutable(g.head) {
+			g.done = true
+		}
+	}
+	g.feed(p)
+	return n, nil
+}
+
+// Found reports whether build info was seen.
+func (g *GoSniffer) Found() bool {
+	return g.Version != "" || g.Old
+}
+
+// BuildInfo parses the module info, if any was found.
+func (g *GoSniffer) BuildInfo() (*debug.BuildInfo, error) {
+	bi, err := debug.ParseBuildInfo(g.ModInfo)
+	if err != nil {
+		return nil, err
+	}
+	bi.GoVersion = g.Version
+	return bi, nil
+}
+
+func isExecutable(head []byte) bool {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")), bytes.HasPrefix(head, []byte("MZ")):
+		return true
+	}
+	switch binary.BigEndian.Uint32(head) {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe, 0xcafebabe:
+		return true
+	}
+	return false
+}
+
+func (g *GoSniffer) feed(p []byte) {
+	for len(p) > 0 && !g.done {
+		if g.buf == nil {
+			start := -1
+			// Check whether the magic straddles the last write and this one first.
+			joined := append(g.tail, p[:min(len(p), len(goBuildInfoMagic)-1)]...)
+			if i := bytes.Index(joined, goBuildInfoMagic); i >= 0 {
+				g.buf = append([]byte{}, joined[i:]...)
+				start = len(joined) - len(g.tail)
+			} else if i := bytes.Index(p, goBuildInfoMagic); i >= 0 {
+				start = i
+			}
+			if start < 0 {
+				if keep := len(goBuildInfoMagic) - 1; len(p) >= keep {
+					g.tail = append(g.tail[:0], p[len(p)-keep:]...)
+				} else {
+					g.tail = append(g.tail, p...)
+					g.tail = g.tail[max(0, len(g.tail)-keep):]
+				}
+				return
+			}
+			g.buf = append(g.buf, p[start:]...)
+		} else {
+			g.buf = append(g.buf, p...)
+		}
+		p = nil
+
+		switch g.check() {
+		case checkMore:
+			return
+		case checkOK:
+			g.buf = nil
+			g.done = true
+			return
+		case checkBad:
+			// Probably the magic as a string in the program itself; look further on.
+			p = g.buf[1:]
+			g.buf, g.tail = nil, nil
+		}
+	}
+}
+
+const (
+	checkMore = iota
+	checkOK
+	checkBad
+)
+
+func (g *GoSniffer) check() int {
+	if len(g.buf) < goBuildInfoHeader {
+		return checkMore
+	}
+	ptrSize, flags := g.buf[14], g.buf[15]
+	if ptrSize != 4 && ptrSize != 8 {
+		return checkBad
+	}
+	if flags&2 == 0 {
+		// Pre-1.18: the header holds pointers into the data segment.
+		g.Old = true
+		return checkOK
+	}
+
+	data := g.buf[goBuildInfoHeader:]
+	var strs [2]string
+	for i := range strs {
+		l, n := binary.Uvarint(data)
+		if n == 0 {
+			return checkMore
+		}
+		if n < 0 || l > maxGoModInfo {
+			return checkBad
+		}
+		if uint64(len(data)-n) < l {
+			return checkMore
+		}
+		strs[i] = string(data[n : n+int(l)])
+		data = data[n+int(l):]
+	}
+	if !strings.HasPrefix(strs[0], "go") && !strings.HasPrefix(strs[0], "devel") {
+		return checkBad
+	}
+	g.Version = strs[0]
+
+	// Like debug/buildinfo, drop the 16 byte sentinels around the text.
+	if mod := strs[1]; len(mod) >= 33 && mod[len(mod)-17] == '\n' {
+		g.ModInfo = mod[16 : len(mod)-16]
+	}
+	return checkOK
+}
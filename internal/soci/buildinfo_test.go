@@ -0,0 +1,89 @@
+package soci
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeGoBinary lays out build info the way Go 1.18+ does, after some junk.
+func fakeGoBinary(version, modinfo string) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x7fELF")
+	b.Write(bytes.Repeat([]byte{0}, 100))
+	// The magic on its own, as a string the program uses.
+	b.Write(goBuildInfoMagic)
+	b.WriteString("junk that isn't a header at all")
+	b.Write(goBuildInfoMagic)
+	b.Write([]byte{8, 2})
+	b.Write(bytes.Repeat([]byte{0}, goBuildInfoHeader-len(goBuildInfoMagic)-2))
+	for _, s := range []string{version, modinfo} {
+		b.Write(binary.AppendUvarint(nil, uint64(len(s))))
+		b.WriteString(s)
+	}
+	b.Write(bytes.Repeat([]byte{0}, 100))
+	return b.Bytes()
+}
+
+func TestGoSniffer(t *testing.T) {
+	const sentinel = "0123456789abcdef"
+	modinfo := "path\texample.com/cmd/app\nmod\texample.com\tv1.2.3\th1:abc=\ndep\tgolang.org/x/sys\tv0.1.0\th1:def=\nbuild\tvcs.revision=deadbeef\n"
+	bin := fakeGoBinary("go1.22.1", sentinel+modinfo+sentinel)
+
+	// Every chunk size, so the magic lands across writes somewhere.
+	for size := 1; size <= 40; size++ {
+		var g GoSniffer
+		for p := bin; len(p) > 0; p = p[min(size, len(p)):] {
+			g.Write(p[:min(size, len(p))])
+		}
+		if !g.Found() || g.Version != "go1.22.1" || g.ModInfo != modinfo {
+			t.Fatalf("chunks of %d: version %q, modinfo %q", size, g.Version, g.ModInfo)
+		}
+	}
+
+	var g GoSniffer
+	g.Write(bin)
+	bi, err := g.BuildInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bi.GoVersion != "go1.22.1" || bi.Main.Path != "example.com" || len(bi.Deps) != 1 || len(bi.Settings) != 1 {
+		t.Errorf("BuildInfo() = %+v", bi)
+	}
+
+	// Not an executable, so not looked at.
+	g = GoSniffer{}
+	g.Write(bytes.TrimPrefix(bin, []byte("\x7fELF")))
+	if g.Found() {
+		t.Errorf("found build info in a non-executable")
+	}
+}
+
+func TestGoSnifferSelf(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	want, err := buildinfo.ReadFile(exe)
+	if err != nil {
+		t.Skip(err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g GoSniffer
+	for p := data; len(p) > 0; p = p[min(32<<10, len(p)):] {
+		g.Write(p[:min(32<<10, len(p))])
+	}
+	bi, err := g.BuildInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bi.GoVersion != want.GoVersion || bi.Path != want.Path || !strings.HasPrefix(g.ModInfo, "path\t") {
+		t.Errorf("got %s %s, want %s %s", bi.GoVersion, bi.Path, want.GoVersion, want.Path)
+	}
+}
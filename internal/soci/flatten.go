@@ -0,0 +1,74 @@
+package soci
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+)
+
+// FlatFile is one entry of the flattened image, i.e. what a container sees.
+type FlatFile struct {
+	TOCFile
+	Layer string `json:"layer"` // ref of the layer it comes from
+
+	sfs *SociFS
+}
+
+// Open extracts the contents of f from its layer.
+func (f *FlatFile) Open(ctx context.Context) (io.ReadCloser, error) {
+	return ExtractFile(ctx, f.sfs.index, f.sfs.bs, &f.TOCFile)
+}
+
+// Flatten applies whiteouts and overwrites across every layer and returns
+// the visible entries (including directories) keyed by cleaned path,
+// e.g. "/etc/passwd".
+func (s *MultiFS) Flatten() map[string]*FlatFile {
+	files := map[string]*FlatFile{}
+	whiteouts := map[string]removal{}
+	opaques := map[string]removal{}
+
+	for _, sfs := range s.fss {
+		layerFiles := map[string]*FlatFile{}
+		layerWhiteouts := map[string]removal{}
+		layerOpaques := map[string]removal{}
+
+		for _, fm := range sfs.files {
+			name := path.Clean("/" + strings.TrimPrefix(fm.Name, "./"))
+			dir, base := path.Split(name)
+
+			if base == ".wh..wh..opq" {
+				layerOpaques[path.Clean(dir)] = removal{"opaque", sfs.ref, name}
+				continue
+			}
+			if strings.HasPrefix(base, ".wh.") {
+				layerWhiteouts[path.Join(dir, strings.TrimPrefix(base, ".wh."))] = removal{"whiteout", sfs.ref, name}
+				continue
+			}
+			if name == "/" {
+				continue
+			}
+			if _, ok := files[name]; ok {
+				continue
+			}
+			if _, ok := removedBy(name, whiteouts, opaques); ok {
+				continue
+			}
+
+			// Later entries in the same tar win.
+			layerFiles[name] = &FlatFile{TOCFile: fm, Layer: sfs.ref, sfs: sfs}
+		}
+
+		for k, v := range layerFiles {
+			files[k] = v
+		}
+		for k, v := range layerWhiteouts {
+			whiteouts[k] = v
+		}
+		for k, v := range layerOpaques {
+			opaques[k] = v
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,42 @@
+package soci
+
+import (
+	"archive/tar"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	layer := func(ref string, files ...TOCFile) *SociFS {
+		return &SociFS{ref: ref, files: files}
+	}
+	reg := func(name string, size int64) TOCFile {
+		return TOCFile{Name: name, Typeflag: tar.TypeReg, Size: size}
+	}
+
+	mfs := NewMultiFS([]*SociFS{
+		layer("top", reg("etc/passwd", 2), reg("app/.wh..wh..opq", 0), reg("app/main.py", 1)),
+		layer("middle", reg("etc/.wh.shadow", 0), reg("app/config.py", 1)),
+		layer("bottom",
+			TOCFile{Name: "./etc/", Typeflag: tar.TypeDir},
+			reg("./etc/shadow", 1),
+			reg("./etc/passwd", 1),
+			reg("./etc/hosts", 1),
+		),
+	}, "", "", 0, "", nil)
+
+	got := mfs.Flatten()
+	names := []string{}
+	for name := range got {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if want := "/app/main.py,/etc,/etc/hosts,/etc/passwd"; strings.Join(names, ",") != want {
+		t.Errorf("Flatten() = %v, want %s", names, want)
+	}
+	if f := got["/etc/passwd"]; f == nil || f.Layer != "top" || f.Size != 2 {
+		t.Errorf("Flatten()[/etc/passwd] = %+v, want top layer", f)
+	}
+}
@@ -181,6 +181,17 @@ func (s *MultiFS) Open(original string) (fs.File, error) {
 	name = strings.TrimPrefix(name, "/")
 	logs.Debug.Printf("multifs.Opening(%q)", name)
 
+	if outer, inner, ok := splitNested(name); ok {
+		fm, sfs, err := s.find(outer)
+		if err != nil {
+			if fm, sfs, err = s.chase(outer, 0); err != nil {
+				return nil, fs.ErrNotExist
+			}
+		}
+		s.lastFs = sfs
+		return sfs.openNested(fm, outer, inner)
+	}
+
 	fm, sfs, err := s.find(name)
 	if err != nil {
 		logs.Debug.Printf("multifs.Open(%q) = %v", name, err)
@@ -245,6 +256,22 @@ func (s *multiFile) Stat() (fs.FileInfo, error) {
 	return &dirInfo{s.name}, nil
 }
 
+// SHA256 is the content digest recorded by the indexer, if any.
+func (s *multiFile) SHA256() string {
+	if s.fm == nil {
+		return ""
+	}
+	return s.fm.SHA256
+}
+
+// GoVersion is the toolchain that built the file, if it's a Go binary.
+func (s *multiFile) GoVersion() string {
+	if s.fm == nil {
+		return ""
+	}
+	return s.fm.GoVersion
+}
+
 func (s *multiFile) Read(p []byte) (int, error) {
 	logs.Debug.Printf("multifs.Read(%q)", s.name)
 	return 0, fmt.Errorf("should not be called")
@@ -363,6 +390,30 @@ type SociFS struct {
 	mt types.MediaType
 
 	render RenderFunc
+
+	// TOC name -> why it was flagged, e.g. by the secret scanner.
+	flagged map[string]string
+
+	// Bounds reads from bs, so they stop when the request goes away.
+	ctx context.Context
+}
+
+// SetFlagged marks files (by TOC name) to call out in directory listings.
+func (s *SociFS) SetFlagged(flagged map[string]string) {
+	s.flagged = flagged
+}
+
+// SetContext bounds the blob reads made for files in s, typically to the
+// request that opened it.
+func (s *SociFS) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+func (s *SociFS) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
 }
 
 func (s *SociFS) RenderHeader(w http.ResponseWriter, r *http.Request, fname string, f httpserve.File, ctype string) error {
@@ -380,7 +431,7 @@ func (s *SociFS) RenderHeader(w http.ResponseWriter, r *http.Request, fname stri
 }
 
 func (s *SociFS) extractFile(tf *TOCFile) (io.ReadCloser, error) {
-	return ExtractFile(context.Background(), s.index, s.bs, tf)
+	return ExtractFile(s.context(), s.index, s.bs, tf)
 }
 
 func (s *SociFS) err(name string) fs.File {
@@ -423,6 +474,16 @@ func (s *SociFS) Open(original string) (fs.File, error) {
 	name = strings.TrimPrefix(name, "/")
 	logs.Debug.Printf("soci.Opening(%q)", name)
 
+	if outer, inner, ok := splitNested(name); ok {
+		fm, err := s.find(outer)
+		if err != nil {
+			if fm, _, err = s.chase(outer, 0); err != nil {
+				return nil, fs.ErrNotExist
+			}
+		}
+		return s.openNested(fm, outer, inner)
+	}
+
 	fm, err := s.find(name)
 	if err != nil {
 		logs.Debug.Printf("soci.Open(%q) = %v", name, err)
@@ -654,6 +715,22 @@ func (s *sociFile) Stat() (fs.FileInfo, error) {
 	return TarHeader(s.fm).FileInfo(), nil
 }
 
+// SHA256 is the content digest recorded by the indexer, if any.
+func (s *sociFile) SHA256() string {
+	if s.fm == nil {
+		return ""
+	}
+	return s.fm.SHA256
+}
+
+// GoVersion is the toolchain that built the file, if it's a Go binary.
+func (s *sociFile) GoVersion() string {
+	if s.fm == nil {
+		return ""
+	}
+	return s.fm.GoVersion
+}
+
 func (s *sociFile) Read(p []byte) (int, error) {
 	// logs.Debug.Printf("soci.Read(%q): len(p) = %d", s.name, len(p))
 	if s.fm == nil || s.fm.Size == 0 {
@@ -783,6 +860,13 @@ func (s *sociDirEntry) Index() int {
 	return s.layerIndex
 }
 
+func (s *sociDirEntry) Flagged() string {
+	if s.fs == nil || s.fm == nil {
+		return ""
+	}
+	return s.fs.flagged[s.fm.Name]
+}
+
 // If we don't have a file, make up a dir.
 type dirInfo struct {
 	name string
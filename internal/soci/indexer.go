@@ -3,9 +3,12 @@ package soci
 import (
 	"archive/tar"
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 
 	"github.com/thesavant42/yolosint/pkg/forks/github.com/klauspost/compress/zstd"
@@ -35,6 +38,11 @@ type Indexer struct {
 	finished bool
 	written  bool
 
+	// Hashes the current regular file as it's read, see finishFile.
+	hash hash.Hash
+	// Likewise looks for Go build info in it.
+	goinfo *GoSniffer
+
 	// OnTOC is called with the digest key and TOC when TOC is finalized.
 	// Set by caller before calling TOC().
 	OnTOC func(key string, toc *TOC)
@@ -123,6 +131,9 @@ func NewIndexer(rc io.ReadCloser, w io.Writer, span int64, mediaType string) (*I
 }
 
 func (i *Indexer) Next() (*tar.Header, error) {
+	if err := i.finishFile(); err != nil {
+		return nil, err
+	}
 	header, err := i.tr.Next()
 	if errors.Is(err, io.EOF) {
 		if !i.finished {
@@ -144,11 +155,47 @@ func (i *Indexer) Next() (*tar.Header, error) {
 	f.Offset = i.zr.UncompressedCount()
 	// logs.Debug.Printf("file: %q, read: %d", header.Name, f.Offset)
 	i.toc.Files = append(i.toc.Files, *f)
+	if header.Typeflag == tar.TypeReg {
+		i.hash = sha256.New()
+		i.goinfo = &GoSniffer{}
+	}
 	return header, err
 }
 
 func (i *Indexer) Read(p []byte) (int, error) {
-	return i.tr.Read(p)
+	n, err := i.tr.Read(p)
+	if i.hash != nil {
+		i.hash.Write(p[:n])
+		i.goinfo.Write(p[:n])
+	}
+	return n, err
+}
+
+// finishFile reads whatever the caller skipped of the current file so that
+// every regular file in the TOC gets a digest, not just the ones rendered.
+func (i *Indexer) finishFile() error {
+	if i.hash == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.MultiWriter(i.hash, i.goinfo), i.tr); err != nil {
+		return err
+	}
+	tf := &i.toc.Files[len(i.toc.Files)-1]
+	tf.SHA256 = hex.EncodeToString(i.hash.Sum(nil))
+	if i.goinfo.Found() {
+		tf.GoVersion = i.goinfo.Version
+		if tf.GoVersion == "" {
+			tf.GoVersion = "go1.17-"
+		}
+		if bi, err := i.goinfo.BuildInfo(); err == nil {
+			tf.GoModule = bi.Main.Path
+			if tf.GoModule == "" {
+				tf.GoModule = bi.Path
+			}
+		}
+	}
+	i.hash, i.goinfo = nil, nil
+	return nil
 }
 
 func (i *Indexer) Close() error {
@@ -0,0 +1,71 @@
+package soci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestIndexerSHA256(t *testing.T) {
+	files := map[string]string{
+		"etc/passwd": "root:x:0:0:root:/root:/bin/sh\n",
+		"etc/hosts":  "127.0.0.1 localhost\n",
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"etc/passwd", "etc/hosts"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(files[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := errors.Join(tw.Close(), zw.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	indexer, _, _, _, err := NewIndexer(io.NopCloser(&buf), io.Discard, 1<<20, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		hdr, err := indexer.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		// Only partially read one file, the rest should still be hashed.
+		if hdr.Name == "etc/passwd" {
+			if _, err := indexer.Read(make([]byte, 4)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	toc, err := indexer.TOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tf := range toc.Files {
+		want := ""
+		if data, ok := files[tf.Name]; ok {
+			sum := sha256.Sum256([]byte(data))
+			want = hex.EncodeToString(sum[:])
+		}
+		if tf.SHA256 != want {
+			t.Errorf("%s: SHA256 = %q, want %q", tf.Name, tf.SHA256, want)
+		}
+	}
+}
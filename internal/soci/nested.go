@@ -0,0 +1,767 @@
+package soci
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thesavant42/yolosint/internal/and"
+	"github.com/thesavant42/yolosint/internal/forks/compress/gzip"
+	"github.com/thesavant42/yolosint/pkg/forks/github.com/klauspost/compress/zstd"
+)
+
+// Archives inside a layer (jars, wheels, tarballs, debs, ...) can be browsed
+// in place by appending "!/" to their path, and nest as deep as they go:
+//
+//	/fs/<repo>@<digest>/app/app.war!/WEB-INF/lib/foo.jar!/META-INF/MANIFEST.MF
+//
+// Nothing is buffered whole. The outermost archive is read with ranged reads
+// that start from the layer's nearest checkpoint, so a zip's central
+// directory or an ar member costs one span, not the whole file. Compressed
+// tarballs can only be streamed, so their listings are cached.
+const NestedSep = "!/"
+
+var archiveExts = []string{
+	".zip", ".jar", ".war", ".ear", ".aar", ".whl", ".egg", ".nupkg", ".apk",
+	".deb", ".ipk", ".gem", ".crate",
+	".tar", ".tar.gz", ".tgz", ".tar.zst", ".tzst", ".tar.bz2", ".tbz2",
+}
+
+const (
+	nestedBlockSize  = 1 << 20
+	nestedBlocks     = 16
+	nestedListings   = 64
+	maxNestedEntries = 1 << 18
+)
+
+// IsArchive reports whether name looks like an archive that can be browsed
+// by appending NestedSep.
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitNested splits "a/foo.jar!/b/c" into "a/foo.jar" and "b/c". A bare
+// "a/foo.jar!" is the root of the archive.
+func splitNested(name string) (outer, inner string, ok bool) {
+	for i := 0; i < len(name); {
+		j := strings.IndexByte(name[i:], '!')
+		if j < 0 {
+			return "", "", false
+		}
+		j += i
+		rest := name[j+1:]
+		if (rest == "" || rest[0] == '/') && IsArchive(name[:j]) {
+			return name[:j], strings.TrimPrefix(rest, "/"), true
+		}
+		i = j + 1
+	}
+	return "", "", false
+}
+
+func (s *SociFS) openNested(fm *TOCFile, outer, inner string) (fs.File, error) {
+	if fm.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("%s is not a regular file", outer)
+	}
+	ra := &cachedReaderAt{ra: &tocReaderAt{sfs: s, tf: fm}, size: fm.Size}
+	open := func() (io.ReadCloser, error) {
+		return s.extractFile(fm)
+	}
+	n, err := newNestedFS(s, strings.TrimPrefix(path.Clean("/"+outer), "/"), ra, fm.Size, open, &closeList{})
+	if err != nil {
+		return nil, err
+	}
+	return n.Open(inner)
+}
+
+// tocReaderAt reads a file in a layer at any offset by extracting just the
+// requested range, starting from the nearest checkpoint.
+type tocReaderAt struct {
+	sfs *SociFS
+	tf  *TOCFile
+}
+
+func (r *tocReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.tf.Size {
+		return 0, io.EOF
+	}
+	sub := *r.tf
+	sub.Offset += off
+	sub.Size = min(int64(len(p)), r.tf.Size-off)
+
+	rc, err := ExtractFile(r.sfs.context(), r.sfs.index, r.sfs.bs, &sub)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	n, err := io.ReadFull(rc, p[:sub.Size])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// streamReaderAt fakes a ReaderAt over something that can only be streamed,
+// reopening it whenever a read goes backwards.
+type streamReaderAt struct {
+	mu   sync.Mutex
+	open func() (io.ReadCloser, error)
+	rc   io.ReadCloser
+	pos  int64
+}
+
+func (s *streamReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rc == nil || off < s.pos {
+		if s.rc != nil {
+			s.rc.Close()
+		}
+		rc, err := s.open()
+		if err != nil {
+			return 0, err
+		}
+		s.rc, s.pos = rc, 0
+	}
+	if off > s.pos {
+		n, err := io.CopyN(io.Discard, s.rc, off-s.pos)
+		s.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(s.rc, p)
+	s.pos += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *streamReaderAt) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rc == nil {
+		return nil
+	}
+	err := s.rc.Close()
+	s.rc = nil
+	return err
+}
+
+// cachedReaderAt keeps the last few blocks read, because archive/zip makes
+// lots of tiny reads and each one would otherwise be its own extraction.
+type cachedReaderAt struct {
+	ra   io.ReaderAt
+	size int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	order  []int64
+}
+
+func (c *cachedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		at := off + int64(n)
+		if at >= c.size {
+			return n, io.EOF
+		}
+		b, err := c.block(at / nestedBlockSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], b[at%nestedBlockSize:])
+	}
+	return n, nil
+}
+
+func (c *cachedReaderAt) block(i int64) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if b, ok := c.blocks[i]; ok {
+		return b, nil
+	}
+	b := make([]byte, min(nestedBlockSize, c.size-i*nestedBlockSize))
+	if n, err := c.ra.ReadAt(b, i*nestedBlockSize); err != nil && !(errors.Is(err, io.EOF) && n == len(b)) {
+		return nil, err
+	}
+
+	if c.blocks == nil {
+		c.blocks = map[int64][]byte{}
+	}
+	c.blocks[i] = b
+	c.order = append(c.order, i)
+	if len(c.order) > nestedBlocks {
+		delete(c.blocks, c.order[0])
+		c.order = c.order[1:]
+	}
+	return b, nil
+}
+
+// closeList holds the streams an archive (and the archives inside it) had
+// to open, so they can all be closed with whichever file was served.
+type closeList struct {
+	mu  sync.Mutex
+	fns []func() error
+}
+
+func (c *closeList) add(fn func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fns = append(c.fns, fn)
+}
+
+func (c *closeList) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, fn := range c.fns {
+		errs = append(errs, fn())
+	}
+	c.fns = nil
+	return errors.Join(errs...)
+}
+
+type nestedEntry struct {
+	TOCFile
+
+	member int   // position in the archive, -1 for directories we made up
+	off    int64 // where an ar member's data starts
+}
+
+// nestedFS is one archive inside a layer, or inside another archive.
+type nestedFS struct {
+	sfs  *SociFS // layer the outermost archive came from
+	name string  // e.g. "app/app.war" or "app/app.war!/WEB-INF/lib/foo.jar"
+	kind string  // "zip", "ar" or "tar"
+
+	ra   io.ReaderAt
+	size int64
+	open func() (io.ReadCloser, error)
+
+	zr      *zip.Reader
+	entries []nestedEntry
+
+	closers *closeList
+}
+
+var listings = struct {
+	sync.Mutex
+	m     map[string][]nestedEntry
+	order []string
+}{m: map[string][]nestedEntry{}}
+
+func newNestedFS(sfs *SociFS, name string, ra io.ReaderAt, size int64, open func() (io.ReadCloser, error), closers *closeList) (*nestedFS, error) {
+	n := &nestedFS{
+		sfs:     sfs,
+		name:    name,
+		ra:      ra,
+		size:    size,
+		open:    open,
+		closers: closers,
+	}
+
+	magic := make([]byte, 8)
+	m, err := ra.ReadAt(magic, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	magic = magic[:m]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		n.kind = "zip"
+		err = n.readZip()
+	case bytes.HasPrefix(magic, []byte("!<arch>\n")):
+		n.kind = "ar"
+		err = n.readAr()
+	default:
+		n.kind = "tar"
+		err = n.readTar()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	n.addImplicitDirs()
+	return n, nil
+}
+
+func cleanMember(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func (n *nestedFS) readZip() error {
+	zr, err := zip.NewReader(n.ra, n.size)
+	if err != nil {
+		return err
+	}
+	if len(zr.File) > maxNestedEntries {
+		return fmt.Errorf("too many entries: %d", len(zr.File))
+	}
+	n.zr = zr
+	for i, f := range zr.File {
+		name := cleanMember(f.Name)
+		if name == "" {
+			continue
+		}
+		e := nestedEntry{
+			TOCFile: TOCFile{
+				Typeflag: tar.TypeReg,
+				Name:     name,
+				Size:     int64(f.UncompressedSize64),
+				Mode:     int64(f.Mode().Perm()),
+				ModTime:  f.Modified,
+			},
+			member: i,
+		}
+		if strings.HasSuffix(f.Name, "/") || f.Mode().IsDir() {
+			e.Typeflag = tar.TypeDir
+			e.Size = 0
+		}
+		if e.Mode == 0 {
+			e.Mode = 0o644
+			if e.Typeflag == tar.TypeDir {
+				e.Mode = 0o755
+			}
+		}
+		n.entries = append(n.entries, e)
+	}
+	return nil
+}
+
+// readAr lists a Unix ar archive, i.e. a .deb or .ipk.
+func (n *nestedFS) readAr() error {
+	off := int64(len("!<arch>\n"))
+	hdr := make([]byte, 60)
+	for i := 0; off < n.size; i++ {
+		if i > maxNestedEntries {
+			return fmt.Errorf("too many entries")
+		}
+		if _, err := n.ra.ReadAt(hdr, off); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if string(hdr[58:60]) != "`\n" {
+			return fmt.Errorf("bad ar header at %d", off)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return fmt.Errorf("ar size at %d: %w", off, err)
+		}
+		mode, _ := strconv.ParseInt(strings.TrimSpace(string(hdr[40:48])), 8, 64)
+		uid, _ := strconv.Atoi(strings.TrimSpace(string(hdr[28:34])))
+		gid, _ := strconv.Atoi(strings.TrimSpace(string(hdr[34:40])))
+		mtime, _ := strconv.ParseInt(strings.TrimSpace(string(hdr[16:28])), 10, 64)
+
+		data := off + 60
+		name := strings.TrimSpace(string(hdr[0:16]))
+		if after, ok := strings.CutPrefix(name, "#1/"); ok {
+			// BSD keeps long names at the start of the data.
+			l, err := strconv.ParseInt(after, 10, 64)
+			if err != nil || l > size {
+				return fmt.Errorf("ar name at %d: %q", off, name)
+			}
+			b := make([]byte, l)
+			if _, err := n.ra.ReadAt(b, data); err != nil {
+				return err
+			}
+			name = strings.TrimRight(string(b), "\x00")
+			data += l
+			size -= l
+		}
+
+		// "/" and "//" are symbol and GNU long name tables.
+		if name != "/" && name != "//" {
+			name = cleanMember(strings.TrimSuffix(name, "/"))
+			n.entries = append(n.entries, nestedEntry{
+				TOCFile: TOCFile{
+					Typeflag: tar.TypeReg,
+					Name:     name,
+					Size:     size,
+					Mode:     mode & 0o7777,
+					ModTime:  time.Unix(mtime, 0),
+					Uid:      uid,
+					Gid:      gid,
+				},
+				member: i,
+				off:    data,
+			})
+		}
+
+		off = data + size
+		if off%2 != 0 {
+			off++
+		}
+	}
+	return nil
+}
+
+func (n *nestedFS) readTar() error {
+	key := ""
+	if n.sfs != nil {
+		key = n.sfs.ref + "/" + n.name
+		listings.Lock()
+		entries, ok := listings.m[key]
+		listings.Unlock()
+		if ok {
+			n.entries = slices.Clone(entries)
+			return nil
+		}
+	}
+
+	rc, err := n.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tr, done, err := untar(rc)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if i == 0 {
+				return fmt.Errorf("not an archive we can read: %w", err)
+			}
+			return err
+		}
+		if i > maxNestedEntries {
+			return fmt.Errorf("too many entries")
+		}
+		name := cleanMember(hdr.Name)
+		if name == "" || hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		tf := FromTar(hdr)
+		tf.Name = name
+		n.entries = append(n.entries, nestedEntry{TOCFile: *tf, member: i})
+	}
+
+	if key != "" {
+		listings.Lock()
+		if _, ok := listings.m[key]; !ok {
+			listings.m[key] = slices.Clone(n.entries)
+			listings.order = append(listings.order, key)
+			if len(listings.order) > nestedListings {
+				delete(listings.m, listings.order[0])
+				listings.order = listings.order[1:]
+			}
+		}
+		listings.Unlock()
+	}
+	return nil
+}
+
+// untar sniffs how a tarball is compressed and returns a reader for it.
+func untar(r io.Reader) (*tar.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tar.NewReader(zr), func() { zr.Close() }, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return tar.NewReader(zr), zr.Close, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return tar.NewReader(bzip2.NewReader(br)), func() {}, nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return nil, nil, fmt.Errorf("xz is not supported")
+	}
+	return tar.NewReader(br), func() {}, nil
+}
+
+// addImplicitDirs makes up directories that only exist as path prefixes,
+// which is most of them in a zip.
+func (n *nestedFS) addImplicitDirs() {
+	have := map[string]struct{}{}
+	for _, e := range n.entries {
+		have[e.Name] = struct{}{}
+	}
+	for _, e := range n.entries {
+		for dir := path.Dir(e.Name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if _, ok := have[dir]; ok {
+				break
+			}
+			have[dir] = struct{}{}
+			n.entries = append(n.entries, nestedEntry{
+				TOCFile: TOCFile{Typeflag: tar.TypeDir, Name: dir, Mode: 0o755},
+				member:  -1,
+			})
+		}
+	}
+}
+
+func (n *nestedFS) find(name string) *nestedEntry {
+	for i := range n.entries {
+		if n.entries[i].Name == name {
+			return &n.entries[i]
+		}
+	}
+	return nil
+}
+
+func (n *nestedFS) Open(inner string) (fs.File, error) {
+	inner = cleanMember(inner)
+	if outer, rest, ok := splitNested(inner); ok {
+		e := n.find(outer)
+		if e == nil || e.Typeflag != tar.TypeReg {
+			return nil, fs.ErrNotExist
+		}
+		child, err := n.child(e)
+		if err != nil {
+			return nil, err
+		}
+		return child.Open(rest)
+	}
+
+	if inner == "" {
+		root := &nestedEntry{
+			TOCFile: TOCFile{Typeflag: tar.TypeDir, Mode: 0o755},
+			member:  -1,
+		}
+		return &nestedFile{fs: n, e: root}, nil
+	}
+
+	e := n.find(inner)
+	if e == nil {
+		return nil, fs.ErrNotExist
+	}
+	return &nestedFile{fs: n, e: e}, nil
+}
+
+func (n *nestedFS) child(e *nestedEntry) (*nestedFS, error) {
+	open := func() (io.ReadCloser, error) {
+		return n.member(e)
+	}
+	var ra io.ReaderAt
+	if sr, err := n.section(e); err != nil {
+		return nil, err
+	} else if sr != nil {
+		ra = sr
+	} else {
+		sra := &streamReaderAt{open: open}
+		n.closers.add(sra.Close)
+		ra = &cachedReaderAt{ra: sra, size: e.Size}
+	}
+	return newNestedFS(n.sfs, n.name+NestedSep+e.Name, ra, e.Size, open, n.closers)
+}
+
+// section returns a seekable view of e if it's stored uncompressed in the
+// archive, or nil if it can only be streamed.
+func (n *nestedFS) section(e *nestedEntry) (*io.SectionReader, error) {
+	switch n.kind {
+	case "ar":
+		return io.NewSectionReader(n.ra, e.off, e.Size), nil
+	case "zip":
+		f := n.zr.File[e.member]
+		if f.Method != zip.Store {
+			return nil, nil
+		}
+		off, err := f.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(n.ra, off, e.Size), nil
+	}
+	return nil, nil
+}
+
+// member streams the contents of e.
+func (n *nestedFS) member(e *nestedEntry) (io.ReadCloser, error) {
+	switch n.kind {
+	case "ar":
+		return io.NopCloser(io.NewSectionReader(n.ra, e.off, e.Size)), nil
+	case "zip":
+		return n.zr.File[e.member].Open()
+	}
+
+	rc, err := n.open()
+	if err != nil {
+		return nil, err
+	}
+	tr, done, err := untar(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		if _, err := tr.Next(); err != nil {
+			done()
+			rc.Close()
+			if errors.Is(err, io.EOF) {
+				return nil, fs.ErrNotExist
+			}
+			return nil, err
+		}
+		if i == e.member {
+			break
+		}
+	}
+	return &and.ReadCloser{Reader: io.LimitReader(tr, e.Size), CloseFunc: func() error {
+		done()
+		return rc.Close()
+	}}, nil
+}
+
+func (n *nestedFS) header(e *nestedEntry) *tar.Header {
+	hdr := TarHeader(&e.TOCFile)
+	if e.Name == "" {
+		hdr.Name = n.name + "!"
+	} else {
+		hdr.Name = n.name + NestedSep + e.Name
+	}
+	return hdr
+}
+
+func (n *nestedFS) readDir(dir string) []fs.DirEntry {
+	if dir == "" {
+		dir = "."
+	}
+	des := []fs.DirEntry{up}
+	for i := range n.entries {
+		if path.Dir(n.entries[i].Name) == dir {
+			des = append(des, &nestedDirEntry{fs: n, e: &n.entries[i]})
+		}
+	}
+	return des
+}
+
+func (n *nestedFS) layer() string {
+	if n.sfs == nil {
+		return ""
+	}
+	return n.sfs.ref
+}
+
+type nestedFile struct {
+	fs *nestedFS
+	e  *nestedEntry
+	rc io.ReadCloser
+	sr *io.SectionReader
+}
+
+func (f *nestedFile) Stat() (fs.FileInfo, error) {
+	return f.fs.header(f.e).FileInfo(), nil
+}
+
+func (f *nestedFile) Read(p []byte) (int, error) {
+	if f.e.Typeflag != tar.TypeReg || f.e.Size == 0 {
+		return 0, io.EOF
+	}
+	if f.sr == nil && f.rc == nil {
+		sr, err := f.fs.section(f.e)
+		if err != nil {
+			return 0, err
+		}
+		if sr != nil {
+			f.sr = sr
+		} else {
+			rc, err := f.fs.member(f.e)
+			if err != nil {
+				return 0, err
+			}
+			f.rc = rc
+		}
+	}
+	if f.sr != nil {
+		return f.sr.Read(p)
+	}
+	return f.rc.Read(p)
+}
+
+func (f *nestedFile) Seek(offset int64, whence int) (int64, error) {
+	if f.sr == nil {
+		sr, err := f.fs.section(f.e)
+		if err != nil {
+			return 0, err
+		}
+		if sr == nil {
+			return 0, fmt.Errorf("not implemented")
+		}
+		f.sr = sr
+	}
+	return f.sr.Seek(offset, whence)
+}
+
+func (f *nestedFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	return f.fs.readDir(f.e.Name), nil
+}
+
+func (f *nestedFile) Size() int64 {
+	return f.e.Size
+}
+
+// Layer is the layer the outermost archive came from.
+func (f *nestedFile) Layer() string {
+	return f.fs.layer()
+}
+
+func (f *nestedFile) Close() error {
+	var err error
+	if f.rc != nil {
+		err = f.rc.Close()
+	}
+	return errors.Join(err, f.fs.closers.close())
+}
+
+type nestedDirEntry struct {
+	fs *nestedFS
+	e  *nestedEntry
+}
+
+func (d *nestedDirEntry) Name() string {
+	return path.Base(d.e.Name)
+}
+
+func (d *nestedDirEntry) IsDir() bool {
+	return d.e.Typeflag == tar.TypeDir
+}
+
+func (d *nestedDirEntry) Type() fs.FileMode {
+	return d.fs.header(d.e).FileInfo().Mode().Type()
+}
+
+func (d *nestedDirEntry) Info() (fs.FileInfo, error) {
+	return d.fs.header(d.e).FileInfo(), nil
+}
+
+func (d *nestedDirEntry) Layer() string {
+	return d.fs.layer()
+}
@@ -0,0 +1,205 @@
+package soci
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(body)), Mode: 0o644}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zipball(t *testing.T, method uint16, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func arball(files [][2]string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, f := range files {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", f[0]+"/", 0, 0, 0, 0o644, len(f[1]))
+		buf.WriteString(f[1])
+		if len(f[1])%2 != 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func readNested(t *testing.T, n *nestedFS, name string) string {
+	t.Helper()
+	f, err := n.Open(name)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", name, err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll(%q): %v", name, err)
+	}
+	return string(b)
+}
+
+func TestNestedFS(t *testing.T) {
+	jar := zipball(t, zip.Deflate, map[string]string{
+		"META-INF/MANIFEST.MF":  "Main-Class: Foo\n",
+		"com/example/Foo.class": "cafebabe",
+	})
+	war := zipball(t, zip.Store, map[string]string{
+		"WEB-INF/lib/foo.jar": string(jar),
+	})
+	deb := arball([][2]string{
+		{"debian-binary", "2.0\n"},
+		{"data.tar.gz", string(tarball(t, map[string]string{"./usr/bin/hello": "hi"}))},
+	})
+	outer := tarball(t, map[string]string{
+		"app/app.war":   string(war),
+		"pkg/hello.deb": string(deb),
+		"README":        "readme",
+	})
+
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(outer)), nil
+	}
+	n, err := newNestedFS(nil, "layer.tar.gz", bytes.NewReader(outer), int64(len(outer)), open, &closeList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.kind != "tar" {
+		t.Errorf("kind = %q, want tar", n.kind)
+	}
+
+	for name, want := range map[string]string{
+		"README": "readme",
+		"app/app.war!/WEB-INF/lib/foo.jar!/META-INF/MANIFEST.MF": "Main-Class: Foo\n",
+		"pkg/hello.deb!/debian-binary":                           "2.0\n",
+		"pkg/hello.deb!/data.tar.gz!/usr/bin/hello":              "hi",
+	} {
+		if got := readNested(t, n, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// Zips rarely have directory entries, so they're made up.
+	f, err := n.Open("app/app.war!/WEB-INF/lib/foo.jar!/com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Errorf("com is not a directory")
+	}
+	hdr := fi.Sys().(*tar.Header)
+	if want := "layer.tar.gz!/app/app.war!/WEB-INF/lib/foo.jar!/com"; hdr.Name != want {
+		t.Errorf("Name = %q, want %q", hdr.Name, want)
+	}
+	des, err := f.(fs.ReadDirFile).ReadDir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(des) != 2 || des[1].Name() != "example" || !des[1].IsDir() {
+		t.Errorf("ReadDir(com) = %v", des)
+	}
+
+	if _, err := n.Open("app/app.war!/nope"); err != fs.ErrNotExist {
+		t.Errorf("Open(nope) = %v, want ErrNotExist", err)
+	}
+}
+
+func TestSplitNested(t *testing.T) {
+	for _, tc := range []struct {
+		in, outer, inner string
+		ok               bool
+	}{
+		{"app/foo.jar!/META-INF/MANIFEST.MF", "app/foo.jar", "META-INF/MANIFEST.MF", true},
+		{"app/foo.jar!", "app/foo.jar", "", true},
+		{"a.war!/lib/b.jar!/c", "a.war", "lib/b.jar!/c", true},
+		{"wow!/foo.jar", "", "", false},
+		{"bang!/x.tar.gz!/y", "bang!/x.tar.gz", "y", true},
+		{"usr/bin/foo", "", "", false},
+	} {
+		outer, inner, ok := splitNested(tc.in)
+		if outer != tc.outer || inner != tc.inner || ok != tc.ok {
+			t.Errorf("splitNested(%q) = %q, %q, %v; want %q, %q, %v", tc.in, outer, inner, ok, tc.outer, tc.inner, tc.ok)
+		}
+	}
+}
+
+// plainIndex is an uncompressed layer without checkpoints.
+type plainIndex struct{}
+
+func (plainIndex) Dict(*Checkpointer) ([]byte, error) { return nil, nil }
+func (plainIndex) Locate(string) (*TOCFile, error)    { return nil, fs.ErrNotExist }
+func (plainIndex) TOC() *TOC                          { return &TOC{Type: "tar"} }
+
+// ctxSeeker serves b, unless the read's context is done.
+type ctxSeeker []byte
+
+func (b ctxSeeker) Reader(ctx context.Context, off, end int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b[off:end])), nil
+}
+
+func TestTocReaderAtContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		ctx     context.Context
+		wantErr error
+	}{
+		{nil, nil},
+		{context.Background(), nil},
+		{canceled, context.Canceled},
+	} {
+		sfs := FS(plainIndex{}, ctxSeeker("0123456789"), "", "", 0, "", nil)
+		if tc.ctx != nil {
+			sfs.SetContext(tc.ctx)
+		}
+		ra := &tocReaderAt{sfs: sfs, tf: &TOCFile{Name: "f", Typeflag: tar.TypeReg, Offset: 2, Size: 6}}
+		p := make([]byte, 4)
+		n, err := ra.ReadAt(p, 1)
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("ReadAt with %v: %v, want %v", tc.ctx, err, tc.wantErr)
+		}
+		if tc.wantErr == nil && string(p[:n]) != "3456" {
+			t.Errorf("ReadAt with %v = %q, want 3456", tc.ctx, p[:n])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package soci
+
+import (
+	"archive/tar"
+	"path"
+	"strings"
+	"time"
+)
+
+// ShadowedFile is a file that's still in a lower layer's bytes but isn't
+// visible in the flattened image because an upper layer removed or replaced it.
+type ShadowedFile struct {
+	Name     string    `json:"name"`
+	Layer    string    `json:"layer"` // ref of the layer that still has the bytes
+	Index    int       `json:"index"` // 0 is the top layer
+	Typeflag byte      `json:"typeflag"`
+	Size     int64     `json:"size"`
+	Mode     int64     `json:"mode"`
+	ModTime  time.Time `json:"mod,omitempty"`
+	Linkname string    `json:"linkname,omitempty"`
+
+	Reason   string `json:"reason"`             // "whiteout", "opaque" or "overwritten"
+	By       string `json:"by"`                 // ref of the layer that removed or replaced it
+	Whiteout string `json:"whiteout,omitempty"` // the whiteout file responsible, if any
+}
+
+type removal struct {
+	reason   string
+	by       string
+	whiteout string
+}
+
+// Shadowed returns every non-directory entry in a lower layer that an upper
+// layer deleted (with a whiteout or an opaque directory) or overwrote.
+// Unlike Everything, a whiteout of a directory hides everything beneath it.
+func (s *MultiFS) Shadowed() []ShadowedFile {
+	// Everything from the layers above the current one, by cleaned path.
+	have := map[string]string{}
+	whiteouts := map[string]removal{}
+	opaques := map[string]removal{}
+
+	shadowed := []ShadowedFile{}
+	for i, sfs := range s.fss {
+		layerHave := map[string]string{}
+		layerWhiteouts := map[string]removal{}
+		layerOpaques := map[string]removal{}
+
+		for _, fm := range sfs.files {
+			name := path.Clean("/" + strings.TrimPrefix(fm.Name, "./"))
+			dir, base := path.Split(name)
+
+			if base == ".wh..wh..opq" {
+				layerOpaques[path.Clean(dir)] = removal{"opaque", sfs.ref, name}
+				continue
+			}
+			if strings.HasPrefix(base, ".wh.") {
+				layerWhiteouts[path.Join(dir, strings.TrimPrefix(base, ".wh."))] = removal{"whiteout", sfs.ref, name}
+				continue
+			}
+			if fm.Typeflag != tar.TypeDir {
+				layerHave[name] = sfs.ref
+			}
+			if i == 0 || fm.Typeflag == tar.TypeDir {
+				continue
+			}
+
+			rm, ok := removedBy(name, whiteouts, opaques)
+			if !ok {
+				by, overwritten := have[name]
+				if !overwritten {
+					continue
+				}
+				rm = removal{reason: "overwritten", by: by}
+			}
+
+			shadowed = append(shadowed, ShadowedFile{
+				Name:     fm.Name,
+				Layer:    sfs.ref,
+				Index:    i,
+				Typeflag: fm.Typeflag,
+				Size:     fm.Size,
+				Mode:     fm.Mode,
+				ModTime:  fm.ModTime,
+				Linkname: fm.Linkname,
+				Reason:   rm.reason,
+				By:       rm.by,
+				Whiteout: rm.whiteout,
+			})
+		}
+
+		// These only apply to the layers below this one, and the closest
+		// layer above a file is the one that actually hid it.
+		for k, v := range layerHave {
+			have[k] = v
+		}
+		for k, v := range layerWhiteouts {
+			whiteouts[k] = v
+		}
+		for k, v := range layerOpaques {
+			opaques[k] = v
+		}
+	}
+
+	return shadowed
+}
+
+// removedBy checks name and each of its parents against upper-layer whiteouts.
+func removedBy(name string, whiteouts, opaques map[string]removal) (removal, bool) {
+	if rm, ok := whiteouts[name]; ok {
+		return rm, true
+	}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if rm, ok := whiteouts[dir]; ok {
+			return rm, true
+		}
+		if rm, ok := opaques[dir]; ok {
+			return rm, true
+		}
+		if dir == "/" {
+			break
+		}
+	}
+	return removal{}, false
+}
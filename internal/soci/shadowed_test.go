@@ -0,0 +1,49 @@
+package soci
+
+import (
+	"archive/tar"
+	"testing"
+)
+
+func TestShadowed(t *testing.T) {
+	layer := func(ref string, files ...TOCFile) *SociFS {
+		return &SociFS{ref: ref, files: files}
+	}
+	reg := func(name string) TOCFile {
+		return TOCFile{Name: name, Typeflag: tar.TypeReg, Size: 1}
+	}
+
+	// Top layer first, like NewMultiFS expects.
+	mfs := NewMultiFS([]*SociFS{
+		layer("top", reg("etc/passwd"), reg("app/.wh..wh..opq"), reg("app/main.py")),
+		layer("middle", reg("root/.wh..aws"), reg("etc/.wh.shadow"), reg("app/config.py")),
+		layer("bottom",
+			TOCFile{Name: "root/.aws/", Typeflag: tar.TypeDir},
+			reg("root/.aws/credentials"),
+			reg("./etc/shadow"),
+			reg("etc/passwd"),
+			reg("etc/hosts"),
+		),
+	}, "", "", 0, "", nil)
+
+	want := map[string][2]string{
+		"app/config.py":         {"opaque", "top"},
+		"root/.aws/credentials": {"whiteout", "middle"},
+		"./etc/shadow":          {"whiteout", "middle"},
+		"etc/passwd":            {"overwritten", "top"},
+	}
+	got := mfs.Shadowed()
+	if len(got) != len(want) {
+		t.Fatalf("Shadowed() = %+v, want %d files", got, len(want))
+	}
+	for _, sf := range got {
+		w, ok := want[sf.Name]
+		if !ok {
+			t.Errorf("unexpected %+v", sf)
+			continue
+		}
+		if sf.Reason != w[0] || sf.By != w[1] {
+			t.Errorf("%s: reason=%q by=%q, want %q by %q", sf.Name, sf.Reason, sf.By, w[0], w[1])
+		}
+	}
+}
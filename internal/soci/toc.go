@@ -39,6 +39,14 @@ type TOCFile struct {
 	Gid        int               `json:"gid,omitempty"`
 	PAXRecords map[string]string `json:"pax,omitempty"`
 
+	// Hex SHA-256 of the contents, for regular files.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// For Go binaries, the toolchain and main module (or package path)
+	// from the embedded build info, see GoSniffer.
+	GoVersion string `json:"goversion,omitempty"`
+	GoModule  string `json:"gomodule,omitempty"`
+
 	// Our uncompressed offset so we can seek ahead.
 	Offset int64 `json:"offset,omitempty"`
 }
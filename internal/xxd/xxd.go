@@ -21,6 +21,17 @@ func NewWriter(w io.Writer, size int64) *Writer {
 	}
 }
 
+// NewWriterAt is NewWriter for a dump of size bytes that starts offset
+// bytes into a file, so the addresses on the left are the real ones.
+// The offset should be a multiple of 16.
+func NewWriterAt(w io.Writer, offset, size int64) *Writer {
+	return &Writer{
+		buf:    bufio.NewWriter(w),
+		size:   offset + size,
+		cursor: offset,
+	}
+}
+
 type Writer struct {
 	buf    *bufio.Writer
 	size   int64
@@ -21,6 +21,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -321,15 +322,26 @@ func (m *manifests) handleCatalog(resp http.ResponseWriter, req *http.Request) *
 		defer m.lock.Unlock()
 
 		var repos []string
-		countRepos := 0
-		// TODO: implement pagination
 		for key := range m.manifests {
-			if countRepos >= n {
-				break
+			repos = append(repos, key)
+		}
+		sort.Strings(repos)
+
+		// Offset using last query parameter, like tags.
+		if last := query.Get("last"); last != "" {
+			i := sort.SearchStrings(repos, last)
+			if i < len(repos) && repos[i] == last {
+				i++
 			}
-			countRepos++
+			repos = repos[i:]
+		}
 
-			repos = append(repos, key)
+		// Link to the next page if there is one.
+		if n >= 0 && n < len(repos) {
+			repos = repos[:n]
+			if n > 0 {
+				resp.Header().Set("Link", fmt.Sprintf(`</v2/_catalog?n=%d&last=%s>; rel="next"`, n, url.QueryEscape(repos[n-1])))
+			}
 		}
 
 		repositoriesToList := catalog{
@@ -437,6 +437,23 @@ func TestCalls(t *testing.T) {
 			URL:         "/v2/_catalog?n=1000",
 			Code:        http.StatusOK,
 		},
+		{
+			Description: "list repos paginated",
+			Manifests:   map[string]string{"foo/manifests/latest": "foo", "bar/manifests/latest": "bar", "baz/manifests/latest": "baz"},
+			Method:      "GET",
+			URL:         "/v2/_catalog?n=2",
+			Code:        http.StatusOK,
+			Header:      map[string]string{"Link": `</v2/_catalog?n=2&last=baz>; rel="next"`},
+			Want:        `{"repositories":["bar","baz"]}`,
+		},
+		{
+			Description: "list repos after last",
+			Manifests:   map[string]string{"foo/manifests/latest": "foo", "bar/manifests/latest": "bar", "baz/manifests/latest": "baz"},
+			Method:      "GET",
+			URL:         "/v2/_catalog?n=2&last=baz",
+			Code:        http.StatusOK,
+			Want:        `{"repositories":["foo"]}`,
+		},
 		{
 			Description: "fetch references",
 			Method:      "GET",
@@ -48,8 +48,17 @@ type PingResp struct {
 
 	// The registry's scheme to use. Communicates whether we fell back to http.
 	Scheme string
+
+	// What GET /v2/ answered with, for callers that want to look closer at
+	// the registry: the status, the headers and the start of the body.
+	StatusCode int
+	Header     http.Header
+	Body       []byte
 }
 
+// maxPingBody is how much of the GET /v2/ body a PingResp keeps.
+const maxPingBody = 1 << 16
+
 func (c challenge) Canonical() challenge {
 	return challenge(strings.ToLower(string(c)))
 }
@@ -107,30 +116,41 @@ func pingSingle(ctx context.Context, reg name.Registry, t http.RoundTripper, sch
 	switch resp.StatusCode {
 	case http.StatusOK:
 		// If we get a 200, then no authentication is needed.
-		return &PingResp{
+		pr := &PingResp{
 			challenge: anonymous,
 			Scheme:    scheme,
-		}, nil
+		}
+		return pr.keep(resp), nil
 	case http.StatusUnauthorized:
 		if challenges := authchallenge.ResponseChallenges(resp); len(challenges) != 0 {
 			// If we hit more than one, let's try to find one that we know how to handle.
 			wac := pickFromMultipleChallenges(challenges)
-			return &PingResp{
+			pr := &PingResp{
 				challenge:  challenge(wac.Scheme).Canonical(),
 				Parameters: wac.Parameters,
 				Scheme:     scheme,
-			}, nil
+			}
+			return pr.keep(resp), nil
 		}
 		// Otherwise, just return the challenge without parameters.
-		return &PingResp{
+		pr := &PingResp{
 			challenge: challenge(resp.Header.Get("WWW-Authenticate")).Canonical(),
 			Scheme:    scheme,
-		}, nil
+		}
+		return pr.keep(resp), nil
 	default:
 		return nil, CheckError(resp, http.StatusOK, http.StatusUnauthorized)
 	}
 }
 
+// keep records the status, headers and start of the body of resp. The body
+// is only informational, so failing to read it all isn't an error.
+func (pr *PingResp) keep(resp *http.Response) *PingResp {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxPingBody))
+	pr.StatusCode, pr.Header, pr.Body = resp.StatusCode, resp.Header, b
+	return pr
+}
+
 // Based on the golang happy eyeballs dialParallel impl in net/dial.go.
 func pingParallel(ctx context.Context, reg name.Registry, t http.RoundTripper, schemes []string) (*PingResp, error) {
 	returned := make(chan struct{})